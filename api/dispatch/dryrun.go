@@ -0,0 +1,109 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	coredispatch "github.com/kilianp07/v2g/core/dispatch"
+	"github.com/kilianp07/v2g/core/model"
+)
+
+// DryRunner computes an allocation without sending orders.
+type DryRunner interface {
+	DryRun(signal model.FlexibilitySignal, vehicles []model.Vehicle) coredispatch.DryRunResult
+}
+
+// DryRunRequest is the body of POST /api/dispatch/dry-run. Vehicles are
+// discovered when none are provided.
+type DryRunRequest struct {
+	SignalType      string          `json:"signal_type"`
+	PowerKW         float64         `json:"power_kw"`
+	DurationSeconds int             `json:"duration_seconds"`
+	Vehicles        []model.Vehicle `json:"vehicles,omitempty"`
+}
+
+// DryRunResponse describes the allocation the manager would dispatch.
+type DryRunResponse struct {
+	SignalType    string                                    `json:"signal_type"`
+	PowerKW       float64                                   `json:"power_kw"`
+	AllocatedKW   float64                                   `json:"allocated_kw"`
+	MarketPrice   float64                                   `json:"market_price"`
+	Assignments   map[string]float64                        `json:"assignments"`
+	Scores        map[string]float64                        `json:"scores"`
+	Excluded      map[string]string                         `json:"excluded"`
+	Trace         map[string]coredispatch.VehicleTrace      `json:"trace"`
+	Coverage      map[string]float64                        `json:"fallback_coverage"`
+	WorstCoverage float64                                   `json:"worst_fallback_coverage"`
+	Plan          *coredispatch.DispatchPlan                `json:"plan,omitempty"`
+	Segments      map[string]coredispatch.SegmentAllocation `json:"segments,omitempty"`
+	WearCostEUR   map[string]float64                        `json:"wear_cost_eur,omitempty"`
+}
+
+// ParseDryRunRequest converts the request into a signal starting now.
+func ParseDryRunRequest(req DryRunRequest) (model.FlexibilitySignal, bool) {
+	st, ok := signalTypeFromString(req.SignalType)
+	if !ok {
+		return model.FlexibilitySignal{}, false
+	}
+	return model.FlexibilitySignal{
+		Type:      st,
+		PowerKW:   req.PowerKW,
+		Duration:  time.Duration(req.DurationSeconds) * time.Second,
+		Timestamp: time.Now(),
+	}, true
+}
+
+// NewDryRunResponse converts a dry-run result for the API.
+func NewDryRunResponse(res coredispatch.DryRunResult) DryRunResponse {
+	return DryRunResponse{
+		SignalType:    res.Signal.Type.String(),
+		PowerKW:       res.Signal.PowerKW,
+		AllocatedKW:   res.AllocatedKW,
+		MarketPrice:   res.MarketPrice,
+		Assignments:   res.Assignments,
+		Scores:        res.Scores,
+		Excluded:      res.Excluded,
+		Trace:         res.Trace,
+		Coverage:      res.Coverage,
+		WorstCoverage: res.WorstCoverage,
+		Plan:          res.Plan,
+		Segments:      res.Segments,
+		WearCostEUR:   res.WearCostEUR,
+	}
+}
+
+// NewDryRunHandler returns an HTTP handler answering POST /api/dispatch/dry-run
+// with the allocation the manager would dispatch. Requests must include an
+// Authorization header with "Bearer <token>" when token is non-empty.
+func NewDryRunHandler(runner DryRunner, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			auth := r.Header.Get("Authorization")
+			if auth != "Bearer "+token {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req DryRunRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sig, ok := ParseDryRunRequest(req)
+		if !ok {
+			http.Error(w, "unknown signal_type", http.StatusBadRequest)
+			return
+		}
+		res := runner.DryRun(sig, req.Vehicles)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(NewDryRunResponse(res)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	coredispatch "github.com/kilianp07/v2g/core/dispatch"
+	"github.com/kilianp07/v2g/core/model"
+)
+
+type stubRunner struct{ signal model.FlexibilitySignal }
+
+func (s *stubRunner) DryRun(sig model.FlexibilitySignal, _ []model.Vehicle) coredispatch.DryRunResult {
+	s.signal = sig
+	return coredispatch.DryRunResult{
+		Signal:        sig,
+		Assignments:   map[string]float64{"v1": sig.PowerKW},
+		AllocatedKW:   sig.PowerKW,
+		Excluded:      map[string]string{"v2": coredispatch.ReasonUnavailable},
+		Coverage:      map[string]float64{"v1": 0},
+		WorstCoverage: 0,
+	}
+}
+
+func TestDryRunHandler(t *testing.T) {
+	runner := &stubRunner{}
+	h := NewDryRunHandler(runner, "tok")
+	body := `{"signal_type":"NEBEF","power_kw":7,"duration_seconds":60}`
+
+	req := httptest.NewRequest(http.MethodPost, "/api/dispatch/dry-run", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/dispatch/dry-run", nil)
+	req.Header.Set("Authorization", "Bearer tok")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/dispatch/dry-run", strings.NewReader(`{"signal_type":"bogus"}`))
+	req.Header.Set("Authorization", "Bearer tok")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/dispatch/dry-run", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer tok")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if runner.signal.Type != model.SignalNEBEF || runner.signal.PowerKW != 7 {
+		t.Fatalf("unexpected signal: %+v", runner.signal)
+	}
+	var resp DryRunResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.SignalType != "NEBEF" || resp.Assignments["v1"] != 7 || resp.Excluded["v2"] != coredispatch.ReasonUnavailable {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
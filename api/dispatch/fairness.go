@@ -0,0 +1,51 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"net/http"
+
+	coredispatch "github.com/kilianp07/v2g/core/dispatch"
+)
+
+// ParticipationReporter reports the decayed participation of each vehicle.
+type ParticipationReporter interface {
+	ParticipationReport() []coredispatch.VehicleParticipation
+}
+
+// FairnessResponse is the body of GET /api/dispatch/fairness.
+type FairnessResponse struct {
+	// FairnessIndex is Jain's index of the energy throughput, 1 when usage is
+	// balanced across the vehicles.
+	FairnessIndex float64                             `json:"fairness_index"`
+	Vehicles      []coredispatch.VehicleParticipation `json:"vehicles"`
+}
+
+// NewFairnessHandler returns an HTTP handler answering GET
+// /api/dispatch/fairness with the participation of each vehicle. Requests must
+// include an Authorization header with "Bearer <token>" when token is
+// non-empty.
+func NewFairnessHandler(reporter ParticipationReporter, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			auth := r.Header.Get("Authorization")
+			if auth != "Bearer "+token {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		vehicles := reporter.ParticipationReport()
+		if vehicles == nil {
+			vehicles = []coredispatch.VehicleParticipation{}
+		}
+		resp := FairnessResponse{FairnessIndex: coredispatch.FairnessIndex(vehicles), Vehicles: vehicles}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	coredispatch "github.com/kilianp07/v2g/core/dispatch"
+)
+
+type staticParticipation []coredispatch.VehicleParticipation
+
+func (s staticParticipation) ParticipationReport() []coredispatch.VehicleParticipation { return s }
+
+func TestFairnessHandler(t *testing.T) {
+	h := NewFairnessHandler(staticParticipation{
+		{VehicleID: "v1", EnergyKWh: 10, Activations: 1, Share: 0.5, Score: 1},
+		{VehicleID: "v2", EnergyKWh: 10, Activations: 1, Share: 0.5, Score: 1},
+	}, "secret")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/dispatch/fairness", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rr.Code)
+	}
+
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	var resp FairnessResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.FairnessIndex != 1 || len(resp.Vehicles) != 2 || resp.Vehicles[0].VehicleID != "v1" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+}
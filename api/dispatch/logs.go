@@ -32,6 +32,7 @@ func NewLogHandler(store logging.LogStore, token string) http.Handler {
 			}
 		}
 		q.VehicleID = r.URL.Query().Get("vehicle_id")
+		q.Reason = r.URL.Query().Get("reason")
 		if st := r.URL.Query().Get("signal_type"); st != "" {
 			if v, ok := signalTypeFromString(st); ok {
 				q.SignalType = v
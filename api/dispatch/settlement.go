@@ -0,0 +1,80 @@
+package dispatch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/kilianp07/v2g/core/dispatch/logging"
+	"github.com/kilianp07/v2g/core/settlement"
+)
+
+// SettlementReporter settles the dispatch logs matching a query.
+type SettlementReporter interface {
+	Report(ctx context.Context, q logging.LogQuery) (settlement.Report, error)
+}
+
+// NewSettlementHandler returns an HTTP handler answering GET
+// /api/dispatch/settlement with the revenue statements of the dispatches
+// between start and end, optionally restricted to a signal_type. format=csv
+// exports the view selected by view (signals, vehicles or months) instead of
+// the JSON report. Requests must include an Authorization header with
+// "Bearer <token>" when token is non-empty.
+func NewSettlementHandler(reporter SettlementReporter, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			auth := r.Header.Get("Authorization")
+			if auth != "Bearer "+token {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		params := r.URL.Query()
+		q := logging.LogQuery{}
+		for name, dst := range map[string]*time.Time{"start": &q.Start, "end": &q.End} {
+			if s := params.Get(name); s != "" {
+				t, err := time.Parse(time.RFC3339, s)
+				if err != nil {
+					http.Error(w, "invalid "+name, http.StatusBadRequest)
+					return
+				}
+				*dst = t
+			}
+		}
+		if st := params.Get("signal_type"); st != "" {
+			v, ok := signalTypeFromString(st)
+			if !ok {
+				http.Error(w, "unknown signal_type", http.StatusBadRequest)
+				return
+			}
+			q.SignalType = v
+		}
+		rep, err := reporter.Report(r.Context(), q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if params.Get("format") == "csv" {
+			view := params.Get("view")
+			if view == "" {
+				view = settlement.ViewSignals
+			}
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", "attachment; filename=settlement-"+view+".csv")
+			if err := settlement.WriteCSV(w, rep, view); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(rep); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package dispatch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/dispatch/logging"
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/core/settlement"
+)
+
+func TestSettlementHandler_JSONAndCSV(t *testing.T) {
+	store := &memStore{}
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := store.Append(context.Background(), logging.LogRecord{
+		Timestamp:   at,
+		Signal:      model.FlexibilitySignal{Type: model.SignalNEBEF, PowerKW: 10, Duration: time.Hour, Timestamp: at},
+		TargetPower: 10,
+		Response: logging.Result{
+			Assignments:  map[string]float64{"v1": 10},
+			Acknowledged: map[string]bool{"v1": true},
+			MarketPrice:  0.1,
+		},
+	}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	settler := settlement.NewSettler(store, settlement.Tariff{Products: map[string]settlement.ProductTariff{"NEBEF": {Capacity: 0.01}}})
+	h := NewSettlementHandler(settler, "secret")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/dispatch/settlement", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/dispatch/settlement?start=2024-03-01T00:00:00Z", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	var rep settlement.Report
+	if err := json.NewDecoder(rr.Body).Decode(&rep); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(rep.Months) != 1 || rep.Months[0].Month != "2024-03" || rep.Total.EnergyKWh != 10 {
+		t.Fatalf("unexpected report: %+v", rep)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/dispatch/settlement?format=csv&view=vehicles", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Header().Get("Content-Type") != "text/csv" || !strings.Contains(rr.Body.String(), "\nv1,1,10,0.1,1,0,0,1.1\n") {
+		t.Fatalf("unexpected csv (%s):\n%s", rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/dispatch/settlement?start=yesterday", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid start, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	dispatchapi "github.com/kilianp07/v2g/api/dispatch"
+	vehiclesapi "github.com/kilianp07/v2g/api/vehicles"
+)
+
+// apiHandler returns the routes of the service HTTP API.
+func (s *Service) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/api/dispatch/dry-run", dispatchapi.NewDryRunHandler(s.Manager, s.api.Token))
+	mux.Handle("/api/dispatch/fairness", dispatchapi.NewFairnessHandler(s.Manager, s.api.Token))
+	mux.Handle("/api/vehicles/status", vehiclesapi.NewStatusHandler(s.status, nil))
+	if s.logs != nil {
+		mux.Handle("/api/dispatch/logs", dispatchapi.NewLogHandler(s.logs, s.api.Token))
+		mux.Handle("/api/dispatch/settlement", dispatchapi.NewSettlementHandler(s.settlement, s.api.Token))
+	}
+	return mux
+}
+
+// serveAPI runs the HTTP API until ctx is cancelled.
+func (s *Service) serveAPI(ctx context.Context) error {
+	srv := &http.Server{Addr: s.api.Address, Handler: s.apiHandler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			s.log.Errorf("api server shutdown: %v", err)
+		}
+	}()
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package app
+
+import (
+	"github.com/kilianp07/v2g/config"
+	"github.com/kilianp07/v2g/core/dispatch/logging"
+)
+
+// newLogStore opens the dispatch log store selected by cfg. JSONL logs rotate
+// when a maximum size is set.
+func newLogStore(cfg config.LoggingConfig) (logging.LogStore, error) {
+	switch {
+	case cfg.Backend == "sqlite":
+		return logging.NewSQLiteStore(cfg.Path)
+	case cfg.MaxSizeMB > 0:
+		return logging.NewRotatingJSONLStore(cfg.Path, cfg.MaxSizeMB, cfg.MaxBackups, cfg.MaxAgeDays)
+	default:
+		return logging.NewJSONLStore(cfg.Path)
+	}
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/knadh/koanf/providers/file"
+
+	"github.com/kilianp07/v2g/config"
+	"github.com/kilianp07/v2g/core/events"
+)
+
+// ReloadConfig loads the configuration at path and applies its dispatch
+// section to the running manager. The outcome is logged and published as an
+// events.ReloadEvent, along with a warning for each changed setting that only
+// applies on restart. The running configuration is kept when the new one is
+// invalid.
+func (s *Service) ReloadConfig(path, source string) error {
+	cfg, err := config.Load(path)
+	if err == nil {
+		err = s.Manager.Reload(cfg.Dispatch)
+	}
+	if s.bus != nil {
+		s.bus.Publish(events.ReloadEvent{Source: source, Err: err})
+	}
+	if err != nil {
+		s.log.Errorf("config reload from %s rejected: %v", source, err)
+		return err
+	}
+	for _, key := range s.dispatchCfg.RestartRequired(cfg.Dispatch) {
+		s.log.Warnf("config reload from %s: dispatch.%s changed but only applies on restart, ignored", source, key)
+	}
+	s.log.Infof("dispatch configuration reloaded from %s", source)
+	return nil
+}
+
+// WatchConfig reloads the configuration at path on SIGHUP and whenever the
+// file changes, until ctx is cancelled.
+func (s *Service) WatchConfig(ctx context.Context, path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	changes := make(chan struct{}, 1)
+	fp := file.Provider(path)
+	if err := fp.Watch(func(_ interface{}, err error) {
+		if err != nil {
+			s.log.Errorf("config watch: %v", err)
+			return
+		}
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}); err != nil {
+		s.log.Warnf("config file watch disabled, reload with SIGHUP: %v", err)
+	} else {
+		defer func() { _ = fp.Unwatch() }()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			_ = s.ReloadConfig(path, "sighup")
+		case <-changes:
+			_ = s.ReloadConfig(path, "file")
+		}
+	}
+}
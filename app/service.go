@@ -3,13 +3,19 @@ package app
 import (
 	"context"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/kilianp07/v2g/config"
 	"github.com/kilianp07/v2g/core/dispatch"
+	"github.com/kilianp07/v2g/core/dispatch/logging"
 	coremetrics "github.com/kilianp07/v2g/core/metrics"
 	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/core/settlement"
+	"github.com/kilianp07/v2g/core/vehiclestatus"
+	"github.com/kilianp07/v2g/infra/frequency"
 	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/market"
 	"github.com/kilianp07/v2g/infra/metrics"
 	"github.com/kilianp07/v2g/infra/mqtt"
 	"github.com/kilianp07/v2g/infra/telemetry"
@@ -29,12 +35,22 @@ type Service struct {
 	metricsSink coremetrics.MetricsSink
 	telemetry   *telemetry.Manager
 	generator   *rtegen.Generator
+	frequency   dispatch.FrequencySource
+	api         config.APIConfig
+	prices      *market.Loader
+	logs        logging.LogStore
+	settlement  *settlement.Settler
+	status      *vehiclestatus.MemoryStore
+	health      *dispatch.HealthTracker
+	// dispatchCfg is the dispatch configuration the service started with, to
+	// report the reloaded settings that need a restart.
+	dispatchCfg dispatch.Config
 }
 
 // New creates a Service from the configuration.
 func New(cfg *config.Config) (*Service, error) {
 	logg := logger.New("service")
-	client, err := mqtt.NewPahoClient(cfg.MQTT)
+	client, err := mqtt.NewClient(cfg.MQTT)
 	if err != nil {
 		return nil, fmt.Errorf("mqtt client: %w", err)
 	}
@@ -61,30 +77,79 @@ func New(cfg *config.Config) (*Service, error) {
 	}
 
 	bus := eventbus.New()
-	disc, err := mqtt.NewPahoFleetDiscovery(cfg.MQTT, "v2g/fleet/discovery", "v2g/fleet/response/+", "hello")
+	disc, err := mqtt.NewFleetDiscovery(cfg.MQTT)
 	if err != nil {
 		return nil, fmt.Errorf("fleet discovery: %w", err)
 	}
+	strategies, err := cfg.Dispatch.BuildStrategies(logg)
+	if err != nil {
+		return nil, fmt.Errorf("dispatch strategies: %w", err)
+	}
 	ackTimeout := time.Duration(cfg.Dispatch.AckTimeoutSeconds) * time.Second
 	manager, err := dispatch.NewDispatchManager(
-		dispatch.SimpleVehicleFilter{},
-		dispatch.EqualDispatcher{},
-		dispatch.NoopFallback{},
+		strategies.Filter,
+		strategies.Dispatcher,
+		strategies.Fallback,
 		client,
 		ackTimeout,
 		sink,
 		bus,
 		disc,
 		logg,
-		nil,
-		nil,
+		strategies.Tuner,
+		strategies.Prediction,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("dispatch manager: %w", err)
 	}
 	manager.SetLPFirst(cfg.Dispatch.LPFirst)
+	manager.SetSessionConfig(cfg.Dispatch.Session)
+	manager.SetFallbackRounds(cfg.Dispatch.FallbackRoundCount())
 
-	svc := &Service{Manager: manager, bus: bus, log: logg, promEnabled: promEnabled, promPort: promPort, metricsSink: sink}
+	svc := &Service{Manager: manager, bus: bus, log: logg, promEnabled: promEnabled, promPort: promPort, metricsSink: sink, api: cfg.API, dispatchCfg: cfg.Dispatch}
+	svc.status = vehiclestatus.NewMemoryStore()
+	manager.SetStatusStore(svc.status)
+	if cfg.Dispatch.Breaker.Enabled {
+		svc.health = dispatch.NewHealthTracker(cfg.Dispatch.Breaker)
+		svc.health.SetStatusStore(svc.status)
+		manager.SetHealthTracker(svc.health)
+	}
+	logs, err := newLogStore(cfg.Logging)
+	if err != nil {
+		return nil, fmt.Errorf("dispatch log store: %w", err)
+	}
+	manager.SetLogStore(logs)
+	hist, err := dispatch.LoadHistory(context.Background(), logs, cfg.Dispatch.History)
+	if err != nil {
+		logg.Errorf("dispatch history: %v", err)
+	}
+	manager.SetHistory(hist)
+	if cfg.Dispatch.Participation.Enabled {
+		ledger, err := dispatch.NewParticipationLedger(cfg.Dispatch.Participation)
+		if err != nil {
+			return nil, fmt.Errorf("participation ledger: %w", err)
+		}
+		manager.SetParticipationLedger(ledger)
+	}
+	svc.logs = logs
+	svc.settlement = settlement.NewSettler(logs, cfg.Settlement)
+	if cfg.Market.Enabled() {
+		svc.prices = market.NewLoader(cfg.Market, logg)
+		if err := svc.prices.Refresh(context.Background()); err != nil {
+			logg.Errorf("market prices: %v", err)
+		}
+		manager.SetPriceProvider(svc.prices)
+	}
+	if cfg.Dispatch.Droop.Enabled {
+		if cfg.Frequency.Source != "" {
+			src, err := frequency.New(cfg.Frequency, cfg.MQTT)
+			if err != nil {
+				return nil, fmt.Errorf("frequency source: %w", err)
+			}
+			svc.frequency = src
+		}
+		manager.SetDroop(cfg.Dispatch.Droop, svc.frequency)
+	}
 	if cfg.RTEGenerator.Enabled {
 		var rs coremetrics.RTESignalRecorder
 		if s, ok := sink.(coremetrics.RTESignalRecorder); ok {
@@ -101,6 +166,9 @@ func New(cfg *config.Config) (*Service, error) {
 		if err != nil {
 			return nil, fmt.Errorf("telemetry manager: %w", err)
 		}
+		cache := dispatch.NewTelemetryCache()
+		tm.SetTelemetryCache(cache)
+		manager.SetTelemetrySource(cache)
 		svc.telemetry = tm
 	}
 	svc.Connector = rte.NewConnector(cfg.RTE, manager)
@@ -125,6 +193,12 @@ func (s *Service) Run(ctx context.Context) error {
 	if s.generator != nil {
 		go s.generator.Start(ctx)
 	}
+	if s.prices != nil {
+		go s.prices.Run(ctx)
+	}
+	if s.health != nil {
+		go s.health.Run(ctx, s.bus)
+	}
 	if s.promEnabled {
 		go func() {
 			if err := metrics.StartPromServer(ctx, s.promPort); err != nil {
@@ -132,10 +206,24 @@ func (s *Service) Run(ctx context.Context) error {
 			}
 		}()
 	}
+	if s.api.Enabled {
+		go func() {
+			if err := s.serveAPI(ctx); err != nil {
+				s.log.Errorf("api server: %v", err)
+			}
+		}()
+	}
 	signals <- model.FlexibilitySignal{Type: model.SignalFCR, Timestamp: time.Now()}
 	<-ctx.Done()
 	return nil
 }
 
 // Close releases resources held by the service.
-func (s *Service) Close() error { return s.Manager.Close() }
+func (s *Service) Close() error {
+	if c, ok := s.frequency.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			s.log.Errorf("frequency source close: %v", err)
+		}
+	}
+	return s.Manager.Close()
+}
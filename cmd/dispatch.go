@@ -39,28 +39,32 @@ func dispatchSignal(cmd *cobra.Command, args []string) error {
 
 	logg := logger.New("dispatch-command")
 	mqttCfg := cfg.MQTT
-	client, err := mqtt.NewPahoClient(mqttCfg)
+	client, err := mqtt.NewClient(mqttCfg)
 	if err != nil {
 		return fmt.Errorf("mqtt client: %w", err)
 	}
 
 	bus := eventbus.New()
-	disc, err := mqtt.NewPahoFleetDiscovery(mqttCfg, "v2g/fleet/discovery", "v2g/fleet/response/+", "hello")
+	disc, err := mqtt.NewFleetDiscovery(mqttCfg)
 	if err != nil {
 		return fmt.Errorf("fleet discovery: %w", err)
 	}
+	strategies, err := cfg.Dispatch.BuildStrategies(logg)
+	if err != nil {
+		return fmt.Errorf("dispatch strategies: %w", err)
+	}
 	manager, err := dispatch.NewDispatchManager(
-		dispatch.SimpleVehicleFilter{},
-		dispatch.EqualDispatcher{},
-		dispatch.NoopFallback{},
+		strategies.Filter,
+		strategies.Dispatcher,
+		strategies.Fallback,
 		client,
 		time.Duration(cfg.Dispatch.AckTimeoutSeconds)*time.Second,
 		nil,
 		bus,
 		disc,
 		logg,
-		nil,
-		nil,
+		strategies.Tuner,
+		strategies.Prediction,
 	)
 	if err != nil {
 		return fmt.Errorf("dispatch manager: %w", err)
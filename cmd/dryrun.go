@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	dispatchapi "github.com/kilianp07/v2g/api/dispatch"
+	"github.com/kilianp07/v2g/config"
+	"github.com/kilianp07/v2g/core/dispatch"
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/market"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+var dryRunCmd = &cobra.Command{
+	Use:   "dry-run",
+	Short: "Show how a flexibility signal would be dispatched without sending orders",
+	RunE:  runDryRun,
+}
+
+var (
+	dryRunSignal   string
+	dryRunPower    float64
+	dryRunDuration time.Duration
+	dryRunVehicles string
+)
+
+func init() {
+	dryRunCmd.Flags().StringVar(&dryRunSignal, "signal", "aFRR", "signal type (FCR, aFRR, MA, NEBEF, EcoWatt)")
+	dryRunCmd.Flags().Float64Var(&dryRunPower, "power", 10, "requested power in kW")
+	dryRunCmd.Flags().DurationVar(&dryRunDuration, "duration", 15*time.Minute, "signal duration")
+	dryRunCmd.Flags().StringVar(&dryRunVehicles, "vehicles", "", "JSON file with the vehicles (discovered over MQTT when empty)")
+	rootCmd.AddCommand(dryRunCmd)
+}
+
+// noSendClient rejects orders so a dry run can never reach a vehicle.
+type noSendClient struct{}
+
+func (noSendClient) SendOrder(string, float64) (string, error) {
+	return "", errors.New("dry run does not send orders")
+}
+
+func (noSendClient) WaitForAck(id string, _ time.Duration) (mqtt.Ack, error) {
+	return mqtt.Ack{CommandID: id}, nil
+}
+
+func runDryRun(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	sig, ok := dispatchapi.ParseDryRunRequest(dispatchapi.DryRunRequest{
+		SignalType:      dryRunSignal,
+		PowerKW:         dryRunPower,
+		DurationSeconds: int(dryRunDuration / time.Second),
+	})
+	if !ok {
+		return fmt.Errorf("unknown signal type %q", dryRunSignal)
+	}
+
+	logg := logger.New("dry-run-command")
+	var vehicles []model.Vehicle
+	var disc dispatch.FleetDiscovery
+	if dryRunVehicles != "" {
+		data, err := os.ReadFile(dryRunVehicles)
+		if err != nil {
+			return fmt.Errorf("read vehicles: %w", err)
+		}
+		if err := json.Unmarshal(data, &vehicles); err != nil {
+			return fmt.Errorf("parse vehicles: %w", err)
+		}
+	} else {
+		discCfg := cfg.MQTT
+		suffix := time.Now().UnixNano()
+		if discCfg.ClientID != "" {
+			discCfg.ClientID = fmt.Sprintf("%s-%d", discCfg.ClientID, suffix)
+		} else {
+			discCfg.ClientID = fmt.Sprintf("dry-run-%d", suffix)
+		}
+		d, err := mqtt.NewFleetDiscovery(discCfg)
+		if err != nil {
+			return fmt.Errorf("fleet discovery: %w", err)
+		}
+		disc = d
+	}
+
+	strategies, err := cfg.Dispatch.BuildStrategies(logg)
+	if err != nil {
+		return fmt.Errorf("dispatch strategies: %w", err)
+	}
+	manager, err := dispatch.NewDispatchManager(
+		strategies.Filter,
+		strategies.Dispatcher,
+		strategies.Fallback,
+		noSendClient{},
+		time.Duration(cfg.Dispatch.AckTimeoutSeconds)*time.Second,
+		nil,
+		nil,
+		disc,
+		logg,
+		strategies.Tuner,
+		strategies.Prediction,
+	)
+	if err != nil {
+		return fmt.Errorf("dispatch manager: %w", err)
+	}
+	manager.SetLPFirst(cfg.Dispatch.LPFirst)
+	if cfg.Market.Enabled() {
+		prices := market.NewLoader(cfg.Market, logg)
+		if err := prices.Refresh(context.Background()); err != nil {
+			logg.Errorf("market prices: %v", err)
+		}
+		manager.SetPriceProvider(prices)
+	}
+	defer func() {
+		if err := manager.Close(); err != nil {
+			logg.Errorf("manager close: %v", err)
+		}
+	}()
+
+	res := manager.DryRun(sig, vehicles)
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "  ")
+	return enc.Encode(dispatchapi.NewDryRunResponse(res))
+}
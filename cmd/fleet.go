@@ -39,7 +39,7 @@ func runFleetLs(cmd *cobra.Command, args []string) error {
 	} else {
 		discCfg.ClientID = fmt.Sprintf("fleet-ls-%d", suffix)
 	}
-	disc, err := mqtt.NewPahoFleetDiscovery(discCfg, "v2g/fleet/discovery", "v2g/fleet/response/+", "hello")
+	disc, err := mqtt.NewFleetDiscovery(discCfg)
 	if err != nil {
 		return fmt.Errorf("fleet discovery: %w", err)
 	}
@@ -77,6 +77,7 @@ func run(cmd *cobra.Command, args []string) error {
 			logger.New("main").Errorf("service close: %v", err)
 		}
 	}()
+	go svc.WatchConfig(ctx, cfgPath)
 	return svc.Run(ctx)
 }
 
@@ -0,0 +1,9 @@
+package config
+
+// APIConfig enables the HTTP API of the service.
+type APIConfig struct {
+	Enabled bool   `json:"enabled"`
+	Address string `json:"address"`
+	// Token is required as a bearer token when set.
+	Token string `json:"token"`
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/kilianp07/v2g/core/dispatch"
 	"github.com/kilianp07/v2g/core/metrics"
+	"github.com/kilianp07/v2g/core/settlement"
 	"github.com/kilianp07/v2g/infra/mqtt"
 )
 
@@ -25,6 +26,10 @@ type Config struct {
 	RTEGenerator RTEGeneratorConfig `json:"rteGenerator"`
 	Sentry       SentryConfig       `json:"sentry"`
 	Telemetry    TelemetryConfig    `json:"telemetry"`
+	Frequency    FrequencyConfig    `json:"frequency"`
+	API          APIConfig          `json:"api"`
+	Market       MarketConfig       `json:"market"`
+	Settlement   settlement.Tariff  `json:"settlement"`
 }
 
 func Load(path string) (*Config, error) {
@@ -64,5 +69,17 @@ func Load(path string) (*Config, error) {
 	if err := cfg.Logging.Validate(); err != nil {
 		return nil, err
 	}
+	if err := cfg.Frequency.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Dispatch.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Market.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Settlement.Validate(); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
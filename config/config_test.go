@@ -74,3 +74,24 @@ rte:
 		t.Errorf("rte.client.poll_interval_seconds mismatch: %d", cfg.RTE.Client.PollIntervalSeconds)
 	}
 }
+
+func TestLoad_RejectsInvalidStrategy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `dispatch:
+  strategy:
+    dispatcher: "equal"
+    tuner: "ack"
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatalf("expected ack tuner on equal dispatcher to be rejected")
+	}
+}
+
+func TestLoad_ExampleConfig(t *testing.T) {
+	if _, err := Load(filepath.Join("..", "config.example.yaml")); err != nil {
+		t.Fatalf("example config: %v", err)
+	}
+}
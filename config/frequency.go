@@ -0,0 +1,43 @@
+package config
+
+import "fmt"
+
+// FrequencyConfig selects the grid frequency input used by the droop
+// controller.
+type FrequencyConfig struct {
+	// Source is one of "file", "mqtt" or "generator".
+	Source string `json:"source"`
+	// Path is the file holding the latest frequency for the file source.
+	Path string `json:"path"`
+	// Topic is the MQTT topic carrying frequency measurements.
+	Topic string `json:"topic"`
+	// Generator settings.
+	NominalHz     float64 `json:"nominal_hz"`
+	AmplitudeMHz  float64 `json:"amplitude_mhz"`
+	PeriodSeconds int     `json:"period_seconds"`
+	NoiseMHz      float64 `json:"noise_mhz"`
+	Seed          int64   `json:"seed"`
+}
+
+// Validate checks the settings required by the selected source.
+func (c FrequencyConfig) Validate() error {
+	switch c.Source {
+	case "":
+		return nil
+	case "file":
+		if c.Path == "" {
+			return fmt.Errorf("frequency.path is required")
+		}
+	case "mqtt":
+		if c.Topic == "" {
+			return fmt.Errorf("frequency.topic is required")
+		}
+	case "generator":
+		if c.PeriodSeconds < 0 {
+			return fmt.Errorf("frequency.period_seconds must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown frequency source %s", c.Source)
+	}
+	return nil
+}
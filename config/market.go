@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/kilianp07/v2g/core/market"
+	"github.com/kilianp07/v2g/core/model"
+)
+
+// MarketConfig selects the price series used to price flexibility signals.
+type MarketConfig struct {
+	DayAhead  PriceSourceConfig `json:"day_ahead"`
+	Imbalance PriceSourceConfig `json:"imbalance"`
+	// Signals overrides the market priced for a signal type, "day_ahead" or
+	// "imbalance". FCR and aFRR use the imbalance price by default.
+	Signals map[model.SignalType]string `json:"signals"`
+	// RefreshMinutes reloads the series periodically when positive.
+	RefreshMinutes int `json:"refresh_minutes"`
+}
+
+// PriceSourceConfig locates a CSV or JSON price series.
+type PriceSourceConfig struct {
+	// File is a local .csv or .json file.
+	File string `json:"file"`
+	// URL is an HTTP endpoint serving CSV or JSON.
+	URL string `json:"url"`
+	// Scale multiplies the imported prices, e.g. 0.001 to convert €/MWh to
+	// €/kWh. Zero keeps them unchanged.
+	Scale float64 `json:"scale"`
+}
+
+// Configured reports whether a source is set.
+func (c PriceSourceConfig) Configured() bool {
+	return c.File != "" || c.URL != ""
+}
+
+// Enabled reports whether any price series is configured.
+func (c MarketConfig) Enabled() bool {
+	return c.DayAhead.Configured() || c.Imbalance.Configured()
+}
+
+// Validate checks the sources and signal routes.
+func (c MarketConfig) Validate() error {
+	for name, src := range map[string]PriceSourceConfig{"day_ahead": c.DayAhead, "imbalance": c.Imbalance} {
+		if src.File != "" && src.URL != "" {
+			return fmt.Errorf("market.%s: file and url are mutually exclusive", name)
+		}
+		if src.Scale < 0 {
+			return fmt.Errorf("market.%s.scale must not be negative", name)
+		}
+	}
+	for st, k := range c.Signals {
+		if !market.Kind(k).Valid() {
+			return fmt.Errorf("market.signals.%d: unknown market %q", st, k)
+		}
+	}
+	if c.RefreshMinutes < 0 {
+		return fmt.Errorf("market.refresh_minutes must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,5 @@
+// Package degradation estimates the battery wear caused by dispatching a
+// vehicle and converts it into a cost. The model combines a cycle-depth term
+// (Wöhler curve), a C-rate surcharge and the calendar ageing difference caused
+// by the lower SoC, with parameters per battery chemistry.
+package degradation
@@ -0,0 +1,126 @@
+package degradation
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+)
+
+// Chemistry holds the wear parameters of a battery chemistry.
+type Chemistry struct {
+	// PackCostPerKWh is the replacement cost of the battery in €/kWh.
+	PackCostPerKWh float64 `json:"pack_cost_per_kwh"`
+	// CycleLife is the number of full cycles at 100 % depth of discharge
+	// before end of life.
+	CycleLife float64 `json:"cycle_life"`
+	// DepthExponent shapes the cycle life at other depths:
+	// N(d) = CycleLife * d^-DepthExponent.
+	DepthExponent float64 `json:"depth_exponent"`
+	// CRateReference is the C-rate below which power adds no wear.
+	CRateReference float64 `json:"c_rate_reference"`
+	// CRateFactor is the extra cycle wear per C above CRateReference.
+	CRateFactor float64 `json:"c_rate_factor"`
+	// CalendarLifeYears is the calendar life of a battery stored at 50 % SoC.
+	CalendarLifeYears float64 `json:"calendar_life_years"`
+	// CalendarSoCFactor scales the calendar ageing with the SoC:
+	// rate(soc) ∝ 1 + CalendarSoCFactor*(soc-0.5).
+	CalendarSoCFactor float64 `json:"calendar_soc_factor"`
+}
+
+// DefaultChemistry is used for vehicles without a known chemistry.
+const DefaultChemistry = "NMC"
+
+var (
+	mu          sync.RWMutex
+	chemistries = map[string]Chemistry{
+		"NMC": {PackCostPerKWh: 130, CycleLife: 3000, DepthExponent: 1.3, CRateReference: 0.5, CRateFactor: 0.3, CalendarLifeYears: 12, CalendarSoCFactor: 1},
+		"NCA": {PackCostPerKWh: 140, CycleLife: 2000, DepthExponent: 1.4, CRateReference: 0.5, CRateFactor: 0.4, CalendarLifeYears: 10, CalendarSoCFactor: 1.2},
+		"LFP": {PackCostPerKWh: 100, CycleLife: 6000, DepthExponent: 1.1, CRateReference: 1, CRateFactor: 0.15, CalendarLifeYears: 15, CalendarSoCFactor: 0.5},
+	}
+)
+
+// Register makes the chemistry parameters available under name, replacing the
+// built-in ones when the name exists.
+func Register(name string, c Chemistry) {
+	mu.Lock()
+	defer mu.Unlock()
+	chemistries[strings.ToUpper(name)] = c
+}
+
+// ChemistryOf returns the parameters of the vehicle battery. The chemistry is
+// read from Vehicle.Chemistry, then Metadata["chemistry"], and defaults to
+// DefaultChemistry.
+func ChemistryOf(v model.Vehicle) Chemistry {
+	name := v.Chemistry
+	if name == "" {
+		name = v.Metadata["chemistry"]
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if c, ok := chemistries[strings.ToUpper(name)]; ok {
+		return c
+	}
+	return chemistries[DefaultChemistry]
+}
+
+// Cost is the wear caused by holding a setpoint, in €.
+type Cost struct {
+	Cycle    float64 `json:"cycle_eur"`
+	CRate    float64 `json:"c_rate_eur"`
+	Calendar float64 `json:"calendar_eur"`
+	// EnergyKWh is the energy exchanged with the battery.
+	EnergyKWh float64 `json:"energy_kwh"`
+}
+
+// Total returns the wear cost in €, never negative.
+func (c Cost) Total() float64 {
+	return math.Max(0, c.Cycle+c.CRate+c.Calendar)
+}
+
+// PerKWh returns the wear cost per kWh exchanged.
+func (c Cost) PerKWh() float64 {
+	if c.EnergyKWh <= 0 {
+		return 0
+	}
+	return c.Total() / c.EnergyKWh
+}
+
+// Estimate returns the wear of holding powerKW, positive when injecting, for
+// d from the current SoC of v. Vehicles without a battery capacity cause no
+// wear.
+func Estimate(v model.Vehicle, powerKW float64, d time.Duration) Cost {
+	if v.BatteryKWh <= 0 || powerKW == 0 || d <= 0 {
+		return Cost{}
+	}
+	c := ChemistryOf(v)
+	pack := c.PackCostPerKWh * v.BatteryKWh
+	energy := math.Abs(powerKW) * d.Hours()
+	after := clamp(v.SoC - powerKW*d.Hours()/v.BatteryKWh)
+	energy = math.Min(energy, math.Abs(v.SoC-after)*v.BatteryKWh)
+
+	var cost Cost
+	cost.EnergyKWh = energy
+	if c.CycleLife > 0 {
+		// A half cycle consumes half the wear of the full cycle of the same
+		// depth, measured from a full battery.
+		d0, d1 := 1-clamp(v.SoC), 1-after
+		cost.Cycle = pack * math.Abs(math.Pow(d1, c.DepthExponent)-math.Pow(d0, c.DepthExponent)) / (2 * c.CycleLife)
+	}
+	if rate := math.Abs(powerKW) / v.BatteryKWh; rate > c.CRateReference {
+		cost.CRate = cost.Cycle * c.CRateFactor * (rate - c.CRateReference)
+	}
+	if c.CalendarLifeYears > 0 {
+		years := d.Hours() / (24 * 365)
+		mean := (clamp(v.SoC) + after) / 2
+		stress := c.CalendarSoCFactor * (mean - clamp(v.SoC))
+		cost.Calendar = pack * years / c.CalendarLifeYears * stress
+	}
+	return cost
+}
+
+func clamp(soc float64) float64 {
+	return math.Max(0, math.Min(1, soc))
+}
@@ -0,0 +1,43 @@
+package degradation
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+)
+
+func TestEstimate_ChemistryAndDepth(t *testing.T) {
+	nmc := model.Vehicle{SoC: 0.8, BatteryKWh: 50}
+	lfp := nmc
+	lfp.Chemistry = "lfp"
+	a := Estimate(nmc, 10, time.Hour)
+	b := Estimate(lfp, 10, time.Hour)
+	if math.Abs(a.EnergyKWh-10) > 1e-9 || math.Abs(b.EnergyKWh-10) > 1e-9 {
+		t.Fatalf("expected 10 kWh exchanged, got %v and %v", a.EnergyKWh, b.EnergyKWh)
+	}
+	if a.PerKWh() <= b.PerKWh() {
+		t.Fatalf("expected LFP cheaper to cycle than NMC: %v vs %v", b.PerKWh(), a.PerKWh())
+	}
+	deep := nmc
+	deep.SoC = 0.4
+	if Estimate(deep, 10, time.Hour).PerKWh() <= a.PerKWh() {
+		t.Fatalf("expected deeper cycles to cost more per kWh")
+	}
+}
+
+func TestEstimate_CRateAndMetadata(t *testing.T) {
+	v := model.Vehicle{SoC: 0.8, BatteryKWh: 20, Metadata: map[string]string{"chemistry": "NCA"}}
+	slow := Estimate(v, 5, 30*time.Minute)
+	fast := Estimate(v, 20, 7*time.Minute+30*time.Second)
+	if slow.CRate != 0 || fast.CRate <= 0 {
+		t.Fatalf("expected a C-rate surcharge above the reference only: %+v %+v", slow, fast)
+	}
+	if ChemistryOf(v) != chemistries["NCA"] {
+		t.Fatalf("expected the chemistry read from metadata")
+	}
+	if c := Estimate(model.Vehicle{SoC: 0.5}, 10, time.Hour); c.Total() != 0 {
+		t.Fatalf("expected no wear without battery capacity, got %+v", c)
+	}
+}
@@ -26,10 +26,16 @@ type AckBasedTuner struct {
 // trigger an increase of the AvailabilityWeight.
 const DefaultAckThreshold = 0.9
 
+// Default AckBasedTuner steps and weight cap.
+const (
+	defaultAckStep      = 0.05
+	defaultAckMaxWeight = 1
+)
+
 // NewAckBasedTuner returns an AckBasedTuner with sane defaults. It returns nil
 // if the dispatcher is nil.
 func NewAckBasedTuner(d *SmartDispatcher) *AckBasedTuner {
-	return NewAckBasedTunerWithConfig(d, 0.05, 0.05, 1, 0, DefaultAckThreshold)
+	return NewAckBasedTunerWithConfig(d, defaultAckStep, defaultAckStep, defaultAckMaxWeight, 0, DefaultAckThreshold)
 }
 
 // NewAckBasedTunerWithConfig creates an AckBasedTuner with custom parameters.
@@ -48,15 +54,36 @@ func NewAckBasedTunerWithConfig(d *SmartDispatcher, increaseStep, decreaseStep,
 	}
 }
 
+// Reuse implements ReusableTuner. The learned AvailabilityWeight is carried
+// over to the new dispatcher.
+func (t *AckBasedTuner) Reuse(cfg Config, d Dispatcher) bool {
+	sd := smartOf(d)
+	c := cfg.Strategy.AckTuner.withDefaults()
+	if cfg.Strategy.Tuner != "ack" || sd == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c.IncreaseStep != t.IncreaseStep || c.DecreaseStep != t.DecreaseStep || c.MaxWeight != t.MaxWeight ||
+		c.MinWeight != t.MinWeight || c.Threshold != t.Threshold {
+		return false
+	}
+	if t.Dispatcher != nil {
+		sd.AvailabilityWeight = t.Dispatcher.AvailabilityWeight
+	}
+	t.Dispatcher = sd
+	return true
+}
+
 // Tune modifies the dispatcher's AvailabilityWeight based on acknowledgment rate and timeouts.
-func (t *AckBasedTuner) Tune(history []DispatchResult) {
-	if t == nil || t.Dispatcher == nil || len(history) == 0 {
+func (t *AckBasedTuner) Tune(history History) {
+	if t == nil || t.Dispatcher == nil || history == nil {
 		return
 	}
 
 	var total, success float64
 	var timeouts int
-	for _, h := range history {
+	for _, h := range history.Recent(0) {
 		for id := range h.Assignments {
 			total++
 			if h.Acknowledged[id] {
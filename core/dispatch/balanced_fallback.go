@@ -35,12 +35,18 @@ func (b *BalancedFallback) SetVehicles(vs []model.Vehicle) {
 // Reallocate implements FallbackStrategy. It uses the remaining capacity of
 // successful vehicles to meet the original power target as much as possible.
 func (b *BalancedFallback) Reallocate(failed []model.Vehicle, current map[string]float64, signal model.FlexibilitySignal) map[string]float64 {
+	return b.ReallocateDeficit(failed, current, 0, signal)
+}
+
+// ReallocateDeficit implements DeficitFallback. It reallocates the deficit
+// along with the power of the failed vehicles.
+func (b *BalancedFallback) ReallocateDeficit(failed []model.Vehicle, current map[string]float64, deficit float64, signal model.FlexibilitySignal) map[string]float64 {
 	res := make(map[string]float64, len(current))
 	for id, p := range current {
 		res[id] = p
 	}
 
-	if len(failed) == 0 {
+	if len(failed) == 0 && deficit <= 0 {
 		return res
 	}
 
@@ -50,7 +56,7 @@ func (b *BalancedFallback) Reallocate(failed []model.Vehicle, current map[string
 	}
 
 	failedIDs := make(map[string]struct{}, len(failed))
-	var residual float64
+	residual := math.Max(0, deficit)
 	for _, v := range failed {
 		failedIDs[v.ID] = struct{}{}
 		residual += math.Abs(res[v.ID])
@@ -62,7 +68,7 @@ func (b *BalancedFallback) Reallocate(failed []model.Vehicle, current map[string
 
 	b.logger.Infof("fallback: reallocating %.2f kW after %d failures", residual*sign, len(failed))
 
-	avail := b.availableCapacity(current, failedIDs, res)
+	avail := b.availableCapacity(current, failedIDs, res, signal)
 	remaining := allocatePower(avail, res, residual, sign)
 
 	efficiency := 1.0
@@ -82,7 +88,7 @@ type alloc struct {
 	capacity float64
 }
 
-func (b *BalancedFallback) availableCapacity(current map[string]float64, failed map[string]struct{}, res map[string]float64) []alloc {
+func (b *BalancedFallback) availableCapacity(current map[string]float64, failed map[string]struct{}, res map[string]float64, signal model.FlexibilitySignal) []alloc {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	var avail []alloc
@@ -93,7 +99,7 @@ func (b *BalancedFallback) availableCapacity(current map[string]float64, failed
 		veh, ok := b.vehicles[id]
 		cap := 0.0
 		if ok {
-			cap = veh.EffectiveCapacity(res[id])
+			cap = math.Min(veh.EffectiveCapacity(res[id]), energyRoom(veh, signal, res[id]))
 		}
 		if cap > 0 {
 			avail = append(avail, alloc{id: id, capacity: cap})
@@ -30,6 +30,21 @@ func TestBalancedFallback_Reallocate(t *testing.T) {
 	}
 }
 
+func TestBalancedFallback_ReallocateDeficit(t *testing.T) {
+	fb := NewBalancedFallback(logger.NopLogger{})
+	fb.SetVehicles([]model.Vehicle{
+		{ID: "v1", MaxPower: 4, SoC: 1},
+		{ID: "v2", MaxPower: 100, SoC: 1},
+	})
+	current := map[string]float64{"v1": 4, "v2": 10}
+	sig := model.FlexibilitySignal{PowerKW: 20}
+
+	res := fb.ReallocateDeficit(nil, current, 6, sig)
+	if len(res) != 2 || res["v1"] != 4 || res["v2"] != 16 {
+		t.Fatalf("expected the deficit on v2, got %v", res)
+	}
+}
+
 func TestBalancedFallback_SkipLowSoC(t *testing.T) {
 	fb := NewBalancedFallback(logger.NopLogger{})
 	vs := []model.Vehicle{
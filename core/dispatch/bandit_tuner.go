@@ -0,0 +1,410 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kilianp07/v2g/core/events"
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/internal/eventbus"
+)
+
+// BanditTunerConfig configures the BanditTuner. Zero values use the defaults
+// of NewBanditTuner.
+type BanditTunerConfig struct {
+	// StatePath persists the learned weights. They are kept in memory only
+	// when empty.
+	StatePath string `json:"state_path"`
+	// Step is the largest relative change of a weight in one exploration.
+	Step float64 `json:"step"`
+	// MinWeight and MaxWeight bound the explored weights.
+	MinWeight float64 `json:"min_weight"`
+	MaxWeight float64 `json:"max_weight"`
+	// TrialDispatches is the number of dispatches a candidate is evaluated
+	// on before it is accepted or rejected.
+	TrialDispatches int `json:"trial_dispatches"`
+	// Smoothing is the weight of the latest outcome in the running reward of
+	// the accepted weights.
+	Smoothing float64 `json:"smoothing"`
+	// Seed makes the exploration reproducible when non-zero.
+	Seed int64 `json:"seed"`
+}
+
+// Default BanditTuner parameters.
+const (
+	DefaultBanditStep            = 0.2
+	DefaultBanditMaxWeight       = 2
+	DefaultBanditTrialDispatches = 5
+	DefaultBanditSmoothing       = 0.2
+)
+
+// withDefaults fills the zero parameters with their defaults and checks the
+// result.
+func (c BanditTunerConfig) withDefaults() (BanditTunerConfig, error) {
+	if c.Step == 0 {
+		c.Step = DefaultBanditStep
+	}
+	if c.MaxWeight == 0 {
+		c.MaxWeight = DefaultBanditMaxWeight
+	}
+	if c.TrialDispatches == 0 {
+		c.TrialDispatches = DefaultBanditTrialDispatches
+	}
+	if c.Smoothing == 0 {
+		c.Smoothing = DefaultBanditSmoothing
+	}
+	if c.Step < 0 || c.MinWeight < 0 || c.MaxWeight < c.MinWeight || c.TrialDispatches < 0 || c.Smoothing < 0 || c.Smoothing > 1 {
+		return c, errors.New("invalid bandit tuner parameters")
+	}
+	return c, nil
+}
+
+// banditArm holds the learned weights of a signal type and the candidate
+// being evaluated against them.
+type banditArm struct {
+	Weights Weights `json:"weights"`
+	Reward  float64 `json:"reward"`
+	Samples int     `json:"samples"`
+
+	trial       *Weights
+	trialReward float64
+	trialRuns   int
+}
+
+// banditState is the persisted tuner state.
+type banditState struct {
+	Signals map[string]*banditArm `json:"signals"`
+}
+
+// BanditTuner learns all SmartDispatcher weights per signal type with a
+// gradient-free random search. After each dispatch it scores the outcome
+// from the ack rate, the delivered share of the requested energy and the
+// deficit left by the fallback rounds. A candidate, one weight of the
+// accepted set moved by up to Step within [MinWeight, MaxWeight], is then
+// used for TrialDispatches dispatches of that signal type and kept only when
+// its mean reward beats the running reward of the accepted weights.
+// Accepted weights are persisted to StatePath and reloaded on start.
+type BanditTuner struct {
+	cfg      BanditTunerConfig
+	defaults SmartDispatcher
+	bus      eventbus.EventBus
+
+	mu   sync.Mutex
+	arms map[model.SignalType]*banditArm
+	rng  *rand.Rand
+}
+
+// NewBanditTuner returns a tuner learning the weights of d, starting from its
+// current weights or from the state persisted at cfg.StatePath. The tuner is
+// installed as the WeightSource of d, and failures to persist its state are
+// logged through the Logger of d.
+func NewBanditTuner(d *SmartDispatcher, cfg BanditTunerConfig) (*BanditTuner, error) {
+	if d == nil {
+		return nil, errors.New("bandit tuner requires a smart dispatcher")
+	}
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	t := &BanditTuner{
+		cfg:      cfg,
+		defaults: *d,
+		arms:     make(map[model.SignalType]*banditArm),
+		rng:      rand.New(rand.NewSource(seed)),
+	}
+	t.defaults.Learned = nil
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	d.Learned = t
+	return t, nil
+}
+
+// Reuse implements ReusableTuner. The learned weights are kept and d starts
+// reading them.
+func (t *BanditTuner) Reuse(cfg Config, d Dispatcher) bool {
+	sd := smartOf(d)
+	c, err := cfg.Strategy.Bandit.withDefaults()
+	if cfg.Strategy.Tuner != "bandit" || sd == nil || err != nil {
+		return false
+	}
+	t.mu.Lock()
+	if c != t.cfg {
+		t.mu.Unlock()
+		return false
+	}
+	t.defaults = *sd
+	t.defaults.Learned = nil
+	t.mu.Unlock()
+	sd.Learned = t
+	return true
+}
+
+// SetEventBus implements ObservableTuner.
+func (t *BanditTuner) SetEventBus(bus eventbus.EventBus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bus = bus
+}
+
+// WeightsFor implements WeightSource. It returns the candidate under
+// evaluation, else the accepted weights of the signal type.
+func (t *BanditTuner) WeightsFor(st model.SignalType) (Weights, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	arm, ok := t.arms[st]
+	if !ok {
+		return Weights{}, false
+	}
+	if arm.trial != nil {
+		return *arm.trial, true
+	}
+	return arm.Weights, true
+}
+
+// Tune implements LearningTuner with the outcome of the latest dispatch.
+func (t *BanditTuner) Tune(history History) {
+	if history == nil {
+		return
+	}
+	recent := history.Recent(1)
+	if len(recent) == 0 {
+		return
+	}
+	last := recent[0]
+	reward, ok := outcomeReward(last)
+	if !ok {
+		return
+	}
+	st := last.Signal.Type
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	arm := t.arm(st)
+	var action string
+	switch {
+	case arm.trial != nil:
+		arm.trialReward += reward
+		arm.trialRuns++
+		if arm.trialRuns < t.cfg.TrialDispatches {
+			return
+		}
+		mean := arm.trialReward / float64(arm.trialRuns)
+		action = "reject"
+		if mean > arm.Reward {
+			action = "accept"
+			arm.Weights = *arm.trial
+			arm.Reward = mean
+		}
+		arm.trial = nil
+		t.persist()
+	default:
+		if arm.Samples == 0 {
+			arm.Reward = reward
+		} else {
+			arm.Reward += t.cfg.Smoothing * (reward - arm.Reward)
+		}
+		arm.Samples++
+		if arm.Samples < t.cfg.TrialDispatches || t.cfg.TrialDispatches == 0 {
+			t.persist()
+			return
+		}
+		trial := t.explore(arm.Weights)
+		arm.trial = &trial
+		arm.trialReward, arm.trialRuns = 0, 0
+		action = "explore"
+	}
+	t.report(st, arm, action)
+}
+
+// arm returns the state of a signal type, starting from the dispatcher
+// weights. t.mu must be held.
+func (t *BanditTuner) arm(st model.SignalType) *banditArm {
+	arm, ok := t.arms[st]
+	if !ok {
+		arm = &banditArm{Weights: t.defaults.weightsForSignal(st)}
+		t.arms[st] = arm
+	}
+	return arm
+}
+
+// explore moves one weight of w by up to Step of its value, or of Step when
+// it is smaller, within the configured bounds. t.mu must be held.
+func (t *BanditTuner) explore(w Weights) Weights {
+	fields := w.fields()
+	f := fields[t.rng.Intn(len(fields))]
+	scale := math.Max(math.Abs(*f), t.cfg.Step)
+	*f += t.cfg.Step * scale * (2*t.rng.Float64() - 1)
+	*f = math.Max(t.cfg.MinWeight, math.Min(t.cfg.MaxWeight, *f))
+	return w
+}
+
+// report publishes the change and updates the metrics. t.mu must be held.
+func (t *BanditTuner) report(st model.SignalType, arm *banditArm, action string) {
+	w := arm.Weights
+	if arm.trial != nil {
+		w = *arm.trial
+	}
+	weights := w.Map()
+	for name, v := range weights {
+		tunerWeight.WithLabelValues(st.String(), name).Set(v)
+	}
+	tunerReward.WithLabelValues(st.String()).Set(arm.Reward)
+	tunerUpdates.WithLabelValues(st.String(), action).Inc()
+	if t.bus != nil {
+		t.bus.Publish(events.TunerEvent{Signal: st, Action: action, Weights: weights, Reward: arm.Reward})
+	}
+}
+
+// load restores the persisted weights. A missing state file is not an error.
+func (t *BanditTuner) load() error {
+	if t.cfg.StatePath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(t.cfg.StatePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read tuner state: %w", err)
+	}
+	var state banditState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("decode tuner state: %w", err)
+	}
+	for name, arm := range state.Signals {
+		st, ok := signalTypeByName(name)
+		if !ok {
+			return fmt.Errorf("tuner state: unknown signal type %q", name)
+		}
+		t.arms[st] = arm
+	}
+	return nil
+}
+
+// persist saves the accepted weights, logging a failure through the Logger of
+// the tuned dispatcher since Tune cannot return it.
+func (t *BanditTuner) persist() {
+	if err := t.save(); err != nil && t.defaults.Logger != nil {
+		t.defaults.Logger.Errorf("bandit tuner: %v", err)
+	}
+}
+
+// save persists the accepted weights, replacing the state file atomically.
+// Failures keep the tuner running on its in-memory state. t.mu must be held.
+func (t *BanditTuner) save() error {
+	if t.cfg.StatePath == "" {
+		return nil
+	}
+	state := banditState{Signals: make(map[string]*banditArm, len(t.arms))}
+	for st, arm := range t.arms {
+		state.Signals[st.String()] = arm
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode tuner state: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(t.cfg.StatePath), ".tuner-*")
+	if err != nil {
+		return fmt.Errorf("write tuner state: %w", err)
+	}
+	_, werr := tmp.Write(data)
+	cerr := tmp.Close()
+	if err := errors.Join(werr, cerr); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write tuner state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), t.cfg.StatePath); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("replace tuner state: %w", err)
+	}
+	return nil
+}
+
+// outcomeReward scores a dispatch between -0.5 and 1: the mean of the ack
+// rate and of the delivered share of the signal, minus half the share left
+// undelivered after the fallback rounds, whatever the signal direction. Every setpoint lasts the signal
+// duration, so power shares equal energy shares.
+func outcomeReward(res DispatchResult) (float64, bool) {
+	target := math.Abs(res.Signal.PowerKW)
+	if target == 0 || len(res.Assignments) == 0 {
+		return 0, false
+	}
+	var acked float64
+	for id := range res.Assignments {
+		if res.Acknowledged[id] {
+			acked++
+		}
+	}
+	var delivered, net float64
+	for _, kw := range heldSetpoints(res) {
+		delivered += math.Abs(kw)
+		net += kw
+	}
+	var deficit float64
+	if len(res.FallbackRounds) > 0 {
+		deficit = math.Max(0, math.Min(1, shortfall(res.Signal.PowerKW, net)/target))
+	}
+	ack := acked / float64(len(res.Assignments))
+	return (ack + math.Min(1, delivered/target) - deficit) / 2, true
+}
+
+// heldSetpoints returns the power each vehicle acknowledged applying last:
+// for its initial assignment, replaced by the fallback rounds it
+// acknowledged.
+func heldSetpoints(res DispatchResult) map[string]float64 {
+	held := make(map[string]float64, len(res.Assignments))
+	for id := range res.Assignments {
+		if res.Acknowledged[id] {
+			held[id] = res.AppliedPower(id)
+		}
+	}
+	for _, r := range res.FallbackRounds {
+		for id := range r.Assignments {
+			if r.Acknowledged[id] {
+				held[id] = r.AppliedPower(id)
+			}
+		}
+	}
+	return held
+}
+
+// fields returns pointers to the weights for exploration.
+func (w *Weights) fields() []*float64 {
+	return []*float64{&w.SoC, &w.Time, &w.Priority, &w.Price, &w.Wear, &w.Degradation, &w.Fairness, &w.Availability}
+}
+
+// Map returns the weights keyed like the dispatcher weights configuration.
+func (w Weights) Map() map[string]float64 {
+	return map[string]float64{
+		"soc":          w.SoC,
+		"time":         w.Time,
+		"priority":     w.Priority,
+		"price":        w.Price,
+		"wear":         w.Wear,
+		"degradation":  w.Degradation,
+		"fairness":     w.Fairness,
+		"availability": w.Availability,
+	}
+}
+
+// signalTypeByName returns the signal type named s by SignalType.String.
+func signalTypeByName(s string) (model.SignalType, bool) {
+	for st := model.SignalFCR; st <= model.SignalEcoWatt; st++ {
+		if st.String() == s {
+			return st, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,193 @@
+package dispatch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/events"
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/internal/eventbus"
+)
+
+func banditResult(st model.SignalType, acked bool) DispatchResult {
+	return DispatchResult{
+		Signal:       model.FlexibilitySignal{Type: st, PowerKW: 20},
+		Assignments:  map[string]float64{"v1": 10, "v2": 10},
+		Acknowledged: map[string]bool{"v1": true, "v2": acked},
+	}
+}
+
+func TestOutcomeReward(t *testing.T) {
+	r, ok := outcomeReward(banditResult(model.SignalFCR, true))
+	if !ok || r != 1 {
+		t.Fatalf("expected full reward, got %v %v", r, ok)
+	}
+	res := banditResult(model.SignalFCR, false)
+	res.FallbackRounds = []FallbackRound{{
+		Assignments:  map[string]float64{"v1": 15},
+		Acknowledged: map[string]bool{"v1": true},
+		DeficitKW:    5,
+	}}
+	r, _ = outcomeReward(res)
+	// ack 0.5, delivered 15/20, deficit 5/20
+	if want := (0.5 + 0.75 - 0.25) / 2; r != want {
+		t.Fatalf("expected %v, got %v", want, r)
+	}
+	res = banditResult(model.SignalFCR, true)
+	res.Applied = map[string]float64{"v2": 4}
+	r, _ = outcomeReward(res)
+	// ack 1, delivered 14/20
+	if want := (1 + 0.7) / 2; r != want {
+		t.Fatalf("expected partial ack rewarded at its applied power %v, got %v", want, r)
+	}
+	res = DispatchResult{
+		Signal:       model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: -20},
+		Assignments:  map[string]float64{"v1": -10, "v2": -10},
+		Acknowledged: map[string]bool{"v1": true},
+		FallbackRounds: []FallbackRound{{
+			Assignments:  map[string]float64{"v1": -15},
+			Acknowledged: map[string]bool{"v1": true},
+			DeficitKW:    5,
+		}},
+	}
+	r, _ = outcomeReward(res)
+	// a charging signal under-delivering is penalised like a discharging one
+	if want := (0.5 + 0.75 - 0.25) / 2; r != want {
+		t.Fatalf("expected %v for the charging signal, got %v", want, r)
+	}
+	if _, ok := outcomeReward(DispatchResult{}); ok {
+		t.Fatalf("expected no reward without assignments")
+	}
+}
+
+func TestBanditTuner_AcceptsBetterWeights(t *testing.T) {
+	disp := NewSmartDispatcher()
+	tuner, err := NewBanditTuner(&disp, BanditTunerConfig{TrialDispatches: 2, Seed: 1})
+	if err != nil {
+		t.Fatalf("new tuner: %v", err)
+	}
+	if disp.Learned != tuner {
+		t.Fatalf("expected tuner installed as weight source")
+	}
+	base := disp.weightsForSignal(model.SignalFCR)
+
+	for i := 0; i < 2; i++ {
+		tuner.Tune(historyOf(banditResult(model.SignalFCR, false)))
+	}
+	trial := disp.weightsForSignal(model.SignalFCR)
+	if trial == base {
+		t.Fatalf("expected exploration after %d dispatches", 2)
+	}
+	for _, v := range trial.Map() {
+		if v < 0 || v > DefaultBanditMaxWeight {
+			t.Fatalf("weight %v outside bounds", v)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		tuner.Tune(historyOf(banditResult(model.SignalFCR, true)))
+	}
+	if got := disp.weightsForSignal(model.SignalFCR); got != trial {
+		t.Fatalf("expected trial weights accepted, got %+v", got)
+	}
+	if other, _ := tuner.WeightsFor(model.SignalMA); other != (Weights{}) {
+		t.Fatalf("expected other signal types untouched")
+	}
+}
+
+func TestBanditTuner_RejectsWorseWeights(t *testing.T) {
+	disp := NewSmartDispatcher()
+	tuner, err := NewBanditTuner(&disp, BanditTunerConfig{TrialDispatches: 2, Seed: 1})
+	if err != nil {
+		t.Fatalf("new tuner: %v", err)
+	}
+	base := disp.weightsForSignal(model.SignalFCR)
+	for i := 0; i < 2; i++ {
+		tuner.Tune(historyOf(banditResult(model.SignalFCR, true)))
+	}
+	for i := 0; i < 2; i++ {
+		tuner.Tune(historyOf(banditResult(model.SignalFCR, false)))
+	}
+	arm := tuner.arms[model.SignalFCR]
+	if arm.Weights != base || arm.trial != nil {
+		t.Fatalf("expected trial rejected, got %+v", arm)
+	}
+}
+
+func TestBanditTuner_PersistsState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tuner.json")
+	disp := NewSmartDispatcher()
+	cfg := BanditTunerConfig{StatePath: path, TrialDispatches: 1, Seed: 3}
+	tuner, err := NewBanditTuner(&disp, cfg)
+	if err != nil {
+		t.Fatalf("new tuner: %v", err)
+	}
+	tuner.Tune(historyOf(banditResult(model.SignalMA, false)))
+	tuner.Tune(historyOf(banditResult(model.SignalMA, true)))
+	learned := tuner.arms[model.SignalMA].Weights
+
+	again := NewSmartDispatcher()
+	reloaded, err := NewBanditTuner(&again, cfg)
+	if err != nil {
+		t.Fatalf("reload tuner: %v", err)
+	}
+	if got, ok := reloaded.WeightsFor(model.SignalMA); !ok || got != learned {
+		t.Fatalf("expected persisted weights %+v, got %+v", learned, got)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := NewBanditTuner(&again, cfg); err == nil {
+		t.Fatalf("expected error for corrupt state")
+	}
+}
+
+type errorLogger struct {
+	logger.NopLogger
+	errors []string
+}
+
+func (l *errorLogger) Errorf(format string, args ...any) {
+	l.errors = append(l.errors, fmt.Sprintf(format, args...))
+}
+
+func TestBanditTuner_LogsSaveErrors(t *testing.T) {
+	log := &errorLogger{}
+	disp := NewSmartDispatcher()
+	disp.Logger = log
+	cfg := BanditTunerConfig{StatePath: filepath.Join(t.TempDir(), "missing", "tuner.json"), TrialDispatches: 2, Seed: 3}
+	tuner, err := NewBanditTuner(&disp, cfg)
+	if err != nil {
+		t.Fatalf("new tuner: %v", err)
+	}
+	tuner.Tune(historyOf(banditResult(model.SignalMA, true)))
+	if len(log.errors) != 1 || !strings.Contains(log.errors[0], "write tuner state") {
+		t.Fatalf("expected the save error to be logged, got %v", log.errors)
+	}
+}
+
+func TestBanditTuner_PublishesEvents(t *testing.T) {
+	disp := NewSmartDispatcher()
+	tuner, err := NewBanditTuner(&disp, BanditTunerConfig{TrialDispatches: 1, Seed: 1})
+	if err != nil {
+		t.Fatalf("new tuner: %v", err)
+	}
+	bus := eventbus.New()
+	ch := bus.Subscribe()
+	tuner.SetEventBus(bus)
+	tuner.Tune(historyOf(banditResult(model.SignalFCR, true)))
+	select {
+	case ev := <-ch:
+		te, ok := ev.(events.TunerEvent)
+		if !ok || te.Action != "explore" || te.Signal != model.SignalFCR || len(te.Weights) != 8 {
+			t.Fatalf("unexpected event %#v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected tuner event")
+	}
+}
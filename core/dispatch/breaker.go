@@ -0,0 +1,268 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kilianp07/v2g/core/events"
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/core/vehiclestatus"
+	"github.com/kilianp07/v2g/internal/eventbus"
+)
+
+// Circuit breaker states of a vehicle.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// ReasonQuarantined is the trace reason of vehicles skipped while their
+// circuit breaker is open.
+const ReasonQuarantined = "quarantined"
+
+// Default circuit breaker parameters.
+const (
+	DefaultBreakerFailures       = 3
+	DefaultBreakerCooldown       = 5 * time.Minute
+	DefaultBreakerProbeKW        = 1
+	DefaultBreakerProbeSuccesses = 1
+)
+
+// BreakerConfig configures the vehicle circuit breaker. A vehicle is
+// quarantined after FailureThreshold consecutive timeouts or rejections, for
+// CooldownSeconds. It is then probed with orders capped to ProbeKW and
+// recovers after ProbeSuccesses acknowledged probes; a failed probe
+// quarantines it again. Zero values use the defaults.
+type BreakerConfig struct {
+	Enabled          bool    `json:"enabled"`
+	FailureThreshold int     `json:"failure_threshold"`
+	CooldownSeconds  int     `json:"cooldown_seconds"`
+	ProbeKW          float64 `json:"probe_kw"`
+	ProbeSuccesses   int     `json:"probe_successes"`
+}
+
+// Validate checks the circuit breaker settings.
+func (c BreakerConfig) Validate() error {
+	if c.FailureThreshold < 0 || c.CooldownSeconds < 0 || c.ProbeKW < 0 || c.ProbeSuccesses < 0 {
+		return errors.New("dispatch.breaker settings must not be negative")
+	}
+	return nil
+}
+
+type breakerState struct {
+	state     string
+	failures  int
+	successes int
+	openUntil time.Time
+	lastErr   string
+}
+
+// HealthTracker keeps a circuit breaker per vehicle, fed by the AckEvents of
+// the dispatches.
+type HealthTracker struct {
+	failures  int
+	cooldown  time.Duration
+	probeKW   float64
+	successes int
+	now       func() time.Time
+
+	mu       sync.Mutex
+	vehicles map[string]*breakerState
+	status   vehiclestatus.Store
+}
+
+// NewHealthTracker returns a tracker with every vehicle closed.
+func NewHealthTracker(cfg BreakerConfig) *HealthTracker {
+	t := &HealthTracker{
+		failures:  cfg.FailureThreshold,
+		cooldown:  time.Duration(cfg.CooldownSeconds) * time.Second,
+		probeKW:   cfg.ProbeKW,
+		successes: cfg.ProbeSuccesses,
+		now:       time.Now,
+		vehicles:  make(map[string]*breakerState),
+	}
+	if t.failures <= 0 {
+		t.failures = DefaultBreakerFailures
+	}
+	if t.cooldown <= 0 {
+		t.cooldown = DefaultBreakerCooldown
+	}
+	if t.probeKW <= 0 {
+		t.probeKW = DefaultBreakerProbeKW
+	}
+	if t.successes <= 0 {
+		t.successes = DefaultBreakerProbeSuccesses
+	}
+	return t
+}
+
+// SetStatusStore reports the breaker state of each vehicle in store.
+func (t *HealthTracker) SetStatusStore(store vehiclestatus.Store) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status = store
+}
+
+// Run feeds the tracker with the AckEvents published on bus until ctx is
+// cancelled. The bus drops events for slow subscribers, so a dropped
+// acknowledgment only delays a transition.
+func (t *HealthTracker) Run(ctx context.Context, bus eventbus.EventBus) {
+	sub := bus.Subscribe()
+	defer bus.Unsubscribe(sub)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-sub:
+			if !ok {
+				return
+			}
+			if ack, ok := ev.(events.AckEvent); ok {
+				t.Observe(ack)
+			}
+		}
+	}
+}
+
+// Observe updates the breaker of the acknowledging vehicle. Negative
+// acknowledgments and errors, such as mqtt.ErrAckTimeout, count as failures.
+func (t *HealthTracker) Observe(ev events.AckEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	b := t.breaker(ev.VehicleID, now)
+	prev := b.state
+	if ev.Acknowledged && ev.Err == nil {
+		b.failures = 0
+		if b.state == BreakerHalfOpen {
+			b.successes++
+			if b.successes >= t.successes {
+				b.state = BreakerClosed
+			}
+		}
+	} else {
+		b.failures++
+		b.lastErr = "rejected"
+		if ev.Err != nil {
+			b.lastErr = ev.Err.Error()
+		}
+		if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= t.failures) {
+			b.state = BreakerOpen
+			b.openUntil = now.Add(t.cooldown)
+		}
+	}
+	t.changed(ev.VehicleID, b, prev)
+}
+
+// State returns the breaker state of a vehicle.
+func (t *HealthTracker) State(id string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.breaker(id, t.now()).state
+}
+
+// Quarantined returns the vehicles whose breaker is open, sorted by ID.
+func (t *HealthTracker) Quarantined() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	var ids []string
+	for id := range t.vehicles {
+		if t.breaker(id, now).state == BreakerOpen {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// breaker returns the breaker of a vehicle, moving it to half-open once its
+// cooldown has elapsed. t.mu must be held.
+func (t *HealthTracker) breaker(id string, now time.Time) *breakerState {
+	b, ok := t.vehicles[id]
+	if !ok {
+		b = &breakerState{state: BreakerClosed}
+		t.vehicles[id] = b
+	}
+	if b.state == BreakerOpen && !now.Before(b.openUntil) {
+		b.state = BreakerHalfOpen
+		b.successes = 0
+		t.changed(id, b, BreakerOpen)
+	}
+	return b
+}
+
+// changed reports a transition in the metrics and the status store. t.mu
+// must be held.
+func (t *HealthTracker) changed(id string, b *breakerState, prev string) {
+	if b.state == prev {
+		return
+	}
+	vehicleBreakerState.WithLabelValues(id).Set(breakerLevel(b.state))
+	breakerTransitions.WithLabelValues(b.state).Inc()
+	if t.status != nil {
+		h := vehiclestatus.Health{State: b.state, ConsecutiveFailures: b.failures, LastError: b.lastErr}
+		if b.state == BreakerOpen {
+			h.OpenUntil = b.openUntil
+		}
+		t.status.SetHealth(id, h)
+	}
+}
+
+// breakerLevel encodes a state for the vehicle_breaker_state gauge.
+func breakerLevel(state string) float64 {
+	switch state {
+	case BreakerOpen:
+		return 2
+	case BreakerHalfOpen:
+		return 1
+	}
+	return 0
+}
+
+// BreakerFilter wraps a VehicleFilter and skips the vehicles whose breaker is
+// open. Half-open vehicles are kept with their power capped to the probe
+// size so they receive small orders.
+type BreakerFilter struct {
+	Inner   VehicleFilter
+	Tracker *HealthTracker
+}
+
+// NewBreakerFilter returns f guarded by the circuit breakers of t.
+func NewBreakerFilter(f VehicleFilter, t *HealthTracker) *BreakerFilter {
+	return &BreakerFilter{Inner: f, Tracker: t}
+}
+
+// Filter implements VehicleFilter.
+func (f *BreakerFilter) Filter(vehicles []model.Vehicle, signal model.FlexibilitySignal) []model.Vehicle {
+	kept := f.Inner.Filter(vehicles, signal)
+	res := make([]model.Vehicle, 0, len(kept))
+	for _, v := range kept {
+		switch f.Tracker.State(v.ID) {
+		case BreakerOpen:
+			continue
+		case BreakerHalfOpen:
+			v.MaxPower = math.Min(v.MaxPower, f.Tracker.probeKW)
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+// Reason implements ExplainingFilter.
+func (f *BreakerFilter) Reason(v model.Vehicle, signal model.FlexibilitySignal) string {
+	if ef, ok := f.Inner.(ExplainingFilter); ok {
+		if r := ef.Reason(v, signal); r != "" {
+			return r
+		}
+	}
+	if f.Tracker.State(v.ID) == BreakerOpen {
+		return ReasonQuarantined
+	}
+	return ""
+}
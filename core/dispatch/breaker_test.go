@@ -0,0 +1,128 @@
+package dispatch
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/events"
+	"github.com/kilianp07/v2g/core/model"
+	coremqtt "github.com/kilianp07/v2g/core/mqtt"
+	"github.com/kilianp07/v2g/core/vehiclestatus"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/mqtt"
+	"github.com/kilianp07/v2g/internal/eventbus"
+)
+
+func timeout(id string) events.AckEvent {
+	return events.AckEvent{VehicleID: id, Err: fmt.Errorf("%w", coremqtt.ErrAckTimeout)}
+}
+
+func TestHealthTracker_Transitions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr := NewHealthTracker(BreakerConfig{FailureThreshold: 2, CooldownSeconds: 60, ProbeSuccesses: 2})
+	tr.now = func() time.Time { return now }
+	store := vehiclestatus.NewMemoryStore()
+	tr.SetStatusStore(store)
+
+	tr.Observe(timeout("v1"))
+	if tr.State("v1") != BreakerClosed {
+		t.Fatalf("expected closed after one failure")
+	}
+	tr.Observe(events.AckEvent{VehicleID: "v1"}) // rejected
+	if tr.State("v1") != BreakerOpen {
+		t.Fatalf("expected open after two failures")
+	}
+	st := store.List(vehiclestatus.Filter{})
+	if len(st) != 1 || st[0].Health == nil || st[0].Health.State != BreakerOpen || !st[0].Health.OpenUntil.Equal(now.Add(time.Minute)) {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	now = now.Add(time.Minute)
+	if tr.State("v1") != BreakerHalfOpen {
+		t.Fatalf("expected half-open after the cooldown")
+	}
+	tr.Observe(timeout("v1"))
+	if tr.State("v1") != BreakerOpen {
+		t.Fatalf("expected failed probe to reopen the breaker")
+	}
+
+	now = now.Add(time.Minute)
+	tr.Observe(events.AckEvent{VehicleID: "v1", Acknowledged: true})
+	if tr.State("v1") != BreakerHalfOpen {
+		t.Fatalf("expected half-open until enough probes succeed")
+	}
+	tr.Observe(events.AckEvent{VehicleID: "v1", Acknowledged: true})
+	if tr.State("v1") != BreakerClosed || len(tr.Quarantined()) != 0 {
+		t.Fatalf("expected closed after successful probes")
+	}
+	if h := store.List(vehiclestatus.Filter{})[0].Health; h.State != BreakerClosed || h.ConsecutiveFailures != 0 {
+		t.Fatalf("unexpected health %+v", h)
+	}
+}
+
+func TestBreakerFilter_SkipsAndProbes(t *testing.T) {
+	now := time.Now()
+	tr := NewHealthTracker(BreakerConfig{FailureThreshold: 1, CooldownSeconds: 60, ProbeKW: 2})
+	tr.now = func() time.Time { return now }
+	f := NewBreakerFilter(SimpleVehicleFilter{}, tr)
+	vehicles := []model.Vehicle{
+		{ID: "v1", Available: true, MaxPower: 10},
+		{ID: "v2", Available: true, MaxPower: 10},
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 10}
+
+	tr.Observe(timeout("v1"))
+	kept := f.Filter(vehicles, sig)
+	if len(kept) != 1 || kept[0].ID != "v2" {
+		t.Fatalf("expected quarantined vehicle skipped, got %+v", kept)
+	}
+	if r := f.Reason(vehicles[0], sig); r != ReasonQuarantined {
+		t.Fatalf("expected quarantined reason, got %q", r)
+	}
+
+	now = now.Add(time.Minute)
+	kept = f.Filter(vehicles, sig)
+	if len(kept) != 2 || kept[0].MaxPower != 2 || kept[1].MaxPower != 10 {
+		t.Fatalf("expected half-open vehicle probed with 2 kW, got %+v", kept)
+	}
+}
+
+func TestHealthTracker_RunAndManager(t *testing.T) {
+	bus := eventbus.New()
+	pub := mqtt.NewMockPublisher()
+	pub.FailIDs["v1"] = true
+	m, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, pub, time.Second, nil, bus, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	tr := NewHealthTracker(BreakerConfig{FailureThreshold: 1})
+	m.SetHealthTracker(tr)
+	m.SetHealthTracker(tr)
+	if bf, ok := m.filter.(*BreakerFilter); !ok || bf.Inner != (SimpleVehicleFilter{}) {
+		t.Fatalf("expected the filter wrapped once, got %#v", m.filter)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tr.Run(ctx, bus)
+	time.Sleep(10 * time.Millisecond)
+
+	vehicles := []model.Vehicle{
+		{ID: "v1", Available: true, MaxPower: 10},
+		{ID: "v2", Available: true, MaxPower: 10},
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 10, Timestamp: time.Now()}
+	m.Dispatch(sig, vehicles)
+	deadline := time.Now().Add(time.Second)
+	for tr.State("v1") != BreakerOpen {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected v1 quarantined from its ack event")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	res := m.Dispatch(sig, vehicles)
+	if _, ok := res.Assignments["v1"]; ok || res.Trace["v1"].Reason != ReasonQuarantined {
+		t.Fatalf("expected v1 skipped as quarantined, got %+v", res.Trace["v1"])
+	}
+}
@@ -10,4 +10,36 @@ type Config struct {
 	EnableSoCConstraints bool                      `json:"enable_soc_constraints"`
 	MinSoC               float64                   `json:"min_soc"`
 	SafeDischargeFloor   float64                   `json:"safe_discharge_floor"`
+	// FallbackRounds defaults to DefaultFallbackRounds when unset; an
+	// explicit 0 only computes the reallocation.
+	FallbackRounds *int                `json:"fallback_rounds"`
+	Session        SessionConfig       `json:"session"`
+	Droop          DroopConfig         `json:"droop"`
+	Strategy       StrategyConfig      `json:"strategy"`
+	History        HistoryConfig       `json:"history"`
+	Participation  ParticipationConfig `json:"participation"`
+	Breaker        BreakerConfig       `json:"breaker"`
+}
+
+// FallbackRoundCount returns the configured number of fallback rounds, or
+// DefaultFallbackRounds when unset.
+func (c Config) FallbackRoundCount() int {
+	if c.FallbackRounds == nil {
+		return DefaultFallbackRounds
+	}
+	return max(*c.FallbackRounds, 0)
+}
+
+// RestartRequired returns the keys of the settings that differ in next but
+// only apply when the service starts, so that a reload can report them as
+// ignored.
+func (c Config) RestartRequired(next Config) []string {
+	var keys []string
+	if c.Participation != next.Participation {
+		keys = append(keys, "participation")
+	}
+	if c.Breaker != next.Breaker {
+		keys = append(keys, "breaker")
+	}
+	return keys
 }
@@ -0,0 +1,242 @@
+package dispatch
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+)
+
+// RampWindow is the time a vehicle has to reach a new setpoint. It matches the
+// 30 s full activation time of FCR. Shorter signals use their duration.
+var RampWindow = 30 * time.Second
+
+// constraintEps absorbs floating point noise when comparing powers.
+const constraintEps = 1e-9
+
+func rampWindow(signal model.FlexibilitySignal) time.Duration {
+	if signal.Duration > 0 && signal.Duration < RampWindow {
+		return signal.Duration
+	}
+	return RampWindow
+}
+
+// powerRange holds the power magnitudes, in the direction of the signal, a
+// vehicle can be dispatched to: zero when lo allows it, otherwise the
+// multiples of step between max(lo, min) and hi.
+type powerRange struct {
+	lo, hi    float64
+	min, step float64
+}
+
+// rangeFor returns the power range of v for the signal, capped to the energy
+// the vehicle can inject and still reach MinSoC at departure. The energy limit
+// takes precedence over the ramp: a vehicle that cannot ramp down to it in
+// time is held at the limit. ok is false when the vehicle cannot follow the
+// direction of the signal within the ramp window.
+func rangeFor(v model.Vehicle, signal model.FlexibilitySignal) (powerRange, bool) {
+	r, ok := rampRange(v, signal)
+	if !ok {
+		return r, false
+	}
+	if limit := energyLimitKW(v, signal); limit < r.hi {
+		r.hi = limit
+		r.lo = math.Min(r.lo, limit)
+	}
+	return r, true
+}
+
+// rampRange returns the power range v can reach within the ramp window.
+func rampRange(v model.Vehicle, signal model.FlexibilitySignal) (powerRange, bool) {
+	lo, hi := v.PowerBounds(rampWindow(signal))
+	if signal.PowerKW < 0 {
+		lo, hi = -hi, -lo
+	}
+	lo = math.Max(lo, 0)
+	if hi < lo {
+		return powerRange{}, false
+	}
+	return powerRange{lo: lo, hi: hi, min: v.MinPowerKW, step: v.PowerStepKW}, true
+}
+
+// first returns the smallest non-zero power of the range. A vehicle that must
+// stay above lo but has no step inside its range is held at hi.
+func (r powerRange) first() (float64, bool) {
+	start := math.Max(r.lo, r.min)
+	if r.step > 0 {
+		start = math.Max(r.step, math.Ceil(start/r.step-constraintEps)*r.step)
+	}
+	if start > r.hi+constraintEps {
+		if r.lo > 0 {
+			return r.hi, true
+		}
+		return 0, false
+	}
+	return start, true
+}
+
+// floor returns the largest power of the range not above x, or the smallest
+// one when the vehicle cannot go down to x.
+func (r powerRange) floor(x float64) float64 {
+	x = math.Min(x, r.hi)
+	if r.step > 0 {
+		x = math.Floor(x/r.step+constraintEps) * r.step
+	}
+	if x <= 0 || x < math.Max(r.lo, r.min)-constraintEps {
+		if r.lo > 0 {
+			f, _ := r.first()
+			return f
+		}
+		return 0
+	}
+	return x
+}
+
+// grow returns the next power above x that adds at most residue.
+func (r powerRange) grow(x, residue float64) (float64, bool) {
+	var next float64
+	switch {
+	case x <= constraintEps:
+		f, ok := r.first()
+		if !ok {
+			return x, false
+		}
+		next = f
+		if r.step == 0 {
+			next = math.Max(f, math.Min(r.hi, residue))
+		}
+	case r.step > 0:
+		next = x + r.step
+	default:
+		next = math.Min(r.hi, x+residue)
+	}
+	if next <= x+constraintEps || next > r.hi+constraintEps || next-x > residue+constraintEps {
+		return x, false
+	}
+	return next, true
+}
+
+// shrink returns the next power below x that removes at most excess.
+func (r powerRange) shrink(x, excess float64) (float64, bool) {
+	bottom := math.Max(r.lo, r.min)
+	next := math.Max(bottom, x-excess)
+	if r.step > 0 {
+		next = x - r.step
+	}
+	if next < bottom-constraintEps {
+		if r.lo > 0 {
+			return x, false
+		}
+		next = 0
+	}
+	if next >= x-constraintEps || x-next > excess+constraintEps {
+		return x, false
+	}
+	return next, true
+}
+
+// applyPowerConstraints adjusts the assignments so that every setpoint can be
+// reached from the vehicle's current setpoint within the ramp window, lies
+// outside the charger dead zone and on its step. Rounding residues are moved
+// to the vehicles able to take them, largest residue first, so the total
+// stays as close as possible to the original allocation. Vehicles that cannot
+// ramp down to zero in time keep the lowest power they can reach. Setpoints are
+// also capped to the energy limit of each vehicle. Fleets without constrained
+// vehicles are returned unchanged.
+func applyPowerConstraints(vehicles []model.Vehicle, signal model.FlexibilitySignal, assignments map[string]float64) map[string]float64 {
+	return constrainPower(vehicles, signal, assignments, rangeFor, energyLimited)
+}
+
+// applyRampConstraints is applyPowerConstraints without the energy limit, for
+// planners bounding the energy over their horizon themselves.
+func applyRampConstraints(vehicles []model.Vehicle, signal model.FlexibilitySignal, assignments map[string]float64) map[string]float64 {
+	return constrainPower(vehicles, signal, assignments, rampRange, func(model.Vehicle, model.FlexibilitySignal) bool { return false })
+}
+
+func constrainPower(vehicles []model.Vehicle, signal model.FlexibilitySignal, assignments map[string]float64,
+	rangeFor func(model.Vehicle, model.FlexibilitySignal) (powerRange, bool),
+	limited func(model.Vehicle, model.FlexibilitySignal) bool) map[string]float64 {
+	constrained := false
+	for _, v := range vehicles {
+		if v.HasPowerConstraints() || limited(v, signal) {
+			constrained = true
+			break
+		}
+	}
+	if !constrained || signal.PowerKW == 0 {
+		return assignments
+	}
+	sign := 1.0
+	if signal.PowerKW < 0 {
+		sign = -1
+	}
+
+	ranges := make(map[string]powerRange, len(vehicles))
+	raw := make(map[string]float64, len(vehicles))
+	quantised := make(map[string]float64, len(vehicles))
+	var ids []string
+	var target float64
+	for _, v := range vehicles {
+		p, assigned := assignments[v.ID]
+		r, ok := rangeFor(v, signal)
+		if !ok {
+			delete(assignments, v.ID)
+			continue
+		}
+		if !assigned && r.lo == 0 {
+			continue
+		}
+		m := math.Max(0, sign*p)
+		ids = append(ids, v.ID)
+		ranges[v.ID] = r
+		raw[v.ID] = m
+		quantised[v.ID] = r.floor(m)
+		target += m
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		ri := raw[ids[i]] - quantised[ids[i]]
+		rj := raw[ids[j]] - quantised[ids[j]]
+		if ri != rj {
+			return ri > rj
+		}
+		return ids[i] < ids[j]
+	})
+	redistributeResidue(ids, ranges, quantised, target)
+
+	for _, id := range ids {
+		assignments[id] = sign * quantised[id]
+	}
+	return assignments
+}
+
+// redistributeResidue moves powers within their range, one step per vehicle
+// and pass, until the total matches target or no vehicle can move.
+func redistributeResidue(ids []string, ranges map[string]powerRange, powers map[string]float64, target float64) {
+	diff := target
+	for _, id := range ids {
+		diff -= powers[id]
+	}
+	for pass := 0; pass < 1000; pass++ {
+		moved := false
+		for _, id := range ids {
+			var next float64
+			var ok bool
+			switch {
+			case diff > constraintEps:
+				next, ok = ranges[id].grow(powers[id], diff)
+			case diff < -constraintEps:
+				next, ok = ranges[id].shrink(powers[id], -diff)
+			}
+			if !ok {
+				continue
+			}
+			diff -= next - powers[id]
+			powers[id] = next
+			moved = true
+		}
+		if !moved {
+			return
+		}
+	}
+}
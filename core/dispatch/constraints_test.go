@@ -0,0 +1,99 @@
+package dispatch
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+)
+
+func onStep(p, step float64) bool {
+	r := math.Mod(math.Abs(p)+constraintEps, step)
+	return r < 1e-6
+}
+
+func TestEqualDispatcher_QuantisesToStep(t *testing.T) {
+	vehicles := []model.Vehicle{
+		{ID: "v1", MaxPower: 11, PowerStepKW: 1.38},
+		{ID: "v2", MaxPower: 11, PowerStepKW: 1.38},
+		{ID: "v3", MaxPower: 11},
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 15}
+	res := EqualDispatcher{}.Dispatch(vehicles, sig)
+	for _, id := range []string{"v1", "v2"} {
+		if !onStep(res[id], 1.38) {
+			t.Fatalf("%s setpoint %v not on 1.38 kW step", id, res[id])
+		}
+	}
+	var sum float64
+	for _, p := range res {
+		sum += p
+	}
+	if math.Abs(sum-15) > 1e-6 {
+		t.Fatalf("expected residue moved to v3, total %v (%v)", sum, res)
+	}
+}
+
+func TestEqualDispatcher_DeadZone(t *testing.T) {
+	vehicles := []model.Vehicle{
+		{ID: "v1", MaxPower: 11, MinPowerKW: 4.1},
+		{ID: "v2", MaxPower: 11, MinPowerKW: 4.1},
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: -5}
+	res := EqualDispatcher{}.Dispatch(vehicles, sig)
+	var sum float64
+	for id, p := range res {
+		if p != 0 && math.Abs(p) < 4.1 {
+			t.Fatalf("%s setpoint %v inside dead zone", id, p)
+		}
+		sum += p
+	}
+	if math.Abs(sum+5) > 1e-6 {
+		t.Fatalf("expected 5 kW charge on one vehicle, got %v", res)
+	}
+}
+
+func TestSmartDispatcher_RespectsRampRate(t *testing.T) {
+	d := NewSmartDispatcher()
+	vehicles := []model.Vehicle{
+		{ID: "slow", IsV2G: true, Available: true, MaxPower: 20, SoC: 0.9, BatteryKWh: 50, RampRateKW: 0.1},
+		{ID: "fast", IsV2G: true, Available: true, MaxPower: 20, SoC: 0.5, BatteryKWh: 50},
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 20, Timestamp: time.Now()}
+	res := d.Dispatch(vehicles, sig)
+	if res["slow"] > 3+1e-9 {
+		t.Fatalf("slow vehicle ramped beyond 3 kW in 30 s: %v", res["slow"])
+	}
+	if math.Abs(res["slow"]+res["fast"]-20) > 1e-6 {
+		t.Fatalf("expected fast vehicle to cover the gap: %v", res)
+	}
+}
+
+func TestLPDispatcher_RampLowerBound(t *testing.T) {
+	d := NewLPDispatcher()
+	vehicles := []model.Vehicle{
+		{ID: "busy", IsV2G: true, Available: true, MaxPower: 20, SoC: 0.5, BatteryKWh: 50, CurrentPowerKW: 10, RampRateKW: 0.1},
+		{ID: "idle", IsV2G: true, Available: true, MaxPower: 20, SoC: 0.9, BatteryKWh: 50},
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 12, Timestamp: time.Now()}
+	res, err := d.DispatchStrict(vehicles, sig)
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if res["busy"] < 7-1e-6 || res["busy"] > 13+1e-6 {
+		t.Fatalf("busy vehicle outside its ramp range: %v", res["busy"])
+	}
+	if math.Abs(res["busy"]+res["idle"]-12) > 1e-3 {
+		t.Fatalf("unexpected total: %v", res)
+	}
+}
+
+func TestPowerRange_ForcedMinimum(t *testing.T) {
+	v := model.Vehicle{ID: "v1", MaxPower: 10, CurrentPowerKW: 8, RampRateKW: 0.1, PowerStepKW: 2}
+	sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 1}
+	res := applyPowerConstraints([]model.Vehicle{v}, sig, map[string]float64{})
+	if res["v1"] != 6 {
+		t.Fatalf("expected vehicle held at 6 kW, got %v", res["v1"])
+	}
+}
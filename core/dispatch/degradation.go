@@ -0,0 +1,40 @@
+package dispatch
+
+import (
+	"math"
+	"time"
+
+	"github.com/kilianp07/v2g/core/degradation"
+	"github.com/kilianp07/v2g/core/model"
+)
+
+// wearCostPerKWh returns the marginal battery wear cost in €/kWh of holding
+// the signal power, limited to the vehicle power, over the signal duration or
+// one hour when it has none.
+func wearCostPerKWh(v model.Vehicle, signal model.FlexibilitySignal) float64 {
+	power := math.Min(v.MaxPower, math.Abs(signal.PowerKW))
+	if power <= 0 {
+		return 0
+	}
+	d := signal.Duration
+	if d <= 0 {
+		d = time.Hour
+	}
+	return degradation.Estimate(v, math.Copysign(power, signal.PowerKW), d).PerKWh()
+}
+
+// wearCosts estimates the battery wear cost in € of each assignment held for
+// the signal duration.
+func wearCosts(vehicles []model.Vehicle, signal model.FlexibilitySignal, assignments map[string]float64) map[string]float64 {
+	costs := make(map[string]float64)
+	for _, v := range vehicles {
+		p := assignments[v.ID]
+		if p == 0 {
+			continue
+		}
+		if c := degradation.Estimate(v, p, signal.Duration).Total(); c > 0 {
+			costs[v.ID] = c
+		}
+	}
+	return costs
+}
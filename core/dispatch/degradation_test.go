@@ -0,0 +1,65 @@
+package dispatch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+func chemistryVehicles(now time.Time) []model.Vehicle {
+	return []model.Vehicle{
+		{ID: "nmc", Chemistry: "NMC", SoC: 0.8, MinSoC: 0.2, BatteryKWh: 40, IsV2G: true, Available: true, MaxPower: 20, Departure: now.Add(4 * time.Hour)},
+		{ID: "lfp", Chemistry: "LFP", SoC: 0.8, MinSoC: 0.2, BatteryKWh: 40, IsV2G: true, Available: true, MaxPower: 20, Departure: now.Add(4 * time.Hour)},
+	}
+}
+
+func TestSmartDispatcher_PrefersCheapToCycleBattery(t *testing.T) {
+	now := time.Now()
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 20, Duration: time.Hour, Timestamp: now}
+	d := NewSmartDispatcher()
+	d.Dispatch(chemistryVehicles(now), sig)
+	if scores := d.GetScores(); scores["lfp"] != scores["nmc"] {
+		t.Fatalf("expected no degradation penalty by default: %v", scores)
+	}
+	d.DegradationWeight = 1
+	d.Dispatch(chemistryVehicles(now), sig)
+	scores := d.GetScores()
+	if scores["lfp"] <= scores["nmc"] {
+		t.Fatalf("expected LFP to score higher: %v", scores)
+	}
+	parts := d.scoreParts(chemistryVehicles(now)[0], &DispatchContext{Signal: sig, Now: now})
+	if parts.components()["degradation"] >= 0 {
+		t.Fatalf("expected a degradation penalty: %v", parts.components())
+	}
+}
+
+func TestLPDispatcher_ObjectiveIncludesWearCost(t *testing.T) {
+	now := time.Now()
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 20, Duration: time.Hour, Timestamp: now}
+	d := NewLPDispatcher()
+	d.DegradationWeight = 1
+	asn := d.Dispatch(chemistryVehicles(now), sig)
+	if asn["lfp"] != 20 || asn["nmc"] != 0 {
+		t.Fatalf("expected the LP to use the LFP battery: %v", asn)
+	}
+}
+
+func TestDispatchManager_ReportsWearCost(t *testing.T) {
+	now := time.Now()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, mqtt.NewMockPublisher(), time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 20, Duration: time.Hour, Timestamp: now}
+	res := mgr.Dispatch(sig, chemistryVehicles(now))
+	if res.WearCostEUR["nmc"] <= res.WearCostEUR["lfp"] || res.WearCostEUR["lfp"] <= 0 {
+		t.Fatalf("unexpected wear costs: %v", res.WearCostEUR)
+	}
+	dry := mgr.DryRun(sig, chemistryVehicles(now))
+	if dry.WearCostEUR["nmc"] != res.WearCostEUR["nmc"] {
+		t.Fatalf("dry run wear cost %v differs from dispatch %v", dry.WearCostEUR, res.WearCostEUR)
+	}
+}
@@ -2,7 +2,8 @@ package dispatch
 
 import "github.com/kilianp07/v2g/core/model"
 
-// EqualDispatcher distributes power equally between all vehicles.
+// EqualDispatcher distributes power equally between all vehicles, then
+// quantises the shares to the charger steps and ramp limits.
 type EqualDispatcher struct{}
 
 func (d EqualDispatcher) Dispatch(vehicles []model.Vehicle, signal model.FlexibilitySignal) map[string]float64 {
@@ -49,5 +50,5 @@ func (d EqualDispatcher) Dispatch(vehicles []model.Vehicle, signal model.Flexibi
 		needMore = next
 	}
 
-	return assignments
+	return applyPowerConstraints(vehicles, signal, assignments)
 }
@@ -0,0 +1,258 @@
+package dispatch
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/kilianp07/v2g/core/events"
+	"github.com/kilianp07/v2g/core/metrics"
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/core/monitoring"
+	"github.com/kilianp07/v2g/core/mqtt"
+)
+
+// Droop modes.
+const (
+	// DroopCentral re-dispatches the fleet at a fixed cadence from the
+	// measured frequency.
+	DroopCentral = "central"
+	// DroopLocal pushes droop parameters once and lets the vehicles follow
+	// the frequency themselves.
+	DroopLocal = "local"
+)
+
+// FrequencySample is a grid frequency measurement.
+type FrequencySample struct {
+	Hz   float64
+	Time time.Time
+}
+
+// FrequencySource provides the measured grid frequency.
+type FrequencySource interface {
+	Latest(ctx context.Context) (FrequencySample, error)
+}
+
+// DroopConfig controls the frequency-droop FCR mode.
+type DroopConfig struct {
+	Enabled           bool    `json:"enabled"`
+	Mode              string  `json:"mode"`
+	NominalHz         float64 `json:"nominal_hz"`
+	DeadbandMHz       float64 `json:"deadband_mhz"`
+	FullActivationMHz float64 `json:"full_activation_mhz"`
+	// CapacityKW is the reserved FCR capacity used when the signal carries
+	// no power.
+	CapacityKW   float64 `json:"capacity_kw"`
+	IntervalMS   int     `json:"interval_ms"`
+	MinChangeKW  float64 `json:"min_change_kw"`
+	StaleAfterMS int     `json:"stale_after_ms"`
+}
+
+// Params returns the droop response for the given capacity. Unset values
+// default to 50 Hz nominal, a 10 mHz deadband and full activation at 200 mHz.
+func (c DroopConfig) Params(capacityKW float64) model.DroopParams {
+	p := model.DroopParams{
+		NominalHz:         c.NominalHz,
+		DeadbandMHz:       c.DeadbandMHz,
+		FullActivationMHz: c.FullActivationMHz,
+		CapacityKW:        capacityKW,
+	}
+	if p.NominalHz <= 0 {
+		p.NominalHz = 50
+	}
+	if p.DeadbandMHz <= 0 {
+		p.DeadbandMHz = 10
+	}
+	if p.FullActivationMHz <= 0 {
+		p.FullActivationMHz = 200
+	}
+	return p
+}
+
+// Interval returns the re-dispatch cadence, defaulting to one second.
+func (c DroopConfig) Interval() time.Duration {
+	if c.IntervalMS <= 0 {
+		return time.Second
+	}
+	return time.Duration(c.IntervalMS) * time.Millisecond
+}
+
+// StaleAfter returns the age after which a frequency sample is ignored. It
+// defaults to three intervals.
+func (c DroopConfig) StaleAfter() time.Duration {
+	if c.StaleAfterMS <= 0 {
+		return 3 * c.Interval()
+	}
+	return time.Duration(c.StaleAfterMS) * time.Millisecond
+}
+
+// SetDroop enables the frequency-droop FCR mode. src is required in central
+// mode and ignored in local mode.
+func (m *DispatchManager) SetDroop(cfg DroopConfig, src FrequencySource) {
+	m.mu.Lock()
+	m.droop = cfg
+	m.frequency = src
+	m.mu.Unlock()
+}
+
+func (m *DispatchManager) droopSettings() (DroopConfig, FrequencySource) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.droop, m.frequency
+}
+
+// droopEnabled reports whether FCR signals should be held in droop mode.
+func (m *DispatchManager) droopEnabled() bool {
+	cfg, src := m.droopSettings()
+	return cfg.Enabled && (cfg.Mode == DroopLocal || src != nil)
+}
+
+// RunDroop holds an FCR signal in frequency-droop mode until
+// signal.Timestamp+signal.Duration or until ctx is cancelled. signal.PowerKW
+// is the symmetric capacity to provide. It is split across the vehicles and
+// reserved in the ledger for the whole signal. In local mode each vehicle
+// receives its droop parameters once; in central mode the fleet is
+// re-dispatched at the configured cadence from the measured frequency. All
+// vehicles are released when the signal ends.
+func (m *DispatchManager) RunDroop(ctx context.Context, signal model.FlexibilitySignal, vehicles []model.Vehicle) SessionResult {
+	cfg, src := m.droopSettings()
+	if signal.PowerKW == 0 {
+		signal.PowerKW = cfg.CapacityKW
+	}
+	shares, pool, commitment, price := m.reserveDroop(signal, vehicles)
+	s := newSession(signal, pool, DispatchResult{MarketPrice: price})
+	s.commitment = commitment
+	s.heldSince = time.Now()
+	m.publishSession(signal, "start", 0, 0)
+
+	res := SessionResult{Signal: signal}
+	end := time.NewTimer(time.Until(signal.Timestamp.Add(signal.Duration)))
+	defer end.Stop()
+	var tick <-chan time.Time
+	if cfg.Mode == DroopLocal {
+		m.pushDroop(s, cfg, shares)
+	} else {
+		ticker := time.NewTicker(cfg.Interval())
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-end.C:
+			break loop
+		case now := <-tick:
+			if round, ok := m.droopRound(ctx, s, cfg, src, shares, now); ok {
+				res.Rounds = append(res.Rounds, round)
+			}
+		}
+	}
+	res.Setpoints = make(map[string]float64, len(s.setpoints))
+	for id, p := range s.setpoints {
+		res.Setpoints[id] = p
+	}
+	res.Released = m.releaseSession(s)
+	droopSetpoint.Set(0)
+	return res
+}
+
+// reserveDroop splits the signal capacity across the selected vehicles and
+// reserves each share in the ledger. It also returns the market price the
+// capacity was allocated at.
+func (m *DispatchManager) reserveDroop(signal model.FlexibilitySignal, vehicles []model.Vehicle) (map[string]float64, []model.Vehicle, uint64, float64) {
+	vehicles = m.discoverVehicles(vehicles)
+	m.reloadMu.RLock()
+	defer m.reloadMu.RUnlock()
+	m.planMu.Lock()
+	defer m.planMu.Unlock()
+	pool := m.selectVehicles(signal, vehicles)
+	capacity := signal
+	capacity.PowerKW = math.Abs(signal.PowerKW)
+	shares, used, _ := m.dispatchStrategy(pool, capacity)
+	id := m.ledger.Open(signal)
+	for vid, p := range shares {
+		m.ledger.Reserve(id, vid, p)
+	}
+	m.logger.Infof("droop %s: reserved %.2f kW on %d vehicles", signal.Type, capacity.PowerKW, len(shares))
+	return shares, pool, id, m.marketPrice(used, signal)
+}
+
+// pushDroop sends each vehicle its droop parameters.
+func (m *DispatchManager) pushDroop(s *session, cfg DroopConfig, shares map[string]float64) {
+	dc, ok := m.publisher.(mqtt.DroopClient)
+	if !ok {
+		m.logger.Errorf("droop %s: publisher cannot push droop parameters", s.signal.Type)
+		return
+	}
+	until := orderDeadline(s.signal)
+	var wg sync.WaitGroup
+	for id, share := range shares {
+		wg.Add(1)
+		go func(id string, share float64) {
+			defer wg.Done()
+			defer monitoring.Recover()
+			cmdID, err := dc.SendDroop(id, cfg.Params(share), until)
+			var ack mqtt.Ack
+			if err == nil {
+				ack, err = m.publisher.WaitForAck(cmdID, m.ackWait())
+			}
+			if err != nil || !ack.Accepted() {
+				m.logger.Errorf("droop parameters not acknowledged by %s: %v", id, err)
+			}
+		}(id, share)
+	}
+	wg.Wait()
+}
+
+// droopRound converts the measured frequency into per-vehicle setpoints
+// proportional to their reserved share and publishes the ones that moved by
+// more than MinChangeKW. A missing or stale frequency brings the fleet back to
+// zero.
+func (m *DispatchManager) droopRound(ctx context.Context, s *session, cfg DroopConfig, src FrequencySource, shares map[string]float64, now time.Time) (DispatchResult, bool) {
+	params := cfg.Params(math.Abs(s.signal.PowerKW))
+	sample, err := src.Latest(ctx)
+	stale := err != nil || now.Sub(sample.Time) > cfg.StaleAfter()
+	activation := 0.0
+	if stale {
+		m.logger.Warnf("droop %s: no fresh frequency (%v), holding zero", s.signal.Type, err)
+	} else {
+		activation = params.Activation(sample.Hz)
+		gridFrequency.Set(sample.Hz)
+	}
+	setpoint := activation * params.CapacityKW
+	droopSetpoint.Set(setpoint)
+	if m.bus != nil {
+		m.bus.Publish(events.DroopEvent{Signal: s.signal, FrequencyHz: sample.Hz, Activation: activation, SetpointKW: setpoint, Stale: stale})
+	}
+
+	round := newDispatchResult(s.signal)
+	round.commitment = s.commitment
+	round.MarketPrice = s.price
+	for id, share := range shares {
+		target := activation * share
+		cur := s.setpoints[id]
+		if math.Abs(target-cur) > cfg.MinChangeKW || (target == 0 && cur != 0) {
+			round.Assignments[id] = target
+		}
+	}
+	if len(round.Assignments) == 0 {
+		return DispatchResult{}, false
+	}
+	s.rounds++
+	round.Round = s.rounds
+	lr, recordLatency := m.metrics.(metrics.LatencyRecorder)
+	lat := m.dispatchAssignments(&round, s.signal, recordLatency)
+	m.holdSession(s, now)
+	for id := range round.Assignments {
+		if round.Acknowledged[id] {
+			s.setpoints[id] = round.AppliedPower(id)
+		}
+	}
+	m.recordParticipation(round, 0)
+	m.recordMetrics(round, lat, lr, recordLatency)
+	m.appendLog(round, s.pool())
+	return round, true
+}
@@ -0,0 +1,88 @@
+package dispatch
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+type fixedFrequency float64
+
+func (f fixedFrequency) Latest(context.Context) (FrequencySample, error) {
+	return FrequencySample{Hz: float64(f), Time: time.Now()}, nil
+}
+
+func droopVehicles() []model.Vehicle {
+	return []model.Vehicle{
+		{ID: "v1", IsV2G: true, Available: true, MaxPower: 20, SoC: 0.8, BatteryKWh: 50},
+		{ID: "v2", IsV2G: true, Available: true, MaxPower: 20, SoC: 0.8, BatteryKWh: 50},
+	}
+}
+
+func TestRunDroop_CentralFollowsFrequency(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	mgr.SetDroop(DroopConfig{Enabled: true, Mode: DroopCentral, IntervalMS: 10}, fixedFrequency(49.895))
+	now := time.Now()
+	sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 20, Duration: 80 * time.Millisecond, Timestamp: now}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan SessionResult)
+	go func() { done <- mgr.RunDroop(ctx, sig, droopVehicles()) }()
+	time.Sleep(30 * time.Millisecond)
+	if h := mgr.Ledger().Headroom("v1", 20, now, now.Add(time.Millisecond), 0); h != 10 {
+		t.Errorf("expected 10 kW reserved on v1, headroom %v", h)
+	}
+	res := <-done
+
+	if len(res.Rounds) != 1 {
+		t.Fatalf("expected a single round at constant frequency, got %d", len(res.Rounds))
+	}
+	for _, id := range []string{"v1", "v2"} {
+		if p := res.Rounds[0].Assignments[id]; math.Abs(p-5) > 1e-9 {
+			t.Errorf("expected 5 kW on %s, got %v", id, p)
+		}
+		if !res.Released[id] {
+			t.Errorf("expected %s released", id)
+		}
+	}
+	if len(mgr.Ledger().Commitments("v1")) != 0 {
+		t.Fatalf("expected droop reservation released")
+	}
+}
+
+func TestRunDroop_LocalPushesParameters(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	mgr.SetDroop(DroopConfig{Enabled: true, Mode: DroopLocal, DeadbandMHz: 20}, nil)
+	if !mgr.droopEnabled() {
+		t.Fatalf("local droop should not require a frequency source")
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 20, Duration: time.Hour, Timestamp: time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	res := mgr.RunDroop(ctx, sig, droopVehicles())
+
+	if len(res.Rounds) != 0 {
+		t.Fatalf("local mode should not re-dispatch, got %d rounds", len(res.Rounds))
+	}
+	if !res.Released["v1"] || !res.Released["v2"] {
+		t.Fatalf("expected release on cancel: %+v", res.Released)
+	}
+	if p := pub.Droop["v1"]; p.CapacityKW != 10 || p.DeadbandMHz != 20 || p.FullActivationMHz != 200 {
+		t.Fatalf("unexpected droop parameters %+v", p)
+	}
+}
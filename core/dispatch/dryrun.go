@@ -0,0 +1,118 @@
+package dispatch
+
+import (
+	"math"
+	"sort"
+
+	"github.com/kilianp07/v2g/core/model"
+)
+
+// DryRunResult describes how a signal would be dispatched.
+type DryRunResult struct {
+	Signal      model.FlexibilitySignal
+	Assignments map[string]float64
+	Scores      map[string]float64
+	// MarketPrice is the price the signal would be dispatched at.
+	MarketPrice float64
+	// Excluded maps the vehicles left out of the allocation to the reason
+	// code of their trace.
+	Excluded map[string]string
+	// Trace explains the decision for each vehicle.
+	Trace map[string]VehicleTrace
+	// Plan holds the per-slot setpoints when the dispatcher plans the horizon.
+	Plan *DispatchPlan
+	// Segments holds the per-segment split of segmented dispatchers.
+	Segments map[string]SegmentAllocation
+	// WearCostEUR is the estimated battery wear cost of each assignment.
+	WearCostEUR map[string]float64
+	// AllocatedKW is the power the assignments deliver.
+	AllocatedKW float64
+	// Coverage is the share of the signal still delivered after the
+	// fallback reallocates the power of each assigned vehicle if it fails.
+	Coverage map[string]float64
+	// WorstCoverage is the lowest Coverage, or 1 without assignments.
+	WorstCoverage float64
+}
+
+// DryRun runs discovery, filtering, prediction and the dispatch strategy for
+// the signal without reserving power or sending any order.
+func (m *DispatchManager) DryRun(signal model.FlexibilitySignal, vehicles []model.Vehicle) DryRunResult {
+	vehicles = m.discoverVehicles(vehicles)
+	m.reloadMu.RLock()
+	defer m.reloadMu.RUnlock()
+	m.planMu.Lock()
+	defer m.planMu.Unlock()
+
+	res := DryRunResult{
+		Signal:      signal,
+		Assignments: make(map[string]float64),
+		Scores:      make(map[string]float64),
+		Excluded:    make(map[string]string),
+		Coverage:    make(map[string]float64),
+	}
+	headroom := m.applyHeadroom(signal, vehicles, 0)
+	filtered := m.filterVehicles(signal, headroom)
+	if va, ok := m.fallback.(VehicleAwareFallback); ok {
+		va.SetVehicles(filtered)
+	}
+	assignments, used, plan := m.dispatchStrategy(filtered, signal)
+	for id, p := range assignments {
+		if p != 0 {
+			res.Assignments[id] = p
+			res.AllocatedKW += p
+		}
+	}
+	if sr, ok := used.(SegmentReporter); ok {
+		res.Segments = sr.GetSegments()
+	}
+	res.Trace = m.traceDecisions(signal, vehicles, headroom, filtered, assignments, used)
+	res.WearCostEUR = wearCosts(filtered, signal, assignments)
+	res.MarketPrice = m.marketPrice(used, signal)
+	for id, t := range res.Trace {
+		if t.PowerKW == 0 {
+			res.Excluded[id] = t.Reason
+		}
+	}
+	if sd, ok := used.(ScoringDispatcher); ok {
+		for id, s := range sd.GetScores() {
+			res.Scores[id] = s
+		}
+	}
+	res.Plan = plan
+	m.fallbackCoverage(&res, filtered)
+	return res
+}
+
+// fallbackCoverage simulates the failure of each assigned vehicle and records
+// the share of the signal the fallback strategy keeps delivered.
+func (m *DispatchManager) fallbackCoverage(res *DryRunResult, vehicles []model.Vehicle) {
+	res.WorstCoverage = 1
+	if res.Signal.PowerKW == 0 {
+		return
+	}
+	byID := make(map[string]model.Vehicle, len(vehicles))
+	for _, v := range vehicles {
+		byID[v.ID] = v
+	}
+	ids := make([]string, 0, len(res.Assignments))
+	for id := range res.Assignments {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		current := make(map[string]float64, len(res.Assignments))
+		for vid, p := range res.Assignments {
+			current[vid] = p
+		}
+		realloc := m.reallocate([]model.Vehicle{byID[id]}, current, 0, res.Signal, vehicles)
+		var delivered float64
+		for vid, p := range realloc {
+			if vid != id {
+				delivered += p
+			}
+		}
+		cov := math.Max(0, math.Min(1, delivered/res.Signal.PowerKW))
+		res.Coverage[id] = cov
+		res.WorstCoverage = math.Min(res.WorstCoverage, cov)
+	}
+}
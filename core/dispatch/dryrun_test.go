@@ -0,0 +1,70 @@
+package dispatch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+func dryRunVehicles() []model.Vehicle {
+	return []model.Vehicle{
+		{ID: "v1", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 50},
+		{ID: "v2", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 50},
+		{ID: "off", IsV2G: true, Available: false, MaxPower: 10, SoC: 0.8, BatteryKWh: 50},
+	}
+}
+
+func TestDryRun_DoesNotSendOrCommit(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 10, Duration: time.Minute, Timestamp: time.Now()}
+	res := mgr.DryRun(sig, dryRunVehicles())
+
+	if len(pub.Messages) != 0 {
+		t.Fatalf("dry run sent orders: %v", pub.Messages)
+	}
+	if len(mgr.ledger.Commitments("v1")) != 0 {
+		t.Fatalf("dry run reserved power")
+	}
+	if res.Assignments["v1"] != 5 || res.Assignments["v2"] != 5 || res.AllocatedKW != 10 {
+		t.Fatalf("unexpected assignments: %+v", res.Assignments)
+	}
+	if res.Excluded["off"] != ReasonUnavailable {
+		t.Fatalf("expected off to be unavailable: %+v", res.Excluded)
+	}
+	if res.WorstCoverage != 0.5 {
+		t.Fatalf("noop fallback should lose the failed share, got %v", res.WorstCoverage)
+	}
+}
+
+func TestDryRun_ReportsCommittedAndFallbackCoverage(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NewBalancedFallback(logger.NopLogger{}), pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	now := time.Now()
+	busy := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 10, Duration: time.Hour, Timestamp: now}
+	id := mgr.ledger.Open(busy)
+	mgr.ledger.Set(id, "v2", 10)
+
+	vehicles := append(dryRunVehicles(), model.Vehicle{ID: "v3", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 50})
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 10, Duration: time.Minute, Timestamp: now}
+	res := mgr.DryRun(sig, vehicles)
+
+	if res.Excluded["v2"] != ReasonCommitted {
+		t.Fatalf("expected v2 fully committed: %+v", res.Excluded)
+	}
+	if len(res.Coverage) != 2 {
+		t.Fatalf("expected coverage for each assigned vehicle: %+v", res.Coverage)
+	}
+	if res.WorstCoverage <= 0.5 {
+		t.Fatalf("balanced fallback should reallocate the failed share, got %v", res.WorstCoverage)
+	}
+}
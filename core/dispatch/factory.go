@@ -0,0 +1,432 @@
+package dispatch
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kilianp07/v2g/core/logger"
+	"github.com/kilianp07/v2g/core/prediction"
+)
+
+// StrategyConfig selects and parameterises the algorithms used by the
+// manager. Empty names select the defaults: the simple filter, the equal
+// dispatcher, the noop fallback, no tuner and no prediction engine.
+type StrategyConfig struct {
+	Filter     string `json:"filter"`
+	Dispatcher string `json:"dispatcher"`
+	Fallback   string `json:"fallback"`
+	Tuner      string `json:"tuner"`
+	Prediction string `json:"prediction"`
+	// Weights overrides the SmartDispatcher weights (soc, time, priority,
+	// price, wear, degradation, fairness, availability, market_price).
+	Weights map[string]float64 `json:"weights"`
+	// SlotMinutes and HorizonMinutes configure the multi_period dispatcher.
+	SlotMinutes    int `json:"slot_minutes"`
+	HorizonMinutes int `json:"horizon_minutes"`
+	// AckTuner configures the ack tuner.
+	AckTuner AckTunerConfig `json:"ack_tuner"`
+	// Bandit configures the bandit tuner.
+	Bandit BanditTunerConfig `json:"bandit"`
+	// Availability holds the per-vehicle probabilities of the static
+	// prediction engine.
+	Availability map[string]float64 `json:"availability"`
+}
+
+// AckTunerConfig configures the AckBasedTuner. Zero values use the defaults
+// of NewAckBasedTuner.
+type AckTunerConfig struct {
+	IncreaseStep float64 `json:"increase_step"`
+	DecreaseStep float64 `json:"decrease_step"`
+	MaxWeight    float64 `json:"max_weight"`
+	MinWeight    float64 `json:"min_weight"`
+	Threshold    float64 `json:"threshold"`
+}
+
+// Default strategy names.
+const (
+	DefaultFilter     = "simple"
+	DefaultDispatcher = "equal"
+	DefaultFallback   = "noop"
+	NoStrategy        = "none"
+)
+
+// Strategies holds the algorithms built from the configuration.
+type Strategies struct {
+	Filter     VehicleFilter
+	Dispatcher Dispatcher
+	Fallback   FallbackStrategy
+	Tuner      LearningTuner
+	Prediction prediction.PredictionEngine
+}
+
+// FilterFactory builds a vehicle filter from the dispatch configuration.
+type FilterFactory func(cfg Config) (VehicleFilter, error)
+
+// DispatcherFactory builds a dispatcher from the dispatch configuration.
+type DispatcherFactory func(cfg Config, log logger.Logger) (Dispatcher, error)
+
+// FallbackFactory builds a fallback strategy from the dispatch configuration.
+type FallbackFactory func(cfg Config, log logger.Logger) (FallbackStrategy, error)
+
+// TunerFactory builds a tuner bound to the dispatcher it adjusts. It returns
+// an error when the dispatcher cannot be tuned.
+type TunerFactory func(cfg Config, d Dispatcher) (LearningTuner, error)
+
+// PredictionFactory builds a prediction engine from the dispatch configuration.
+type PredictionFactory func(cfg Config) (prediction.PredictionEngine, error)
+
+// ConfigCheck validates the parameters of a strategy without building it, so
+// that checking a configuration has no side effect such as loading state.
+type ConfigCheck func(cfg Config) error
+
+var (
+	registryMu  sync.RWMutex
+	filters     = map[string]FilterFactory{}
+	dispatchers = map[string]DispatcherFactory{}
+	fallbacks   = map[string]FallbackFactory{}
+	tuners      = map[string]TunerFactory{}
+	predictions = map[string]PredictionFactory{}
+	checks      = map[string]ConfigCheck{}
+)
+
+// RegisterFilter makes a vehicle filter available under name.
+func RegisterFilter(name string, f FilterFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	filters[name] = f
+}
+
+// RegisterDispatcher makes a dispatcher available under name.
+func RegisterDispatcher(name string, f DispatcherFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	dispatchers[name] = f
+}
+
+// RegisterFallback makes a fallback strategy available under name.
+func RegisterFallback(name string, f FallbackFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	fallbacks[name] = f
+}
+
+// RegisterTuner makes a tuner available under name.
+func RegisterTuner(name string, f TunerFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	tuners[name] = f
+}
+
+// RegisterPrediction makes a prediction engine available under name.
+func RegisterPrediction(name string, f PredictionFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	predictions[name] = f
+}
+
+// RegisterCheck adds a parameter check to the strategy of the given kind
+// (filter, dispatcher, fallback, tuner or prediction) registered under name.
+// Config.Validate runs it when the strategy is selected.
+func RegisterCheck(kind, name string, f ConfigCheck) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	checks[kind+"/"+name] = f
+}
+
+func init() {
+	RegisterFilter(DefaultFilter, func(Config) (VehicleFilter, error) { return SimpleVehicleFilter{}, nil })
+
+	RegisterDispatcher(DefaultDispatcher, func(Config, logger.Logger) (Dispatcher, error) { return EqualDispatcher{}, nil })
+	RegisterDispatcher("smart", func(cfg Config, log logger.Logger) (Dispatcher, error) {
+		d := cfg.smartDispatcher(log)
+		return &d, nil
+	})
+	RegisterDispatcher("lp", func(cfg Config, log logger.Logger) (Dispatcher, error) {
+		return &LPDispatcher{SmartDispatcher: cfg.smartDispatcher(log)}, nil
+	})
+	RegisterDispatcher("multi_period", func(cfg Config, log logger.Logger) (Dispatcher, error) {
+		d := NewMultiPeriodLPDispatcher(time.Duration(cfg.Strategy.SlotMinutes)*time.Minute, time.Duration(cfg.Strategy.HorizonMinutes)*time.Minute)
+		d.SmartDispatcher = cfg.smartDispatcher(log)
+		return d, nil
+	})
+	RegisterDispatcher("segmented", func(cfg Config, _ logger.Logger) (Dispatcher, error) {
+		return NewSegmentedSmartDispatcher(cfg.Segments), nil
+	})
+
+	RegisterFallback(DefaultFallback, func(Config, logger.Logger) (FallbackStrategy, error) { return NoopFallback{}, nil })
+	RegisterFallback("balanced", func(_ Config, log logger.Logger) (FallbackStrategy, error) { return NewBalancedFallback(log), nil })
+	RegisterFallback("probabilistic", func(_ Config, log logger.Logger) (FallbackStrategy, error) {
+		return NewProbabilisticFallback(log), nil
+	})
+
+	RegisterTuner(NoStrategy, func(Config, Dispatcher) (LearningTuner, error) { return nil, nil })
+	RegisterTuner("ack", func(cfg Config, d Dispatcher) (LearningTuner, error) {
+		sd := smartOf(d)
+		if sd == nil {
+			return nil, fmt.Errorf("ack tuner requires a smart, lp or multi_period dispatcher")
+		}
+		c := cfg.Strategy.AckTuner.withDefaults()
+		t := NewAckBasedTunerWithConfig(sd, c.IncreaseStep, c.DecreaseStep, c.MaxWeight, c.MinWeight, c.Threshold)
+		if t == nil {
+			return nil, fmt.Errorf("invalid ack tuner parameters")
+		}
+		return t, nil
+	})
+	RegisterCheck("tuner", "ack", func(cfg Config) error {
+		if !tunable(cfg) {
+			return fmt.Errorf("ack tuner requires a smart, lp or multi_period dispatcher")
+		}
+		c := cfg.Strategy.AckTuner.withDefaults()
+		if c.IncreaseStep <= 0 || c.DecreaseStep <= 0 || c.MaxWeight < c.MinWeight {
+			return fmt.Errorf("invalid ack tuner parameters")
+		}
+		return nil
+	})
+	RegisterTuner("bandit", func(cfg Config, d Dispatcher) (LearningTuner, error) {
+		sd := smartOf(d)
+		if sd == nil {
+			return nil, fmt.Errorf("bandit tuner requires a smart, lp or multi_period dispatcher")
+		}
+		return NewBanditTuner(sd, cfg.Strategy.Bandit)
+	})
+	RegisterCheck("tuner", "bandit", func(cfg Config) error {
+		if !tunable(cfg) {
+			return fmt.Errorf("bandit tuner requires a smart, lp or multi_period dispatcher")
+		}
+		_, err := cfg.Strategy.Bandit.withDefaults()
+		return err
+	})
+
+	RegisterPrediction(NoStrategy, func(Config) (prediction.PredictionEngine, error) { return nil, nil })
+	RegisterPrediction("static", func(cfg Config) (prediction.PredictionEngine, error) {
+		return prediction.NewStaticPredictionEngine(cfg.Strategy.Availability)
+	})
+	RegisterCheck("prediction", "static", func(cfg Config) error {
+		return prediction.ValidateAvailability(cfg.Strategy.Availability)
+	})
+}
+
+// withDefaults fills the zero parameters with the defaults of
+// NewAckBasedTuner.
+func (c AckTunerConfig) withDefaults() AckTunerConfig {
+	c.IncreaseStep = orDefault(c.IncreaseStep, defaultAckStep)
+	c.DecreaseStep = orDefault(c.DecreaseStep, defaultAckStep)
+	c.MaxWeight = orDefault(c.MaxWeight, defaultAckMaxWeight)
+	c.Threshold = orDefault(c.Threshold, DefaultAckThreshold)
+	return c
+}
+
+// tunable reports whether the configured dispatcher embeds the
+// SmartDispatcher the tuners adjust.
+func tunable(cfg Config) bool {
+	switch strategyName(cfg.Strategy.Dispatcher, DefaultDispatcher) {
+	case "smart", "lp", "multi_period":
+		return true
+	}
+	return false
+}
+
+func orDefault(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// smartOf returns the SmartDispatcher a tuner can adjust, or nil.
+func smartOf(d Dispatcher) *SmartDispatcher {
+	switch d := d.(type) {
+	case *SmartDispatcher:
+		return d
+	case *LPDispatcher:
+		return &d.SmartDispatcher
+	case *MultiPeriodLPDispatcher:
+		return &d.SmartDispatcher
+	}
+	return nil
+}
+
+// smartDispatcher returns a SmartDispatcher with the configured SoC
+// constraints and weights.
+func (c Config) smartDispatcher(log logger.Logger) SmartDispatcher {
+	d := NewSmartDispatcher()
+	d.EnableSoCConstraints = c.EnableSoCConstraints
+	d.MinSoC = c.MinSoC
+	d.SafeDischargeFloor = c.SafeDischargeFloor
+	d.Logger = log
+	applyWeights(&d, c.Strategy.Weights)
+	return d
+}
+
+func strategyName(name, def string) string {
+	if name == "" {
+		return def
+	}
+	return name
+}
+
+func registered[F any](kind, name string, m map[string]F) (F, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	f, ok := m[name]
+	if !ok {
+		names := make([]string, 0, len(m))
+		for n := range m {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return f, fmt.Errorf("unknown %s %q (available: %v)", kind, name, names)
+	}
+	return f, nil
+}
+
+// Validate checks the dispatch configuration and rejects unknown strategies
+// and combinations the manager cannot honour.
+//
+//gocyclo:ignore
+func (c Config) Validate() error {
+	if c.MinSoC < 0 || c.MinSoC > 1 {
+		return fmt.Errorf("dispatch.min_soc must be between 0 and 1")
+	}
+	if c.SafeDischargeFloor < 0 || c.SafeDischargeFloor > 1 {
+		return fmt.Errorf("dispatch.safe_discharge_floor must be between 0 and 1")
+	}
+	if c.Droop.Mode != "" && c.Droop.Mode != DroopCentral && c.Droop.Mode != DroopLocal {
+		return fmt.Errorf("dispatch.droop.mode must be %s or %s", DroopCentral, DroopLocal)
+	}
+	if err := c.History.Validate(); err != nil {
+		return err
+	}
+	if err := c.Participation.Validate(); err != nil {
+		return err
+	}
+	if err := c.Breaker.Validate(); err != nil {
+		return err
+	}
+	s := c.Strategy
+	disp := strategyName(s.Dispatcher, DefaultDispatcher)
+	if s.SlotMinutes < 0 || s.HorizonMinutes < 0 {
+		return fmt.Errorf("dispatch.strategy slot and horizon must not be negative")
+	}
+	if disp == DefaultDispatcher || disp == "segmented" {
+		for t, on := range c.LPFirst {
+			if on {
+				return fmt.Errorf("dispatch.lp_first for %s requires a smart or lp dispatcher, not %s", t, disp)
+			}
+		}
+		if len(s.Weights) > 0 {
+			return fmt.Errorf("dispatch.strategy.weights are not used by the %s dispatcher", disp)
+		}
+	}
+	for name, seg := range c.Segments {
+		if seg.DispatcherType != "" && seg.DispatcherType != "heuristic" && seg.DispatcherType != "lp" {
+			return fmt.Errorf("dispatch.segments.%s: unknown dispatcher_type %s", name, seg.DispatcherType)
+		}
+		if seg.QuotaKW < 0 {
+			return fmt.Errorf("dispatch.segments.%s: quota_kw must not be negative", name)
+		}
+	}
+	return c.checkStrategies()
+}
+
+// checkStrategies rejects unknown strategy names and runs the parameter checks
+// of the selected strategies without building them.
+func (c Config) checkStrategies() error {
+	s := c.Strategy
+	selected := []struct{ kind, name string }{
+		{"filter", strategyName(s.Filter, DefaultFilter)},
+		{"dispatcher", strategyName(s.Dispatcher, DefaultDispatcher)},
+		{"fallback", strategyName(s.Fallback, DefaultFallback)},
+		{"tuner", strategyName(s.Tuner, NoStrategy)},
+		{"prediction", strategyName(s.Prediction, NoStrategy)},
+	}
+	for _, sel := range selected {
+		if err := knownStrategy(sel.kind, sel.name); err != nil {
+			return err
+		}
+		registryMu.RLock()
+		check := checks[sel.kind+"/"+sel.name]
+		registryMu.RUnlock()
+		if check == nil {
+			continue
+		}
+		if err := check(c); err != nil {
+			return fmt.Errorf("%s: %w", sel.kind, err)
+		}
+	}
+	return nil
+}
+
+// knownStrategy returns an error listing the available strategies when none
+// of the kind is registered under name.
+func knownStrategy(kind, name string) error {
+	var err error
+	switch kind {
+	case "filter":
+		_, err = registered(kind, name, filters)
+	case "dispatcher":
+		_, err = registered(kind, name, dispatchers)
+	case "fallback":
+		_, err = registered(kind, name, fallbacks)
+	case "tuner":
+		_, err = registered(kind, name, tuners)
+	case "prediction":
+		_, err = registered(kind, name, predictions)
+	}
+	return err
+}
+
+// BuildStrategies creates the filter, dispatcher, fallback, tuner and
+// prediction engine selected by c.Strategy.
+func (c Config) BuildStrategies(log logger.Logger) (Strategies, error) {
+	return c.buildStrategies(log, nil)
+}
+
+// buildStrategies is BuildStrategies keeping prev as the tuner when it is a
+// ReusableTuner accepting the configuration.
+func (c Config) buildStrategies(log logger.Logger, prev LearningTuner) (Strategies, error) {
+	s := c.Strategy
+	var res Strategies
+	ff, err := registered("filter", strategyName(s.Filter, DefaultFilter), filters)
+	if err != nil {
+		return res, err
+	}
+	if res.Filter, err = ff(c); err != nil {
+		return res, fmt.Errorf("filter: %w", err)
+	}
+	df, err := registered("dispatcher", strategyName(s.Dispatcher, DefaultDispatcher), dispatchers)
+	if err != nil {
+		return res, err
+	}
+	if res.Dispatcher, err = df(c, log); err != nil {
+		return res, fmt.Errorf("dispatcher: %w", err)
+	}
+	fb, err := registered("fallback", strategyName(s.Fallback, DefaultFallback), fallbacks)
+	if err != nil {
+		return res, err
+	}
+	if res.Fallback, err = fb(c, log); err != nil {
+		return res, fmt.Errorf("fallback: %w", err)
+	}
+	pf, err := registered("prediction", strategyName(s.Prediction, NoStrategy), predictions)
+	if err != nil {
+		return res, err
+	}
+	if res.Prediction, err = pf(c); err != nil {
+		return res, fmt.Errorf("prediction: %w", err)
+	}
+	tf, err := registered("tuner", strategyName(s.Tuner, NoStrategy), tuners)
+	if err != nil {
+		return res, err
+	}
+	// The tuner comes last so that prev is only rebound once the other
+	// strategies were built.
+	if rt, ok := prev.(ReusableTuner); ok && rt.Reuse(c, res.Dispatcher) {
+		res.Tuner = prev
+	} else if res.Tuner, err = tf(c, res.Dispatcher); err != nil {
+		return res, fmt.Errorf("tuner: %w", err)
+	}
+	return res, nil
+}
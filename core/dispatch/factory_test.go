@@ -0,0 +1,105 @@
+package dispatch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+)
+
+func TestBuildStrategies_Defaults(t *testing.T) {
+	s, err := Config{}.BuildStrategies(logger.NopLogger{})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if _, ok := s.Dispatcher.(EqualDispatcher); !ok {
+		t.Fatalf("expected equal dispatcher, got %T", s.Dispatcher)
+	}
+	if _, ok := s.Fallback.(NoopFallback); !ok {
+		t.Fatalf("expected noop fallback, got %T", s.Fallback)
+	}
+	if s.Tuner != nil || s.Prediction != nil {
+		t.Fatalf("expected no tuner nor prediction")
+	}
+}
+
+func TestBuildStrategies_Configured(t *testing.T) {
+	cfg := Config{
+		EnableSoCConstraints: true,
+		MinSoC:               0.2,
+		Strategy: StrategyConfig{
+			Dispatcher:   "lp",
+			Fallback:     "balanced",
+			Tuner:        "ack",
+			Prediction:   "static",
+			Weights:      map[string]float64{"availability": 0.4},
+			Availability: map[string]float64{"v1": 0.5},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	s, err := cfg.BuildStrategies(logger.NopLogger{})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	lp, ok := s.Dispatcher.(*LPDispatcher)
+	if !ok {
+		t.Fatalf("expected lp dispatcher, got %T", s.Dispatcher)
+	}
+	if lp.MinSoC != 0.2 || lp.AvailabilityWeight != 0.4 {
+		t.Fatalf("dispatcher not parameterised: %+v", lp.SmartDispatcher)
+	}
+	tuner, ok := s.Tuner.(*AckBasedTuner)
+	if !ok || tuner.Dispatcher != &lp.SmartDispatcher {
+		t.Fatalf("expected ack tuner bound to the lp dispatcher")
+	}
+	if _, ok := s.Fallback.(*BalancedFallback); !ok {
+		t.Fatalf("expected balanced fallback, got %T", s.Fallback)
+	}
+	if p := s.Prediction.PredictAvailability("v1", time.Now()); p != 0.5 {
+		t.Fatalf("expected static availability, got %v", p)
+	}
+}
+
+func TestConfigValidate_RejectsInvalidCombinations(t *testing.T) {
+	cases := map[string]Config{
+		"unknown dispatcher": {Strategy: StrategyConfig{Dispatcher: "magic"}},
+		"unknown fallback":   {Strategy: StrategyConfig{Fallback: "magic"}},
+		"ack on equal":       {Strategy: StrategyConfig{Tuner: "ack"}},
+		"lp_first on equal":  {LPFirst: map[model.SignalType]bool{model.SignalFCR: true}},
+		"weights on equal":   {Strategy: StrategyConfig{Weights: map[string]float64{"soc": 1}}},
+		"bad availability":   {Strategy: StrategyConfig{Prediction: "static", Availability: map[string]float64{"v1": 2}}},
+		"bandit on equal":    {Strategy: StrategyConfig{Tuner: "bandit"}},
+		"bad bandit":         {Strategy: StrategyConfig{Dispatcher: "smart", Tuner: "bandit", Bandit: BanditTunerConfig{Smoothing: 2}}},
+		"bad ack steps":      {Strategy: StrategyConfig{Dispatcher: "smart", Tuner: "ack", AckTuner: AckTunerConfig{IncreaseStep: -1}}},
+		"bad min soc":        {MinSoC: 1.5},
+	}
+	for name, cfg := range cases {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	err := Config{Strategy: StrategyConfig{Dispatcher: "magic"}}.Validate()
+	if err == nil || !strings.Contains(err.Error(), "segmented") {
+		t.Fatalf("expected available dispatchers in error, got %v", err)
+	}
+}
+
+func TestConfigValidate_DoesNotBuildStrategies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bandit.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cfg := Config{Strategy: StrategyConfig{Dispatcher: "smart", Tuner: "bandit", Bandit: BanditTunerConfig{StatePath: path}}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected validation not to read the tuner state, got %v", err)
+	}
+	if _, err := cfg.BuildStrategies(logger.NopLogger{}); err == nil {
+		t.Fatalf("expected building the tuner to read its state")
+	}
+}
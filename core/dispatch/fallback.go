@@ -14,3 +14,11 @@ func (NoopFallback) Reallocate(failed []model.Vehicle, current map[string]float6
 type VehicleAwareFallback interface {
 	SetVehicles([]model.Vehicle)
 }
+
+// DeficitFallback can also reallocate power that no failed vehicle held, such
+// as the power partially accepting vehicles did not apply. deficit is a
+// magnitude in kW, reallocated in the direction of the signal together with
+// the power of the failed vehicles.
+type DeficitFallback interface {
+	ReallocateDeficit(failed []model.Vehicle, current map[string]float64, deficit float64, signal model.FlexibilitySignal) map[string]float64
+}
@@ -0,0 +1,246 @@
+package dispatch
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/kilianp07/v2g/core/dispatch/logging"
+	"github.com/kilianp07/v2g/core/metrics"
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/core/mqtt"
+)
+
+// DefaultFallbackRounds is the number of fallback rounds published after the
+// initial dispatch when none is configured.
+const DefaultFallbackRounds = 1
+
+// SetFallbackRounds configures how many fallback rounds are published after
+// the initial dispatch. Zero or a negative value only computes the fallback
+// assignments without sending them.
+func (m *DispatchManager) SetFallbackRounds(n int) {
+	if n < 0 {
+		n = 0
+	}
+	m.mu.Lock()
+	m.fallbackRounds = n
+	m.mu.Unlock()
+}
+
+func (m *DispatchManager) fallbackRoundCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fallbackRounds
+}
+
+// runFallbackRounds reallocates the power of the failed vehicles, and the
+// power partially accepting vehicles did not apply, and publishes the changed
+// setpoints. Vehicles failing during a round are reallocated in the next one,
+// up to the configured number of rounds. The final allocation is stored in
+// res.FallbackAssignments.
+func (m *DispatchManager) runFallbackRounds(res *DispatchResult, filtered []model.Vehicle, failed []model.Vehicle) {
+	byID := make(map[string]model.Vehicle, len(filtered))
+	for _, v := range filtered {
+		byID[v.ID] = v
+	}
+	current := make(map[string]float64, len(res.Assignments))
+	for id, p := range res.Assignments {
+		current[id] = p
+	}
+	excluded := make(map[string]struct{})
+	maxRounds := m.fallbackRoundCount()
+	pool := filtered
+	partial := partialApplied(*res)
+	errs := res.Errors
+
+	for n := 1; len(failed) > 0 || len(partial) > 0; n++ {
+		var deficit float64
+		pool, deficit = capPartial(partial, current, pool)
+		if va, ok := m.fallback.(VehicleAwareFallback); ok && deficit > 0 {
+			va.SetVehicles(pool)
+		}
+		realloc := m.reallocate(failed, current, deficit, res.Signal, pool)
+		failedIDs := make(map[string]struct{}, len(failed))
+		for _, v := range failed {
+			failedIDs[v.ID] = struct{}{}
+			excluded[v.ID] = struct{}{}
+		}
+		res.FallbackAssignments = make(map[string]float64, len(realloc)+len(excluded))
+		for id, p := range realloc {
+			res.FallbackAssignments[id] = p
+		}
+		for id := range excluded {
+			res.FallbackAssignments[id] = 0
+		}
+		if n > maxRounds {
+			return
+		}
+
+		round := newDispatchResult(res.Signal)
+		round.MarketPrice = res.MarketPrice
+		round.commitment = res.commitment
+		for id, p := range realloc {
+			if _, ok := failedIDs[id]; ok {
+				continue
+			}
+			if math.Abs(p-current[id]) > 1e-6 {
+				round.Assignments[id] = p
+				round.Scores[id] = res.Scores[id]
+			}
+		}
+		current = make(map[string]float64, len(realloc))
+		for id, p := range realloc {
+			if _, ok := excluded[id]; !ok {
+				current[id] = p
+			}
+		}
+		if len(round.Assignments) == 0 {
+			return
+		}
+		m.dropQueued(failed, errs)
+
+		m.logger.Infof("fallback round %d: publishing %d orders", n, len(round.Assignments))
+		lr, recordLatency := m.metrics.(metrics.LatencyRecorder)
+		lat := m.dispatchAssignments(&round, res.Signal, recordLatency)
+
+		failed = nil
+		var delivered float64
+		for id, p := range round.Assignments {
+			fallbackOrders.WithLabelValues(res.Signal.Type.String(), strconv.FormatBool(round.Acknowledged[id])).Inc()
+			if !round.Acknowledged[id] {
+				failed = append(failed, byID[id])
+			}
+			m.recordFallback(res.Signal, id, p, n)
+		}
+		for id, p := range current {
+			if _, sent := round.Assignments[id]; sent {
+				if !round.Acknowledged[id] {
+					continue
+				}
+				p = round.AppliedPower(id)
+			}
+			delivered += p
+		}
+		partial = partialApplied(round)
+		errs = round.Errors
+		res.FallbackRounds = append(res.FallbackRounds, FallbackRound{
+			Round:        n,
+			Assignments:  round.Assignments,
+			Acknowledged: round.Acknowledged,
+			Applied:      round.Applied,
+			Errors:       round.Errors,
+			DeficitKW:    shortfall(res.Signal.PowerKW, delivered),
+		})
+		m.recordMetrics(round, lat, lr, recordLatency)
+	}
+}
+
+// shortfall returns the magnitude of the power missing to deliver target, zero
+// when delivered meets or exceeds it.
+func shortfall(target, delivered float64) float64 {
+	if target < 0 {
+		target, delivered = -target, -delivered
+	}
+	return math.Max(0, target-delivered)
+}
+
+// dropQueued drops the orders the client queued for the failed vehicles, whose
+// power the fallback round reallocates, so that delivering them later does
+// not over-deliver.
+func (m *DispatchManager) dropQueued(failed []model.Vehicle, errs map[string]error) {
+	qc, ok := m.publisher.(mqtt.QueueingClient)
+	if !ok {
+		return
+	}
+	for _, v := range failed {
+		if !errors.Is(errs[v.ID], mqtt.ErrOrderQueued) {
+			continue
+		}
+		if err := qc.DropQueued(v.ID); err != nil {
+			m.logger.Errorf("drop queued order of %s: %v", v.ID, err)
+		}
+	}
+}
+
+// partialApplied returns the power applied by the vehicles of the result that
+// acknowledged only part of their setpoint.
+func partialApplied(res DispatchResult) map[string]float64 {
+	partial := make(map[string]float64)
+	for id, p := range res.Assignments {
+		applied, ok := res.Applied[id]
+		if ok && res.Acknowledged[id] && math.Abs(applied-p) > 1e-6 {
+			partial[id] = applied
+		}
+	}
+	return partial
+}
+
+// capPartial lowers the allocation of the partially accepting vehicles in
+// current to the power they applied and returns the power they left missing,
+// for the fallback to reallocate. The returned pool caps those vehicles at the
+// power they applied so that the fallback does not hand them more.
+func capPartial(partial map[string]float64, current map[string]float64, pool []model.Vehicle) ([]model.Vehicle, float64) {
+	if len(partial) == 0 {
+		return pool, 0
+	}
+	capped := make([]model.Vehicle, len(pool))
+	copy(capped, pool)
+	for i, v := range capped {
+		if applied, ok := partial[v.ID]; ok {
+			capped[i].MaxPower = math.Min(v.MaxPower, math.Abs(applied))
+		}
+	}
+	var deficit float64
+	for id, applied := range partial {
+		deficit += math.Max(0, math.Abs(current[id])-math.Abs(applied))
+		current[id] = applied
+	}
+	return capped, deficit
+}
+
+// recordFallback forwards a fallback order to the metrics sink when supported.
+func (m *DispatchManager) recordFallback(signal model.FlexibilitySignal, vehicleID string, power float64, round int) {
+	rec, ok := m.metrics.(metrics.FallbackRecorder)
+	if !ok {
+		return
+	}
+	if err := rec.RecordFallback(metrics.FallbackEvent{
+		VehicleID:     vehicleID,
+		Signal:        signal.Type,
+		Reason:        "ack_failure",
+		ResidualPower: power,
+		Round:         round,
+		Time:          time.Now(),
+	}); err != nil {
+		m.logger.Errorf("fallback metrics error: %v", err)
+	}
+}
+
+// logFallbackRounds converts the fallback rounds for the log store.
+func logFallbackRounds(rounds []FallbackRound) []logging.FallbackRound {
+	if len(rounds) == 0 {
+		return nil
+	}
+	res := make([]logging.FallbackRound, 0, len(rounds))
+	for _, r := range rounds {
+		lr := logging.FallbackRound{
+			Round:        r.Round,
+			Assignments:  r.Assignments,
+			Acknowledged: r.Acknowledged,
+			Applied:      r.Applied,
+			DeficitKW:    r.DeficitKW,
+		}
+		for id, err := range r.Errors {
+			if err == nil {
+				continue
+			}
+			if lr.Errors == nil {
+				lr.Errors = make(map[string]string)
+			}
+			lr.Errors[id] = err.Error()
+		}
+		res = append(res, lr)
+	}
+	return res
+}
@@ -0,0 +1,152 @@
+package dispatch
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+func fallbackRoundVehicles() []model.Vehicle {
+	return []model.Vehicle{
+		{ID: "v1", IsV2G: true, Available: true, MaxPower: 20, SoC: 0.8, BatteryKWh: 50},
+		{ID: "v2", IsV2G: true, Available: true, MaxPower: 20, SoC: 0.8, BatteryKWh: 50},
+		{ID: "v3", IsV2G: true, Available: true, MaxPower: 20, SoC: 0.8, BatteryKWh: 50},
+	}
+}
+
+func TestDispatch_PublishesFallbackRound(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	pub.FailIDs["v1"] = true
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NewBalancedFallback(logger.NopLogger{}), pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 30, Timestamp: time.Now()}
+	res := mgr.Dispatch(sig, fallbackRoundVehicles())
+
+	if len(res.FallbackRounds) != 1 {
+		t.Fatalf("expected one fallback round, got %d", len(res.FallbackRounds))
+	}
+	round := res.FallbackRounds[0]
+	for _, id := range []string{"v2", "v3"} {
+		if !round.Acknowledged[id] {
+			t.Errorf("expected %s to acknowledge the fallback order", id)
+		}
+	}
+	if total := pub.Messages["v2"] + pub.Messages["v3"]; math.Abs(total-30) > 1e-6 {
+		t.Errorf("expected 30 kW published to v2 and v3, got %v", total)
+	}
+	if round.DeficitKW > 1e-6 {
+		t.Errorf("expected no deficit, got %v", round.DeficitKW)
+	}
+	if p, ok := res.FallbackAssignments["v1"]; !ok || p != 0 {
+		t.Errorf("expected v1 fallback assignment to be zero, got %v", p)
+	}
+}
+
+func TestDispatch_FallbackRoundsDisabled(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	pub.FailIDs["v1"] = true
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NewBalancedFallback(logger.NopLogger{}), pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	mgr.SetFallbackRounds(0)
+	sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 30, Timestamp: time.Now()}
+	res := mgr.Dispatch(sig, fallbackRoundVehicles())
+
+	if len(res.FallbackRounds) != 0 {
+		t.Fatalf("expected no fallback rounds, got %d", len(res.FallbackRounds))
+	}
+	if pub.Messages["v2"] != 10 {
+		t.Fatalf("expected initial setpoint to be kept, got %v", pub.Messages["v2"])
+	}
+	if res.FallbackAssignments["v2"] <= 10 {
+		t.Fatalf("expected fallback assignment to be computed, got %v", res.FallbackAssignments["v2"])
+	}
+}
+
+func TestDispatch_PartialAckResidualIsReallocated(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	pub.AppliedKW["v1"] = 4
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NewBalancedFallback(logger.NopLogger{}), pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 30, Timestamp: time.Now()}
+	res := mgr.Dispatch(sig, fallbackRoundVehicles())
+
+	if !res.Acknowledged["v1"] || res.Applied["v1"] != 4 || res.AppliedPower("v2") != 10 {
+		t.Fatalf("expected v1 to apply 4 kW, got %v %v", res.Acknowledged["v1"], res.Applied)
+	}
+	if len(res.FallbackRounds) != 1 {
+		t.Fatalf("expected one fallback round, got %d", len(res.FallbackRounds))
+	}
+	if _, resent := res.FallbackRounds[0].Assignments["v1"]; resent {
+		t.Errorf("expected v1 to keep its applied setpoint")
+	}
+	if total := pub.Messages["v2"] + pub.Messages["v3"]; math.Abs(total-26) > 1e-6 {
+		t.Errorf("expected the 6 kW residual on v2 and v3, got %v", total)
+	}
+	if d := res.FallbackRounds[0].DeficitKW; math.Abs(d) > 1e-6 {
+		t.Errorf("expected no deficit, got %v", d)
+	}
+	for id := range res.FallbackAssignments {
+		if id != "v1" && id != "v2" && id != "v3" {
+			t.Errorf("unexpected fallback assignment for %s", id)
+		}
+	}
+}
+
+func TestShortfall(t *testing.T) {
+	cases := []struct{ target, delivered, want float64 }{
+		{30, 20, 10},
+		{30, 35, 0},
+		{-50, -40, 10},
+		{-50, -60, 0},
+		{-50, 5, 55},
+	}
+	for _, c := range cases {
+		if got := shortfall(c.target, c.delivered); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("shortfall(%v, %v) = %v, want %v", c.target, c.delivered, got, c.want)
+		}
+	}
+}
+
+func TestDispatch_FallbackDropsQueuedOrders(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	pub.QueueIDs["v1"] = true
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NewBalancedFallback(logger.NopLogger{}), pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 30, Timestamp: time.Now()}
+	res := mgr.Dispatch(sig, fallbackRoundVehicles())
+
+	if len(res.FallbackRounds) != 1 {
+		t.Fatalf("expected the queued order reallocated, got %d rounds", len(res.FallbackRounds))
+	}
+	if p, queued := pub.Queued["v1"]; queued {
+		t.Fatalf("expected the queued %v kW order dropped once reallocated", p)
+	}
+}
+
+func TestDispatch_QueuedOrderKeptWithoutFallbackRound(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	pub.QueueIDs["v1"] = true
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NewBalancedFallback(logger.NopLogger{}), pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	mgr.SetFallbackRounds(0)
+	sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 30, Timestamp: time.Now()}
+	mgr.Dispatch(sig, fallbackRoundVehicles())
+
+	if _, queued := pub.Queued["v1"]; !queued {
+		t.Fatalf("expected the queued order kept when nothing is reallocated")
+	}
+}
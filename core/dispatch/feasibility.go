@@ -0,0 +1,81 @@
+package dispatch
+
+import (
+	"math"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+)
+
+// energyLimitKW returns the largest power v can inject for the whole signal
+// and still recharge to its MinSoC before departure. Signals that do not
+// discharge the battery are not limited.
+func energyLimitKW(v model.Vehicle, signal model.FlexibilitySignal) float64 {
+	if signal.PowerKW <= 0 {
+		return math.Inf(1)
+	}
+	start := signal.Timestamp
+	if start.IsZero() {
+		start = time.Now()
+	}
+	energy := v.DischargeableKWh(start, signal.Duration)
+	if signal.Duration <= 0 || math.IsInf(energy, 1) {
+		if energy > 0 {
+			return math.Inf(1)
+		}
+		return 0
+	}
+	return energy / signal.Duration.Hours()
+}
+
+// energyLimited reports whether the energy limit of v is below its MaxPower.
+func energyLimited(v model.Vehicle, signal model.FlexibilitySignal) bool {
+	return energyLimitKW(v, signal) < v.MaxPower
+}
+
+// energyRoom returns the power v can inject on top of current without
+// exceeding its energy limit.
+func energyRoom(v model.Vehicle, signal model.FlexibilitySignal, current float64) float64 {
+	return math.Max(0, energyLimitKW(v, signal)-math.Max(0, current))
+}
+
+// enforceEnergyLimits caps each setpoint to the energy limit of its vehicle so
+// that no dispatcher or fallback can leave a vehicle unable to reach MinSoC at
+// departure. It returns the power removed.
+func enforceEnergyLimits(vehicles []model.Vehicle, signal model.FlexibilitySignal, assignments map[string]float64) float64 {
+	if signal.PowerKW <= 0 {
+		return 0
+	}
+	var removed float64
+	for _, v := range vehicles {
+		p, ok := assignments[v.ID]
+		if !ok || p <= 0 {
+			continue
+		}
+		limit := energyLimitKW(v, signal)
+		if p <= limit+constraintEps {
+			continue
+		}
+		capped := limit
+		if r, ok := rangeFor(v, signal); ok {
+			capped = math.Min(limit, r.floor(limit))
+		}
+		assignments[v.ID] = capped
+		removed += p - capped
+	}
+	return removed
+}
+
+// reallocate runs the fallback strategy and caps the reallocation to the
+// energy limits of the vehicles. The deficit, power no failed vehicle held, is
+// only reallocated by strategies implementing DeficitFallback.
+func (m *DispatchManager) reallocate(failed []model.Vehicle, current map[string]float64, deficit float64, signal model.FlexibilitySignal, vehicles []model.Vehicle) map[string]float64 {
+	var realloc map[string]float64
+	if df, ok := m.fallback.(DeficitFallback); ok && deficit > 0 {
+		realloc = df.ReallocateDeficit(failed, current, deficit, signal)
+	} else {
+		realloc = m.fallback.Reallocate(failed, current, signal)
+	}
+	enforceEnergyLimits(vehicles, signal, realloc)
+	return realloc
+}
@@ -0,0 +1,75 @@
+package dispatch
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+// tight can deliver 4 kWh above MinSoC and leaves right after the signal.
+func feasibilityVehicles(now time.Time) []model.Vehicle {
+	return []model.Vehicle{
+		{ID: "tight", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.5, MinSoC: 0.4, BatteryKWh: 40, Departure: now.Add(time.Hour)},
+		{ID: "free", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.9, MinSoC: 0.1, BatteryKWh: 40},
+	}
+}
+
+func TestDispatchers_RespectEnergyLimit(t *testing.T) {
+	now := time.Now()
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 12, Duration: time.Hour, Timestamp: now}
+	sd := NewSmartDispatcher()
+	lp := NewLPDispatcher()
+	for name, d := range map[string]Dispatcher{"equal": EqualDispatcher{}, "smart": &sd, "lp": &lp} {
+		asn := d.Dispatch(feasibilityVehicles(now), sig)
+		if asn["tight"] > 4+1e-6 {
+			t.Fatalf("%s: tight vehicle assigned %v kW over its 4 kW limit", name, asn["tight"])
+		}
+		if math.Abs(asn["tight"]+asn["free"]-12) > 1e-3 {
+			t.Fatalf("%s: expected the free vehicle to take the rest: %v", name, asn)
+		}
+	}
+}
+
+func TestFallback_RespectsEnergyLimit(t *testing.T) {
+	now := time.Now()
+	vehicles := feasibilityVehicles(now)
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 10, Duration: time.Hour, Timestamp: now}
+	fb := NewBalancedFallback(logger.NopLogger{})
+	fb.SetVehicles(vehicles)
+	res := fb.Reallocate(vehicles[1:], map[string]float64{"tight": 2, "free": 8}, sig)
+	if res["tight"] > 4+1e-6 {
+		t.Fatalf("fallback exceeded the energy limit: %v", res)
+	}
+}
+
+func TestManager_EnforcesEnergyLimit(t *testing.T) {
+	now := time.Now()
+	pub := mqtt.NewMockPublisher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, stubDispatcher{"tight": 10}, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 10, Duration: time.Hour, Timestamp: now}
+	res := mgr.Dispatch(sig, feasibilityVehicles(now))
+	if p := res.Assignments["tight"]; math.Abs(p-4) > 1e-6 {
+		t.Fatalf("expected the setpoint capped to 4 kW, got %v", p)
+	}
+	if p, _ := pub.Setpoint("tight"); math.Abs(p-4) > 1e-6 {
+		t.Fatalf("expected the capped setpoint sent, got %v", p)
+	}
+}
+
+// stubDispatcher returns fixed assignments regardless of the fleet.
+type stubDispatcher map[string]float64
+
+func (s stubDispatcher) Dispatch([]model.Vehicle, model.FlexibilitySignal) map[string]float64 {
+	res := make(map[string]float64, len(s))
+	for id, p := range s {
+		res[id] = p
+	}
+	return res
+}
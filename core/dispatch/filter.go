@@ -8,21 +8,30 @@ type SimpleVehicleFilter struct{}
 func (f SimpleVehicleFilter) Filter(vehicles []model.Vehicle, signal model.FlexibilitySignal) []model.Vehicle {
 	var res []model.Vehicle
 	for _, v := range vehicles {
-		if !v.Available {
-			continue
-		}
-		switch signal.Type {
-		case model.SignalFCR:
-			if v.IsV2G && v.SoC >= 0.6 {
-				res = append(res, v)
-			}
-		case model.SignalNEBEF:
-			if v.CanReduceCharge() {
-				res = append(res, v)
-			}
-		default:
+		if f.Reason(v, signal) == "" {
 			res = append(res, v)
 		}
 	}
 	return res
 }
+
+// Reason implements ExplainingFilter.
+func (f SimpleVehicleFilter) Reason(v model.Vehicle, signal model.FlexibilitySignal) string {
+	if !v.Available {
+		return ReasonUnavailable
+	}
+	switch signal.Type {
+	case model.SignalFCR:
+		if !v.IsV2G {
+			return ReasonNotV2G
+		}
+		if v.SoC < 0.6 {
+			return ReasonSoCBelowThreshold
+		}
+	case model.SignalNEBEF:
+		if !v.CanReduceCharge() {
+			return ReasonCannotReduceCharge
+		}
+	}
+	return ""
+}
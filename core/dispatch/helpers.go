@@ -1,6 +1,10 @@
 package dispatch
 
-import "github.com/kilianp07/v2g/core/model"
+import (
+	"math"
+
+	"github.com/kilianp07/v2g/core/model"
+)
 
 // availableEnergyAndCapacity returns the usable energy above the minimum SoC and
 // the maximum dispatchable power for the given vehicle. When useFloor is true
@@ -31,15 +35,32 @@ func availableEnergyAndCapacity(v model.Vehicle, signal model.FlexibilitySignal,
 }
 
 // prepareVehicles filters vehicles with positive energy capacity and power
-// capability and returns candidate structs with their score and capacity.
+// capability and returns candidate structs with their score and capacity. The
+// capacity is limited to the power the vehicle can ramp to and min holds the
+// power it cannot ramp below.
 func prepareVehicles(vehicles []model.Vehicle, signal model.FlexibilitySignal, ctx *DispatchContext, scorer func(model.Vehicle, *DispatchContext) float64, useFloor bool, floor float64) []candidate {
 	var list []candidate
 	for _, v := range vehicles {
-		_, cap := availableEnergyAndCapacity(v, signal, useFloor, floor)
-		if cap <= 0 {
+		cap, min, ok := candidateCapacity(v, signal, useFloor, floor)
+		if !ok {
 			continue
 		}
-		list = append(list, candidate{v: v, score: scorer(v, ctx), capacity: cap})
+		list = append(list, candidate{v: v, score: scorer(v, ctx), capacity: cap, min: min})
 	}
 	return list
 }
+
+// candidateCapacity returns the power a vehicle can provide for the signal and
+// the power it cannot ramp below. ok is false when it can provide none.
+func candidateCapacity(v model.Vehicle, signal model.FlexibilitySignal, useFloor bool, floor float64) (cap, min float64, ok bool) {
+	_, cap = availableEnergyAndCapacity(v, signal, useFloor, floor)
+	r, ok := rangeFor(v, signal)
+	if !ok {
+		return 0, 0, false
+	}
+	cap = math.Min(cap, r.hi)
+	if cap <= 0 {
+		return 0, 0, false
+	}
+	return cap, math.Min(r.lo, cap), true
+}
@@ -0,0 +1,210 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kilianp07/v2g/core/dispatch/logging"
+	coremqtt "github.com/kilianp07/v2g/core/mqtt"
+)
+
+// DefaultHistoryEntries bounds the dispatch history when no window is
+// configured.
+const DefaultHistoryEntries = 1000
+
+// HistoryConfig bounds the dispatch history kept by the manager. Results are
+// dropped once more than MaxEntries are kept or when they are older than
+// MaxAgeMinutes. Zero values keep DefaultHistoryEntries results of any age.
+type HistoryConfig struct {
+	MaxEntries    int `json:"max_entries"`
+	MaxAgeMinutes int `json:"max_age_minutes"`
+}
+
+// Validate checks the history window.
+func (c HistoryConfig) Validate() error {
+	if c.MaxEntries < 0 || c.MaxAgeMinutes < 0 {
+		return errors.New("dispatch.history window must not be negative")
+	}
+	return nil
+}
+
+// History gives access to the results of past dispatches, oldest first.
+type History interface {
+	Append(res DispatchResult)
+	// Recent returns the last n results, or all of them when n <= 0.
+	Recent(n int) []DispatchResult
+	// Since returns the results recorded at or after t.
+	Since(t time.Time) []DispatchResult
+	Len() int
+}
+
+type historyEntry struct {
+	at  time.Time
+	res DispatchResult
+}
+
+// MemoryHistory keeps the dispatch results of a bounded window in memory.
+type MemoryHistory struct {
+	maxEntries int
+	maxAge     time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries []historyEntry
+}
+
+// NewMemoryHistory returns an empty history bounded by cfg.
+func NewMemoryHistory(cfg HistoryConfig) *MemoryHistory {
+	h := &MemoryHistory{now: time.Now}
+	h.maxEntries, h.maxAge = cfg.bounds()
+	return h
+}
+
+// bounds returns the number of results and the age the window keeps.
+func (c HistoryConfig) bounds() (int, time.Duration) {
+	n := c.MaxEntries
+	if n <= 0 {
+		n = DefaultHistoryEntries
+	}
+	return n, time.Duration(c.MaxAgeMinutes) * time.Minute
+}
+
+// SetBounds changes the window of the history. Results already dropped are
+// not restored when it grows.
+func (h *MemoryHistory) SetBounds(cfg HistoryConfig) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxEntries, h.maxAge = cfg.bounds()
+	h.trim()
+}
+
+// LoadHistory returns a history bounded by cfg and seeded with the latest
+// dispatches the log store recorded within the window, so that tuners and
+// KPIs keep their history across restarts. Session and droop rounds are left
+// out since they only carry the setpoints they changed.
+func LoadHistory(ctx context.Context, store logging.LogStore, cfg HistoryConfig) (*MemoryHistory, error) {
+	h := NewMemoryHistory(cfg)
+	if store == nil {
+		return h, nil
+	}
+	q := logging.LogQuery{SkipRounds: true, Limit: h.maxEntries}
+	if h.maxAge > 0 {
+		q.Start = h.now().Add(-h.maxAge)
+	}
+	recs, err := store.Query(ctx, q)
+	if err != nil {
+		return h, err
+	}
+	for _, rec := range recs {
+		h.entries = append(h.entries, historyEntry{at: rec.Timestamp, res: resultFromLog(rec)})
+	}
+	return h, nil
+}
+
+// Append implements History.
+func (h *MemoryHistory) Append(res DispatchResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, historyEntry{at: h.now(), res: res})
+	h.trim()
+}
+
+// Recent implements History.
+func (h *MemoryHistory) Recent(n int) []DispatchResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.trim()
+	start := 0
+	if n > 0 && n < len(h.entries) {
+		start = len(h.entries) - n
+	}
+	return results(h.entries[start:])
+}
+
+// Since implements History.
+func (h *MemoryHistory) Since(t time.Time) []DispatchResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.trim()
+	start := len(h.entries)
+	for start > 0 && !h.entries[start-1].at.Before(t) {
+		start--
+	}
+	return results(h.entries[start:])
+}
+
+// Len implements History.
+func (h *MemoryHistory) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.trim()
+	return len(h.entries)
+}
+
+// trim drops the results outside the window. h.mu must be held.
+func (h *MemoryHistory) trim() {
+	drop := max(len(h.entries)-h.maxEntries, 0)
+	if h.maxAge > 0 {
+		cutoff := h.now().Add(-h.maxAge)
+		for drop < len(h.entries) && h.entries[drop].at.Before(cutoff) {
+			drop++
+		}
+	}
+	if drop == 0 {
+		return
+	}
+	// Copy so the dropped results can be collected.
+	h.entries = append([]historyEntry(nil), h.entries[drop:]...)
+}
+
+func results(entries []historyEntry) []DispatchResult {
+	res := make([]DispatchResult, len(entries))
+	for i, e := range entries {
+		res[i] = e.res
+	}
+	return res
+}
+
+// resultFromLog rebuilds the dispatch result a log record was written from.
+// Errors are restored as messages, with acknowledgment timeouts matching
+// mqtt.ErrAckTimeout.
+func resultFromLog(rec logging.LogRecord) DispatchResult {
+	r := rec.Response
+	res := DispatchResult{
+		Signal:              r.Signal,
+		Assignments:         r.Assignments,
+		FallbackAssignments: r.FallbackAssignments,
+		Acknowledged:        r.Acknowledged,
+		Errors:              logErrors(r.Errors),
+		MarketPrice:         r.MarketPrice,
+		Scores:              r.Scores,
+		WearCostEUR:         r.WearCostEUR,
+		Applied:             r.Applied,
+		AckReasons:          r.AckReasons,
+	}
+	for _, fr := range r.FallbackRounds {
+		res.FallbackRounds = append(res.FallbackRounds, FallbackRound{
+			Round:        fr.Round,
+			Assignments:  fr.Assignments,
+			Acknowledged: fr.Acknowledged,
+			Applied:      fr.Applied,
+			Errors:       logErrors(fr.Errors),
+			DeficitKW:    fr.DeficitKW,
+		})
+	}
+	return res
+}
+
+func logErrors(msgs map[string]string) map[string]error {
+	errs := make(map[string]error, len(msgs))
+	for id, msg := range msgs {
+		if msg == coremqtt.ErrAckTimeout.Error() {
+			errs[id] = coremqtt.ErrAckTimeout
+		} else {
+			errs[id] = errors.New(msg)
+		}
+	}
+	return errs
+}
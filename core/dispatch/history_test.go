@@ -0,0 +1,116 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/dispatch/logging"
+	"github.com/kilianp07/v2g/core/model"
+	coremqtt "github.com/kilianp07/v2g/core/mqtt"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+// historyOf returns a history holding results, oldest first.
+func historyOf(results ...DispatchResult) History {
+	h := NewMemoryHistory(HistoryConfig{})
+	for _, r := range results {
+		h.Append(r)
+	}
+	return h
+}
+
+func resultWithPower(kw float64) DispatchResult {
+	return DispatchResult{Signal: model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: kw}}
+}
+
+func TestMemoryHistory_MaxEntries(t *testing.T) {
+	h := NewMemoryHistory(HistoryConfig{MaxEntries: 3})
+	for i := 1; i <= 5; i++ {
+		h.Append(resultWithPower(float64(i)))
+	}
+	if h.Len() != 3 {
+		t.Fatalf("expected 3 results, got %d", h.Len())
+	}
+	all := h.Recent(0)
+	if all[0].Signal.PowerKW != 3 || all[2].Signal.PowerKW != 5 {
+		t.Fatalf("expected oldest results dropped, got %+v", all)
+	}
+	last := h.Recent(1)
+	if len(last) != 1 || last[0].Signal.PowerKW != 5 {
+		t.Fatalf("unexpected latest result %+v", last)
+	}
+}
+
+func TestMemoryHistory_MaxAge(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	h := NewMemoryHistory(HistoryConfig{MaxAgeMinutes: 10})
+	h.now = func() time.Time { return now }
+	h.Append(resultWithPower(1))
+	now = now.Add(6 * time.Minute)
+	h.Append(resultWithPower(2))
+	if got := h.Since(now.Add(-time.Minute)); len(got) != 1 || got[0].Signal.PowerKW != 2 {
+		t.Fatalf("unexpected results since last minute %+v", got)
+	}
+	now = now.Add(5 * time.Minute)
+	if got := h.Recent(0); len(got) != 1 || got[0].Signal.PowerKW != 2 {
+		t.Fatalf("expected expired result dropped, got %+v", got)
+	}
+}
+
+func TestLoadHistory_FromLogStore(t *testing.T) {
+	store, err := logging.NewJSONLStore(filepath.Join(t.TempDir(), "log.jsonl"))
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	now := time.Now()
+	for i, age := range []time.Duration{2 * time.Hour, 30 * time.Minute, 10 * time.Minute, time.Minute} {
+		sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: float64(i)}
+		rec := logging.LogRecord{Timestamp: now.Add(-age), Signal: sig, Response: logging.Result{
+			Signal:       sig,
+			Assignments:  map[string]float64{"v1": 1},
+			Acknowledged: map[string]bool{"v1": false},
+			Errors:       map[string]string{"v1": fmt.Errorf("%w", coremqtt.ErrAckTimeout).Error()},
+		}}
+		if err := store.Append(ctx, rec); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	round := logging.LogRecord{Timestamp: now, Round: 1, Signal: model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 3}}
+	if err := store.Append(ctx, round); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	h, err := LoadHistory(ctx, store, HistoryConfig{MaxEntries: 2, MaxAgeMinutes: 60})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	got := h.Recent(0)
+	if len(got) != 2 || got[0].Signal.PowerKW != 2 || got[1].Signal.PowerKW != 3 {
+		t.Fatalf("expected the two latest dispatches in the window, got %+v", got)
+	}
+	if !errors.Is(got[1].Errors["v1"], coremqtt.ErrAckTimeout) {
+		t.Fatalf("expected ack timeout restored, got %v", got[1].Errors["v1"])
+	}
+}
+
+func TestDispatchManager_HistoryBounded(t *testing.T) {
+	m, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, mqtt.NewMockPublisher(), time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	m.SetHistory(NewMemoryHistory(HistoryConfig{MaxEntries: 2}))
+	vehicles := []model.Vehicle{{ID: "v1", SoC: 0.8, IsV2G: true, Available: true, MaxPower: 10, BatteryKWh: 50}}
+	for i := 0; i < 3; i++ {
+		m.Dispatch(model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 5, Timestamp: time.Now()}, vehicles)
+	}
+	if n := m.History().Len(); n != 2 {
+		t.Fatalf("expected history bounded to 2, got %d", n)
+	}
+}
@@ -0,0 +1,220 @@
+package dispatch
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+)
+
+// Commitment is the power a dispatch has committed to a vehicle for the
+// duration of its signal.
+type Commitment struct {
+	ID        uint64
+	VehicleID string
+	Signal    model.SignalType
+	PowerKW   float64
+	// ReservedKW is headroom held for the vehicle regardless of its current
+	// setpoint, for example the capacity of a droop response.
+	ReservedKW float64
+	Start      time.Time
+	End        time.Time
+}
+
+// commitment groups the reservations made while dispatching one signal.
+type commitment struct {
+	signal   model.FlexibilitySignal
+	start    time.Time
+	end      time.Time
+	power    map[string]float64
+	reserved map[string]float64
+}
+
+// held returns the headroom the commitment takes from the vehicle.
+func (c *commitment) held(vehicleID string) float64 {
+	return math.Max(math.Abs(c.power[vehicleID]), c.reserved[vehicleID])
+}
+
+// CommitmentLedger tracks the power committed to each vehicle over time so
+// that overlapping signals never exceed a vehicle's MaxPower. Each dispatch
+// opens a commitment that stops counting once its signal ends and is removed
+// when it is released.
+type CommitmentLedger struct {
+	mu      sync.Mutex
+	entries map[uint64]*commitment
+	nextID  uint64
+	now     func() time.Time
+}
+
+// NewCommitmentLedger returns an empty ledger.
+func NewCommitmentLedger() *CommitmentLedger {
+	return &CommitmentLedger{entries: make(map[uint64]*commitment), now: time.Now}
+}
+
+// commitmentWindow returns the time span covered by the signal. Signals
+// without a duration cover a single instant.
+func commitmentWindow(signal model.FlexibilitySignal) (time.Time, time.Time) {
+	start := signal.Timestamp
+	if start.IsZero() {
+		start = time.Now()
+	}
+	return start, start.Add(signal.Duration)
+}
+
+// Open starts a commitment for the signal and returns its identifier.
+// Signals without a duration are not held in the ledger and return zero.
+func (l *CommitmentLedger) Open(signal model.FlexibilitySignal) uint64 {
+	if signal.Duration <= 0 {
+		return 0
+	}
+	start, end := commitmentWindow(signal)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.nextID++
+	l.entries[l.nextID] = &commitment{
+		signal:   signal,
+		start:    start,
+		end:      end,
+		power:    make(map[string]float64),
+		reserved: make(map[string]float64),
+	}
+	return l.nextID
+}
+
+// Set records the power committed to the vehicle by commitment id. A zero
+// power keeps the vehicle attached to the commitment without reserving any
+// headroom, so that it is still released when the commitment ends.
+func (l *CommitmentLedger) Set(id uint64, vehicleID string, powerKW float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.entries[id]; ok {
+		c.power[vehicleID] = powerKW
+	}
+}
+
+// Reserve holds kw of the vehicle's headroom for commitment id independently
+// of the power it is currently asked to deliver.
+func (l *CommitmentLedger) Reserve(id uint64, vehicleID string, kw float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.entries[id]; ok {
+		c.reserved[vehicleID] = math.Abs(kw)
+		if _, ok := c.power[vehicleID]; !ok {
+			c.power[vehicleID] = 0
+		}
+	}
+}
+
+// Release removes the commitment and returns the vehicles it was holding,
+// sorted by ID.
+func (l *CommitmentLedger) Release(id uint64) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, ok := l.entries[id]
+	if !ok {
+		return nil
+	}
+	delete(l.entries, id)
+	ids := make([]string, 0, len(c.power))
+	for vid := range c.power {
+		ids = append(ids, vid)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Headroom returns the power the vehicle can still take between start and
+// end, given every commitment overlapping that window. Commitment exclude is
+// ignored.
+func (l *CommitmentLedger) Headroom(vehicleID string, maxPower float64, start, end time.Time, exclude uint64) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	committed := 0.0
+	for id, c := range l.entries {
+		if id == exclude || !overlaps(c.start, c.end, start, end) {
+			continue
+		}
+		committed += c.held(vehicleID)
+	}
+	return math.Max(0, maxPower-committed)
+}
+
+// Active returns the net power committed to the vehicle by the commitments
+// running now, other than exclude, along with the latest of their end times.
+// ok is false when no other commitment holds the vehicle.
+func (l *CommitmentLedger) Active(vehicleID string, exclude uint64) (power float64, until time.Time, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for id, c := range l.entries {
+		p, held := c.power[vehicleID]
+		if id == exclude || !held || now.Before(c.start) || !now.Before(c.end) {
+			continue
+		}
+		power += p
+		if c.end.After(until) {
+			until = c.end
+		}
+		ok = true
+	}
+	return power, until, ok
+}
+
+// Commitments returns the active and upcoming commitments of the vehicle.
+func (l *CommitmentLedger) Commitments(vehicleID string) []Commitment {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	var res []Commitment
+	for id, c := range l.entries {
+		p, ok := c.power[vehicleID]
+		if !ok || !now.Before(c.end) {
+			continue
+		}
+		res = append(res, Commitment{
+			ID:         id,
+			VehicleID:  vehicleID,
+			Signal:     c.signal.Type,
+			PowerKW:    p,
+			ReservedKW: c.reserved[vehicleID],
+			Start:      c.start,
+			End:        c.end,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// overlaps reports whether [aStart, aEnd) and [bStart, bEnd) intersect. An
+// empty window is treated as a single instant.
+func overlaps(aStart, aEnd, bStart, bEnd time.Time) bool {
+	if !bEnd.After(bStart) {
+		return !bStart.Before(aStart) && bStart.Before(aEnd)
+	}
+	return aStart.Before(bEnd) && bStart.Before(aEnd)
+}
+
+// Ledger returns the commitment ledger used to arbitrate overlapping signals.
+func (m *DispatchManager) Ledger() *CommitmentLedger {
+	return m.ledger
+}
+
+// applyHeadroom returns the vehicles with MaxPower limited to the headroom
+// left by the commitments overlapping the signal, other than exclude. Vehicles
+// without headroom are skipped.
+func (m *DispatchManager) applyHeadroom(signal model.FlexibilitySignal, vehicles []model.Vehicle, exclude uint64) []model.Vehicle {
+	start, end := commitmentWindow(signal)
+	res := make([]model.Vehicle, 0, len(vehicles))
+	for _, v := range vehicles {
+		head := m.ledger.Headroom(v.ID, v.MaxPower, start, end, exclude)
+		if head <= 0 {
+			m.logger.Debugf("vehicle %s fully committed, skipping %s", v.ID, signal.Type)
+			continue
+		}
+		v.MaxPower = head
+		res = append(res, v)
+	}
+	return res
+}
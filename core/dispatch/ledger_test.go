@@ -0,0 +1,73 @@
+package dispatch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+func TestCommitmentLedger_Headroom(t *testing.T) {
+	l := NewCommitmentLedger()
+	now := time.Now()
+	fcr := l.Open(model.FlexibilitySignal{Type: model.SignalFCR, Duration: time.Hour, Timestamp: now})
+	l.Set(fcr, "v1", 4)
+	afrr := l.Open(model.FlexibilitySignal{Type: model.SignalAFRR, Duration: time.Hour, Timestamp: now.Add(2 * time.Hour)})
+	l.Set(afrr, "v1", -6)
+
+	if h := l.Headroom("v1", 10, now, now.Add(30*time.Minute), 0); h != 6 {
+		t.Fatalf("expected 6 kW headroom during FCR, got %v", h)
+	}
+	if h := l.Headroom("v1", 10, now, now.Add(3*time.Hour), 0); h != 0 {
+		t.Fatalf("expected no headroom across both signals, got %v", h)
+	}
+	if h := l.Headroom("v1", 10, now, now.Add(30*time.Minute), fcr); h != 10 {
+		t.Fatalf("expected excluded commitment to be ignored, got %v", h)
+	}
+	if p, _, ok := l.Active("v1", 0); !ok || p != 4 {
+		t.Fatalf("expected 4 kW active, got %v", p)
+	}
+	if ids := l.Release(fcr); len(ids) != 1 || ids[0] != "v1" {
+		t.Fatalf("unexpected released vehicles %v", ids)
+	}
+	if _, _, ok := l.Active("v1", 0); ok {
+		t.Fatalf("expected no active commitment after release")
+	}
+	if cs := l.Commitments("v1"); len(cs) != 1 || cs[0].Signal != model.SignalAFRR {
+		t.Fatalf("unexpected commitments %+v", cs)
+	}
+}
+
+func TestDispatch_OverlappingSignalsShareHeadroom(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	veh := model.Vehicle{ID: "v1", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 40}
+	now := time.Now()
+	mgr.Dispatch(model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 6, Duration: 30 * time.Millisecond, Timestamp: now}, []model.Vehicle{veh})
+	res := mgr.Dispatch(model.FlexibilitySignal{Type: model.SignalAFRR, PowerKW: 7, Duration: time.Hour, Timestamp: now}, []model.Vehicle{veh})
+
+	if res.Assignments["v1"] != 4 {
+		t.Fatalf("expected aFRR limited to 4 kW headroom, got %v", res.Assignments["v1"])
+	}
+	if p, _ := pub.Setpoint("v1"); p != 10 {
+		t.Fatalf("expected stacked 10 kW setpoint, got %v", p)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	if p, released := pub.Setpoint("v1"); released || p != 4 {
+		t.Fatalf("expected v1 back to the aFRR setpoint, got %v", p)
+	}
+	if h := mgr.Ledger().Headroom("v1", 10, now, now.Add(time.Minute), 0); h != 6 {
+		t.Fatalf("expected FCR commitment released, headroom %v", h)
+	}
+
+	mgr.CancelSignal(model.SignalAFRR)
+	if p, released := pub.Setpoint("v1"); !released || p != 0 {
+		t.Fatalf("expected v1 released after cancel")
+	}
+}
@@ -8,24 +8,67 @@ import (
 	"sync"
 )
 
+// reasonNotDiscovered mirrors dispatch.ReasonNotDiscovered, reported for every
+// vehicle a dispatch remembers but did not discover.
+const reasonNotDiscovered = "not_discovered"
+
+// recordMatchesVehicle reports whether the record concerns the vehicle id: it
+// was assigned power, acknowledged an order or has a trace entry other than
+// not discovered.
 func recordMatchesVehicle(r LogRecord, id string) bool {
 	if id == "" {
 		return true
 	}
-	for _, vid := range r.VehiclesSelected {
-		if vid == id {
-			return true
-		}
-	}
 	if _, ok := r.Response.Assignments[id]; ok {
 		return true
 	}
 	if _, ok := r.Response.FallbackAssignments[id]; ok {
 		return true
 	}
+	if _, ok := r.Response.Acknowledged[id]; ok {
+		return true
+	}
+	if t, ok := r.Response.Trace[id]; ok && t.Reason != reasonNotDiscovered {
+		return true
+	}
 	return false
 }
 
+// recordMatchesReason reports whether the trace of the vehicle id, or of any
+// vehicle when id is empty, holds the reason code.
+func recordMatchesReason(r LogRecord, id, reason string) bool {
+	if reason == "" {
+		return true
+	}
+	for vid, t := range r.Response.Trace {
+		if id != "" && vid != id {
+			continue
+		}
+		if t.Reason == reason {
+			return true
+		}
+		for _, st := range t.Stages {
+			if st.Reason == reason {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recordMatches applies the round, vehicle and reason filters of q. A reason
+// is looked up in the trace of the vehicle, so it alone decides whether the
+// record concerns the vehicle.
+func recordMatches(r LogRecord, q LogQuery) bool {
+	if q.SkipRounds && r.Round > 0 {
+		return false
+	}
+	if q.Reason != "" {
+		return recordMatchesReason(r, q.VehicleID, q.Reason)
+	}
+	return recordMatchesVehicle(r, q.VehicleID)
+}
+
 // JSONLStore stores logs in a JSONL file.
 type JSONLStore struct {
 	path string
@@ -80,10 +123,10 @@ func (s *JSONLStore) Query(ctx context.Context, q LogQuery) ([]LogRecord, error)
 		if q.SignalType != 0 && r.Signal.Type != q.SignalType {
 			continue
 		}
-		if !recordMatchesVehicle(r, q.VehicleID) {
+		if !recordMatches(r, q) {
 			continue
 		}
-		res = append(res, r)
+		res = q.keep(res, r)
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, err
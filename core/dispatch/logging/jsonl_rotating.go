@@ -70,10 +70,10 @@ func (s *RotatingJSONLStore) Query(ctx context.Context, q LogQuery) ([]LogRecord
 			if q.SignalType != 0 && r.Signal.Type != q.SignalType {
 				continue
 			}
-			if !recordMatchesVehicle(r, q.VehicleID) {
+			if !recordMatches(r, q) {
 				continue
 			}
-			res = append(res, r)
+			res = q.keep(res, r)
 		}
 		_ = file.Close()
 	}
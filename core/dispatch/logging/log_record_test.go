@@ -31,3 +31,29 @@ func TestLogRecord_JSON(t *testing.T) {
 		}
 	}
 }
+
+func TestRecordMatches_Reason(t *testing.T) {
+	rec := LogRecord{Response: Result{Trace: map[string]VehicleTrace{
+		"v1": {Reason: "allocated", Stages: []StageDecision{{Stage: "ledger", Reason: "headroom_limited"}}},
+		"v2": {Reason: "soc_below_min"},
+	}}}
+	if !recordMatches(rec, LogQuery{Reason: "soc_below_min"}) {
+		t.Fatalf("expected a match on any vehicle")
+	}
+	if recordMatches(rec, LogQuery{VehicleID: "v1", Reason: "soc_below_min"}) {
+		t.Fatalf("expected the reason checked for v1 only")
+	}
+	if !recordMatches(rec, LogQuery{VehicleID: "v1", Reason: "headroom_limited"}) {
+		t.Fatalf("expected a match on a stage reason")
+	}
+	if !recordMatches(rec, LogQuery{VehicleID: "v2"}) {
+		t.Fatalf("expected excluded vehicles to match their trace")
+	}
+	rec.Response.Trace["v3"] = VehicleTrace{Reason: "not_discovered"}
+	if recordMatches(rec, LogQuery{VehicleID: "v3"}) {
+		t.Fatalf("expected vehicles that were not discovered not to match")
+	}
+	if !recordMatches(rec, LogQuery{VehicleID: "v3", Reason: "not_discovered"}) {
+		t.Fatalf("expected an explicit reason query to match")
+	}
+}
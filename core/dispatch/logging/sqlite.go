@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"slices"
 
 	_ "modernc.org/sqlite"
 )
@@ -63,7 +64,21 @@ func (s *SQLiteStore) Query(ctx context.Context, q LogQuery) ([]LogRecord, error
 		query += ` AND signal_type = ?`
 		args = append(args, q.SignalType.String())
 	}
-	query += ` ORDER BY ts`
+	if q.SkipRounds {
+		query += ` AND COALESCE(json_extract(record, '$.round'), 0) = 0`
+	}
+	// With a limit the latest records are read first and reversed, so that
+	// the scan stops once enough records matched.
+	latest := q.Limit > 0
+	if latest {
+		query += ` ORDER BY ts DESC, id DESC`
+		if q.VehicleID == "" && q.Reason == "" {
+			query += ` LIMIT ?`
+			args = append(args, q.Limit)
+		}
+	} else {
+		query += ` ORDER BY ts, id`
+	}
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
@@ -79,14 +94,20 @@ func (s *SQLiteStore) Query(ctx context.Context, q LogQuery) ([]LogRecord, error
 		if err := json.Unmarshal([]byte(data), &r); err != nil {
 			return nil, fmt.Errorf("unmarshal record: %w", err)
 		}
-		if !recordMatchesVehicle(r, q.VehicleID) {
+		if !recordMatches(r, q) {
 			continue
 		}
 		res = append(res, r)
+		if latest && len(res) == q.Limit {
+			break
+		}
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	if latest {
+		slices.Reverse(res)
+	}
 	return res, nil
 }
 
@@ -32,3 +32,29 @@ func TestSQLiteStore_PersistQuery(t *testing.T) {
 		t.Fatalf("expected 1 record, got %d", len(out))
 	}
 }
+
+func TestSQLiteStore_LatestDispatches(t *testing.T) {
+	store, err := NewSQLiteStore("file:latest.db?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	ctx := context.Background()
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		rec := LogRecord{Timestamp: now.Add(time.Duration(i) * time.Second), TargetPower: float64(i)}
+		if i == 3 {
+			rec.Round = 1
+		}
+		if err := store.Append(ctx, rec); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	out, err := store.Query(ctx, LogQuery{SkipRounds: true, Limit: 2})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(out) != 2 || out[0].TargetPower != 1 || out[1].TargetPower != 2 {
+		t.Fatalf("expected the two latest dispatches oldest first, got %+v", out)
+	}
+}
@@ -13,18 +13,54 @@ type LogRecord struct {
 	Signal           model.FlexibilitySignal `json:"signal"`
 	TargetPower      float64                 `json:"target_power"`
 	VehiclesSelected []string                `json:"vehicles_selected"`
-	Response         Result                  `json:"response"`
+	// Round numbers the later rounds of a session or droop signal, which
+	// only carry the setpoints they changed. It is zero for a dispatch.
+	Round    int    `json:"round,omitempty"`
+	Response Result `json:"response"`
 }
 
 // Result mirrors dispatch.DispatchResult for logging purposes.
 type Result struct {
 	Assignments         map[string]float64      `json:"assignments"`
 	FallbackAssignments map[string]float64      `json:"fallback_assignments"`
+	FallbackRounds      []FallbackRound         `json:"fallback_rounds,omitempty"`
 	Errors              map[string]string       `json:"errors"`
 	Acknowledged        map[string]bool         `json:"acknowledged"`
 	Signal              model.FlexibilitySignal `json:"signal"`
 	MarketPrice         float64                 `json:"market_price"`
 	Scores              map[string]float64      `json:"scores"`
+	Trace               map[string]VehicleTrace `json:"trace,omitempty"`
+	WearCostEUR         map[string]float64      `json:"wear_cost_eur,omitempty"`
+	Applied             map[string]float64      `json:"applied,omitempty"`
+	AckReasons          map[string]string       `json:"ack_reasons,omitempty"`
+}
+
+// VehicleTrace mirrors dispatch.VehicleTrace for logging purposes.
+type VehicleTrace struct {
+	Reason           string             `json:"reason"`
+	Stages           []StageDecision    `json:"stages"`
+	SoC              float64            `json:"soc"`
+	AvailabilityProb float64            `json:"availability_prob"`
+	CapacityKW       float64            `json:"capacity_kw"`
+	Score            float64            `json:"score"`
+	ScoreComponents  map[string]float64 `json:"score_components,omitempty"`
+	PowerKW          float64            `json:"power_kw"`
+}
+
+// StageDecision mirrors dispatch.StageDecision for logging purposes.
+type StageDecision struct {
+	Stage  string `json:"stage"`
+	Reason string `json:"reason"`
+}
+
+// FallbackRound mirrors dispatch.FallbackRound for logging purposes.
+type FallbackRound struct {
+	Round        int                `json:"round"`
+	Assignments  map[string]float64 `json:"assignments"`
+	Acknowledged map[string]bool    `json:"acknowledged"`
+	Applied      map[string]float64 `json:"applied,omitempty"`
+	Errors       map[string]string  `json:"errors,omitempty"`
+	DeficitKW    float64            `json:"deficit_kw"`
 }
 
 // LogQuery defines filters for retrieving records.
@@ -33,6 +69,23 @@ type LogQuery struct {
 	End        time.Time
 	VehicleID  string
 	SignalType model.SignalType
+	// Reason keeps records where a vehicle, or VehicleID when set, has this
+	// reason code at any stage of its trace.
+	Reason string
+	// SkipRounds drops the rounds of session and droop signals, keeping the
+	// dispatches only.
+	SkipRounds bool
+	// Limit keeps the latest Limit matching records when positive.
+	Limit int
+}
+
+// keep appends r to res, dropping the oldest record beyond q.Limit.
+func (q LogQuery) keep(res []LogRecord, r LogRecord) []LogRecord {
+	res = append(res, r)
+	if q.Limit > 0 && len(res) > q.Limit {
+		res = res[len(res)-q.Limit:]
+	}
+	return res
 }
 
 // LogStore persists LogRecords and supports querying.
@@ -18,33 +18,55 @@ type LPDispatcher struct {
 type lpData struct {
 	ids    []string
 	scores []float64
-	caps   []float64
+	// objective holds the unclamped scores, so the battery wear cost still
+	// ranks vehicles whose penalties exceed their score.
+	objective []float64
+	caps      []float64
+	lows      []float64
 }
 
 func (d LPDispatcher) buildData(vehicles []model.Vehicle, signal model.FlexibilitySignal, ctx *DispatchContext) lpData {
 	cands := prepareVehicles(vehicles, signal, ctx, d.vehicleScore, d.EnableSoCConstraints, d.SafeDischargeFloor)
-	data := lpData{ids: make([]string, len(cands)), scores: make([]float64, len(cands)), caps: make([]float64, len(cands))}
+	data := lpData{ids: make([]string, len(cands)), scores: make([]float64, len(cands)), objective: make([]float64, len(cands)), caps: make([]float64, len(cands)), lows: make([]float64, len(cands))}
 	for i, c := range cands {
 		data.ids[i] = c.v.ID
 		data.scores[i] = c.score
+		data.objective[i] = d.objectiveScore(c.v, ctx)
 		data.caps[i] = c.capacity
+		data.lows[i] = c.min
 	}
 	return data
 }
 
+// objectiveScore returns the LP objective coefficient of a vehicle: its score,
+// left unclamped when a degradation weight is set so that the wear cost is
+// subtracted in full.
+func (d SmartDispatcher) objectiveScore(v model.Vehicle, ctx *DispatchContext) float64 {
+	if v.BatteryKWh <= 0 {
+		return 0
+	}
+	parts := d.scoreParts(v, ctx)
+	if parts.degradation == 0 {
+		return parts.total()
+	}
+	return parts.net()
+}
+
 // solveLP runs the simplex algorithm to maximise the weighted score subject to
-// capacity constraints.
+// 0 <= x <= caps and returns x.
 func solveLP(scores, caps []float64, target float64) ([]float64, error) {
-	c := make([]float64, len(scores))
+	n := len(caps)
+	c := make([]float64, n)
 	for i, s := range scores {
 		c[i] = -s
 	}
 
-	g := mat.NewDense(len(caps), len(caps), nil)
-	h := make([]float64, len(caps))
+	g := mat.NewDense(2*n, n, nil)
+	h := make([]float64, 2*n)
 	for i, cap := range caps {
 		g.Set(i, i, 1)
 		h[i] = cap
+		g.Set(n+i, i, -1)
 	}
 
 	A := mat.NewDense(1, len(caps), nil)
@@ -55,7 +77,15 @@ func solveLP(scores, caps []float64, target float64) ([]float64, error) {
 
 	cStd, AStd, bStd := lp.Convert(c, g, h, A, b)
 	_, sol, err := lp.Simplex(cStd, AStd, bStd, 1e-7, nil)
-	return sol, err
+	if err != nil {
+		return nil, err
+	}
+	// The standard form splits each variable into x = x+ - x-.
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = sol[i] - sol[n+i]
+	}
+	return x, nil
 }
 
 // lpSolve points to the function used to solve the LP. It can be overridden in
@@ -81,8 +111,8 @@ func (d *LPDispatcher) DispatchStrict(vehicles []model.Vehicle, signal model.Fle
 	ctx := &DispatchContext{
 		Signal:             signal,
 		Now:                signal.Timestamp,
-		MarketPrice:        d.MarketPrice,
-		ParticipationScore: d.Participation,
+		MarketPrice:        d.MarketPriceFor(signal),
+		ParticipationScore: d.participationScores(),
 	}
 
 	data := d.buildData(vehicles, signal, ctx)
@@ -100,16 +130,27 @@ func (d *LPDispatcher) DispatchStrict(vehicles []model.Vehicle, signal model.Fle
 		sign = -1
 	}
 
-	sol, err := lpSolve(data.scores, data.caps, target)
+	// Vehicles that cannot ramp down to zero are bounded below by shifting
+	// their variable by the minimum power: x = low + y with 0 <= y <= cap-low.
+	shifted := make([]float64, len(data.caps))
+	var floor float64
+	for i, cap := range data.caps {
+		shifted[i] = cap - data.lows[i]
+		floor += data.lows[i]
+	}
+	if floor > target+1e-3 {
+		return nil, ErrInfeasible
+	}
+	sol, err := lpSolve(data.objective, shifted, target-floor)
 	if err != nil {
 		return nil, err
 	}
 
 	var sum float64
 	for i, id := range data.ids {
-		power := sol[i]
-		if power < 0 {
-			power = 0
+		power := data.lows[i] + sol[i]
+		if power < data.lows[i] {
+			power = data.lows[i]
 		}
 		if power > data.caps[i] {
 			power = data.caps[i]
@@ -120,12 +161,12 @@ func (d *LPDispatcher) DispatchStrict(vehicles []model.Vehicle, signal model.Fle
 	if math.Abs(sum-target) > 1e-3 {
 		return assignments, ErrInfeasible
 	}
-	return assignments, nil
+	return applyPowerConstraints(vehicles, signal, assignments), nil
 }
 
 // Dispatch implements the Dispatcher interface. It solves
-// a linear program maximizing the weighted score while meeting
-// the power target.
+// a linear program maximizing the weighted score, net of the battery wear
+// cost, while meeting the power target.
 func (d *LPDispatcher) Dispatch(vehicles []model.Vehicle, signal model.FlexibilitySignal) map[string]float64 {
 	asn, err := d.DispatchStrict(vehicles, signal)
 	if err != nil {
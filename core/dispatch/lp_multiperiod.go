@@ -0,0 +1,225 @@
+package dispatch
+
+import (
+	"math"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/optimize/convex/lp"
+)
+
+// DefaultPlanSlot is the slot length used by MultiPeriodLPDispatcher when none
+// is configured.
+const DefaultPlanSlot = 15 * time.Minute
+
+// MultiPeriodLPDispatcher plans setpoints over the signal horizon split into
+// slots. Each slot must meet the signal power while every vehicle keeps enough
+// energy to stay above its minimum SoC until departure and only receives
+// power in the slots starting after it arrives and ending before it leaves.
+// The objective maximises the
+// SmartDispatcher scores, so long activations are spread across the fleet
+// instead of draining the best-scored vehicles first.
+type MultiPeriodLPDispatcher struct {
+	SmartDispatcher
+	// SlotDuration is the length of a planning slot.
+	SlotDuration time.Duration
+	// Horizon is planned for signals without a duration.
+	Horizon time.Duration
+}
+
+// NewMultiPeriodLPDispatcher returns a planner with default weights.
+func NewMultiPeriodLPDispatcher(slot, horizon time.Duration) *MultiPeriodLPDispatcher {
+	return &MultiPeriodLPDispatcher{SmartDispatcher: NewSmartDispatcher(), SlotDuration: slot, Horizon: horizon}
+}
+
+// planVar is one LP variable: the power of a vehicle during a slot.
+type planVar struct {
+	vehicle int
+	slot    int
+}
+
+// slots returns the length of every slot covering the signal horizon. The
+// last slot is shortened to end with the horizon.
+func (d *MultiPeriodLPDispatcher) slots(signal model.FlexibilitySignal) []time.Duration {
+	slot := d.SlotDuration
+	if slot <= 0 {
+		slot = DefaultPlanSlot
+	}
+	horizon := signal.Duration
+	if horizon <= 0 {
+		horizon = d.Horizon
+	}
+	if horizon <= 0 {
+		horizon = slot
+	}
+	var res []time.Duration
+	for rest := horizon; rest > 0; rest -= slot {
+		res = append(res, time.Duration(math.Min(float64(rest), float64(slot))))
+	}
+	return res
+}
+
+// planEnergy returns the energy the vehicle can exchange in the direction of
+// the signal without crossing its SoC limits.
+func (d *MultiPeriodLPDispatcher) planEnergy(v model.Vehicle, signal model.FlexibilitySignal) float64 {
+	if signal.PowerKW < 0 {
+		return (1 - v.SoC) * v.BatteryKWh
+	}
+	floor := v.MinSoC
+	if d.EnableSoCConstraints {
+		floor = math.Max(floor, math.Max(d.MinSoC, d.SafeDischargeFloor))
+	}
+	start := signal.Timestamp
+	if start.IsZero() {
+		start = time.Now()
+	}
+	return math.Min((v.SoC-floor)*v.BatteryKWh, v.DischargeableKWh(start, signal.Duration))
+}
+
+// PlanStrict solves the multi-period LP and returns the plan. It returns
+// ErrInfeasible when a slot cannot be met.
+//
+//gocyclo:ignore
+func (d *MultiPeriodLPDispatcher) PlanStrict(vehicles []model.Vehicle, signal model.FlexibilitySignal) (DispatchPlan, error) {
+	lengths := d.slots(signal)
+	start := signal.Timestamp
+	if start.IsZero() {
+		start = time.Now()
+	}
+	plan := newDispatchPlan(start, lengths)
+	if len(vehicles) == 0 || signal.PowerKW == 0 {
+		return plan, nil
+	}
+	target := math.Abs(signal.PowerKW)
+	sign := 1.0
+	if signal.PowerKW < 0 {
+		sign = -1
+	}
+
+	ctx := &DispatchContext{Signal: signal, Now: start, MarketPrice: d.MarketPriceFor(signal), ParticipationScore: d.participationScores()}
+	d.scores = make(map[string]float64, len(vehicles))
+	var (
+		cands    []model.Vehicle
+		caps     []float64
+		energies []float64
+		scores   []float64
+		vars     []planVar
+	)
+	for _, v := range vehicles {
+		// The plan bounds the energy over the horizon, so slots may exceed
+		// the average power of the energy limit.
+		r, ok := rampRange(v, signal)
+		energy := d.planEnergy(v, signal)
+		if !ok || r.hi <= 0 || v.BatteryKWh <= 0 || energy <= 0 {
+			continue
+		}
+		i := len(cands)
+		d.scores[v.ID] = d.vehicleScore(v, ctx)
+		cands = append(cands, v)
+		caps = append(caps, math.Min(v.MaxPower, r.hi))
+		energies = append(energies, energy)
+		scores = append(scores, d.objectiveScore(v, ctx))
+		from := start
+		for t, l := range lengths {
+			end := from.Add(l)
+			if !from.Before(v.Arrival) && (v.Departure.IsZero() || !end.After(v.Departure)) {
+				vars = append(vars, planVar{vehicle: i, slot: t})
+			}
+			from = end
+		}
+	}
+
+	covered := make([]bool, len(lengths))
+	for _, pv := range vars {
+		covered[pv.slot] = true
+	}
+	for _, ok := range covered {
+		if !ok {
+			return plan, ErrInfeasible
+		}
+	}
+
+	// Standard form: the slot powers x, a slack per cap and a slack per
+	// energy budget, all non-negative.
+	nx := len(vars)
+	cols := 2*nx + len(cands)
+	rows := len(lengths) + nx + len(cands)
+	A := mat.NewDense(rows, cols, nil)
+	b := make([]float64, rows)
+	c := make([]float64, cols)
+	for k, pv := range vars {
+		c[k] = -scores[pv.vehicle]
+		A.Set(pv.slot, k, 1)
+		A.Set(len(lengths)+k, k, 1)
+		A.Set(len(lengths)+k, nx+k, 1)
+		b[len(lengths)+k] = caps[pv.vehicle]
+		A.Set(len(lengths)+nx+pv.vehicle, k, lengths[pv.slot].Hours())
+	}
+	for t := range lengths {
+		b[t] = target
+	}
+	for i, e := range energies {
+		A.Set(len(lengths)+nx+i, 2*nx+i, 1)
+		b[len(lengths)+nx+i] = e
+	}
+
+	_, sol, err := lp.Simplex(c, A, b, 1e-7, nil)
+	if err != nil {
+		if err == lp.ErrInfeasible {
+			return plan, ErrInfeasible
+		}
+		return plan, err
+	}
+
+	used := make([]float64, len(cands))
+	for t := range lengths {
+		for k, pv := range vars {
+			if pv.slot != t {
+				continue
+			}
+			p := math.Max(0, math.Min(sol[k], caps[pv.vehicle]))
+			if p > 1e-9 {
+				plan.Setpoints[t][cands[pv.vehicle].ID] = sign * p
+			}
+		}
+		for i := range cands {
+			if t > 0 {
+				cands[i].CurrentPowerKW = plan.Setpoints[t-1][cands[i].ID]
+			}
+		}
+		plan.Setpoints[t] = applyRampConstraints(cands, signal, plan.Setpoints[t])
+		for i, v := range cands {
+			used[i] += math.Abs(plan.Setpoints[t][v.ID]) * lengths[t].Hours()
+			soc := v.SoC - sign*used[i]/v.BatteryKWh
+			plan.SoC[t][v.ID] = math.Max(0, math.Min(1, soc))
+		}
+	}
+	return plan, nil
+}
+
+// Dispatch implements the Dispatcher interface by returning the first slot of
+// the plan.
+func (d *MultiPeriodLPDispatcher) Dispatch(vehicles []model.Vehicle, signal model.FlexibilitySignal) map[string]float64 {
+	assignments, _ := d.PlanDispatch(vehicles, signal)
+	return assignments
+}
+
+// PlanDispatch implements PlanningDispatcher by returning the first slot of
+// the plan along with the plan. The SmartDispatcher allocation and a nil plan
+// are returned when the LP cannot be solved.
+func (d *MultiPeriodLPDispatcher) PlanDispatch(vehicles []model.Vehicle, signal model.FlexibilitySignal) (map[string]float64, *DispatchPlan) {
+	plan, err := d.PlanStrict(vehicles, signal)
+	if err != nil {
+		gd := d.SmartDispatcher
+		return gd.Dispatch(vehicles, signal), nil
+	}
+	if len(plan.Setpoints) == 0 {
+		return map[string]float64{}, nil
+	}
+	first := make(map[string]float64, len(plan.Setpoints[0]))
+	for id, p := range plan.Setpoints[0] {
+		first[id] = p
+	}
+	return first, &plan
+}
@@ -0,0 +1,140 @@
+package dispatch
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+func TestMultiPeriodLP_SpreadsEnergyOverHorizon(t *testing.T) {
+	d := NewMultiPeriodLPDispatcher(time.Hour, 0)
+	now := time.Now()
+	vehicles := []model.Vehicle{
+		{ID: "small", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.9, MinSoC: 0.1, BatteryKWh: 10},
+		{ID: "large", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.5, MinSoC: 0.1, BatteryKWh: 100},
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalNEBEF, PowerKW: 10, Duration: 2 * time.Hour, Timestamp: now}
+	plan, err := d.PlanStrict(vehicles, sig)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if len(plan.Setpoints) != 2 {
+		t.Fatalf("expected 2 slots, got %d", len(plan.Setpoints))
+	}
+	var smallEnergy float64
+	for i, slot := range plan.Setpoints {
+		if math.Abs(slot["small"]+slot["large"]-10) > 1e-6 {
+			t.Fatalf("slot %d does not meet the target: %v", i, slot)
+		}
+		smallEnergy += slot["small"]
+	}
+	if smallEnergy > 8+1e-6 {
+		t.Fatalf("small vehicle drained below MinSoC: %v kWh", smallEnergy)
+	}
+	if soc := plan.SoC[1]["small"]; soc < 0.1-1e-6 {
+		t.Fatalf("expected SoC above floor, got %v", soc)
+	}
+}
+
+func TestMultiPeriodLP_DepartureWindow(t *testing.T) {
+	d := NewMultiPeriodLPDispatcher(time.Hour, 0)
+	now := time.Now()
+	vehicles := []model.Vehicle{
+		{ID: "leaving", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.9, BatteryKWh: 60, Departure: now.Add(time.Hour)},
+		{ID: "staying", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.6, BatteryKWh: 60},
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 5, Duration: 2 * time.Hour, Timestamp: now}
+	plan, err := d.PlanStrict(vehicles, sig)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if p := plan.Setpoints[1]["leaving"]; p != 0 {
+		t.Fatalf("vehicle planned after departure: %v", p)
+	}
+	if p := plan.Setpoints[1]["staying"]; math.Abs(p-5) > 1e-6 {
+		t.Fatalf("expected remaining vehicle to cover slot 1, got %v", p)
+	}
+}
+
+func TestMultiPeriodLP_ArrivalWindow(t *testing.T) {
+	d := NewMultiPeriodLPDispatcher(time.Hour, 0)
+	now := time.Now()
+	vehicles := []model.Vehicle{
+		{ID: "arriving", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.9, BatteryKWh: 60, Arrival: now.Add(time.Hour)},
+		{ID: "leaving", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.9, BatteryKWh: 60, Departure: now.Add(time.Hour)},
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 5, Duration: 2 * time.Hour, Timestamp: now}
+	plan, err := d.PlanStrict(vehicles, sig)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if p := plan.Setpoints[0]["arriving"]; p != 0 {
+		t.Fatalf("vehicle planned before arrival: %v", p)
+	}
+	if p := plan.Setpoints[1]["arriving"]; math.Abs(p-5) > 1e-6 {
+		t.Fatalf("expected arriving vehicle to cover slot 1, got %v", p)
+	}
+	res, got := d.PlanDispatch(vehicles, sig)
+	if got == nil || len(got.Setpoints) != 2 || res["leaving"] != 5 {
+		t.Fatalf("expected the first slot and its plan, got %v %+v", res, got)
+	}
+}
+
+func TestMultiPeriodLP_InfeasibleFallsBack(t *testing.T) {
+	d := NewMultiPeriodLPDispatcher(time.Hour, 0)
+	vehicles := []model.Vehicle{{ID: "v1", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.9, BatteryKWh: 10}}
+	sig := model.FlexibilitySignal{Type: model.SignalNEBEF, PowerKW: 10, Duration: 4 * time.Hour, Timestamp: time.Now()}
+	if _, err := d.PlanStrict(vehicles, sig); err != ErrInfeasible {
+		t.Fatalf("expected ErrInfeasible, got %v", err)
+	}
+	res, plan := d.PlanDispatch(vehicles, sig)
+	if len(res) == 0 {
+		t.Fatalf("expected smart fallback allocation")
+	}
+	if plan != nil {
+		t.Fatalf("expected no plan after fallback")
+	}
+}
+
+func TestRunSession_FollowsPlan(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	now := time.Now()
+	d := NewMultiPeriodLPDispatcher(60*time.Millisecond, 0)
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, d, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	mgr.SetSessionConfig(SessionConfig{IntervalMS: 10, ToleranceKW: 100})
+	vehicles := []model.Vehicle{
+		{ID: "leaving", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.9, BatteryKWh: 60, Departure: now.Add(60 * time.Millisecond)},
+		{ID: "staying", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.6, BatteryKWh: 60},
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 10, Duration: 120 * time.Millisecond, Timestamp: now}
+	res := mgr.RunSession(context.Background(), sig, vehicles)
+
+	if res.Rounds[0].Plan == nil || res.Rounds[0].Assignments["leaving"] != 10 {
+		t.Fatalf("expected first slot on the leaving vehicle: %+v", res.Rounds[0].Assignments)
+	}
+	var switched bool
+	for i, r := range res.Rounds {
+		if r.Round != i {
+			t.Fatalf("expected round %d to be numbered, got %d", i, r.Round)
+		}
+	}
+	for _, r := range res.Rounds[1:] {
+		if r.Assignments["leaving"] == 0 && r.Assignments["staying"] == 10 {
+			switched = true
+		}
+	}
+	if !switched {
+		t.Fatalf("expected the session to move to the second slot")
+	}
+	if !res.Released["leaving"] || !res.Released["staying"] {
+		t.Fatalf("expected both vehicles released: %+v", res.Released)
+	}
+}
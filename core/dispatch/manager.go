@@ -3,6 +3,7 @@ package dispatch
 import (
 	"context"
 	"fmt"
+	"math"
 	"sync"
 	"time"
 
@@ -19,23 +20,41 @@ import (
 )
 
 type DispatchManager struct {
-	filter       VehicleFilter
-	dispatcher   Dispatcher
-	lpDispatcher *LPDispatcher
-	lpFirst      map[model.SignalType]bool
-	fallback     FallbackStrategy
-	publisher    mqtt.Client
-	discovery    FleetDiscovery
-	ackTimeout   time.Duration
-	logger       logger.Logger
-	metrics      metrics.MetricsSink
-	bus          eventbus.EventBus
-	tuner        LearningTuner
-	prediction   prediction.PredictionEngine
-	store        logging.LogStore
-	statusStore  vehiclestatus.Store
-	history      []DispatchResult
-	mu           sync.Mutex
+	filter         VehicleFilter
+	dispatcher     Dispatcher
+	lpDispatcher   *LPDispatcher
+	lpFirst        map[model.SignalType]bool
+	fallback       FallbackStrategy
+	publisher      mqtt.Client
+	discovery      FleetDiscovery
+	ackTimeout     time.Duration
+	logger         logger.Logger
+	metrics        metrics.MetricsSink
+	bus            eventbus.EventBus
+	tuner          LearningTuner
+	prediction     prediction.PredictionEngine
+	prices         PriceProvider
+	participation  *ParticipationLedger
+	health         *HealthTracker
+	store          logging.LogStore
+	statusStore    vehiclestatus.Store
+	history        History
+	seen           map[string]time.Time
+	fallbackRounds int
+	session        SessionConfig
+	telemetry      TelemetrySource
+	droop          DroopConfig
+	frequency      FrequencySource
+	ledger         *CommitmentLedger
+	pending        map[uint64]*pendingRelease
+	planMu         sync.Mutex
+	// reloadMu is held for reading while a dispatch or session round uses
+	// the strategies and for writing while Reload swaps them.
+	reloadMu sync.RWMutex
+	// swapMu serialises reloads so that a reused tuner is bound to the
+	// dispatcher that is swapped in.
+	swapMu sync.Mutex
+	mu     sync.Mutex
 }
 
 // SetLPFirst configures which signal types should try LP dispatch first.
@@ -51,6 +70,134 @@ func (m *DispatchManager) SetLPFirst(cfg map[model.SignalType]bool) {
 	}
 }
 
+// SetPriceProvider prices signals with p. Dispatchers implementing
+// PriceAwareDispatcher use the price at the signal timestamp, including those
+// swapped in by Reload, and dispatch results record the price.
+func (m *DispatchManager) SetPriceProvider(p PriceProvider) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	m.prices = p
+	m.attachPrices()
+}
+
+// attachPrices hands the price provider to the dispatchers. reloadMu must be
+// held for writing.
+func (m *DispatchManager) attachPrices() {
+	if m.prices == nil {
+		return
+	}
+	if pd, ok := m.dispatcher.(PriceAwareDispatcher); ok {
+		pd.SetPriceProvider(m.prices)
+	}
+	if m.lpDispatcher != nil {
+		m.lpDispatcher.SetPriceProvider(m.prices)
+	}
+}
+
+// SetParticipationLedger records the energy and activations of every
+// acknowledged dispatch in l and feeds its scores to the fairness and wear
+// penalties of the dispatchers, including those swapped in by Reload.
+func (m *DispatchManager) SetParticipationLedger(l *ParticipationLedger) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	m.participation = l
+	m.attachParticipation()
+}
+
+// ParticipationReport returns the participation of each vehicle, or nil
+// without a participation ledger.
+func (m *DispatchManager) ParticipationReport() []VehicleParticipation {
+	m.reloadMu.RLock()
+	defer m.reloadMu.RUnlock()
+	if m.participation == nil {
+		return nil
+	}
+	return m.participation.Report()
+}
+
+// attachParticipation hands the participation ledger to the dispatchers.
+// reloadMu must be held for writing.
+func (m *DispatchManager) attachParticipation() {
+	if m.participation == nil {
+		return
+	}
+	if pd, ok := m.dispatcher.(ParticipationAwareDispatcher); ok {
+		pd.SetParticipationSource(m.participation)
+	}
+	if m.lpDispatcher != nil {
+		m.lpDispatcher.SetParticipationSource(m.participation)
+	}
+}
+
+// recordParticipation records an activation of the vehicles that acknowledged
+// a setpoint of the result in the participation ledger, along with the energy
+// they deliver holding it for hold.
+func (m *DispatchManager) recordParticipation(result DispatchResult, hold time.Duration) {
+	if m.participation == nil {
+		return
+	}
+	if err := m.participation.Record(deliveredEnergy(result, hold)); err != nil {
+		m.logger.Errorf("participation ledger: %v", err)
+	}
+}
+
+// creditParticipation adds the energy the setpoints delivered over hold to the
+// participation ledger.
+func (m *DispatchManager) creditParticipation(setpoints map[string]float64, hold time.Duration) {
+	if m.participation == nil {
+		return
+	}
+	if err := m.participation.Credit(heldEnergy(setpoints, hold)); err != nil {
+		m.logger.Errorf("participation ledger: %v", err)
+	}
+}
+
+// SetHealthTracker skips the vehicles t quarantines and probes the recovering
+// ones with small orders, by wrapping the vehicle filter, including the ones
+// swapped in by Reload.
+func (m *DispatchManager) SetHealthTracker(t *HealthTracker) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	if bf, ok := m.filter.(*BreakerFilter); ok {
+		m.filter = bf.Inner
+	}
+	m.health = t
+	m.attachHealth()
+}
+
+// attachHealth wraps the vehicle filter with the circuit breakers. reloadMu
+// must be held for writing.
+func (m *DispatchManager) attachHealth() {
+	if m.health == nil {
+		return
+	}
+	m.filter = NewBreakerFilter(m.filter, m.health)
+}
+
+// attachTuner hands the event bus to a tuner publishing its changes.
+func (m *DispatchManager) attachTuner() {
+	if ot, ok := m.tuner.(ObservableTuner); ok && m.bus != nil {
+		ot.SetEventBus(m.bus)
+	}
+}
+
+// marketPrice returns the price used to dispatch signal: the one the
+// dispatcher priced it with, else the price provider's.
+func (m *DispatchManager) marketPrice(used Dispatcher, signal model.FlexibilitySignal) float64 {
+	if pd, ok := used.(PriceAwareDispatcher); ok {
+		return pd.MarketPriceFor(signal)
+	}
+	if mp, ok := used.(MarketPriceProvider); ok {
+		return mp.GetMarketPrice()
+	}
+	if m.prices != nil {
+		if p, ok := m.prices.PriceAt(signal.Timestamp, signal.Type); ok {
+			return p
+		}
+	}
+	return 0
+}
+
 // SetLogStore configures the store used to persist dispatch logs.
 func (m *DispatchManager) SetLogStore(store logging.LogStore) {
 	m.mu.Lock()
@@ -58,6 +205,24 @@ func (m *DispatchManager) SetLogStore(store logging.LogStore) {
 	m.mu.Unlock()
 }
 
+// SetHistory replaces the dispatch history handed to the tuner, for instance
+// with one seeded from the log store by LoadHistory.
+func (m *DispatchManager) SetHistory(h History) {
+	if h == nil {
+		return
+	}
+	m.mu.Lock()
+	m.history = h
+	m.mu.Unlock()
+}
+
+// History returns the results of the recent dispatches.
+func (m *DispatchManager) History() History {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.history
+}
+
 // SetStatusStore configures the store used to persist vehicle status information.
 func (m *DispatchManager) SetStatusStore(store vehiclestatus.Store) {
 	m.mu.Lock()
@@ -65,9 +230,24 @@ func (m *DispatchManager) SetStatusStore(store vehiclestatus.Store) {
 	m.mu.Unlock()
 }
 
-// dispatchStrategy selects the appropriate dispatcher based on configuration
+// dispatchStrategy allocates the signal with the configured strategy and caps
+// the setpoints to the energy limits of the vehicles. It also returns the plan
+// computed for this signal, if any; plans keep their own energy bounds over
+// the horizon.
+func (m *DispatchManager) dispatchStrategy(v []model.Vehicle, s model.FlexibilitySignal) (map[string]float64, Dispatcher, *DispatchPlan) {
+	assignments, used, plan := m.runStrategy(v, s)
+	if plan != nil {
+		return assignments, used, plan
+	}
+	if removed := enforceEnergyLimits(v, s, assignments); removed > 0 {
+		m.logger.Warnf("energy limits removed %.2f kW from the %s allocation", removed, s.Type)
+	}
+	return assignments, used, nil
+}
+
+// runStrategy selects the appropriate dispatcher based on configuration
 // and falls back from LP to Smart on failure.
-func (m *DispatchManager) dispatchStrategy(v []model.Vehicle, s model.FlexibilitySignal) (map[string]float64, Dispatcher) {
+func (m *DispatchManager) runStrategy(v []model.Vehicle, s model.FlexibilitySignal) (map[string]float64, Dispatcher, *DispatchPlan) {
 	m.mu.Lock()
 	lpFirst := m.lpFirst[s.Type]
 	m.mu.Unlock()
@@ -83,7 +263,7 @@ func (m *DispatchManager) dispatchStrategy(v []model.Vehicle, s model.Flexibilit
 		}
 		asn, err := m.lpDispatcher.DispatchStrict(v, s)
 		if err == nil {
-			return asn, m.lpDispatcher
+			return asn, m.lpDispatcher, nil
 		}
 		if m.bus != nil {
 			m.bus.Publish(events.StrategyEvent{Signal: s.Type, Action: "lp_failure", Err: err})
@@ -92,13 +272,23 @@ func (m *DispatchManager) dispatchStrategy(v []model.Vehicle, s model.Flexibilit
 			sl.Debugw("lp_dispatch_failed", map[string]any{"signal": s.Type.String(), "error": err.Error()})
 		}
 		m.logger.Warnf("LP dispatch failed: %v", err)
-		assignments := m.dispatcher.Dispatch(v, s)
+		assignments, plan := runPlanning(m.dispatcher, v, s)
 		if m.bus != nil {
 			m.bus.Publish(events.StrategyEvent{Signal: s.Type, Action: "smart_fallback"})
 		}
-		return assignments, m.dispatcher
+		return assignments, m.dispatcher, plan
 	}
-	return m.dispatcher.Dispatch(v, s), m.dispatcher
+	assignments, plan := runPlanning(m.dispatcher, v, s)
+	return assignments, m.dispatcher, plan
+}
+
+// runPlanning runs the dispatcher and returns the plan it computed for the
+// signal when it is a PlanningDispatcher.
+func runPlanning(d Dispatcher, v []model.Vehicle, s model.FlexibilitySignal) (map[string]float64, *DispatchPlan) {
+	if pd, ok := d.(PlanningDispatcher); ok {
+		return pd.PlanDispatch(v, s)
+	}
+	return d.Dispatch(v, s), nil
 }
 
 // Close releases resources held by the manager.
@@ -120,30 +310,41 @@ func (m *DispatchManager) Close() error {
 // Run processes incoming flexibility signals until the context is canceled.
 // For each signal received on the channel, Dispatch is invoked. If a
 // FleetDiscovery is configured, the vehicles are discovered before each
-// dispatch.
+// dispatch. When droop mode is enabled, FCR signals with a duration follow the
+// grid frequency. When sessions are enabled, other signals with a duration are
+// held in a closed-loop session running in the background. Vehicles still holding a
+// setpoint are released when the context is canceled.
 func (m *DispatchManager) Run(ctx context.Context, signals <-chan model.FlexibilitySignal) {
 	for {
 		select {
 		case sig := <-signals:
+			if sig.Type == model.SignalFCR && sig.Duration > 0 && m.droopEnabled() {
+				go m.RunDroop(ctx, sig, nil)
+				continue
+			}
+			if m.sessionConfig().Enabled && sig.Duration > 0 {
+				go m.RunSession(ctx, sig, nil)
+				continue
+			}
 			m.Dispatch(sig, nil)
 		case <-ctx.Done():
+			m.ReleasePending()
 			return
 		}
 	}
 }
 
 // sendAndWait sends the command and waits for an acknowledgment while measuring
-// the latency.
-
-func (m *DispatchManager) sendAndWait(id string, power float64) (string, bool, time.Duration, error) {
+// the latency. A non-zero validUntil bounds the validity of the order.
+func (m *DispatchManager) sendAndWait(id string, power float64, validUntil time.Time, signal model.FlexibilitySignal) (string, mqtt.Ack, time.Duration, error) {
 	start := time.Now()
-	cmdID, err := m.publisher.SendOrder(id, power)
+	cmdID, err := m.sendOrder(id, power, validUntil, orderMetadata(signal))
 	if err != nil {
 		mqttFailure.Inc()
-		return "", false, time.Since(start), err
+		return "", mqtt.Ack{}, time.Since(start), err
 	}
 	mqttSuccess.Inc()
-	ack, err := m.publisher.WaitForAck(cmdID, m.ackTimeout)
+	ack, err := m.publisher.WaitForAck(cmdID, m.ackWait())
 	return cmdID, ack, time.Since(start), err
 }
 
@@ -159,144 +360,144 @@ func NewDispatchManager(filter VehicleFilter, dispatcher Dispatcher, fallback Fa
 	}
 
 	mgr := &DispatchManager{
-		filter:     filter,
-		dispatcher: dispatcher,
-		fallback:   fallback,
-		publisher:  publisher,
-		discovery:  disc,
-		ackTimeout: ackTimeout,
-		logger:     log,
-		metrics:    sink,
-		bus:        bus,
-		tuner:      tuner,
-		prediction: pred,
-		lpFirst:    make(map[model.SignalType]bool),
-	}
+		filter:         filter,
+		dispatcher:     dispatcher,
+		fallback:       fallback,
+		publisher:      publisher,
+		discovery:      disc,
+		ackTimeout:     ackTimeout,
+		logger:         log,
+		metrics:        sink,
+		bus:            bus,
+		tuner:          tuner,
+		prediction:     pred,
+		lpFirst:        make(map[model.SignalType]bool),
+		fallbackRounds: DefaultFallbackRounds,
+		ledger:         NewCommitmentLedger(),
+		pending:        make(map[uint64]*pendingRelease),
+		history:        NewMemoryHistory(HistoryConfig{}),
+	}
+	mgr.lpDispatcher = lpDispatcherFor(dispatcher)
+	mgr.attachTuner()
+	return mgr, nil
+}
+
+// lpDispatcherFor returns the LP dispatcher used for lp_first signals, or nil
+// when the dispatcher has no LP counterpart.
+func lpDispatcherFor(dispatcher Dispatcher) *LPDispatcher {
 	switch d := dispatcher.(type) {
 	case *LPDispatcher:
-		mgr.lpDispatcher = d
+		return d
 	case *SmartDispatcher:
 		lp := NewLPDispatcher()
 		lp.SmartDispatcher = *d
-		mgr.lpDispatcher = &lp
+		return &lp
 	}
-	return mgr, nil
+	return nil
 }
 
-// Dispatch runs the dispatch process.
-//
-//gocyclo:ignore
+// Dispatch runs the dispatch process. The dispatched power is committed in the
+// ledger until signal.Timestamp+signal.Duration, when orders expire and the
+// vehicles are released back to their remaining commitments.
 func (m *DispatchManager) Dispatch(signal model.FlexibilitySignal, vehicles []model.Vehicle) DispatchResult {
 	start := time.Now()
-	if len(vehicles) == 0 && m.discovery != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-		defer cancel()
-		if vs, err := m.discovery.Discover(ctx, time.Second); err == nil {
-			vehicles = vs
-			if fr, ok := m.metrics.(metrics.FleetSizeRecorder); ok {
-				if err := fr.RecordFleetSize(len(vs)); err != nil {
-					m.logger.Errorf("fleet size metrics error: %v", err)
-				}
-			}
-			m.logger.Infof("discovered %d vehicles", len(vs))
-		} else {
-			m.logger.Errorf("fleet discovery failed: %v", err)
+	result, _ := m.dispatchVehicles(signal, vehicles)
+	m.recordParticipation(result, signal.Duration)
+	m.scheduleRelease(result)
+	if sl, ok := m.logger.(logger.StructuredLogger); ok {
+		sl.Debugw("dispatch_complete", map[string]any{"signal": signal.Type.String(), "duration_ms": time.Since(start).Milliseconds()})
+	}
+	return result
+}
+
+// discoverVehicles returns the provided vehicles or, when none are provided,
+// the fleet found by the configured FleetDiscovery.
+func (m *DispatchManager) discoverVehicles(vehicles []model.Vehicle) []model.Vehicle {
+	if len(vehicles) > 0 || m.discovery == nil {
+		return vehicles
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	vs, err := m.discovery.Discover(ctx, time.Second)
+	if err != nil {
+		m.logger.Errorf("fleet discovery failed: %v", err)
+		return vehicles
+	}
+	if fr, ok := m.metrics.(metrics.FleetSizeRecorder); ok {
+		if err := fr.RecordFleetSize(len(vs)); err != nil {
+			m.logger.Errorf("fleet size metrics error: %v", err)
 		}
 	}
+	m.logger.Infof("discovered %d vehicles", len(vs))
+	return vs
+}
+
+// selectVehicles limits MaxPower to the headroom left by other commitments,
+// applies the vehicle filter and enriches the remaining vehicles with
+// predictions.
+func (m *DispatchManager) selectVehicles(signal model.FlexibilitySignal, vehicles []model.Vehicle) []model.Vehicle {
+	return m.filterVehicles(signal, m.applyHeadroom(signal, vehicles, 0))
+}
+
+// filterVehicles applies the vehicle filter and enriches the remaining
+// vehicles with predictions.
+func (m *DispatchManager) filterVehicles(signal model.FlexibilitySignal, vehicles []model.Vehicle) []model.Vehicle {
 	filtered := m.filter.Filter(vehicles, signal)
 	if m.prediction != nil {
-		var avrecs []metrics.VehicleAvailability
-		horizon := signal.Duration
-		if horizon <= 0 {
-			horizon = time.Hour
-		}
-		for i, v := range filtered {
-			filtered[i].AvailabilityProb = m.prediction.PredictAvailability(v.ID, signal.Timestamp.Add(horizon))
-			if fc := m.prediction.ForecastSoC(v.ID, horizon); len(fc) > 0 {
-				filtered[i].SoC = fc[len(fc)-1]
-			}
-			avrecs = append(avrecs, metrics.VehicleAvailability{
-				VehicleID:   v.ID,
-				Probability: filtered[i].AvailabilityProb,
-				Time:        time.Now(),
-			})
-		}
-		if vr, ok := m.metrics.(metrics.VehicleAvailabilityRecorder); ok && len(avrecs) > 0 {
-			if err := vr.RecordVehicleAvailability(avrecs); err != nil {
-				m.logger.Errorf("availability metrics error: %v", err)
-			}
-		}
+		m.applyPredictions(signal, filtered)
 	}
-	if va, ok := m.fallback.(VehicleAwareFallback); ok {
-		va.SetVehicles(filtered)
-	}
-	if m.bus != nil {
-		m.bus.Publish(events.SignalEvent{Signal: signal})
-	}
-	assignments, used := m.dispatchStrategy(filtered, signal)
-	m.logger.Infof("dispatching %s to %d vehicles", signal.Type, len(filtered))
+	return filtered
+}
 
-	result := DispatchResult{
-		Assignments:  make(map[string]float64, len(assignments)),
-		Errors:       make(map[string]error),
-		Acknowledged: make(map[string]bool),
-		Scores:       make(map[string]float64),
-	}
-	for id, p := range assignments {
-		result.Assignments[id] = p
+// applyPredictions updates availability probabilities and SoC of the vehicles
+// using the configured prediction engine.
+func (m *DispatchManager) applyPredictions(signal model.FlexibilitySignal, filtered []model.Vehicle) {
+	var avrecs []metrics.VehicleAvailability
+	horizon := signal.Duration
+	if horizon <= 0 {
+		horizon = time.Hour
+	}
+	for i, v := range filtered {
+		filtered[i].AvailabilityProb = m.prediction.PredictAvailability(v.ID, signal.Timestamp.Add(horizon))
+		if fc := m.prediction.ForecastSoC(v.ID, horizon); len(fc) > 0 {
+			filtered[i].SoC = fc[len(fc)-1]
+		}
+		avrecs = append(avrecs, metrics.VehicleAvailability{
+			VehicleID:   v.ID,
+			Probability: filtered[i].AvailabilityProb,
+			Time:        time.Now(),
+		})
 	}
-
-	if sd, ok := used.(ScoringDispatcher); ok {
-		for id, s := range sd.GetScores() {
-			result.Scores[id] = s
+	if vr, ok := m.metrics.(metrics.VehicleAvailabilityRecorder); ok && len(avrecs) > 0 {
+		if err := vr.RecordVehicleAvailability(avrecs); err != nil {
+			m.logger.Errorf("availability metrics error: %v", err)
 		}
 	}
+}
+
+// dispatchVehicles selects the vehicles, allocates the signal across them,
+// publishes the orders and records the outcome. It returns the result along
+// with the selected vehicles.
+func (m *DispatchManager) dispatchVehicles(signal model.FlexibilitySignal, vehicles []model.Vehicle) (DispatchResult, []model.Vehicle) {
+	vehicles = m.discoverVehicles(vehicles)
+	m.reloadMu.RLock()
+	defer m.reloadMu.RUnlock()
+	filtered, result := m.planDispatch(signal, vehicles)
 
 	lr, recordLatency := m.metrics.(metrics.LatencyRecorder)
 	latencies := m.dispatchAssignments(&result, signal, recordLatency)
 
 	failed := m.unacknowledged(filtered, result.Acknowledged)
-	if len(failed) > 0 {
-		m.logger.Warnf("%d vehicles failed, reallocating", len(failed))
-		result.FallbackAssignments = m.fallback.Reallocate(failed, result.Assignments, signal)
-	}
-
-	result.Signal = signal
-	if mp, ok := used.(MarketPriceProvider); ok {
-		result.MarketPrice = mp.GetMarketPrice()
+	if partial := partialApplied(result); len(failed) > 0 || len(partial) > 0 {
+		m.logger.Warnf("%d vehicles failed and %d applied part of their setpoint, reallocating", len(failed), len(partial))
+		m.runFallbackRounds(&result, filtered, failed)
 	}
 	m.recordMetrics(result, latencies, lr, recordLatency)
 	m.mu.Lock()
-	m.history = append(m.history, result)
-	hist := append([]DispatchResult(nil), m.history...)
+	hist := m.history
 	m.mu.Unlock()
-	if m.store != nil {
-		vids := make([]string, 0, len(filtered))
-		for _, v := range filtered {
-			vids = append(vids, v.ID)
-		}
-		lr := logging.Result{
-			Assignments:         result.Assignments,
-			FallbackAssignments: result.FallbackAssignments,
-			Errors:              map[string]string{},
-			Acknowledged:        result.Acknowledged,
-			Signal:              result.Signal,
-			MarketPrice:         result.MarketPrice,
-			Scores:              result.Scores,
-		}
-		for id, err := range result.Errors {
-			if err != nil {
-				lr.Errors[id] = err.Error()
-			}
-		}
-		_ = m.store.Append(context.Background(), logging.LogRecord{
-			Timestamp:        time.Now(),
-			Signal:           signal,
-			TargetPower:      signal.PowerKW,
-			VehiclesSelected: vids,
-			Response:         lr,
-		})
-	}
+	hist.Append(result)
+	m.appendLog(result, filtered)
 	if m.statusStore != nil {
 		dec := vehiclestatus.LastDispatch{
 			SignalType:       signal.Type.String(),
@@ -314,10 +515,118 @@ func (m *DispatchManager) Dispatch(signal model.FlexibilitySignal, vehicles []mo
 	if m.tuner != nil {
 		m.tuner.Tune(hist)
 	}
-	if sl, ok := m.logger.(logger.StructuredLogger); ok {
-		sl.Debugw("dispatch_complete", map[string]any{"signal": signal.Type.String(), "duration_ms": time.Since(start).Milliseconds()})
+	return result, filtered
+}
+
+// planDispatch selects the vehicles, allocates the signal and reserves the
+// allocation in the ledger. Planning is serialised so that concurrent
+// dispatches never share the same headroom.
+func (m *DispatchManager) planDispatch(signal model.FlexibilitySignal, vehicles []model.Vehicle) ([]model.Vehicle, DispatchResult) {
+	m.planMu.Lock()
+	defer m.planMu.Unlock()
+	headroom := m.applyHeadroom(signal, vehicles, 0)
+	filtered := m.filterVehicles(signal, headroom)
+	if va, ok := m.fallback.(VehicleAwareFallback); ok {
+		va.SetVehicles(filtered)
+	}
+	if m.bus != nil {
+		m.bus.Publish(events.SignalEvent{Signal: signal})
+	}
+	assignments, used, plan := m.dispatchStrategy(filtered, signal)
+	m.logger.Infof("dispatching %s to %d vehicles", signal.Type, len(filtered))
+
+	result := newDispatchResult(signal)
+	result.commitment = m.ledger.Open(signal)
+	result.MarketPrice = m.marketPrice(used, signal)
+	for id, p := range assignments {
+		result.Assignments[id] = p
+		m.ledger.Set(result.commitment, id, p)
+	}
+
+	if sd, ok := used.(ScoringDispatcher); ok {
+		for id, s := range sd.GetScores() {
+			result.Scores[id] = s
+		}
+	}
+	if sr, ok := used.(SegmentReporter); ok {
+		result.Segments = sr.GetSegments()
+	}
+	result.Trace = m.traceDecisions(signal, vehicles, headroom, filtered, assignments, used)
+	result.WearCostEUR = wearCosts(filtered, signal, assignments)
+	m.markSeen(vehicles)
+	if plan != nil {
+		result.Plan = plan
+		for id, kw := range plan.Peak() {
+			m.ledger.Reserve(result.commitment, id, kw)
+		}
+	}
+	return filtered, result
+}
+
+// newDispatchResult returns an empty result for the signal with all maps
+// initialised.
+func newDispatchResult(signal model.FlexibilitySignal) DispatchResult {
+	return DispatchResult{
+		Assignments:  make(map[string]float64),
+		Errors:       make(map[string]error),
+		Acknowledged: make(map[string]bool),
+		Scores:       make(map[string]float64),
+		Applied:      make(map[string]float64),
+		AckReasons:   make(map[string]string),
+		Signal:       signal,
+	}
+}
+
+// AppliedPower returns the power the vehicle acknowledged applying for its
+// assignment, or the assignment when the result records no applied power.
+func (r DispatchResult) AppliedPower(id string) float64 {
+	if p, ok := r.Applied[id]; ok {
+		return p
+	}
+	return r.Assignments[id]
+}
+
+// appendLog persists the result in the configured log store, if any.
+func (m *DispatchManager) appendLog(result DispatchResult, selected []model.Vehicle) {
+	m.mu.Lock()
+	store := m.store
+	m.mu.Unlock()
+	if store == nil {
+		return
+	}
+	vids := make([]string, 0, len(selected))
+	for _, v := range selected {
+		vids = append(vids, v.ID)
+	}
+	lr := logging.Result{
+		Assignments:         result.Assignments,
+		FallbackAssignments: result.FallbackAssignments,
+		FallbackRounds:      logFallbackRounds(result.FallbackRounds),
+		Errors:              map[string]string{},
+		Acknowledged:        result.Acknowledged,
+		Signal:              result.Signal,
+		MarketPrice:         result.MarketPrice,
+		Scores:              result.Scores,
+		Trace:               logTrace(result.Trace),
+		WearCostEUR:         result.WearCostEUR,
+		Applied:             result.Applied,
+		AckReasons:          result.AckReasons,
+	}
+	for id, err := range result.Errors {
+		if err != nil {
+			lr.Errors[id] = err.Error()
+		}
+	}
+	if err := store.Append(context.Background(), logging.LogRecord{
+		Timestamp:        time.Now(),
+		Signal:           result.Signal,
+		TargetPower:      result.Signal.PowerKW,
+		VehiclesSelected: vids,
+		Round:            result.Round,
+		Response:         lr,
+	}); err != nil {
+		m.logger.Errorf("dispatch log error: %v", err)
 	}
-	return result
 }
 
 // dispatchAssignments publishes the orders concurrently and records acknowledgments.
@@ -327,6 +636,9 @@ func (m *DispatchManager) dispatchAssignments(res *DispatchResult, signal model.
 		mu       sync.Mutex
 		lat      []metrics.DispatchLatency
 		ackCount int
+		until    = orderDeadline(signal)
+
+		requestedKW, appliedKW float64
 	)
 	update := func(id, orderID string, ack bool, err error, dur time.Duration) {
 		mu.Lock()
@@ -359,12 +671,38 @@ func (m *DispatchManager) dispatchAssignments(res *DispatchResult, signal model.
 			ackCount++
 		}
 	}
+	record := func(id string, requested, applied float64, ack mqtt.Ack) {
+		mu.Lock()
+		defer mu.Unlock()
+		res.Applied[id] = applied
+		if ack.Reason != "" {
+			res.AckReasons[id] = ack.Reason
+		}
+		if ack.Status != "" {
+			ackStatus.WithLabelValues(signal.Type.String(), string(ack.Status)).Inc()
+		}
+		requestedKW += math.Abs(requested)
+		appliedKW += math.Abs(applied)
+	}
 	for id, power := range res.Assignments {
 		wg.Add(1)
 		go func(id string, p float64) {
 			defer wg.Done()
 			defer monitoring.Recover()
-			orderID, ack, d, err := m.sendAndWait(id, p)
+			base, _, _ := m.ledger.Active(id, res.commitment)
+			m.ledger.Set(res.commitment, id, p)
+			orderID, ack, d, err := m.sendAndWait(id, base+p, until, signal)
+			if err == nil && ack.Status == mqtt.AckRejected {
+				err = fmt.Errorf("%w: %s", mqtt.ErrOrderRejected, ack.Reason)
+			}
+			accepted := err == nil && ack.Accepted()
+			applied := 0.0
+			if accepted {
+				applied = appliedShare(p, ack.Applied(base+p)-base)
+			}
+			if applied != p {
+				m.ledger.Set(res.commitment, id, applied)
+			}
 			if err != nil {
 				monitoring.CaptureException(err, map[string]string{
 					"vehicle_id":  id,
@@ -372,7 +710,11 @@ func (m *DispatchManager) dispatchAssignments(res *DispatchResult, signal model.
 					"module":      "dispatch_manager",
 				})
 			}
-			update(id, orderID, ack, err, d)
+			if accepted && applied != p {
+				m.logger.Warnf("%s applied %.2f kW of %.2f kW for %s (%s)", id, applied, p, signal.Type, ack.Status)
+			}
+			record(id, p, applied, ack)
+			update(id, orderID, accepted, err, d)
 			if rec, ok := m.metrics.(metrics.DispatchOrderRecorder); ok {
 				_ = rec.RecordDispatchOrder(metrics.DispatchOrderEvent{
 					OrderID:     orderID,
@@ -381,7 +723,7 @@ func (m *DispatchManager) dispatchAssignments(res *DispatchResult, signal model.
 					PowerKW:     p,
 					Score:       res.Scores[id],
 					MarketPrice: res.MarketPrice,
-					Accepted:    err == nil && ack,
+					Accepted:    accepted,
 					Time:        time.Now(),
 				})
 			}
@@ -391,9 +733,21 @@ func (m *DispatchManager) dispatchAssignments(res *DispatchResult, signal model.
 	if total := len(res.Assignments); total > 0 {
 		ackRate.WithLabelValues(signal.Type.String()).Set(float64(ackCount) / float64(total))
 	}
+	if requestedKW > 0 {
+		appliedRatio.WithLabelValues(signal.Type.String()).Set(appliedKW / requestedKW)
+	}
 	return lat
 }
 
+// appliedShare bounds the power a vehicle reported applying for a setpoint
+// between zero and the requested power.
+func appliedShare(requested, applied float64) float64 {
+	if requested < 0 {
+		return -appliedShare(-requested, -applied)
+	}
+	return math.Max(0, math.Min(applied, requested))
+}
+
 // unacknowledged returns the subset of vehicles that did not acknowledge.
 func (m *DispatchManager) unacknowledged(all []model.Vehicle, acks map[string]bool) []model.Vehicle {
 	var failed []model.Vehicle
@@ -418,6 +772,7 @@ func (m *DispatchManager) recordMetrics(res DispatchResult, lat []metrics.Dispat
 			EndTime:      res.Signal.Timestamp.Add(res.Signal.Duration),
 			VehicleID:    vid,
 			PowerKW:      p,
+			AppliedKW:    res.AppliedPower(vid),
 			Score:        res.Scores[vid],
 			MarketPrice:  res.MarketPrice,
 			Acknowledged: res.Acknowledged[vid],
@@ -84,7 +84,7 @@ func TestContextParticipation(t *testing.T) {
 func TestNoopTuner(t *testing.T) {
 	var tuner NoopTuner
 	// should not panic or modify input
-	tuner.Tune([]DispatchResult{})
+	tuner.Tune(NewMemoryHistory(HistoryConfig{}))
 }
 
 type dummyDiscovery struct{ closed bool }
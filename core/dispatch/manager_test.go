@@ -16,6 +16,7 @@ type fakeStatusStore struct {
 
 func (f *fakeStatusStore) Set(vehiclestatus.Status)                         {}
 func (f *fakeStatusStore) List(vehiclestatus.Filter) []vehiclestatus.Status { return nil }
+func (f *fakeStatusStore) SetHealth(string, vehiclestatus.Health)           {}
 func (f *fakeStatusStore) RecordDispatch(id string, dec vehiclestatus.LastDispatch) {
 	if f.calls == nil {
 		f.calls = make(map[string]vehiclestatus.LastDispatch)
@@ -5,15 +5,63 @@ import (
 )
 
 var (
-	dispatchLatency    *prometheus.HistogramVec
-	vehiclesDispatched *prometheus.CounterVec
-	ackRate            *prometheus.GaugeVec
-	mqttSuccess        prometheus.Counter
-	mqttFailure        prometheus.Counter
+	dispatchLatency     *prometheus.HistogramVec
+	vehiclesDispatched  *prometheus.CounterVec
+	ackRate             *prometheus.GaugeVec
+	mqttSuccess         prometheus.Counter
+	mqttFailure         prometheus.Counter
+	fallbackOrders      *prometheus.CounterVec
+	gridFrequency       prometheus.Gauge
+	droopSetpoint       prometheus.Gauge
+	tunerWeight         *prometheus.GaugeVec
+	tunerReward         *prometheus.GaugeVec
+	tunerUpdates        *prometheus.CounterVec
+	vehicleBreakerState *prometheus.GaugeVec
+	breakerTransitions  *prometheus.CounterVec
+	ackStatus           *prometheus.CounterVec
+	appliedRatio        *prometheus.GaugeVec
 )
 
+// collectors groups the dispatch metric collectors.
+type collectors struct {
+	latency             *prometheus.HistogramVec
+	vehiclesDispatched  *prometheus.CounterVec
+	ackRate             *prometheus.GaugeVec
+	mqttSuccess         prometheus.Counter
+	mqttFailure         prometheus.Counter
+	fallbackOrders      *prometheus.CounterVec
+	gridFrequency       prometheus.Gauge
+	droopSetpoint       prometheus.Gauge
+	tunerWeight         *prometheus.GaugeVec
+	tunerReward         *prometheus.GaugeVec
+	tunerUpdates        *prometheus.CounterVec
+	vehicleBreakerState *prometheus.GaugeVec
+	breakerTransitions  *prometheus.CounterVec
+	ackStatus           *prometheus.CounterVec
+	appliedRatio        *prometheus.GaugeVec
+}
+
+// use makes c the collectors updated by the package.
+func (c collectors) use() {
+	dispatchLatency = c.latency
+	vehiclesDispatched = c.vehiclesDispatched
+	ackRate = c.ackRate
+	mqttSuccess = c.mqttSuccess
+	mqttFailure = c.mqttFailure
+	fallbackOrders = c.fallbackOrders
+	gridFrequency = c.gridFrequency
+	droopSetpoint = c.droopSetpoint
+	tunerWeight = c.tunerWeight
+	tunerReward = c.tunerReward
+	tunerUpdates = c.tunerUpdates
+	vehicleBreakerState = c.vehicleBreakerState
+	breakerTransitions = c.breakerTransitions
+	ackStatus = c.ackStatus
+	appliedRatio = c.appliedRatio
+}
+
 // newCollectors creates new metric collectors.
-func newCollectors() (*prometheus.HistogramVec, *prometheus.CounterVec, *prometheus.GaugeVec, prometheus.Counter, prometheus.Counter) {
+func newCollectors() collectors {
 	lat := prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "dispatch_execution_latency_seconds",
@@ -48,11 +96,95 @@ func newCollectors() (*prometheus.HistogramVec, *prometheus.CounterVec, *prometh
 			Help: "Number of failed MQTT publish operations",
 		},
 	)
-	return lat, veh, ack, suc, fail
+	fb := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dispatch_fallback_orders_total",
+			Help: "Number of orders published during fallback rounds",
+		},
+		[]string{"signal_type", "acknowledged"},
+	)
+	freq := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "grid_frequency_hz",
+			Help: "Last grid frequency used by the droop controller",
+		},
+	)
+	droop := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "droop_setpoint_kw",
+			Help: "Fleet setpoint computed by the droop controller",
+		},
+	)
+	weight := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dispatch_tuner_weight",
+			Help: "Score weight in use for a signal type",
+		},
+		[]string{"signal_type", "weight"},
+	)
+	reward := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dispatch_tuner_reward",
+			Help: "Estimated dispatch outcome reward of the learned weights",
+		},
+		[]string{"signal_type"},
+	)
+	updates := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dispatch_tuner_updates_total",
+			Help: "Number of weight changes by the learning tuner",
+		},
+		[]string{"signal_type", "action"},
+	)
+	breaker := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vehicle_breaker_state",
+			Help: "Circuit breaker state of a vehicle (0 closed, 1 half-open, 2 open)",
+		},
+		[]string{"vehicle_id"},
+	)
+	transitions := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "vehicle_breaker_transitions_total",
+			Help: "Number of vehicle circuit breaker transitions to a state",
+		},
+		[]string{"state"},
+	)
+	status := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dispatch_ack_status_total",
+			Help: "Number of acknowledgments by reported status",
+		},
+		[]string{"signal_type", "status"},
+	)
+	applied := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dispatch_applied_power_ratio",
+			Help: "Share of the requested power the vehicles acknowledged applying",
+		},
+		[]string{"signal_type"},
+	)
+	return collectors{
+		latency:             lat,
+		vehiclesDispatched:  veh,
+		ackRate:             ack,
+		mqttSuccess:         suc,
+		mqttFailure:         fail,
+		fallbackOrders:      fb,
+		gridFrequency:       freq,
+		droopSetpoint:       droop,
+		tunerWeight:         weight,
+		tunerReward:         reward,
+		tunerUpdates:        updates,
+		vehicleBreakerState: breaker,
+		breakerTransitions:  transitions,
+		ackStatus:           status,
+		appliedRatio:        applied,
+	}
 }
 
 func init() {
-	dispatchLatency, vehiclesDispatched, ackRate, mqttSuccess, mqttFailure = newCollectors()
+	newCollectors().use()
 	MustRegisterMetrics(nil)
 }
 
@@ -62,13 +194,13 @@ func MustRegisterMetrics(reg prometheus.Registerer) {
 	if reg == nil {
 		reg = prometheus.DefaultRegisterer
 	}
-	reg.MustRegister(dispatchLatency, vehiclesDispatched, ackRate, mqttSuccess, mqttFailure)
+	reg.MustRegister(dispatchLatency, vehiclesDispatched, ackRate, mqttSuccess, mqttFailure, fallbackOrders, gridFrequency, droopSetpoint, tunerWeight, tunerReward, tunerUpdates, vehicleBreakerState, breakerTransitions, ackStatus, appliedRatio)
 }
 
 // ResetMetrics reinitializes metrics collectors for testing purposes and
 // registers them on the provided registry if not nil.
 func ResetMetrics(reg prometheus.Registerer) {
-	dispatchLatency, vehiclesDispatched, ackRate, mqttSuccess, mqttFailure = newCollectors()
+	newCollectors().use()
 	if reg != nil {
 		MustRegisterMetrics(reg)
 	}
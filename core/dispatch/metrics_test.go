@@ -17,6 +17,16 @@ func TestMetricsRegistration(t *testing.T) {
 	ackRate.WithLabelValues("FCR").Set(1)
 	mqttSuccess.Inc()
 	mqttFailure.Inc()
+	fallbackOrders.WithLabelValues("FCR", "true").Inc()
+	gridFrequency.Set(50)
+	droopSetpoint.Set(0)
+	tunerWeight.WithLabelValues("FCR", "soc").Set(0.4)
+	tunerReward.WithLabelValues("FCR").Set(1)
+	tunerUpdates.WithLabelValues("FCR", "explore").Inc()
+	vehicleBreakerState.WithLabelValues("v1").Set(2)
+	breakerTransitions.WithLabelValues("open").Inc()
+	ackStatus.WithLabelValues("FCR", "partial").Inc()
+	appliedRatio.WithLabelValues("FCR").Set(0.8)
 	mfs, err := reg.Gather()
 	if err != nil {
 		t.Fatalf("gather: %v", err)
@@ -31,6 +41,16 @@ func TestMetricsRegistration(t *testing.T) {
 		"ack_rate",
 		"mqtt_publish_success_total",
 		"mqtt_publish_failure_total",
+		"dispatch_fallback_orders_total",
+		"grid_frequency_hz",
+		"droop_setpoint_kw",
+		"dispatch_tuner_weight",
+		"dispatch_tuner_reward",
+		"dispatch_tuner_updates_total",
+		"vehicle_breaker_state",
+		"vehicle_breaker_transitions_total",
+		"dispatch_ack_status_total",
+		"dispatch_applied_power_ratio",
 	}
 	for _, n := range expected {
 		if !names[n] {
@@ -0,0 +1,246 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultParticipationHalfLife is the time after which the recorded
+// participation of a vehicle counts for half.
+const DefaultParticipationHalfLife = 7 * 24 * time.Hour
+
+// ParticipationConfig configures the participation ledger. StatePath persists
+// the ledger across restarts; it is kept in memory only when empty.
+// HalfLifeHours defaults to a week.
+type ParticipationConfig struct {
+	Enabled       bool    `json:"enabled"`
+	StatePath     string  `json:"state_path"`
+	HalfLifeHours float64 `json:"half_life_hours"`
+}
+
+// Validate checks the participation settings.
+func (c ParticipationConfig) Validate() error {
+	if c.HalfLifeHours < 0 {
+		return errors.New("dispatch.participation.half_life_hours must not be negative")
+	}
+	return nil
+}
+
+// VehicleParticipation is the decayed usage of a vehicle.
+type VehicleParticipation struct {
+	VehicleID   string  `json:"vehicle_id"`
+	EnergyKWh   float64 `json:"energy_kwh"`
+	Activations float64 `json:"activations"`
+	// Share is the part of the fleet energy throughput the vehicle provided.
+	Share float64 `json:"share"`
+	// Score is the participation score used by the dispatchers.
+	Score float64 `json:"score"`
+}
+
+// participationEntry holds the usage of a vehicle decayed to Updated.
+type participationEntry struct {
+	EnergyKWh   float64   `json:"energy_kwh"`
+	Activations float64   `json:"activations"`
+	Updated     time.Time `json:"updated"`
+}
+
+// ParticipationLedger records the energy throughput and the activations of
+// each vehicle with exponential decay. It implements ParticipationSource: the
+// score of a vehicle is the mean of its energy and activations relative to the
+// most used vehicle, so the fairness and wear penalties steer dispatches
+// towards the vehicles used least recently.
+type ParticipationLedger struct {
+	halfLife time.Duration
+	path     string
+	now      func() time.Time
+
+	mu       sync.Mutex
+	vehicles map[string]*participationEntry
+}
+
+// NewParticipationLedger returns a ledger restored from cfg.StatePath when the
+// file exists.
+func NewParticipationLedger(cfg ParticipationConfig) (*ParticipationLedger, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	l := &ParticipationLedger{
+		halfLife: time.Duration(cfg.HalfLifeHours * float64(time.Hour)),
+		path:     cfg.StatePath,
+		now:      time.Now,
+		vehicles: make(map[string]*participationEntry),
+	}
+	if l.halfLife == 0 {
+		l.halfLife = DefaultParticipationHalfLife
+	}
+	if l.path == "" {
+		return l, nil
+	}
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read participation ledger: %w", err)
+	}
+	if err := json.Unmarshal(data, &l.vehicles); err != nil {
+		return nil, fmt.Errorf("decode participation ledger: %w", err)
+	}
+	return l, nil
+}
+
+// Record adds the energy each vehicle delivered in one activation and
+// persists the ledger. A zero energy only counts the activation.
+func (l *ParticipationLedger) Record(energyKWh map[string]float64) error {
+	return l.add(energyKWh, 1)
+}
+
+// Credit adds the energy each vehicle delivered while holding a setpoint of
+// an activation already recorded, and persists the ledger.
+func (l *ParticipationLedger) Credit(energyKWh map[string]float64) error {
+	return l.add(energyKWh, 0)
+}
+
+func (l *ParticipationLedger) add(energyKWh map[string]float64, activations float64) error {
+	if len(energyKWh) == 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for id, e := range energyKWh {
+		entry := l.decayed(id, now)
+		entry.EnergyKWh += math.Abs(e)
+		entry.Activations += activations
+		l.vehicles[id] = &entry
+	}
+	return l.save()
+}
+
+// ParticipationScores implements ParticipationSource.
+func (l *ParticipationLedger) ParticipationScores() map[string]float64 {
+	scores := make(map[string]float64)
+	for _, p := range l.Report() {
+		scores[p.VehicleID] = p.Score
+	}
+	return scores
+}
+
+// Report returns the participation of each recorded vehicle, sorted by
+// vehicle ID.
+func (l *ParticipationLedger) Report() []VehicleParticipation {
+	l.mu.Lock()
+	now := l.now()
+	res := make([]VehicleParticipation, 0, len(l.vehicles))
+	var total, maxEnergy, maxActivations float64
+	for id := range l.vehicles {
+		e := l.decayed(id, now)
+		res = append(res, VehicleParticipation{VehicleID: id, EnergyKWh: e.EnergyKWh, Activations: e.Activations})
+		total += e.EnergyKWh
+		maxEnergy = math.Max(maxEnergy, e.EnergyKWh)
+		maxActivations = math.Max(maxActivations, e.Activations)
+	}
+	l.mu.Unlock()
+
+	for i := range res {
+		p := &res[i]
+		if total > 0 {
+			p.Share = p.EnergyKWh / total
+		}
+		if maxEnergy > 0 {
+			p.Score += p.EnergyKWh / maxEnergy / 2
+		}
+		if maxActivations > 0 {
+			p.Score += p.Activations / maxActivations / 2
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].VehicleID < res[j].VehicleID })
+	return res
+}
+
+// decayed returns the usage of a vehicle decayed to now. l.mu must be held.
+func (l *ParticipationLedger) decayed(id string, now time.Time) participationEntry {
+	e, ok := l.vehicles[id]
+	if !ok {
+		return participationEntry{Updated: now}
+	}
+	f := 1.0
+	if age := now.Sub(e.Updated); age > 0 {
+		f = math.Exp2(-float64(age) / float64(l.halfLife))
+	}
+	return participationEntry{EnergyKWh: e.EnergyKWh * f, Activations: e.Activations * f, Updated: now}
+}
+
+// save writes the ledger to its state file atomically. l.mu must be held.
+func (l *ParticipationLedger) save() error {
+	if l.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(l.vehicles)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".participation-*")
+	if err != nil {
+		return fmt.Errorf("write participation ledger: %w", err)
+	}
+	_, werr := tmp.Write(data)
+	if err := errors.Join(werr, tmp.Close()); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write participation ledger: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write participation ledger: %w", err)
+	}
+	return nil
+}
+
+// deliveredEnergy returns the energy each vehicle delivered holding the
+// setpoints it acknowledged last for hold. The energy is zero when the hold
+// time is unknown, so that only the activation is counted.
+func deliveredEnergy(res DispatchResult, hold time.Duration) map[string]float64 {
+	energy := make(map[string]float64)
+	for id, kw := range heldSetpoints(res) {
+		if kw != 0 {
+			energy[id] = math.Abs(kw) * math.Max(0, hold.Hours())
+		}
+	}
+	return energy
+}
+
+// heldEnergy returns the energy of the setpoints held for hold.
+func heldEnergy(setpoints map[string]float64, hold time.Duration) map[string]float64 {
+	if hold <= 0 {
+		return nil
+	}
+	energy := make(map[string]float64, len(setpoints))
+	for id, kw := range setpoints {
+		if kw != 0 {
+			energy[id] = math.Abs(kw) * hold.Hours()
+		}
+	}
+	return energy
+}
+
+// FairnessIndex returns Jain's fairness index of the energy throughput of the
+// vehicles: 1 when they all delivered the same energy, down to 1/n when a
+// single vehicle delivered everything. It is 1 without throughput.
+func FairnessIndex(ps []VehicleParticipation) float64 {
+	var sum, sq float64
+	for _, p := range ps {
+		sum += p.EnergyKWh
+		sq += p.EnergyKWh * p.EnergyKWh
+	}
+	if sq == 0 {
+		return 1
+	}
+	return sum * sum / (float64(len(ps)) * sq)
+}
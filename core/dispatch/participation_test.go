@@ -0,0 +1,167 @@
+package dispatch
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+func TestParticipationLedger_DecayAndScores(t *testing.T) {
+	l, err := NewParticipationLedger(ParticipationConfig{HalfLifeHours: 1})
+	if err != nil {
+		t.Fatalf("ledger: %v", err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	if err := l.Record(map[string]float64{"v1": 10, "v2": 5}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	now = now.Add(time.Hour)
+	if err := l.Record(map[string]float64{"v2": 5}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	rep := l.Report()
+	if len(rep) != 2 || rep[0].VehicleID != "v1" {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+	v1, v2 := rep[0], rep[1]
+	if v1.EnergyKWh != 5 || v1.Activations != 0.5 {
+		t.Fatalf("expected v1 halved after one half-life, got %+v", v1)
+	}
+	if v2.EnergyKWh != 7.5 || v2.Activations != 1.5 {
+		t.Fatalf("unexpected v2 usage %+v", v2)
+	}
+	if math.Abs(v2.Share-0.6) > 1e-9 || v2.Score != 1 {
+		t.Fatalf("expected v2 most used, got %+v", v2)
+	}
+	if want := (5.0/7.5 + 0.5/1.5) / 2; math.Abs(l.ParticipationScores()["v1"]-want) > 1e-9 {
+		t.Fatalf("expected v1 score %v, got %v", want, l.ParticipationScores()["v1"])
+	}
+	if idx := FairnessIndex(rep); idx <= 0.5 || idx >= 1 {
+		t.Fatalf("unexpected fairness index %v", idx)
+	}
+}
+
+func TestParticipationLedger_Persists(t *testing.T) {
+	cfg := ParticipationConfig{StatePath: filepath.Join(t.TempDir(), "participation.json")}
+	l, err := NewParticipationLedger(cfg)
+	if err != nil {
+		t.Fatalf("ledger: %v", err)
+	}
+	if err := l.Record(map[string]float64{"v1": 4}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	restored, err := NewParticipationLedger(cfg)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	rep := restored.Report()
+	if len(rep) != 1 || math.Abs(rep[0].EnergyKWh-4) > 1e-6 || math.Abs(rep[0].Activations-1) > 1e-6 {
+		t.Fatalf("unexpected restored ledger %+v", rep)
+	}
+}
+
+func TestDispatchManager_RecordsParticipation(t *testing.T) {
+	vehicles := []model.Vehicle{
+		{ID: "v1", SoC: 0.8, IsV2G: true, Available: true, MaxPower: 10, BatteryKWh: 50},
+		{ID: "v2", SoC: 0.8, IsV2G: true, Available: true, MaxPower: 10, BatteryKWh: 50},
+	}
+	pub := mqtt.NewMockPublisher()
+	pub.FailIDs["v2"] = true
+	disp := NewSmartDispatcher()
+	m, err := NewDispatchManager(SimpleVehicleFilter{}, &disp, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	l, err := NewParticipationLedger(ParticipationConfig{})
+	if err != nil {
+		t.Fatalf("ledger: %v", err)
+	}
+	m.SetParticipationLedger(l)
+	if disp.Usage != l {
+		t.Fatalf("expected ledger injected into the dispatcher")
+	}
+	res := m.Dispatch(model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 10, Duration: 30 * time.Minute, Timestamp: time.Now()}, vehicles)
+
+	rep := m.ParticipationReport()
+	if len(rep) != 1 || rep[0].VehicleID != "v1" || math.Abs(rep[0].Activations-1) > 1e-6 || math.Abs(rep[0].EnergyKWh-res.Assignments["v1"]/2) > 1e-6 {
+		t.Fatalf("expected only the acknowledged vehicle recorded for 30 min, got %+v", rep)
+	}
+	if scores := disp.participationScores(); scores["v1"] != 1 || scores["v2"] != 0 {
+		t.Fatalf("unexpected participation scores %v", scores)
+	}
+}
+
+func participationManager(t *testing.T) (*DispatchManager, *ParticipationLedger) {
+	t.Helper()
+	m, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, mqtt.NewMockPublisher(), time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	l, err := NewParticipationLedger(ParticipationConfig{})
+	if err != nil {
+		t.Fatalf("ledger: %v", err)
+	}
+	m.SetParticipationLedger(l)
+	return m, l
+}
+
+func TestDispatchManager_UnknownDurationCountsActivationOnly(t *testing.T) {
+	m, l := participationManager(t)
+	v := model.Vehicle{ID: "v1", SoC: 0.8, IsV2G: true, Available: true, MaxPower: 10, BatteryKWh: 50}
+	m.Dispatch(model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 10, Timestamp: time.Now()}, []model.Vehicle{v})
+
+	rep := l.Report()
+	if len(rep) != 1 || math.Abs(rep[0].Activations-1) > 1e-6 || rep[0].EnergyKWh != 0 {
+		t.Fatalf("expected an activation without energy, got %+v", rep)
+	}
+}
+
+func TestCorrectSession_RecordsParticipation(t *testing.T) {
+	m, l := participationManager(t)
+	now := time.Now()
+	sig := model.FlexibilitySignal{Type: model.SignalAFRR, PowerKW: 10, Duration: time.Hour, Timestamp: now}
+	v := model.Vehicle{ID: "v1", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 40}
+	s := newSession(sig, []model.Vehicle{v}, DispatchResult{})
+	s.setpoints["v1"] = 5
+	s.commitment = m.ledger.Open(sig)
+	s.heldSince = now.Add(-30 * time.Minute)
+
+	if _, ok := m.correctSession(s, SessionConfig{ToleranceKW: 0.1}, now); !ok {
+		t.Fatalf("expected a correction round")
+	}
+	// 5 kW held for 30 min before the round raised the setpoint.
+	rep := l.Report()
+	if len(rep) != 1 || math.Abs(rep[0].EnergyKWh-2.5) > 1e-6 || math.Abs(rep[0].Activations-1) > 1e-6 {
+		t.Fatalf("expected the held energy and the round activation, got %+v", rep)
+	}
+	if !s.heldSince.Equal(now) {
+		t.Fatalf("expected the new setpoint held from the round")
+	}
+}
+
+func TestDroopRound_RecordsParticipation(t *testing.T) {
+	m, l := participationManager(t)
+	now := time.Now()
+	sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 20, Duration: time.Hour, Timestamp: now}
+	s := newSession(sig, droopVehicles(), DispatchResult{})
+	s.commitment = m.ledger.Open(sig)
+	s.setpoints["v1"] = 10
+	s.heldSince = now.Add(-6 * time.Minute)
+	shares := map[string]float64{"v1": 10, "v2": 10}
+
+	if _, ok := m.droopRound(context.Background(), s, DroopConfig{}, fixedFrequency(49.895), shares, now); !ok {
+		t.Fatalf("expected a droop round")
+	}
+	rep := l.Report()
+	// v1 held 10 kW for 6 min, then both vehicles acknowledged 5 kW.
+	if len(rep) != 2 || math.Abs(rep[0].EnergyKWh-1) > 1e-6 || rep[1].EnergyKWh != 0 || math.Abs(rep[1].Activations-1) > 1e-6 {
+		t.Fatalf("unexpected participation %+v", rep)
+	}
+}
@@ -0,0 +1,131 @@
+package dispatch
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/market"
+	coremetrics "github.com/kilianp07/v2g/core/metrics"
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+func priceBook(t0 time.Time) *market.Book {
+	b := market.NewBook()
+	b.Set(market.DayAhead, market.Series{
+		{Start: t0, End: t0.Add(time.Hour), Price: 0.05},
+		{Start: t0.Add(time.Hour), End: t0.Add(2 * time.Hour), Price: 0.2},
+	})
+	b.Set(market.Imbalance, market.Series{{Start: t0, End: t0.Add(2 * time.Hour), Price: 0.5}})
+	return b
+}
+
+func TestDispatchManager_PricesSignalAtTimestamp(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sd := NewSmartDispatcher()
+	sd.MarketPrice = 1
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, &sd, NoopFallback{}, mqtt.NewMockPublisher(), time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	vehicles := []model.Vehicle{{ID: "v1", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 50}}
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 5, Duration: time.Minute, Timestamp: t0.Add(30 * time.Minute)}
+
+	if res := mgr.DryRun(sig, vehicles); res.MarketPrice != 1 {
+		t.Fatalf("expected the static price without a provider, got %v", res.MarketPrice)
+	}
+	mgr.SetPriceProvider(priceBook(t0))
+	if res := mgr.Dispatch(sig, vehicles); res.MarketPrice != 0.05 {
+		t.Fatalf("expected the first day-ahead price, got %v", res.MarketPrice)
+	}
+	sig.Timestamp = t0.Add(90 * time.Minute)
+	res := mgr.Dispatch(sig, vehicles)
+	if res.MarketPrice != 0.2 {
+		t.Fatalf("expected the second day-ahead price, got %v", res.MarketPrice)
+	}
+	if got := res.Trace["v1"].ScoreComponents["price"]; got <= 0 {
+		t.Fatalf("expected the price to feed the score, got %v", got)
+	}
+	sig.Type = model.SignalFCR
+	if res := mgr.DryRun(sig, vehicles); res.MarketPrice != 0.5 {
+		t.Fatalf("expected the imbalance price for FCR, got %v", res.MarketPrice)
+	}
+	sig.Timestamp = t0.Add(3 * time.Hour)
+	if res := mgr.DryRun(sig, vehicles); res.MarketPrice != 1 {
+		t.Fatalf("expected the static price outside the series, got %v", res.MarketPrice)
+	}
+}
+
+func TestDispatchManager_PricesSurviveReload(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, mqtt.NewMockPublisher(), time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	mgr.SetPriceProvider(priceBook(t0))
+	vehicles := []model.Vehicle{{ID: "v1", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 50}}
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 5, Duration: time.Minute, Timestamp: t0.Add(90 * time.Minute)}
+	if res := mgr.DryRun(sig, vehicles); res.MarketPrice != 0.2 {
+		t.Fatalf("expected the provider price with the equal dispatcher, got %v", res.MarketPrice)
+	}
+	if err := mgr.Reload(Config{LPFirst: map[model.SignalType]bool{model.SignalMA: true}, Strategy: StrategyConfig{Dispatcher: "smart"}}); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if sd := mgr.dispatcher.(*SmartDispatcher); sd.Prices == nil || mgr.lpDispatcher.Prices == nil {
+		t.Fatalf("expected the reloaded dispatchers to use the price provider")
+	}
+	if res := mgr.DryRun(sig, vehicles); res.MarketPrice != 0.2 {
+		t.Fatalf("expected the provider price after reload, got %v", res.MarketPrice)
+	}
+}
+
+type orderPriceSink struct {
+	mu     sync.Mutex
+	prices []float64
+}
+
+func (s *orderPriceSink) RecordDispatchResult([]coremetrics.DispatchResult) error { return nil }
+
+func (s *orderPriceSink) RecordDispatchOrder(ev coremetrics.DispatchOrderEvent) error {
+	s.mu.Lock()
+	s.prices = append(s.prices, ev.MarketPrice)
+	s.mu.Unlock()
+	return nil
+}
+
+func TestDispatchManager_OrdersAndRoundsCarryPrice(t *testing.T) {
+	t0 := time.Now().Truncate(time.Hour)
+	sink := &orderPriceSink{}
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, mqtt.NewMockPublisher(), time.Second, sink, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	b := market.NewBook()
+	b.Set(market.DayAhead, market.Series{{Start: t0, End: t0.Add(2 * time.Hour), Price: 0.3}})
+	mgr.SetPriceProvider(b)
+	mgr.SetSessionConfig(SessionConfig{IntervalMS: 10, ToleranceKW: 0.1})
+	vehicles := []model.Vehicle{
+		{ID: "v1", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 50},
+		{ID: "v2", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 50},
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 5, Duration: 50 * time.Millisecond, Timestamp: time.Now()}
+	res := mgr.RunSession(context.Background(), sig, vehicles)
+	for i, r := range res.Rounds {
+		if r.MarketPrice != 0.3 {
+			t.Fatalf("round %d priced at %v", i, r.MarketPrice)
+		}
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.prices) == 0 {
+		t.Fatalf("expected orders to be recorded")
+	}
+	for _, p := range sink.prices {
+		if p != 0.3 {
+			t.Fatalf("expected orders recorded at the signal price, got %v", sink.prices)
+		}
+	}
+}
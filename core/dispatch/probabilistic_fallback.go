@@ -32,12 +32,18 @@ func (p *ProbabilisticFallback) SetVehicles(vs []model.Vehicle) {
 // according to a weighted capacity accounting for SoC, availability and
 // degradation.
 func (p *ProbabilisticFallback) Reallocate(failed []model.Vehicle, current map[string]float64, signal model.FlexibilitySignal) map[string]float64 {
+	return p.ReallocateDeficit(failed, current, 0, signal)
+}
+
+// ReallocateDeficit implements DeficitFallback. It reallocates the deficit
+// along with the power of the failed vehicles.
+func (p *ProbabilisticFallback) ReallocateDeficit(failed []model.Vehicle, current map[string]float64, deficit float64, signal model.FlexibilitySignal) map[string]float64 {
 	res := make(map[string]float64, len(current))
 	for id, pwr := range current {
 		res[id] = pwr
 	}
 
-	if len(failed) == 0 {
+	if len(failed) == 0 && deficit <= 0 {
 		return res
 	}
 
@@ -47,7 +53,7 @@ func (p *ProbabilisticFallback) Reallocate(failed []model.Vehicle, current map[s
 	}
 
 	failedIDs := make(map[string]struct{}, len(failed))
-	var residual float64
+	residual := math.Max(0, deficit)
 	for _, v := range failed {
 		failedIDs[v.ID] = struct{}{}
 		residual += math.Abs(res[v.ID])
@@ -59,7 +65,7 @@ func (p *ProbabilisticFallback) Reallocate(failed []model.Vehicle, current map[s
 
 	p.logger.Infof("fallback: reallocating %.2f kW after %d failures", residual*sign, len(failed))
 
-	avail := p.availableCapacity(current, failedIDs, res)
+	avail := p.availableCapacity(current, failedIDs, res, signal)
 	remaining := allocatePower(avail, res, residual, sign)
 
 	efficiency := 1.0
@@ -76,7 +82,7 @@ func (p *ProbabilisticFallback) Reallocate(failed []model.Vehicle, current map[s
 	return res
 }
 
-func (p *ProbabilisticFallback) availableCapacity(current map[string]float64, failed map[string]struct{}, res map[string]float64) []alloc {
+func (p *ProbabilisticFallback) availableCapacity(current map[string]float64, failed map[string]struct{}, res map[string]float64, signal model.FlexibilitySignal) []alloc {
 	var avail []alloc
 	for id := range current {
 		if _, ok := failed[id]; ok {
@@ -87,7 +93,7 @@ func (p *ProbabilisticFallback) availableCapacity(current map[string]float64, fa
 			continue
 		}
 
-		cap := veh.EffectiveCapacity(res[id])
+		cap := math.Min(veh.EffectiveCapacity(res[id]), energyRoom(veh, signal, res[id]))
 		if cap > 0 {
 			avail = append(avail, alloc{id: id, capacity: cap})
 		}
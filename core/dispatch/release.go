@@ -0,0 +1,156 @@
+package dispatch
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/core/monitoring"
+	"github.com/kilianp07/v2g/core/mqtt"
+)
+
+// pendingRelease is a release scheduled at the end of a dispatched signal.
+type pendingRelease struct {
+	signal model.FlexibilitySignal
+	timer  *time.Timer
+}
+
+// orderDeadline returns the time at which the orders for the signal expire.
+// Signals without a duration leave the deadline to the publisher.
+func orderDeadline(signal model.FlexibilitySignal) time.Time {
+	if signal.Duration <= 0 {
+		return time.Time{}
+	}
+	return signal.Timestamp.Add(signal.Duration)
+}
+
+// orderMetadata describes the signal an order is sent for.
+func orderMetadata(signal model.FlexibilitySignal) map[string]string {
+	return map[string]string{
+		"signal_type":       signal.Type.String(),
+		"signal_power_kw":   strconv.FormatFloat(signal.PowerKW, 'f', -1, 64),
+		"signal_start":      signal.Timestamp.UTC().Format(time.RFC3339),
+		"signal_duration_s": strconv.Itoa(int(signal.Duration.Seconds())),
+	}
+}
+
+// sendOrder publishes a setpoint bounded by validUntil when the publisher
+// supports expiring orders. Publishers supporting metadata receive meta when
+// it is non-nil.
+func (m *DispatchManager) sendOrder(id string, power float64, validUntil time.Time, meta map[string]string) (string, error) {
+	if mc, ok := m.publisher.(mqtt.MetadataClient); ok && meta != nil {
+		return mc.SendOrderWithMetadata(id, power, validUntil, meta)
+	}
+	if ec, ok := m.publisher.(mqtt.ExpiringClient); ok && !validUntil.IsZero() {
+		return ec.SendOrderUntil(id, power, validUntil)
+	}
+	return m.publisher.SendOrder(id, power)
+}
+
+// sendRelease publishes a release command, or a zero-power order when the
+// publisher has no dedicated release command.
+func (m *DispatchManager) sendRelease(id string) (string, error) {
+	if ec, ok := m.publisher.(mqtt.ExpiringClient); ok {
+		return ec.SendRelease(id)
+	}
+	return m.publisher.SendOrder(id, 0)
+}
+
+// scheduleRelease sends a release command at signal.Timestamp+signal.Duration
+// to the vehicles held by the commitment of the result.
+func (m *DispatchManager) scheduleRelease(res DispatchResult) {
+	id := res.commitment
+	if id == 0 {
+		return
+	}
+	m.mu.Lock()
+	m.pending[id] = &pendingRelease{
+		signal: res.Signal,
+		timer:  time.AfterFunc(time.Until(orderDeadline(res.Signal)), func() { m.firePending(id) }),
+	}
+	m.mu.Unlock()
+}
+
+// firePending releases the commitment of a scheduled release.
+func (m *DispatchManager) firePending(id uint64) {
+	m.mu.Lock()
+	p, ok := m.pending[id]
+	delete(m.pending, id)
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	if ids := m.ledger.Release(id); len(ids) > 0 {
+		m.logger.Infof("signal %s ended, releasing %d vehicles", p.signal.Type, len(ids))
+		m.releaseVehicles(p.signal, ids)
+	}
+}
+
+// releasePendingWhere immediately fires the scheduled releases whose signal
+// satisfies match.
+func (m *DispatchManager) releasePendingWhere(match func(model.FlexibilitySignal) bool) {
+	m.mu.Lock()
+	ids := make([]uint64, 0, len(m.pending))
+	for id, p := range m.pending {
+		if match(p.signal) {
+			p.timer.Stop()
+			ids = append(ids, id)
+		}
+	}
+	m.mu.Unlock()
+	for _, id := range ids {
+		m.firePending(id)
+	}
+}
+
+// ReleasePending immediately releases every vehicle that still holds a
+// setpoint from a dispatch whose signal has not ended yet.
+func (m *DispatchManager) ReleasePending() {
+	m.releasePendingWhere(func(model.FlexibilitySignal) bool { return true })
+}
+
+// CancelSignal ends the pending dispatches of the given signal type before
+// their scheduled end and releases their commitments.
+func (m *DispatchManager) CancelSignal(t model.SignalType) {
+	m.releasePendingWhere(func(s model.FlexibilitySignal) bool { return s.Type == t })
+}
+
+// releaseVehicles sends release commands concurrently and reports which
+// vehicles acknowledged them. Vehicles still committed to other signals are
+// sent the setpoint of those signals instead.
+func (m *DispatchManager) releaseVehicles(signal model.FlexibilitySignal, ids []string) map[string]bool {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		acks = make(map[string]bool, len(ids))
+	)
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			defer monitoring.Recover()
+			var (
+				cmdID string
+				err   error
+			)
+			if p, until, held := m.ledger.Active(id, 0); held {
+				cmdID, err = m.sendOrder(id, p, until, nil)
+			} else {
+				cmdID, err = m.sendRelease(id)
+			}
+			var ack mqtt.Ack
+			if err == nil {
+				ack, err = m.publisher.WaitForAck(cmdID, m.ackWait())
+			}
+			if err != nil || !ack.Accepted() {
+				m.logger.Errorf("release of %s for %s not acknowledged: %v", id, signal.Type, err)
+			}
+			mu.Lock()
+			acks[id] = err == nil && ack.Accepted()
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	return acks
+}
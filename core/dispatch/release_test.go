@@ -0,0 +1,48 @@
+package dispatch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+func TestDispatch_OrdersExpireAtSignalEnd(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	veh := model.Vehicle{ID: "v1", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 40}
+	sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 5, Duration: time.Hour, Timestamp: time.Now()}
+	mgr.Dispatch(sig, []model.Vehicle{veh})
+
+	if got := pub.ValidUntil["v1"]; !got.Equal(sig.Timestamp.Add(sig.Duration)) {
+		t.Fatalf("expected order valid until signal end, got %v", got)
+	}
+	mgr.ReleasePending()
+	if !pub.Released["v1"] || pub.Messages["v1"] != 0 {
+		t.Fatalf("expected v1 to be released")
+	}
+}
+
+func TestDispatch_OrdersCarrySignalMetadata(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	veh := model.Vehicle{ID: "v1", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 40}
+	sig := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 5, Duration: time.Hour, Timestamp: time.Now()}
+	mgr.Dispatch(sig, []model.Vehicle{veh})
+
+	meta := pub.Metadata["v1"]
+	if meta["signal_type"] != "FCR" || meta["signal_power_kw"] != "5" || meta["signal_duration_s"] != "3600" {
+		t.Fatalf("unexpected metadata: %v", meta)
+	}
+	if meta["signal_start"] != sig.Timestamp.UTC().Format(time.RFC3339) {
+		t.Fatalf("unexpected signal start: %s", meta["signal_start"])
+	}
+}
@@ -0,0 +1,69 @@
+package dispatch
+
+import (
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+)
+
+// Reload validates cfg and swaps the strategies it selects, lp_first, the ack
+// timeout, the fallback rounds, the history bounds and the session and droop
+// settings into the running manager. The participation and breaker settings
+// only apply on restart, see Config.RestartRequired. Dispatches and session rounds in progress finish with the
+// previous settings and the next ones use the new settings. A ReusableTuner is
+// kept with what it learned when its configuration is unchanged. The manager
+// is left untouched when cfg is invalid.
+func (m *DispatchManager) Reload(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	m.swapMu.Lock()
+	defer m.swapMu.Unlock()
+	m.reloadMu.RLock()
+	prev := m.tuner
+	m.reloadMu.RUnlock()
+	s, err := cfg.buildStrategies(m.logger, prev)
+	if err != nil {
+		return err
+	}
+
+	m.reloadMu.Lock()
+	m.filter = s.Filter
+	m.dispatcher = s.Dispatcher
+	m.lpDispatcher = lpDispatcherFor(s.Dispatcher)
+	m.fallback = s.Fallback
+	m.tuner = s.Tuner
+	m.prediction = s.Prediction
+	m.attachPrices()
+	m.attachParticipation()
+	m.attachHealth()
+	m.attachTuner()
+	m.reloadMu.Unlock()
+
+	ackTimeout := time.Duration(cfg.AckTimeoutSeconds) * time.Second
+	if ackTimeout <= 0 {
+		ackTimeout = 5 * time.Second
+	}
+	m.mu.Lock()
+	m.ackTimeout = ackTimeout
+	m.lpFirst = make(map[model.SignalType]bool, len(cfg.LPFirst))
+	for k, v := range cfg.LPFirst {
+		m.lpFirst[k] = v
+	}
+	m.fallbackRounds = cfg.FallbackRoundCount()
+	m.session = cfg.Session
+	m.droop = cfg.Droop
+	hist := m.history
+	m.mu.Unlock()
+	if mh, ok := hist.(*MemoryHistory); ok {
+		mh.SetBounds(cfg.History)
+	}
+	return nil
+}
+
+// ackWait returns the time to wait for an acknowledgment.
+func (m *DispatchManager) ackWait() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ackTimeout
+}
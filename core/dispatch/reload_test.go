@@ -0,0 +1,154 @@
+package dispatch
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+func TestReload_SwapsStrategies(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	rounds := 3
+	cfg := Config{
+		AckTimeoutSeconds: 2,
+		LPFirst:           map[model.SignalType]bool{model.SignalFCR: true},
+		FallbackRounds:    &rounds,
+		Strategy:          StrategyConfig{Dispatcher: "smart", Fallback: "balanced", Weights: map[string]float64{"soc": 0.9}},
+	}
+	if err := mgr.Reload(cfg); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	sd, ok := mgr.dispatcher.(*SmartDispatcher)
+	if !ok || sd.SocWeight != 0.9 {
+		t.Fatalf("expected smart dispatcher with new weights, got %T", mgr.dispatcher)
+	}
+	if mgr.lpDispatcher == nil || !mgr.lpFirst[model.SignalFCR] {
+		t.Fatalf("expected lp_first enabled with an lp dispatcher")
+	}
+	if _, ok := mgr.fallback.(*BalancedFallback); !ok {
+		t.Fatalf("expected balanced fallback, got %T", mgr.fallback)
+	}
+	if mgr.ackWait() != 2*time.Second || mgr.fallbackRoundCount() != 3 {
+		t.Fatalf("expected ack timeout and fallback rounds updated")
+	}
+}
+
+func TestReload_DisablesFallbackRoundsAndBoundsHistory(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		mgr.History().Append(DispatchResult{})
+	}
+	zero := 0
+	if err := mgr.Reload(Config{FallbackRounds: &zero, History: HistoryConfig{MaxEntries: 2}}); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if n := mgr.fallbackRoundCount(); n != 0 {
+		t.Fatalf("expected fallback rounds disabled, got %d", n)
+	}
+	if n := mgr.History().Len(); n != 2 {
+		t.Fatalf("expected the history trimmed to the new bound, got %d", n)
+	}
+	if err := mgr.Reload(Config{}); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if n := mgr.fallbackRoundCount(); n != DefaultFallbackRounds {
+		t.Fatalf("expected unset fallback rounds to use the default, got %d", n)
+	}
+}
+
+func TestConfig_RestartRequired(t *testing.T) {
+	cfg := Config{Participation: ParticipationConfig{Enabled: true}}
+	next := cfg
+	next.Session.IntervalMS = 100
+	if keys := cfg.RestartRequired(next); len(keys) != 0 {
+		t.Fatalf("expected reloadable changes only, got %v", keys)
+	}
+	next.Participation.HalfLifeHours = 2
+	next.Breaker.Enabled = true
+	if keys := cfg.RestartRequired(next); len(keys) != 2 || keys[0] != "participation" || keys[1] != "breaker" {
+		t.Fatalf("expected participation and breaker reported, got %v", keys)
+	}
+}
+
+func TestReload_RejectsInvalidConfig(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	if err := mgr.Reload(Config{AckTimeoutSeconds: 9, Strategy: StrategyConfig{Tuner: "ack"}}); err == nil {
+		t.Fatalf("expected invalid config to be rejected")
+	}
+	if _, ok := mgr.dispatcher.(EqualDispatcher); !ok || mgr.ackWait() != time.Second {
+		t.Fatalf("manager changed by a rejected reload")
+	}
+}
+
+func TestReload_ConcurrentWithDispatch(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	vehicles := []model.Vehicle{{ID: "v1", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 40}}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			mgr.Dispatch(model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 5, Timestamp: time.Now()}, vehicles)
+		}()
+		go func(i int) {
+			defer wg.Done()
+			name := "equal"
+			if i%2 == 0 {
+				name = "smart"
+			}
+			if err := mgr.Reload(Config{Strategy: StrategyConfig{Dispatcher: name}}); err != nil {
+				t.Errorf("reload: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestReload_KeepsUnchangedTuner(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	cfg := Config{Strategy: StrategyConfig{Dispatcher: "smart", Tuner: "bandit", Bandit: BanditTunerConfig{Seed: 1}}}
+	s, err := cfg.BuildStrategies(logger.NopLogger{})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	mgr, err := NewDispatchManager(s.Filter, s.Dispatcher, s.Fallback, pub, time.Second, nil, nil, nil, logger.NopLogger{}, s.Tuner, s.Prediction)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	cfg.Strategy.Weights = map[string]float64{"soc": 0.7}
+	if err := mgr.Reload(cfg); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	sd := mgr.dispatcher.(*SmartDispatcher)
+	if mgr.tuner != s.Tuner || sd == s.Dispatcher || sd.Learned != s.Tuner.(*BanditTuner) {
+		t.Fatalf("expected the tuner to be kept and bound to the new dispatcher")
+	}
+
+	cfg.Strategy.Bandit.Step = 0.5
+	if err := mgr.Reload(cfg); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if mgr.tuner == s.Tuner {
+		t.Fatalf("expected a new tuner once its configuration changed")
+	}
+}
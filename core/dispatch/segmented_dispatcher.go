@@ -1,12 +1,18 @@
 package dispatch
 
 import (
+	"math"
+	"sort"
+
 	"github.com/kilianp07/v2g/core/model"
 )
 
 // SegmentedSmartDispatcher applies different dispatcher configurations per vehicle segment.
 type SegmentedSmartDispatcher struct {
 	segments map[string]SegmentConfig
+	last     map[string]SegmentAllocation
+	prices   PriceProvider
+	usage    ParticipationSource
 }
 
 // SegmentConfig defines weights and strategy for a segment.
@@ -14,6 +20,24 @@ type SegmentConfig struct {
 	Weights        map[string]float64 `json:"weights"`
 	DispatcherType string             `json:"dispatcher_type"`
 	Fallback       bool               `json:"fallback"`
+	// Priority orders the segments: higher priorities are served up to their
+	// capacity before lower ones receive any power.
+	Priority int `json:"priority"`
+	// QuotaKW caps the power allocated to the segment. Zero means no cap.
+	QuotaKW float64 `json:"quota_kw"`
+}
+
+// SegmentAllocation reports how much of a signal a segment was asked for and
+// delivered. Values are absolute powers in kW.
+type SegmentAllocation struct {
+	CapacityKW  float64 `json:"capacity_kw"`
+	TargetKW    float64 `json:"target_kw"`
+	DeliveredKW float64 `json:"delivered_kw"`
+}
+
+// SegmentReporter optionally exposes the per-segment split of the last dispatch.
+type SegmentReporter interface {
+	GetSegments() map[string]SegmentAllocation
 }
 
 // DefaultSegmentConfigs returns rule-based defaults for common fleet segments.
@@ -78,6 +102,8 @@ func applyWeights(d *SmartDispatcher, weights map[string]float64) {
 			d.WearWeight = v
 		case "fairness":
 			d.FairnessWeight = v
+		case "degradation":
+			d.DegradationWeight = v
 		case "availability":
 			d.AvailabilityWeight = v
 		case "market_price":
@@ -86,9 +112,33 @@ func applyWeights(d *SmartDispatcher, weights map[string]float64) {
 	}
 }
 
-func (d *SegmentedSmartDispatcher) dispatchSegment(vs []model.Vehicle, signal model.FlexibilitySignal, cfg SegmentConfig) map[string]float64 {
+// segmentDispatcher returns the smart dispatcher configured for a segment.
+func (d *SegmentedSmartDispatcher) segmentDispatcher(cfg SegmentConfig) SmartDispatcher {
 	sd := NewSmartDispatcher()
 	applyWeights(&sd, cfg.Weights)
+	sd.Prices = d.prices
+	sd.Usage = d.usage
+	return sd
+}
+
+// SetPriceProvider implements PriceAwareDispatcher. Segments without a price
+// at the signal timestamp keep their market_price weight.
+func (d *SegmentedSmartDispatcher) SetPriceProvider(p PriceProvider) {
+	d.prices = p
+}
+
+// SetParticipationSource implements ParticipationAwareDispatcher.
+func (d *SegmentedSmartDispatcher) SetParticipationSource(p ParticipationSource) {
+	d.usage = p
+}
+
+// MarketPriceFor implements PriceAwareDispatcher.
+func (d *SegmentedSmartDispatcher) MarketPriceFor(signal model.FlexibilitySignal) float64 {
+	return SmartDispatcher{Prices: d.prices}.MarketPriceFor(signal)
+}
+
+func (d *SegmentedSmartDispatcher) dispatchSegment(vs []model.Vehicle, signal model.FlexibilitySignal, cfg SegmentConfig) map[string]float64 {
+	sd := d.segmentDispatcher(cfg)
 
 	if cfg.DispatcherType == "lp" {
 		lp := NewLPDispatcher()
@@ -105,9 +155,65 @@ func (d *SegmentedSmartDispatcher) dispatchSegment(vs []model.Vehicle, signal mo
 	return sd.Dispatch(vs, signal)
 }
 
-// Dispatch allocates power per segment using the configured strategy for each.
+// segmentTolerance is the shortfall in kW a segment may leave before the
+// missing power is offered to the other segments. The iterative dispatchers
+// converge to within a few watts of their target.
+const segmentTolerance = 0.01
+
+// segmentState tracks a segment while the signal is split between segments.
+type segmentState struct {
+	name     string
+	vehicles []model.Vehicle
+	cfg      SegmentConfig
+	limit    float64
+	alloc    SegmentAllocation
+	result   map[string]float64
+	short    bool
+}
+
+// segmentCapacity returns the power the vehicles can provide for the signal.
+func segmentCapacity(vs []model.Vehicle, signal model.FlexibilitySignal) float64 {
+	var total float64
+	for _, v := range vs {
+		_, cap := availableEnergyAndCapacity(v, signal, false, 0)
+		r, ok := rangeFor(v, signal)
+		if !ok {
+			continue
+		}
+		total += math.Max(0, math.Min(cap, r.hi))
+	}
+	return total
+}
+
+// splitPower distributes power between the segments in priority order. Within
+// a priority level each segment receives a share proportional to its room, the
+// power it can still take. It returns the power left unassigned.
+func splitPower(segs []*segmentState, power float64, room func(*segmentState) float64, add func(*segmentState, float64)) float64 {
+	for i := 0; i < len(segs) && power > constraintEps; {
+		j := i
+		var total float64
+		for ; j < len(segs) && segs[j].cfg.Priority == segs[i].cfg.Priority; j++ {
+			total += room(segs[j])
+		}
+		if total > constraintEps {
+			part := math.Min(power, total)
+			for _, s := range segs[i:j] {
+				add(s, part*room(s)/total)
+			}
+			power -= part
+		}
+		i = j
+	}
+	return power
+}
+
+// Dispatch allocates the signal between segments in proportion to their
+// aggregate capacity, honouring segment priorities and quotas, and dispatches
+// each segment with its configured strategy. Power a segment fails to deliver
+// is offered to the segments that still have room.
 func (d *SegmentedSmartDispatcher) Dispatch(vehicles []model.Vehicle, signal model.FlexibilitySignal) map[string]float64 {
 	assignments := make(map[string]float64)
+	d.last = make(map[string]SegmentAllocation)
 	if len(vehicles) == 0 {
 		return assignments
 	}
@@ -115,18 +221,92 @@ func (d *SegmentedSmartDispatcher) Dispatch(vehicles []model.Vehicle, signal mod
 	for _, v := range vehicles {
 		groups[v.Segment] = append(groups[v.Segment], v)
 	}
-	share := signal.PowerKW / float64(len(groups))
-	for seg, vs := range groups {
-		cfg, ok := d.segments[seg]
-		if !ok {
-			cfg = SegmentConfig{}
+	segs := make([]*segmentState, 0, len(groups))
+	for name, vs := range groups {
+		cfg := d.segments[name]
+		s := &segmentState{name: name, vehicles: vs, cfg: cfg}
+		s.alloc.CapacityKW = segmentCapacity(vs, signal)
+		s.limit = s.alloc.CapacityKW
+		if cfg.QuotaKW > 0 {
+			s.limit = math.Min(s.limit, cfg.QuotaKW)
+		}
+		segs = append(segs, s)
+	}
+	sort.Slice(segs, func(i, j int) bool {
+		if segs[i].cfg.Priority != segs[j].cfg.Priority {
+			return segs[i].cfg.Priority > segs[j].cfg.Priority
+		}
+		return segs[i].name < segs[j].name
+	})
+
+	sign := 1.0
+	if signal.PowerKW < 0 {
+		sign = -1
+	}
+	target := math.Abs(signal.PowerKW)
+	splitPower(segs, target,
+		func(s *segmentState) float64 { return s.limit },
+		func(s *segmentState, kw float64) { s.alloc.TargetKW += kw })
+
+	pending := segs
+	for round := 0; round <= len(segs) && len(pending) > 0; round++ {
+		var shortfall float64
+		for _, s := range pending {
+			d.runSegment(s, signal, sign)
+			if gap := s.alloc.TargetKW - s.alloc.DeliveredKW; gap > segmentTolerance {
+				s.short = true
+				shortfall += gap
+			}
+		}
+		if shortfall == 0 {
+			break
 		}
-		part := signal
-		part.PowerKW = share
-		res := d.dispatchSegment(vs, part, cfg)
-		for id, p := range res {
+		pending = pending[:0:0]
+		room := func(s *segmentState) float64 {
+			if s.short {
+				return 0
+			}
+			return math.Max(0, s.limit-s.alloc.TargetKW)
+		}
+		splitPower(segs, shortfall, room, func(s *segmentState, kw float64) {
+			if kw <= constraintEps {
+				return
+			}
+			s.alloc.TargetKW += kw
+			pending = append(pending, s)
+		})
+	}
+
+	for _, s := range segs {
+		for id, p := range s.result {
 			assignments[id] = p
 		}
+		d.last[s.name] = s.alloc
 	}
 	return assignments
 }
+
+// runSegment dispatches the segment target and records the delivered power.
+func (d *SegmentedSmartDispatcher) runSegment(s *segmentState, signal model.FlexibilitySignal, sign float64) {
+	s.result = nil
+	s.alloc.DeliveredKW = 0
+	if s.alloc.TargetKW <= constraintEps {
+		return
+	}
+	part := signal
+	part.PowerKW = sign * s.alloc.TargetKW
+	s.result = d.dispatchSegment(s.vehicles, part, s.cfg)
+	for _, p := range s.result {
+		s.alloc.DeliveredKW += math.Abs(p)
+	}
+}
+
+// GetSegments implements SegmentReporter by returning the split of the last
+// dispatch.
+func (d *SegmentedSmartDispatcher) GetSegments() map[string]SegmentAllocation {
+	res := make(map[string]SegmentAllocation, len(d.last))
+	for k, v := range d.last {
+		res[k] = v
+	}
+	return res
+}
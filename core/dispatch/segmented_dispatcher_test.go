@@ -2,6 +2,7 @@ package dispatch
 
 import (
 	"errors"
+	"math"
 	"testing"
 	"time"
 
@@ -84,3 +85,67 @@ func TestApplyWeights(t *testing.T) {
 		t.Fatalf("weights not applied correctly")
 	}
 }
+
+func TestSegmentedDispatcher_SplitsByCapacity(t *testing.T) {
+	d := NewSegmentedSmartDispatcher(map[string]SegmentConfig{})
+	now := time.Now()
+	vehicles := []model.Vehicle{{ID: "c1", Segment: "commuter", SoC: 0.9, BatteryKWh: 40, MaxPower: 10, IsV2G: true, Available: true}}
+	for _, id := range []string{"f1", "f2", "f3"} {
+		vehicles = append(vehicles, model.Vehicle{ID: id, Segment: "captive_fleet", SoC: 0.9, BatteryKWh: 40, MaxPower: 10, IsV2G: true, Available: true})
+	}
+	sig := model.FlexibilitySignal{PowerKW: 20, Duration: time.Hour, Timestamp: now}
+	asn := d.Dispatch(vehicles, sig)
+	segs := d.GetSegments()
+	if math.Abs(segs["commuter"].TargetKW-5) > 1e-3 || math.Abs(segs["captive_fleet"].TargetKW-15) > 1e-3 {
+		t.Fatalf("expected a 5/15 split, got %+v", segs)
+	}
+	var total float64
+	for _, p := range asn {
+		total += p
+	}
+	if math.Abs(total-20) > 1e-3 {
+		t.Fatalf("expected 20 kW delivered, got %v", total)
+	}
+}
+
+func TestSegmentedDispatcher_PriorityAndQuota(t *testing.T) {
+	d := NewSegmentedSmartDispatcher(map[string]SegmentConfig{
+		"captive_fleet": {Priority: 1, QuotaKW: 12},
+	})
+	now := time.Now()
+	var vehicles []model.Vehicle
+	for _, id := range []string{"f1", "f2"} {
+		vehicles = append(vehicles, model.Vehicle{ID: id, Segment: "captive_fleet", SoC: 0.9, BatteryKWh: 40, MaxPower: 10, IsV2G: true, Available: true})
+	}
+	vehicles = append(vehicles, model.Vehicle{ID: "c1", Segment: "commuter", SoC: 0.9, BatteryKWh: 40, MaxPower: 10, IsV2G: true, Available: true})
+	sig := model.FlexibilitySignal{PowerKW: 15, Duration: time.Hour, Timestamp: now}
+	d.Dispatch(vehicles, sig)
+	segs := d.GetSegments()
+	if math.Abs(segs["captive_fleet"].TargetKW-12) > 1e-3 || math.Abs(segs["commuter"].TargetKW-3) > 1e-3 {
+		t.Fatalf("expected the quota to cap the priority segment: %+v", segs)
+	}
+}
+
+func TestSegmentedDispatcher_RedistributesShortfall(t *testing.T) {
+	d := NewSegmentedSmartDispatcher(map[string]SegmentConfig{})
+	now := time.Now()
+	vehicles := []model.Vehicle{
+		// The SoC constraints of the smart dispatcher exclude the commuter
+		// although its estimated capacity earns it a share of the signal.
+		{ID: "c1", Segment: "commuter", SoC: 0.05, BatteryKWh: 40, MaxPower: 10, IsV2G: true, Available: true},
+		{ID: "f1", Segment: "captive_fleet", SoC: 0.9, BatteryKWh: 40, MaxPower: 10, IsV2G: true, Available: true},
+		{ID: "f2", Segment: "captive_fleet", SoC: 0.9, BatteryKWh: 40, MaxPower: 10, IsV2G: true, Available: true},
+	}
+	sig := model.FlexibilitySignal{PowerKW: 9, Duration: time.Hour, Timestamp: now}
+	asn := d.Dispatch(vehicles, sig)
+	segs := d.GetSegments()
+	if c := segs["commuter"]; c.DeliveredKW != 0 || c.TargetKW <= 0 {
+		t.Fatalf("expected the commuter shortfall recorded: %+v", segs["commuter"])
+	}
+	if math.Abs(asn["f1"]+asn["f2"]-9) > 1e-3 {
+		t.Fatalf("expected the shortfall moved to the fleet: %v", asn)
+	}
+	if seg := segs["captive_fleet"]; math.Abs(seg.TargetKW-9) > 1e-3 || math.Abs(seg.DeliveredKW-9) > 1e-3 {
+		t.Fatalf("expected the fleet to deliver the whole signal: %+v", seg)
+	}
+}
@@ -0,0 +1,393 @@
+package dispatch
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/kilianp07/v2g/core/events"
+	"github.com/kilianp07/v2g/core/metrics"
+	"github.com/kilianp07/v2g/core/model"
+)
+
+// SessionConfig controls closed-loop dispatch sessions that hold a signal for
+// its whole duration.
+type SessionConfig struct {
+	Enabled      bool    `json:"enabled"`
+	IntervalMS   int     `json:"interval_ms"`
+	ToleranceKW  float64 `json:"tolerance_kw"`
+	StaleAfterMS int     `json:"stale_after_ms"`
+}
+
+// Interval returns the control loop cadence, defaulting to five seconds.
+func (c SessionConfig) Interval() time.Duration {
+	if c.IntervalMS <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.IntervalMS) * time.Millisecond
+}
+
+// StaleAfter returns the age after which telemetry is ignored. It defaults to
+// three control intervals.
+func (c SessionConfig) StaleAfter() time.Duration {
+	if c.StaleAfterMS <= 0 {
+		return 3 * c.Interval()
+	}
+	return time.Duration(c.StaleAfterMS) * time.Millisecond
+}
+
+// SessionResult summarises a closed-loop dispatch session.
+type SessionResult struct {
+	Signal model.FlexibilitySignal
+	// Rounds holds the initial dispatch followed by every correction round.
+	Rounds []DispatchResult
+	// Setpoints is the last acknowledged setpoint of each vehicle before release.
+	Setpoints map[string]float64
+	// Released reports which vehicles acknowledged the release order.
+	Released map[string]bool
+}
+
+type session struct {
+	signal    model.FlexibilitySignal
+	vehicles  map[string]model.Vehicle
+	setpoints map[string]float64
+	// commitment holds the session's power in the ledger.
+	commitment uint64
+	// plan is followed slot by slot when the dispatcher planned the horizon.
+	plan *DispatchPlan
+	slot int
+	// price is the market price the signal was dispatched at, recorded on
+	// every round.
+	price float64
+	// rounds counts the rounds published after the initial dispatch.
+	rounds int
+	// heldSince is when the setpoints started being held, for the
+	// participation ledger.
+	heldSince time.Time
+}
+
+func newSession(signal model.FlexibilitySignal, pool []model.Vehicle, first DispatchResult) *session {
+	s := &session{
+		signal:    signal,
+		vehicles:  make(map[string]model.Vehicle, len(pool)),
+		setpoints: make(map[string]float64, len(first.Assignments)),
+		price:     first.MarketPrice,
+	}
+	for _, v := range pool {
+		s.vehicles[v.ID] = v
+	}
+	for id := range first.Assignments {
+		if first.Acknowledged[id] {
+			s.setpoints[id] = first.AppliedPower(id)
+		}
+	}
+	return s
+}
+
+// pool returns the vehicles still participating in the session sorted by ID.
+func (s *session) pool() []model.Vehicle {
+	ids := make([]string, 0, len(s.vehicles))
+	for id := range s.vehicles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	res := make([]model.Vehicle, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, s.vehicles[id])
+	}
+	return res
+}
+
+// SetSessionConfig configures closed-loop dispatch sessions.
+func (m *DispatchManager) SetSessionConfig(cfg SessionConfig) {
+	m.mu.Lock()
+	m.session = cfg
+	m.mu.Unlock()
+}
+
+// SetTelemetrySource configures where sessions read the delivered power from.
+func (m *DispatchManager) SetTelemetrySource(src TelemetrySource) {
+	m.mu.Lock()
+	m.telemetry = src
+	m.mu.Unlock()
+}
+
+func (m *DispatchManager) sessionConfig() SessionConfig {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.session
+}
+
+func (m *DispatchManager) latestTelemetry(id string) (TelemetrySample, bool) {
+	m.mu.Lock()
+	src := m.telemetry
+	m.mu.Unlock()
+	if src == nil {
+		return TelemetrySample{}, false
+	}
+	return src.Latest(id)
+}
+
+// RunSession dispatches the signal and keeps it delivered until
+// signal.Timestamp+signal.Duration or until ctx is cancelled. Delivered power
+// is tracked through the configured TelemetrySource: vehicles that unplug or
+// reach their minimum SoC are dropped and their share is reallocated with the
+// FallbackStrategy, while any remaining gap is re-dispatched with the
+// Dispatcher. Every vehicle that received an order gets a release command when
+// the session ends.
+func (m *DispatchManager) RunSession(ctx context.Context, signal model.FlexibilitySignal, vehicles []model.Vehicle) SessionResult {
+	cfg := m.sessionConfig()
+	first, pool := m.dispatchVehicles(signal, vehicles)
+	s := newSession(signal, pool, first)
+	s.commitment = first.commitment
+	s.plan = first.Plan
+	s.heldSince = time.Now()
+	m.recordParticipation(first, 0)
+	m.publishSession(signal, "start", 0, 0)
+
+	res := SessionResult{Signal: signal, Rounds: []DispatchResult{first}}
+	end := time.NewTimer(time.Until(signal.Timestamp.Add(signal.Duration)))
+	defer end.Stop()
+	ticker := time.NewTicker(cfg.Interval())
+	defer ticker.Stop()
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-end.C:
+			break loop
+		case now := <-ticker.C:
+			if round, ok := m.correctSession(s, cfg, now); ok {
+				res.Rounds = append(res.Rounds, round)
+			}
+		}
+	}
+	res.Setpoints = make(map[string]float64, len(s.setpoints))
+	for id, p := range s.setpoints {
+		res.Setpoints[id] = p
+	}
+	res.Released = m.releaseSession(s)
+	return res
+}
+
+// correctSession compares the delivered power with the signal target and
+// publishes corrective orders when the gap exceeds the configured tolerance.
+func (m *DispatchManager) correctSession(s *session, cfg SessionConfig, now time.Time) (DispatchResult, bool) {
+	m.reloadMu.RLock()
+	defer m.reloadMu.RUnlock()
+	delivered, dropped := m.measureSession(s, cfg, now)
+	round, delivered, gap := m.planCorrection(s, cfg, now, delivered, dropped)
+	if len(round.Assignments) == 0 {
+		return DispatchResult{}, false
+	}
+	s.rounds++
+	round.Round = s.rounds
+	m.publishSession(s.signal, "correction", delivered, gap)
+	m.logger.Infof("session %s: delivered %.2f kW, gap %.2f kW, sending %d orders", s.signal.Type, delivered, gap, len(round.Assignments))
+
+	lr, recordLatency := m.metrics.(metrics.LatencyRecorder)
+	lat := m.dispatchAssignments(&round, s.signal, recordLatency)
+	m.holdSession(s, now)
+	for id := range round.Assignments {
+		if !round.Acknowledged[id] {
+			continue
+		}
+		if p := round.AppliedPower(id); p == 0 {
+			delete(s.setpoints, id)
+		} else {
+			s.setpoints[id] = p
+		}
+	}
+	m.recordParticipation(round, 0)
+	m.recordMetrics(round, lat, lr, recordLatency)
+	m.appendLog(round, s.pool())
+	return round, true
+}
+
+// planCorrection computes the corrective setpoints of a session round and
+// holds them in the session's commitment. Like planDispatch it is serialised
+// with the other plans, and the vehicles are limited to the headroom left by
+// the other commitments overlapping the signal. It returns the round along
+// with the expected delivery and the gap it corrects.
+func (m *DispatchManager) planCorrection(s *session, cfg SessionConfig, now time.Time, delivered float64, dropped []model.Vehicle) (DispatchResult, float64, float64) {
+	m.planMu.Lock()
+	defer m.planMu.Unlock()
+	next := make(map[string]float64, len(s.setpoints))
+	for id, p := range s.setpoints {
+		next[id] = p
+	}
+	s.followPlan(now, next)
+	if len(dropped) > 0 {
+		m.logger.Warnf("session %s: %d vehicles dropped, reallocating", s.signal.Type, len(dropped))
+		delivered += m.reallocateDropped(s, dropped, next)
+	}
+	gap := s.signal.PowerKW - delivered
+	if math.Abs(gap) > cfg.ToleranceKW {
+		m.redispatchGap(s, next, gap)
+	}
+	if s.plan == nil {
+		enforceEnergyLimits(s.pool(), s.signal, next)
+	}
+
+	round := newDispatchResult(s.signal)
+	round.commitment = s.commitment
+	round.MarketPrice = s.price
+	for id, p := range next {
+		if math.Abs(p-s.setpoints[id]) > 1e-6 {
+			round.Assignments[id] = p
+			m.ledger.Set(s.commitment, id, p)
+		}
+	}
+	return round, delivered, gap
+}
+
+// headroomPool returns the session vehicles with MaxPower limited to the
+// headroom left by the other commitments overlapping the signal.
+func (m *DispatchManager) headroomPool(s *session) []model.Vehicle {
+	return m.applyHeadroom(s.signal, s.pool(), s.commitment)
+}
+
+// followPlan moves next to the plan slot covering now when the session has
+// entered a new slot. Vehicles that left the session are not planned again.
+func (s *session) followPlan(now time.Time, next map[string]float64) {
+	if s.plan == nil {
+		return
+	}
+	idx, ok := s.plan.Slot(now)
+	if !ok || idx == s.slot {
+		return
+	}
+	s.slot = idx
+	for id := range next {
+		next[id] = 0
+	}
+	for id, p := range s.plan.Setpoints[idx] {
+		if _, ok := s.vehicles[id]; ok {
+			next[id] = p
+		}
+	}
+}
+
+// measureSession sums the power delivered by vehicles holding a setpoint and
+// returns the vehicles that can no longer participate. Without fresh telemetry
+// a vehicle is assumed to deliver its setpoint.
+func (m *DispatchManager) measureSession(s *session, cfg SessionConfig, now time.Time) (float64, []model.Vehicle) {
+	var delivered float64
+	var dropped []model.Vehicle
+	for _, v := range s.pool() {
+		sp := s.setpoints[v.ID]
+		sample, ok := m.latestTelemetry(v.ID)
+		if !ok || now.Sub(sample.Time) > cfg.StaleAfter() {
+			delivered += sp
+			continue
+		}
+		v.SoC = sample.SoC
+		v.Available = sample.Available
+		s.vehicles[v.ID] = v
+		if !sample.Available || (s.signal.PowerKW > 0 && sample.SoC <= v.MinSoC) {
+			dropped = append(dropped, v)
+			continue
+		}
+		if sp != 0 {
+			delivered += sample.PowerKW
+		}
+	}
+	return delivered, dropped
+}
+
+// reallocateDropped removes the dropped vehicles from the session, zeroes
+// their setpoints and lets the fallback strategy move their share to the
+// remaining vehicles. It returns the additional power expected from the
+// reallocation.
+func (m *DispatchManager) reallocateDropped(s *session, dropped []model.Vehicle, next map[string]float64) float64 {
+	gone := make(map[string]struct{}, len(dropped))
+	for _, v := range dropped {
+		gone[v.ID] = struct{}{}
+		delete(s.vehicles, v.ID)
+		if s.setpoints[v.ID] != 0 {
+			next[v.ID] = 0
+		}
+	}
+	pool := m.headroomPool(s)
+	if va, ok := m.fallback.(VehicleAwareFallback); ok {
+		va.SetVehicles(pool)
+	}
+	realloc := m.reallocate(dropped, s.setpoints, 0, s.signal, pool)
+	var extra float64
+	for id, p := range realloc {
+		if _, ok := gone[id]; ok {
+			continue
+		}
+		extra += p - next[id]
+		next[id] = p
+	}
+	return extra
+}
+
+// redispatchGap updates next so that the expected delivery moves by gap. A gap
+// in the direction of the signal is split by the dispatcher across the
+// headroom the vehicles have left, given the other commitments; an over-delivery scales every setpoint
+// down proportionally.
+func (m *DispatchManager) redispatchGap(s *session, next map[string]float64, gap float64) {
+	if gap*s.signal.PowerKW > 0 {
+		var cands []model.Vehicle
+		for _, v := range m.headroomPool(s) {
+			head := v.MaxPower - math.Abs(next[v.ID])
+			if head <= 0 {
+				continue
+			}
+			v.MaxPower = head
+			cands = append(cands, v)
+		}
+		residual := s.signal
+		residual.PowerKW = gap
+		extra, _, _ := m.dispatchStrategy(cands, residual)
+		for id, p := range extra {
+			next[id] += p
+		}
+		return
+	}
+	var total float64
+	for _, p := range next {
+		total += p
+	}
+	if total == 0 {
+		return
+	}
+	factor := math.Max(0, (total+gap)/total)
+	for id, p := range next {
+		next[id] = p * factor
+	}
+}
+
+// releaseSession releases the session's commitment and sends a release
+// command to every vehicle that received an order during the session.
+func (m *DispatchManager) releaseSession(s *session) map[string]bool {
+	now := time.Now()
+	if end := s.signal.Timestamp.Add(s.signal.Duration); end.After(s.heldSince) && end.Before(now) {
+		now = end
+	}
+	m.holdSession(s, now)
+	ids := m.ledger.Release(s.commitment)
+	if len(ids) == 0 {
+		return map[string]bool{}
+	}
+	m.publishSession(s.signal, "release", 0, 0)
+	return m.releaseVehicles(s.signal, ids)
+}
+
+// holdSession credits the participation ledger with the energy of the session
+// setpoints held until now, before they change.
+func (m *DispatchManager) holdSession(s *session, now time.Time) {
+	m.creditParticipation(s.setpoints, now.Sub(s.heldSince))
+	s.heldSince = now
+}
+
+func (m *DispatchManager) publishSession(signal model.FlexibilitySignal, action string, delivered, gap float64) {
+	if m.bus == nil {
+		return
+	}
+	m.bus.Publish(events.SessionEvent{Signal: signal, Action: action, DeliveredKW: delivered, GapKW: gap})
+}
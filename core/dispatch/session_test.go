@@ -0,0 +1,115 @@
+package dispatch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+func TestTelemetryCache_KeepsNewest(t *testing.T) {
+	c := NewTelemetryCache()
+	now := time.Now()
+	c.Update(TelemetrySample{VehicleID: "v1", PowerKW: 5, Time: now})
+	c.Update(TelemetrySample{VehicleID: "v1", PowerKW: 3, Time: now.Add(-time.Second)})
+	s, ok := c.Latest("v1")
+	if !ok || s.PowerKW != 5 {
+		t.Fatalf("expected newest sample, got %+v", s)
+	}
+	if _, ok := c.Latest("v2"); ok {
+		t.Fatalf("unexpected sample for v2")
+	}
+}
+
+func TestRunSession_ReallocatesDroppedVehicle(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	cache := NewTelemetryCache()
+	mgr.SetTelemetrySource(cache)
+	mgr.SetSessionConfig(SessionConfig{IntervalMS: 20, ToleranceKW: 0.1, StaleAfterMS: 1000})
+
+	vehicles := []model.Vehicle{
+		{ID: "v1", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 40},
+		{ID: "v2", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 40},
+	}
+	now := time.Now()
+	cache.Update(TelemetrySample{VehicleID: "v1", Available: false, SoC: 0.8, Time: now})
+	cache.Update(TelemetrySample{VehicleID: "v2", Available: true, SoC: 0.8, PowerKW: 5, Time: now})
+
+	sig := model.FlexibilitySignal{Type: model.SignalAFRR, PowerKW: 10, Duration: 150 * time.Millisecond, Timestamp: now}
+	res := mgr.RunSession(context.Background(), sig, vehicles)
+
+	if len(res.Rounds) < 2 {
+		t.Fatalf("expected a correction round, got %d rounds", len(res.Rounds))
+	}
+	corr := res.Rounds[1]
+	if corr.Assignments["v1"] != 0 {
+		t.Errorf("expected v1 released on drop, got %v", corr.Assignments["v1"])
+	}
+	if corr.Assignments["v2"] != 10 {
+		t.Errorf("expected v2 to take the gap, got %v", corr.Assignments["v2"])
+	}
+	if !res.Released["v1"] || !res.Released["v2"] {
+		t.Fatalf("expected release for both vehicles: %+v", res.Released)
+	}
+	if pub.Messages["v1"] != 0 || pub.Messages["v2"] != 0 {
+		t.Fatalf("expected zero setpoints after release: %+v", pub.Messages)
+	}
+}
+
+func TestRunSession_ContextCancelReleases(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	mgr.SetSessionConfig(SessionConfig{IntervalMS: 10})
+	vehicles := []model.Vehicle{{ID: "v1", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 40}}
+	sig := model.FlexibilitySignal{Type: model.SignalAFRR, PowerKW: 5, Duration: time.Hour, Timestamp: time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	res := mgr.RunSession(ctx, sig, vehicles)
+	if res.Setpoints["v1"] != 5 {
+		t.Fatalf("expected setpoint held at 5 kW, got %v", res.Setpoints["v1"])
+	}
+	if !res.Released["v1"] || pub.Messages["v1"] != 0 {
+		t.Fatalf("expected release on cancel")
+	}
+}
+
+func TestCorrectSession_RespectsOverlappingCommitments(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, EqualDispatcher{}, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	now := time.Now()
+	sig := model.FlexibilitySignal{Type: model.SignalAFRR, PowerKW: 10, Duration: time.Hour, Timestamp: now}
+	v := model.Vehicle{ID: "v1", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 40}
+	s := newSession(sig, []model.Vehicle{v}, DispatchResult{})
+	s.setpoints["v1"] = 5
+	s.commitment = mgr.ledger.Open(sig)
+	mgr.ledger.Set(s.commitment, "v1", 5)
+	other := mgr.ledger.Open(model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 3, Duration: time.Hour, Timestamp: now})
+	mgr.ledger.Set(other, "v1", 3)
+
+	round, _, gap := mgr.planCorrection(s, SessionConfig{ToleranceKW: 0.1}, now, 5, nil)
+	if gap != 5 {
+		t.Fatalf("expected a 5 kW gap, got %v", gap)
+	}
+	if round.Assignments["v1"] != 7 {
+		t.Fatalf("expected the correction capped by the other commitment, got %v", round.Assignments["v1"])
+	}
+	for _, c := range mgr.ledger.Commitments("v1") {
+		if c.ID == s.commitment && c.PowerKW != 7 {
+			t.Fatalf("expected the session commitment updated, got %+v", c)
+		}
+	}
+}
@@ -10,16 +10,24 @@ import (
 // SmartDispatcher allocates power using a weighted greedy strategy. Scores are
 // computed from energy slack, time until departure and charging priority. The
 // weights can be tuned and dynamically adapted based on the signal type. A
-// participation score allows fairness between vehicles.
+// participation score allows fairness between vehicles. DegradationWeight, in
+// score points per €/kWh, turns the marginal battery wear cost into a score
+// penalty so batteries that are cheap to cycle are preferred. It is zero by
+// default. Learned, when set,
+// overrides the weights per signal type, and Usage the Participation scores.
 type SmartDispatcher struct {
 	SocWeight            float64
 	TimeWeight           float64
 	PriorityWeight       float64
 	PriceWeight          float64
 	WearWeight           float64
+	DegradationWeight    float64
 	FairnessWeight       float64
 	AvailabilityWeight   float64
 	MarketPrice          float64
+	Prices               PriceProvider
+	Learned              WeightSource
+	Usage                ParticipationSource
 	Participation        map[string]float64
 	MaxRounds            int
 	scores               map[string]float64
@@ -33,6 +41,7 @@ type candidate struct {
 	v        model.Vehicle
 	score    float64
 	capacity float64
+	min      float64
 }
 
 func (d SmartDispatcher) filterBySoC(vehicles []model.Vehicle, signal model.FlexibilitySignal) ([]model.Vehicle, []model.Vehicle) {
@@ -42,18 +51,7 @@ func (d SmartDispatcher) filterBySoC(vehicles []model.Vehicle, signal model.Flex
 	var eligible []model.Vehicle
 	var excluded []model.Vehicle
 	for _, v := range vehicles {
-		if v.SoC < d.MinSoC || v.BatteryKWh <= 0 {
-			excluded = append(excluded, v)
-			continue
-		}
-		energy, cap := availableEnergyAndCapacity(v, signal, true, d.SafeDischargeFloor)
-		if signal.PowerKW < 0 && energy <= 0 {
-			excluded = append(excluded, v)
-			continue
-		}
-		// When only one vehicle is available and it cannot meet the full
-		// request, skip it so fallback strategies can handle the deficit.
-		if len(vehicles) == 1 && cap < math.Abs(signal.PowerKW) {
+		if d.socExclusion(v, signal, len(vehicles)) != "" {
 			excluded = append(excluded, v)
 			continue
 		}
@@ -62,6 +60,24 @@ func (d SmartDispatcher) filterBySoC(vehicles []model.Vehicle, signal model.Flex
 	return eligible, excluded
 }
 
+// socExclusion returns the reason the SoC constraints exclude v from a
+// dispatch among n vehicles, or "" when v is eligible.
+func (d SmartDispatcher) socExclusion(v model.Vehicle, signal model.FlexibilitySignal, n int) string {
+	if v.SoC < d.MinSoC || v.BatteryKWh <= 0 {
+		return ReasonSoCBelowMin
+	}
+	energy, cap := availableEnergyAndCapacity(v, signal, true, d.SafeDischargeFloor)
+	if signal.PowerKW < 0 && energy <= 0 {
+		return ReasonNoEnergy
+	}
+	// When only one vehicle is available and it cannot meet the full
+	// request, skip it so fallback strategies can handle the deficit.
+	if n == 1 && cap < math.Abs(signal.PowerKW) {
+		return ReasonInsufficientCapacity
+	}
+	return ""
+}
+
 func (d SmartDispatcher) buildCandidates(vehicles []model.Vehicle, signal model.FlexibilitySignal, ctx *DispatchContext) ([]candidate, []model.Vehicle) {
 	eligible, excluded := d.filterBySoC(vehicles, signal)
 	return prepareVehicles(eligible, signal, ctx, d.vehicleScore, d.EnableSoCConstraints, d.SafeDischargeFloor), excluded
@@ -86,35 +102,103 @@ func NewSmartDispatcher() SmartDispatcher {
 	}
 }
 
-func (d SmartDispatcher) weightsForSignal(t model.SignalType) (float64, float64, float64, float64, float64, float64, float64) {
-	soc := d.SocWeight
-	tm := d.TimeWeight
-	prio := d.PriorityWeight
-	price := d.PriceWeight
-	wear := d.WearWeight
-	fair := d.FairnessWeight
-	avail := d.AvailabilityWeight
+// Weights are the SmartDispatcher score weights.
+type Weights struct {
+	SoC          float64 `json:"soc"`
+	Time         float64 `json:"time"`
+	Priority     float64 `json:"priority"`
+	Price        float64 `json:"price"`
+	Wear         float64 `json:"wear"`
+	Degradation  float64 `json:"degradation"`
+	Fairness     float64 `json:"fairness"`
+	Availability float64 `json:"availability"`
+}
+
+// WeightSource optionally overrides the weights used for a signal type, for
+// example with weights learned from past dispatches.
+type WeightSource interface {
+	WeightsFor(t model.SignalType) (Weights, bool)
+}
+
+func (d SmartDispatcher) weightsForSignal(t model.SignalType) Weights {
+	if d.Learned != nil {
+		if w, ok := d.Learned.WeightsFor(t); ok {
+			return w
+		}
+	}
+	w := Weights{
+		SoC:          d.SocWeight,
+		Time:         d.TimeWeight,
+		Priority:     d.PriorityWeight,
+		Price:        d.PriceWeight,
+		Wear:         d.WearWeight,
+		Degradation:  d.DegradationWeight,
+		Fairness:     d.FairnessWeight,
+		Availability: d.AvailabilityWeight,
+	}
 	switch t {
 	case model.SignalFCR:
 		// Emphasise immediate power capability
-		soc += 0.2
-		prio += 0.1
+		w.SoC += 0.2
+		w.Priority += 0.1
 	case model.SignalNEBEF:
 		// Availability over a longer window
-		soc += 0.1
-		tm += 0.2
+		w.SoC += 0.1
+		w.Time += 0.2
 	case model.SignalMA, model.SignalEcoWatt:
-		soc += 0.1
+		w.SoC += 0.1
+	}
+	return w
+}
+
+// scoreParts holds the weighted terms of a vehicle score. Wear, fairness and
+// degradation are penalties subtracted from the other terms.
+type scoreParts struct {
+	soc, time, priority, price, availability, wear, fairness, degradation float64
+}
+
+func (p scoreParts) total() float64 {
+	score := p.net()
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+// net returns the score without clamping the penalties at zero.
+func (p scoreParts) net() float64 {
+	score := p.soc + p.time + p.priority + p.price
+	score += p.availability
+	score -= p.wear + p.fairness
+	score -= p.degradation
+	return score
+}
+
+// components returns the terms keyed like the dispatcher weights, with the
+// penalties as negative values.
+func (p scoreParts) components() map[string]float64 {
+	return map[string]float64{
+		"soc":          p.soc,
+		"time":         p.time,
+		"priority":     p.priority,
+		"price":        p.price,
+		"availability": p.availability,
+		"wear":         -p.wear,
+		"fairness":     -p.fairness,
+		"degradation":  -p.degradation,
 	}
-	return soc, tm, prio, price, wear, fair, avail
 }
 
 // vehicleScore computes the weighted score for a vehicle.
 func (d SmartDispatcher) vehicleScore(v model.Vehicle, ctx *DispatchContext) float64 {
-	socW, timeW, prioW, priceW, wearW, fairW, availW := d.weightsForSignal(ctx.Signal.Type)
 	if v.BatteryKWh <= 0 {
 		return 0
 	}
+	return d.scoreParts(v, ctx).total()
+}
+
+func (d SmartDispatcher) scoreParts(v model.Vehicle, ctx *DispatchContext) scoreParts {
+	w := d.weightsForSignal(ctx.Signal.Type)
 	var energyNorm float64
 	denom := 1 - v.MinSoC
 	if denom == 0 {
@@ -138,16 +222,20 @@ func (d SmartDispatcher) vehicleScore(v model.Vehicle, ctx *DispatchContext) flo
 		priority = 1.0
 	}
 	wear := ctx.GetParticipation(v.ID)
-	score := energyNorm*socW + timeScore*timeW + priority*prioW + energyNorm*ctx.MarketPrice*priceW
-	score += v.AvailabilityProb * availW
-	score -= wear*wearW + wear*fairW
-	if score < 0 {
-		return 0
+	return scoreParts{
+		soc:          energyNorm * w.SoC,
+		time:         timeScore * w.Time,
+		priority:     priority * w.Priority,
+		price:        energyNorm * ctx.MarketPrice * w.Price,
+		availability: v.AvailabilityProb * w.Availability,
+		wear:         wear * w.Wear,
+		fairness:     wear * w.Fairness,
+		degradation:  wearCostPerKWh(v, ctx.Signal) * w.Degradation,
 	}
-	return score
 }
 
 // Dispatch implements the Dispatcher interface using the greedy weighted scores.
+// Setpoints are then quantised to the charger steps and ramp limits.
 //
 //gocyclo:ignore
 func (d *SmartDispatcher) Dispatch(vehicles []model.Vehicle, signal model.FlexibilitySignal) map[string]float64 {
@@ -156,7 +244,7 @@ func (d *SmartDispatcher) Dispatch(vehicles []model.Vehicle, signal model.Flexib
 		return assignments
 	}
 
-	ctx := &DispatchContext{Signal: signal, Now: signal.Timestamp, MarketPrice: d.MarketPrice, ParticipationScore: d.Participation}
+	ctx := &DispatchContext{Signal: signal, Now: signal.Timestamp, MarketPrice: d.MarketPriceFor(signal), ParticipationScore: d.participationScores()}
 
 	list, excluded := d.buildCandidates(vehicles, signal, ctx)
 	if d.Logger != nil {
@@ -206,7 +294,7 @@ func (d *SmartDispatcher) Dispatch(vehicles []model.Vehicle, signal model.Flexib
 			}
 		}
 	}
-	return assignments
+	return applyPowerConstraints(vehicles, signal, assignments)
 }
 
 func (d SmartDispatcher) allocateRound(list []candidate, weightSum, sign, remaining float64, assignments map[string]float64) ([]candidate, float64, float64, float64) {
@@ -246,3 +334,32 @@ func (d *SmartDispatcher) GetScores() map[string]float64 {
 func (d *SmartDispatcher) GetMarketPrice() float64 {
 	return d.MarketPrice
 }
+
+// SetPriceProvider implements PriceAwareDispatcher.
+func (d *SmartDispatcher) SetPriceProvider(p PriceProvider) {
+	d.Prices = p
+}
+
+// SetParticipationSource implements ParticipationAwareDispatcher.
+func (d *SmartDispatcher) SetParticipationSource(p ParticipationSource) {
+	d.Usage = p
+}
+
+// participationScores returns the scores of Usage, else Participation.
+func (d SmartDispatcher) participationScores() map[string]float64 {
+	if d.Usage != nil {
+		return d.Usage.ParticipationScores()
+	}
+	return d.Participation
+}
+
+// MarketPriceFor implements PriceAwareDispatcher. It returns the price of the
+// signal type at the signal timestamp, or MarketPrice when Prices has none.
+func (d SmartDispatcher) MarketPriceFor(signal model.FlexibilitySignal) float64 {
+	if d.Prices != nil {
+		if p, ok := d.Prices.PriceAt(signal.Timestamp, signal.Type); ok {
+			return p
+		}
+	}
+	return d.MarketPrice
+}
@@ -0,0 +1,52 @@
+package dispatch
+
+import (
+	"sync"
+	"time"
+)
+
+// TelemetrySample is the latest measurement reported by a vehicle.
+type TelemetrySample struct {
+	VehicleID string
+	PowerKW   float64
+	SoC       float64
+	Available bool
+	Time      time.Time
+}
+
+// TelemetrySource exposes the most recent telemetry received for a vehicle.
+type TelemetrySource interface {
+	Latest(vehicleID string) (TelemetrySample, bool)
+}
+
+// TelemetryCache is an in-memory TelemetrySource fed by telemetry collectors.
+type TelemetryCache struct {
+	mu      sync.RWMutex
+	samples map[string]TelemetrySample
+}
+
+// NewTelemetryCache returns an empty cache.
+func NewTelemetryCache() *TelemetryCache {
+	return &TelemetryCache{samples: make(map[string]TelemetrySample)}
+}
+
+// Update stores the sample if it is newer than the one already cached.
+func (c *TelemetryCache) Update(s TelemetrySample) {
+	if s.VehicleID == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prev, ok := c.samples[s.VehicleID]; ok && prev.Time.After(s.Time) {
+		return
+	}
+	c.samples[s.VehicleID] = s
+}
+
+// Latest implements TelemetrySource.
+func (c *TelemetryCache) Latest(vehicleID string) (TelemetrySample, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s, ok := c.samples[vehicleID]
+	return s, ok
+}
@@ -0,0 +1,315 @@
+package dispatch
+
+import (
+	"math"
+	"time"
+
+	"github.com/kilianp07/v2g/core/dispatch/logging"
+	"github.com/kilianp07/v2g/core/model"
+)
+
+// Stages of the dispatch pipeline recorded in a decision trace.
+const (
+	StageDiscovery  = "discovery"
+	StageLedger     = "ledger"
+	StageFilter     = "filter"
+	StageDispatcher = "dispatcher"
+)
+
+// Reason codes recorded in a decision trace.
+const (
+	ReasonPassed               = "passed"
+	ReasonNotDiscovered        = "not_discovered"
+	ReasonCommitted            = "fully_committed"
+	ReasonHeadroomLimited      = "headroom_limited"
+	ReasonUnavailable          = "unavailable"
+	ReasonNotV2G               = "not_v2g"
+	ReasonSoCBelowThreshold    = "soc_below_threshold"
+	ReasonCannotReduceCharge   = "cannot_reduce_charge"
+	ReasonFiltered             = "filtered"
+	ReasonSoCBelowMin          = "soc_below_min"
+	ReasonNoEnergy             = "no_energy"
+	ReasonInsufficientCapacity = "insufficient_capacity"
+	ReasonNoCapacity           = "no_capacity"
+	ReasonZeroScore            = "zero_score"
+	ReasonNoAllocation         = "no_allocation"
+	ReasonAllocated            = "allocated"
+	ReasonCapacityLimited      = "capacity_limited"
+)
+
+// StageDecision records the outcome of one pipeline stage for a vehicle.
+type StageDecision struct {
+	Stage  string `json:"stage"`
+	Reason string `json:"reason"`
+}
+
+// VehicleTrace explains the power allocated to a vehicle by a dispatch.
+type VehicleTrace struct {
+	// Reason is the outcome of the last stage the vehicle reached.
+	Reason string          `json:"reason"`
+	Stages []StageDecision `json:"stages"`
+	// SoC and AvailabilityProb are the values used for the decision, after
+	// predictions were applied.
+	SoC              float64 `json:"soc"`
+	AvailabilityProb float64 `json:"availability_prob"`
+	// CapacityKW is the power the vehicle could provide for the signal.
+	CapacityKW      float64            `json:"capacity_kw"`
+	Score           float64            `json:"score"`
+	ScoreComponents map[string]float64 `json:"score_components,omitempty"`
+	PowerKW         float64            `json:"power_kw"`
+}
+
+// DispatcherDecision holds what a dispatcher knew about a vehicle. Reason is
+// set when the dispatcher could not allocate any power to it.
+type DispatcherDecision struct {
+	Reason          string
+	CapacityKW      float64
+	Score           float64
+	ScoreComponents map[string]float64
+}
+
+// ExplainingFilter optionally reports why a vehicle filter drops a vehicle.
+type ExplainingFilter interface {
+	// Reason returns the reason code for dropping v, or "" when v is kept.
+	Reason(v model.Vehicle, signal model.FlexibilitySignal) string
+}
+
+// ExplainingDispatcher optionally reports the inputs it uses to allocate the
+// signal between vehicles. Explain must not change the dispatcher state.
+type ExplainingDispatcher interface {
+	Explain(vehicles []model.Vehicle, signal model.FlexibilitySignal) map[string]DispatcherDecision
+}
+
+// explain reports the capacity, score and exclusion reason of each vehicle.
+// socFilter applies the SoC constraints the greedy dispatch enforces.
+func (d SmartDispatcher) explain(vehicles []model.Vehicle, signal model.FlexibilitySignal, socFilter bool) map[string]DispatcherDecision {
+	ctx := &DispatchContext{Signal: signal, Now: signal.Timestamp, MarketPrice: d.MarketPriceFor(signal), ParticipationScore: d.participationScores()}
+	res := make(map[string]DispatcherDecision, len(vehicles))
+	for _, v := range vehicles {
+		var dec DispatcherDecision
+		if v.BatteryKWh > 0 {
+			parts := d.scoreParts(v, ctx)
+			dec.Score = parts.total()
+			dec.ScoreComponents = parts.components()
+		}
+		cap, _, ok := candidateCapacity(v, signal, d.EnableSoCConstraints, d.SafeDischargeFloor)
+		dec.CapacityKW = cap
+		switch {
+		case socFilter && d.EnableSoCConstraints && d.socExclusion(v, signal, len(vehicles)) != "":
+			dec.Reason = d.socExclusion(v, signal, len(vehicles))
+		case !ok:
+			dec.Reason = ReasonNoCapacity
+		case dec.Score == 0:
+			dec.Reason = ReasonZeroScore
+		}
+		res[v.ID] = dec
+	}
+	return res
+}
+
+// Explain implements ExplainingDispatcher.
+func (d *SmartDispatcher) Explain(vehicles []model.Vehicle, signal model.FlexibilitySignal) map[string]DispatcherDecision {
+	return d.explain(vehicles, signal, true)
+}
+
+// Explain implements ExplainingDispatcher. The LP allocates power to vehicles
+// with a zero score, so only the capacity excludes vehicles.
+func (d *LPDispatcher) Explain(vehicles []model.Vehicle, signal model.FlexibilitySignal) map[string]DispatcherDecision {
+	res := d.explain(vehicles, signal, false)
+	for id, dec := range res {
+		if dec.Reason == ReasonZeroScore {
+			dec.Reason = ""
+			res[id] = dec
+		}
+	}
+	return res
+}
+
+// Explain implements ExplainingDispatcher. Vehicles without energy above their
+// SoC floor over the horizon are left out of the plan.
+func (d *MultiPeriodLPDispatcher) Explain(vehicles []model.Vehicle, signal model.FlexibilitySignal) map[string]DispatcherDecision {
+	res := d.explain(vehicles, signal, false)
+	for _, v := range vehicles {
+		dec := res[v.ID]
+		r, ok := rampRange(v, signal)
+		switch {
+		case !ok || r.hi <= 0:
+			dec.Reason = ReasonNoCapacity
+		case v.BatteryKWh <= 0 || d.planEnergy(v, signal) <= 0:
+			dec.Reason = ReasonNoEnergy
+		default:
+			dec.Reason = ""
+			dec.CapacityKW = math.Min(v.MaxPower, r.hi)
+		}
+		res[v.ID] = dec
+	}
+	return res
+}
+
+// Explain implements ExplainingDispatcher using the strategy of each segment.
+func (d *SegmentedSmartDispatcher) Explain(vehicles []model.Vehicle, signal model.FlexibilitySignal) map[string]DispatcherDecision {
+	groups := make(map[string][]model.Vehicle)
+	for _, v := range vehicles {
+		groups[v.Segment] = append(groups[v.Segment], v)
+	}
+	res := make(map[string]DispatcherDecision, len(vehicles))
+	for seg, vs := range groups {
+		cfg := d.segments[seg]
+		sd := d.segmentDispatcher(cfg)
+		part := signal
+		if alloc, ok := d.last[seg]; ok {
+			part.PowerKW = math.Copysign(alloc.TargetKW, signal.PowerKW)
+		}
+		var decs map[string]DispatcherDecision
+		if cfg.DispatcherType == "lp" {
+			decs = (&LPDispatcher{SmartDispatcher: sd}).Explain(vs, part)
+		} else {
+			decs = sd.Explain(vs, part)
+		}
+		for id, dec := range decs {
+			res[id] = dec
+		}
+	}
+	return res
+}
+
+// traceDecisions explains the allocation of each vehicle the dispatch saw:
+// the discovered vehicles, those left after the ledger headroom and the
+// filter, and the assignments the dispatcher returned. Vehicles seen by earlier
+// dispatches within seenRetention but missing from vehicles are reported as not
+// discovered.
+//
+//gocyclo:ignore
+func (m *DispatchManager) traceDecisions(signal model.FlexibilitySignal, vehicles, headroom, filtered []model.Vehicle, assignments map[string]float64, used Dispatcher) map[string]VehicleTrace {
+	trace := make(map[string]VehicleTrace, len(vehicles))
+	now := time.Now()
+	m.mu.Lock()
+	for id, last := range m.seen {
+		if now.Sub(last) > seenRetention {
+			continue
+		}
+		trace[id] = VehicleTrace{Reason: ReasonNotDiscovered, Stages: []StageDecision{{Stage: StageDiscovery, Reason: ReasonNotDiscovered}}}
+	}
+	m.mu.Unlock()
+
+	kept := make(map[string]model.Vehicle, len(headroom))
+	for _, v := range headroom {
+		kept[v.ID] = v
+	}
+	selected := make(map[string]model.Vehicle, len(filtered))
+	for _, v := range filtered {
+		selected[v.ID] = v
+	}
+	var decisions map[string]DispatcherDecision
+	if ed, ok := used.(ExplainingDispatcher); ok {
+		decisions = ed.Explain(filtered, signal)
+	}
+	ef, explains := m.filter.(ExplainingFilter)
+
+	for _, v := range vehicles {
+		t := VehicleTrace{SoC: v.SoC, AvailabilityProb: v.AvailabilityProb}
+		t.Stages = append(t.Stages, StageDecision{Stage: StageDiscovery, Reason: ReasonPassed})
+		hv, ok := kept[v.ID]
+		if !ok {
+			t.Reason = ReasonCommitted
+			t.Stages = append(t.Stages, StageDecision{Stage: StageLedger, Reason: ReasonCommitted})
+			trace[v.ID] = t
+			continue
+		}
+		t.CapacityKW = hv.MaxPower
+		ledger := ReasonPassed
+		if hv.MaxPower < v.MaxPower {
+			ledger = ReasonHeadroomLimited
+		}
+		t.Stages = append(t.Stages, StageDecision{Stage: StageLedger, Reason: ledger})
+
+		sv, ok := selected[v.ID]
+		if !ok {
+			reason := ""
+			if explains {
+				reason = ef.Reason(hv, signal)
+			} else if !hv.Available {
+				reason = ReasonUnavailable
+			}
+			if reason == "" {
+				reason = ReasonFiltered
+			}
+			t.Reason = reason
+			t.Stages = append(t.Stages, StageDecision{Stage: StageFilter, Reason: reason})
+			trace[v.ID] = t
+			continue
+		}
+		t.Stages = append(t.Stages, StageDecision{Stage: StageFilter, Reason: ReasonPassed})
+		t.SoC, t.AvailabilityProb = sv.SoC, sv.AvailabilityProb
+
+		dec, hasDec := decisions[v.ID]
+		if hasDec {
+			t.CapacityKW = dec.CapacityKW
+			t.Score = dec.Score
+			t.ScoreComponents = dec.ScoreComponents
+		}
+		t.PowerKW = assignments[v.ID]
+		switch {
+		case t.PowerKW != 0 && hasDec && dec.CapacityKW > 0 && math.Abs(t.PowerKW) >= dec.CapacityKW-1e-6:
+			t.Reason = ReasonCapacityLimited
+		case t.PowerKW != 0:
+			t.Reason = ReasonAllocated
+		case dec.Reason != "":
+			t.Reason = dec.Reason
+		default:
+			t.Reason = ReasonNoAllocation
+		}
+		t.Stages = append(t.Stages, StageDecision{Stage: StageDispatcher, Reason: t.Reason})
+		trace[v.ID] = t
+	}
+	return trace
+}
+
+// seenRetention is how long a vehicle missing from discovery is still reported
+// as not discovered.
+const seenRetention = 24 * time.Hour
+
+// markSeen remembers the vehicles so later dispatches can report the ones
+// discovery no longer returns, and forgets those missing for longer than
+// seenRetention.
+func (m *DispatchManager) markSeen(vehicles []model.Vehicle) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.seen == nil {
+		m.seen = make(map[string]time.Time)
+	}
+	for id, last := range m.seen {
+		if now.Sub(last) > seenRetention {
+			delete(m.seen, id)
+		}
+	}
+	for _, v := range vehicles {
+		m.seen[v.ID] = now
+	}
+}
+
+// logTrace converts the decision trace for the log store.
+func logTrace(trace map[string]VehicleTrace) map[string]logging.VehicleTrace {
+	if len(trace) == 0 {
+		return nil
+	}
+	res := make(map[string]logging.VehicleTrace, len(trace))
+	for id, t := range trace {
+		lt := logging.VehicleTrace{
+			Reason:           t.Reason,
+			Stages:           make([]logging.StageDecision, 0, len(t.Stages)),
+			SoC:              t.SoC,
+			AvailabilityProb: t.AvailabilityProb,
+			CapacityKW:       t.CapacityKW,
+			Score:            t.Score,
+			ScoreComponents:  t.ScoreComponents,
+			PowerKW:          t.PowerKW,
+		}
+		for _, st := range t.Stages {
+			lt.Stages = append(lt.Stages, logging.StageDecision{Stage: st.Stage, Reason: st.Reason})
+		}
+		res[id] = lt
+	}
+	return res
+}
@@ -0,0 +1,86 @@
+package dispatch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+func TestDispatchTrace_Reasons(t *testing.T) {
+	pub := mqtt.NewMockPublisher()
+	sd := NewSmartDispatcher()
+	mgr, err := NewDispatchManager(SimpleVehicleFilter{}, &sd, NoopFallback{}, pub, time.Second, nil, nil, nil, logger.NopLogger{}, nil, nil)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	now := time.Now()
+	busy := model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 10, Duration: time.Hour, Timestamp: now}
+	id := mgr.ledger.Open(busy)
+	mgr.ledger.Set(id, "busy", 10)
+
+	vehicles := []model.Vehicle{
+		{ID: "ok", IsV2G: true, Available: true, MaxPower: 20, SoC: 0.8, BatteryKWh: 50},
+		{ID: "off", IsV2G: true, Available: false, MaxPower: 10, SoC: 0.8, BatteryKWh: 50},
+		{ID: "empty", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.05, BatteryKWh: 50},
+		{ID: "busy", IsV2G: true, Available: true, MaxPower: 10, SoC: 0.8, BatteryKWh: 50},
+	}
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 10, Duration: time.Minute, Timestamp: now}
+	res := mgr.Dispatch(sig, vehicles)
+
+	want := map[string]string{
+		"ok":    ReasonAllocated,
+		"off":   ReasonUnavailable,
+		"empty": ReasonSoCBelowMin,
+		"busy":  ReasonCommitted,
+	}
+	for id, reason := range want {
+		if got := res.Trace[id].Reason; got != reason {
+			t.Fatalf("%s: expected %s, got %s (%+v)", id, reason, got, res.Trace[id])
+		}
+	}
+	ok := res.Trace["ok"]
+	if len(ok.Stages) != 4 || ok.Stages[3].Stage != StageDispatcher || ok.PowerKW != res.Assignments["ok"] {
+		t.Fatalf("unexpected trace: %+v", ok)
+	}
+	if ok.Score == 0 || ok.ScoreComponents["soc"] == 0 || ok.CapacityKW != 20 {
+		t.Fatalf("expected the dispatcher inputs in the trace: %+v", ok)
+	}
+
+	res = mgr.Dispatch(sig, vehicles[:1])
+	if got := res.Trace["off"].Reason; got != ReasonNotDiscovered {
+		t.Fatalf("expected off not discovered, got %s", got)
+	}
+
+	mgr.mu.Lock()
+	mgr.seen["off"] = now.Add(-seenRetention - time.Minute)
+	mgr.mu.Unlock()
+	if res = mgr.Dispatch(sig, vehicles[:1]); len(mgr.seen) != 3 {
+		t.Fatalf("expected off to be forgotten, seen %v", mgr.seen)
+	}
+	if _, ok := res.Trace["off"]; ok {
+		t.Fatalf("expected no trace for a vehicle missing for longer than the retention")
+	}
+}
+
+func TestSimpleVehicleFilter_Reason(t *testing.T) {
+	f := SimpleVehicleFilter{}
+	fcr := model.FlexibilitySignal{Type: model.SignalFCR}
+	cases := []struct {
+		v      model.Vehicle
+		signal model.FlexibilitySignal
+		want   string
+	}{
+		{model.Vehicle{Available: true, IsV2G: false, SoC: 0.9}, fcr, ReasonNotV2G},
+		{model.Vehicle{Available: true, IsV2G: true, SoC: 0.5}, fcr, ReasonSoCBelowThreshold},
+		{model.Vehicle{Available: true, Charging: false}, model.FlexibilitySignal{Type: model.SignalNEBEF}, ReasonCannotReduceCharge},
+		{model.Vehicle{Available: true, IsV2G: true, SoC: 0.9}, fcr, ""},
+	}
+	for i, c := range cases {
+		if got := f.Reason(c.v, c.signal); got != c.want {
+			t.Fatalf("case %d: expected %q, got %q", i, c.want, got)
+		}
+	}
+}
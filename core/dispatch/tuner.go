@@ -1,13 +1,27 @@
 package dispatch
 
+import "github.com/kilianp07/v2g/internal/eventbus"
+
 // LearningTuner adjusts SmartDispatcher parameters based on past dispatch results.
-// history contains results of past dispatches.
+// history holds the results of past dispatches, the latest one last.
 type LearningTuner interface {
-	Tune(history []DispatchResult)
+	Tune(history History)
+}
+
+// ObservableTuner optionally publishes the changes it makes on the event bus.
+type ObservableTuner interface {
+	SetEventBus(bus eventbus.EventBus)
+}
+
+// ReusableTuner optionally keeps a tuner and what it learned across reloads.
+// Reuse binds the tuner to the rebuilt dispatcher d and returns true when cfg
+// selects the same tuner with the same parameters.
+type ReusableTuner interface {
+	Reuse(cfg Config, d Dispatcher) bool
 }
 
 // NoopTuner returns the dispatcher unchanged.
 type NoopTuner struct{}
 
-func (NoopTuner) Tune(_ []DispatchResult) {
+func (NoopTuner) Tune(_ History) {
 }
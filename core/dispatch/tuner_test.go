@@ -23,7 +23,7 @@ func TestAckBasedTuner_Increase(t *testing.T) {
 		Errors:       map[string]error{},
 	}}
 
-	tuner.Tune(history)
+	tuner.Tune(historyOf(history...))
 	if disp.AvailabilityWeight <= 0 {
 		t.Fatalf("expected weight increase")
 	}
@@ -40,7 +40,7 @@ func TestAckBasedTuner_Decrease(t *testing.T) {
 		Errors:       map[string]error{"v1": fmt.Errorf("%w", coremqtt.ErrAckTimeout)},
 	}}
 
-	tuner.Tune(history)
+	tuner.Tune(historyOf(history...))
 	if disp.AvailabilityWeight >= 0.5 {
 		t.Fatalf("expected weight decrease")
 	}
@@ -2,6 +2,7 @@ package dispatch
 
 import (
 	"context"
+	"math"
 	"time"
 
 	"github.com/kilianp07/v2g/core/model"
@@ -11,11 +12,54 @@ import (
 type DispatchResult struct {
 	Assignments         map[string]float64 // initial allocation per vehicle
 	FallbackAssignments map[string]float64 // reallocation if some vehicles fail
+	FallbackRounds      []FallbackRound    // orders published to apply the reallocation
 	Errors              map[string]error
 	Acknowledged        map[string]bool
 	Signal              model.FlexibilitySignal
 	MarketPrice         float64
 	Scores              map[string]float64
+	// Applied holds the power each vehicle acknowledged applying. It differs
+	// from Assignments when a vehicle accepted only part of its setpoint and
+	// is zero for vehicles that rejected or did not acknowledge it.
+	Applied map[string]float64
+	// AckReasons holds the reason codes vehicles gave for rejecting or
+	// partly applying their orders.
+	AckReasons map[string]string
+	// Plan holds the per-slot setpoints when the dispatcher planned the
+	// signal horizon. Sessions follow it slot by slot.
+	Plan *DispatchPlan
+	// Segments holds the per-segment targets and delivered power when the
+	// dispatcher splits the signal between vehicle segments.
+	Segments map[string]SegmentAllocation
+	// Trace explains, stage by stage, the power allocated to each vehicle.
+	Trace map[string]VehicleTrace
+	// WearCostEUR is the estimated battery wear cost of each assignment.
+	WearCostEUR map[string]float64
+	// Round numbers the later rounds of a session or droop signal, which
+	// only carry the setpoints they changed. It is zero for a dispatch.
+	Round int
+
+	// commitment identifies the ledger entry holding the dispatched power.
+	commitment uint64
+}
+
+// FallbackRound records the orders published during one fallback round.
+type FallbackRound struct {
+	Round        int
+	Assignments  map[string]float64 // setpoints changed by the reallocation
+	Acknowledged map[string]bool
+	Applied      map[string]float64 // power reported by the acknowledgments
+	Errors       map[string]error
+	DeficitKW    float64 // magnitude of the power still missing after the round, zero when met
+}
+
+// AppliedPower returns the power the vehicle acknowledged applying for its
+// setpoint of the round, or the setpoint when the round records none.
+func (r FallbackRound) AppliedPower(id string) float64 {
+	if p, ok := r.Applied[id]; ok {
+		return p
+	}
+	return r.Assignments[id]
 }
 
 // Dispatcher defines how power is distributed between vehicles.
@@ -38,11 +82,95 @@ type ScoringDispatcher interface {
 	GetScores() map[string]float64
 }
 
+// DispatchPlan holds setpoints planned slot by slot over a signal horizon.
+type DispatchPlan struct {
+	Start time.Time
+	// Slots holds the length of each slot.
+	Slots []time.Duration
+	// Setpoints holds the power of each vehicle during each slot.
+	Setpoints []map[string]float64
+	// SoC holds the expected SoC of each vehicle at the end of each slot.
+	SoC []map[string]float64
+}
+
+func newDispatchPlan(start time.Time, slots []time.Duration) DispatchPlan {
+	p := DispatchPlan{
+		Start:     start,
+		Slots:     slots,
+		Setpoints: make([]map[string]float64, len(slots)),
+		SoC:       make([]map[string]float64, len(slots)),
+	}
+	for i := range slots {
+		p.Setpoints[i] = make(map[string]float64)
+		p.SoC[i] = make(map[string]float64)
+	}
+	return p
+}
+
+// Slot returns the index of the slot covering t. ok is false outside the
+// plan.
+func (p DispatchPlan) Slot(t time.Time) (int, bool) {
+	if t.Before(p.Start) {
+		return 0, false
+	}
+	end := p.Start
+	for i, l := range p.Slots {
+		end = end.Add(l)
+		if t.Before(end) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Peak returns the largest power planned for each vehicle.
+func (p DispatchPlan) Peak() map[string]float64 {
+	res := make(map[string]float64)
+	for _, slot := range p.Setpoints {
+		for id, kw := range slot {
+			res[id] = math.Max(res[id], math.Abs(kw))
+		}
+	}
+	return res
+}
+
+// PlanningDispatcher optionally plans the signal over several slots.
+// PlanDispatch returns the setpoints of the first slot and the plan, or a nil
+// plan when the allocation was not planned.
+type PlanningDispatcher interface {
+	PlanDispatch(vehicles []model.Vehicle, signal model.FlexibilitySignal) (map[string]float64, *DispatchPlan)
+}
+
 // MarketPriceProvider exposes the current market price used by the dispatcher.
 type MarketPriceProvider interface {
 	GetMarketPrice() float64
 }
 
+// PriceProvider returns the market price of a signal type at a given time.
+type PriceProvider interface {
+	PriceAt(t time.Time, st model.SignalType) (float64, bool)
+}
+
+// PriceAwareDispatcher optionally prices signals with a PriceProvider instead
+// of a static market price.
+type PriceAwareDispatcher interface {
+	SetPriceProvider(p PriceProvider)
+	// MarketPriceFor returns the market price used to dispatch signal.
+	MarketPriceFor(signal model.FlexibilitySignal) float64
+}
+
+// ParticipationSource returns the participation score of each vehicle, from 0
+// for unused vehicles to 1 for the most used ones.
+type ParticipationSource interface {
+	ParticipationScores() map[string]float64
+}
+
+// ParticipationAwareDispatcher optionally reads the participation scores
+// driving its fairness and wear penalties from a ParticipationSource.
+type ParticipationAwareDispatcher interface {
+	SetParticipationSource(p ParticipationSource)
+}
+
 // FleetDiscovery retrieves the current list of available vehicles.
 // Discover should return within the provided timeout and must be non-blocking.
 type FleetDiscovery interface {
@@ -4,4 +4,8 @@
 //   - SignalEvent: new flexibility signal
 //   - AckEvent: vehicle acknowledgment result
 //   - StrategyEvent: dispatcher selection and fallback information
+//   - SessionEvent: closed-loop session corrections and release
+//   - DroopEvent: frequency-droop evaluation
+//   - ReloadEvent: configuration reload outcome
+//   - TunerEvent: weights changed by a learning tuner
 package events
@@ -0,0 +1,13 @@
+package events
+
+import "github.com/kilianp07/v2g/core/model"
+
+// DroopEvent is emitted each time the droop controller evaluates the grid
+// frequency.
+type DroopEvent struct {
+	Signal      model.FlexibilitySignal
+	FrequencyHz float64
+	Activation  float64
+	SetpointKW  float64
+	Stale       bool
+}
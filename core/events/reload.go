@@ -0,0 +1,8 @@
+package events
+
+// ReloadEvent reports the outcome of a configuration reload. Err is nil when
+// the new configuration was applied.
+type ReloadEvent struct {
+	Source string
+	Err    error
+}
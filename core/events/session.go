@@ -0,0 +1,12 @@
+package events
+
+import "github.com/kilianp07/v2g/core/model"
+
+// SessionEvent is emitted by closed-loop dispatch sessions.
+// Action can be "start", "correction" or "release".
+type SessionEvent struct {
+	Signal      model.FlexibilitySignal
+	Action      string
+	DeliveredKW float64
+	GapKW       float64
+}
@@ -0,0 +1,13 @@
+package events
+
+import "github.com/kilianp07/v2g/core/model"
+
+// TunerEvent is emitted when a learning tuner changes the weights used for a
+// signal type. Action can be "explore", "accept" or "reject". Weights holds
+// the weights in use after the change, keyed like the dispatcher weights.
+type TunerEvent struct {
+	Signal  model.SignalType
+	Action  string
+	Weights map[string]float64
+	Reward  float64
+}
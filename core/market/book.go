@@ -0,0 +1,72 @@
+package market
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+)
+
+// Kind names a market publishing a price series.
+type Kind string
+
+const (
+	// DayAhead is the day-ahead spot market.
+	DayAhead Kind = "day_ahead"
+	// Imbalance is the balancing settlement price.
+	Imbalance Kind = "imbalance"
+)
+
+// Valid reports whether k is a known market.
+func (k Kind) Valid() bool {
+	return k == DayAhead || k == Imbalance
+}
+
+// Book holds the price series of each market and the market priced for each
+// signal type. It is safe for concurrent use.
+type Book struct {
+	mu     sync.RWMutex
+	series map[Kind]Series
+	routes map[model.SignalType]Kind
+}
+
+// NewBook returns an empty book pricing the balancing signals (FCR and aFRR)
+// at the imbalance price and the others at the day-ahead price.
+func NewBook() *Book {
+	return &Book{
+		series: make(map[Kind]Series),
+		routes: map[model.SignalType]Kind{
+			model.SignalFCR:  Imbalance,
+			model.SignalAFRR: Imbalance,
+		},
+	}
+}
+
+// Set replaces the series of market k.
+func (b *Book) Set(k Kind, s Series) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.series[k] = s
+}
+
+// Route prices signals of type st with the series of market k.
+func (b *Book) Route(st model.SignalType, k Kind) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.routes[st] = k
+}
+
+// PriceAt returns the price of a signal of type st at t. Signals routed to a
+// market without a price at t use the day-ahead price.
+func (b *Book) PriceAt(t time.Time, st model.SignalType) (float64, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	k, ok := b.routes[st]
+	if !ok {
+		k = DayAhead
+	}
+	if p, ok := b.series[k].At(t); ok {
+		return p, true
+	}
+	return b.series[DayAhead].At(t)
+}
@@ -0,0 +1,58 @@
+package market
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+)
+
+func TestNewSeries_ClosesOpenPoints(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, err := NewSeries([]Point{
+		{Start: t0.Add(time.Hour), Price: 60},
+		{Start: t0, Price: 50},
+	})
+	if err != nil {
+		t.Fatalf("series: %v", err)
+	}
+	if p, ok := s.At(t0.Add(30 * time.Minute)); !ok || p != 50 {
+		t.Fatalf("expected 50, got %v %v", p, ok)
+	}
+	if p, ok := s.At(t0.Add(90 * time.Minute)); !ok || p != 60 {
+		t.Fatalf("expected 60, got %v %v", p, ok)
+	}
+	if _, ok := s.At(t0.Add(2 * time.Hour)); ok {
+		t.Fatalf("expected no price after the last interval")
+	}
+	if _, ok := s.At(t0.Add(-time.Minute)); ok {
+		t.Fatalf("expected no price before the series")
+	}
+	if _, err := NewSeries([]Point{{Start: t0, End: t0.Add(time.Hour)}, {Start: t0.Add(time.Minute)}}); err == nil {
+		t.Fatalf("expected overlapping points to be rejected")
+	}
+}
+
+func TestBook_RoutesSignalTypes(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBook()
+	b.Set(DayAhead, Series{{Start: t0, End: t0.Add(2 * time.Hour), Price: 50}})
+	b.Set(Imbalance, Series{{Start: t0, End: t0.Add(time.Hour), Price: 120}})
+
+	if p, _ := b.PriceAt(t0, model.SignalMA); p != 50 {
+		t.Fatalf("expected day-ahead price for MA, got %v", p)
+	}
+	if p, _ := b.PriceAt(t0, model.SignalFCR); p != 120 {
+		t.Fatalf("expected imbalance price for FCR, got %v", p)
+	}
+	if p, _ := b.PriceAt(t0.Add(90*time.Minute), model.SignalFCR); p != 50 {
+		t.Fatalf("expected day-ahead price without imbalance price, got %v", p)
+	}
+	b.Route(model.SignalMA, Imbalance)
+	if p, _ := b.PriceAt(t0, model.SignalMA); p != 120 {
+		t.Fatalf("expected rerouted MA to use imbalance price, got %v", p)
+	}
+	if _, ok := b.PriceAt(t0.Add(3*time.Hour), model.SignalMA); ok {
+		t.Fatalf("expected no price outside the series")
+	}
+}
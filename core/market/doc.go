@@ -0,0 +1,4 @@
+// Package market holds time-varying electricity prices. A Book keeps one price
+// series per market, such as day-ahead or imbalance, and answers the price of a
+// signal type at a given time.
+package market
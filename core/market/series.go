@@ -0,0 +1,56 @@
+package market
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Point is a price valid from Start until End.
+type Point struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Price float64   `json:"price"`
+}
+
+// Series is a list of non-overlapping prices sorted by start time.
+type Series []Point
+
+// NewSeries sorts the points and closes the open ones: a point without End
+// lasts until the next one starts, and the last one as long as the previous
+// interval, or one hour for a single point. Overlapping points are rejected.
+func NewSeries(points []Point) (Series, error) {
+	s := append(Series(nil), points...)
+	sort.Slice(s, func(i, j int) bool { return s[i].Start.Before(s[j].Start) })
+	for i := range s {
+		if !s[i].End.IsZero() {
+			continue
+		}
+		switch {
+		case i+1 < len(s):
+			s[i].End = s[i+1].Start
+		case i > 0:
+			s[i].End = s[i].Start.Add(s[i-1].End.Sub(s[i-1].Start))
+		default:
+			s[i].End = s[i].Start.Add(time.Hour)
+		}
+	}
+	for i, p := range s {
+		if !p.End.After(p.Start) {
+			return nil, fmt.Errorf("price at %s ends before it starts", p.Start.Format(time.RFC3339))
+		}
+		if i > 0 && p.Start.Before(s[i-1].End) {
+			return nil, fmt.Errorf("price at %s overlaps the previous one", p.Start.Format(time.RFC3339))
+		}
+	}
+	return s, nil
+}
+
+// At returns the price valid at t.
+func (s Series) At(t time.Time) (float64, bool) {
+	i := sort.Search(len(s), func(i int) bool { return s[i].End.After(t) })
+	if i == len(s) || t.Before(s[i].Start) {
+		return 0, false
+	}
+	return s[i].Price, true
+}
@@ -13,6 +13,7 @@ type DispatchResult struct {
 	EndTime      time.Time
 	VehicleID    string
 	PowerKW      float64
+	AppliedKW    float64
 	Score        float64
 	MarketPrice  float64
 	Acknowledged bool
@@ -93,6 +94,7 @@ type FallbackEvent struct {
 	Signal        model.SignalType
 	Reason        string
 	ResidualPower float64
+	Round         int
 	Time          time.Time
 }
 
@@ -0,0 +1,35 @@
+package model
+
+import "math"
+
+// DroopParams describes a frequency-droop response. The vehicle injects
+// CapacityKW when the frequency is FullActivationMHz below NominalHz and
+// absorbs CapacityKW when it is as much above. Deviations within DeadbandMHz
+// are ignored.
+type DroopParams struct {
+	NominalHz         float64 `json:"nominal_hz"`
+	DeadbandMHz       float64 `json:"deadband_mhz"`
+	FullActivationMHz float64 `json:"full_activation_mhz"`
+	CapacityKW        float64 `json:"capacity_kw"`
+}
+
+// Activation returns the share of the capacity to deliver at the given
+// frequency, between -1 (full absorption) and 1 (full injection). The
+// response grows linearly from the edge of the deadband to full activation.
+func (p DroopParams) Activation(hz float64) float64 {
+	devMHz := (p.NominalHz - hz) * 1000
+	band := math.Abs(devMHz) - p.DeadbandMHz
+	if band <= 0 {
+		return 0
+	}
+	span := p.FullActivationMHz - p.DeadbandMHz
+	if span <= 0 {
+		return math.Copysign(1, devMHz)
+	}
+	return math.Copysign(math.Min(1, band/span), devMHz)
+}
+
+// SetpointKW returns the power to deliver at the given frequency.
+func (p DroopParams) SetpointKW(hz float64) float64 {
+	return p.Activation(hz) * p.CapacityKW
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDroopParams_Activation(t *testing.T) {
+	p := DroopParams{NominalHz: 50, DeadbandMHz: 10, FullActivationMHz: 200, CapacityKW: 10}
+	cases := []struct {
+		hz   float64
+		want float64
+	}{
+		{50, 0},
+		{50.005, 0},
+		{49.8, 1},
+		{49.7, 1},
+		{50.2, -1},
+		{49.895, 0.5},
+		{50.105, -0.5},
+	}
+	for _, c := range cases {
+		if got := p.Activation(c.hz); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("activation at %.3f Hz: got %v, want %v", c.hz, got, c.want)
+		}
+	}
+	if got := p.SetpointKW(49.895); math.Abs(got-5) > 1e-9 {
+		t.Errorf("expected 5 kW setpoint, got %v", got)
+	}
+}
@@ -17,6 +17,7 @@ type Vehicle struct {
 	Charging   bool      // whether the vehicle is currently charging
 	Priority   bool      // whether the charging session is marked as priority
 	Departure  time.Time // planned departure time
+	Arrival    time.Time // planned arrival time, zero when already connected
 	MinSoC     float64   // minimum required SoC at departure
 
 	// Optional profile and metadata information used by advanced algorithms.
@@ -36,6 +37,25 @@ type Vehicle struct {
 	// battery degradation or temperature effects. 0 means no degradation,
 	// 1 means completely unusable.
 	DegradationFactor float64
+
+	// CurrentPowerKW is the setpoint the vehicle is following, positive when
+	// injecting.
+	CurrentPowerKW float64
+	// RampRateKW limits how fast the setpoint can change, in kW per second.
+	// Zero means the charger can jump to any setpoint.
+	RampRateKW float64
+	// MinPowerKW is the smallest non-zero power the charger can operate at.
+	// Setpoints between zero and MinPowerKW fall in its dead zone.
+	MinPowerKW float64
+	// PowerStepKW is the setpoint resolution of the charger, for example
+	// 6 A per phase. Zero means continuous.
+	PowerStepKW float64
+	// ChargeRateKW is the power available to recharge the battery before
+	// departure. Zero uses MaxPower.
+	ChargeRateKW float64
+	// Chemistry names the battery chemistry, for example NMC or LFP, used to
+	// estimate the wear of dispatching the vehicle.
+	Chemistry string
 }
 
 // UserProfile contains user-specific data that can be leveraged
@@ -59,6 +79,47 @@ func (v Vehicle) CanProvidePower(power float64) bool {
 	return v.IsV2G && v.Available && v.SoC >= v.MinSoC && v.MaxPower >= power
 }
 
+// HasPowerConstraints reports whether the charger limits how its setpoint can
+// change beyond MaxPower.
+func (v Vehicle) HasPowerConstraints() bool {
+	return v.RampRateKW > 0 || v.MinPowerKW > 0 || v.PowerStepKW > 0
+}
+
+// PowerBounds returns the signed setpoint range the vehicle can reach within
+// the given time from CurrentPowerKW.
+func (v Vehicle) PowerBounds(within time.Duration) (lo, hi float64) {
+	lo, hi = -v.MaxPower, v.MaxPower
+	if v.RampRateKW > 0 {
+		delta := v.RampRateKW * within.Seconds()
+		lo = math.Max(lo, v.CurrentPowerKW-delta)
+		hi = math.Min(hi, v.CurrentPowerKW+delta)
+	}
+	return lo, hi
+}
+
+// DischargeableKWh returns the energy the vehicle can deliver between start and
+// start+d and still recharge to MinSoC by Departure at ChargeRateKW. Without a
+// departure time the vehicle must stay at or above MinSoC. A vehicle without a
+// battery capacity is not limited.
+func (v Vehicle) DischargeableKWh(start time.Time, d time.Duration) float64 {
+	if v.BatteryKWh <= 0 {
+		return math.Inf(1)
+	}
+	stored := v.SoC * v.BatteryKWh
+	reserve := v.MinSoC * v.BatteryKWh
+	var recharge float64
+	if !v.Departure.IsZero() {
+		rate := v.ChargeRateKW
+		if rate <= 0 {
+			rate = v.MaxPower
+		}
+		if end := start.Add(d); v.Departure.After(end) {
+			recharge = rate * v.Departure.Sub(end).Hours()
+		}
+	}
+	return math.Max(0, math.Min(stored, stored-reserve+recharge))
+}
+
 // CanReduceCharge returns true if the vehicle can reduce its charging power.
 func (v Vehicle) CanReduceCharge() bool {
 	return v.Charging && !v.Priority
@@ -3,6 +3,7 @@ package model
 import (
 	"math"
 	"testing"
+	"time"
 )
 
 func TestVehicleEffectiveCapacity(t *testing.T) {
@@ -29,3 +30,36 @@ func TestVehicleEffectiveCapacityLowSoC(t *testing.T) {
 		t.Fatalf("expected 0 got %v", cap)
 	}
 }
+
+func TestVehiclePowerBounds(t *testing.T) {
+	v := Vehicle{MaxPower: 10, CurrentPowerKW: 8, RampRateKW: 0.1}
+	lo, hi := v.PowerBounds(30 * time.Second)
+	if math.Abs(lo-5) > 1e-9 || hi != 10 {
+		t.Fatalf("expected [5, 10], got [%v, %v]", lo, hi)
+	}
+	v.RampRateKW = 0
+	if lo, hi := v.PowerBounds(time.Second); lo != -10 || hi != 10 {
+		t.Fatalf("expected unlimited ramp, got [%v, %v]", lo, hi)
+	}
+}
+
+func TestVehicleDischargeableKWh(t *testing.T) {
+	now := time.Now()
+	v := Vehicle{SoC: 0.5, MinSoC: 0.4, BatteryKWh: 50, MaxPower: 10, ChargeRateKW: 7}
+	if e := v.DischargeableKWh(now, time.Hour); math.Abs(e-5) > 1e-9 {
+		t.Fatalf("expected 5 kWh above MinSoC without departure, got %v", e)
+	}
+	v.Departure = now.Add(3 * time.Hour)
+	// 5 kWh above MinSoC plus 2 h of recharge at 7 kW.
+	if e := v.DischargeableKWh(now, time.Hour); math.Abs(e-19) > 1e-9 {
+		t.Fatalf("expected 19 kWh with recharge time, got %v", e)
+	}
+	v.Departure = now.Add(30 * time.Minute)
+	if e := v.DischargeableKWh(now, time.Hour); math.Abs(e-5) > 1e-9 {
+		t.Fatalf("expected no recharge when leaving during the signal, got %v", e)
+	}
+	v.BatteryKWh = 0
+	if e := v.DischargeableKWh(now, time.Hour); !math.IsInf(e, 1) {
+		t.Fatalf("expected no limit without battery capacity, got %v", e)
+	}
+}
@@ -0,0 +1,56 @@
+package mqtt
+
+// AckStatus is the outcome a vehicle reports for a command.
+type AckStatus string
+
+// Acknowledgment statuses.
+const (
+	AckAccepted AckStatus = "accepted"
+	AckRejected AckStatus = "rejected"
+	AckPartial  AckStatus = "partial"
+)
+
+// Reason codes reported by vehicles that reject a command or apply only part
+// of it.
+const (
+	AckReasonMaxPower      = "max_power"
+	AckReasonDischargeRate = "discharge_rate"
+	AckReasonChargeRate    = "charge_rate"
+	AckReasonBatteryEmpty  = "battery_empty"
+	AckReasonBatteryFull   = "battery_full"
+	AckReasonExpired       = "expired"
+)
+
+// Ack is the acknowledgment of a command. Vehicles reporting only the command
+// ID are considered to have accepted it, without applied power or SoC.
+type Ack struct {
+	CommandID string    `json:"command_id"`
+	VehicleID string    `json:"vehicle_id,omitempty"`
+	Status    AckStatus `json:"status,omitempty"`
+	// AppliedKW is the setpoint the vehicle applies, nil when not reported.
+	AppliedKW *float64 `json:"applied_kw,omitempty"`
+	// Reason explains a rejection or a partial acceptance.
+	Reason string `json:"reason,omitempty"`
+	// SoC is the state of charge of the vehicle when it answered, nil when
+	// not reported.
+	SoC *float64 `json:"soc,omitempty"`
+}
+
+// Accepted reports whether the vehicle applies the command, fully or in part.
+func (a Ack) Accepted() bool {
+	return a.Status == AckAccepted || a.Status == AckPartial
+}
+
+// Applied returns the setpoint the vehicle applies for a command requesting
+// requestedKW: the reported power, the requested power when none was
+// reported, or zero when the command was not accepted.
+func (a Ack) Applied(requestedKW float64) float64 {
+	switch {
+	case !a.Accepted():
+		return 0
+	case a.AppliedKW != nil:
+		return *a.AppliedKW
+	default:
+		return requestedKW
+	}
+}
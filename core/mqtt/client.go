@@ -1,6 +1,10 @@
 package mqtt
 
-import "time"
+import (
+	"time"
+
+	"github.com/kilianp07/v2g/core/model"
+)
 
 // Client represents an MQTT client capable of sending dispatch orders and
 // waiting for acknowledgments from vehicles.
@@ -10,6 +14,49 @@ type Client interface {
 	SendOrder(vehicleID string, powerKW float64) (commandID string, err error)
 
 	// WaitForAck waits for an acknowledgment for the provided command
-	// identifier or until the timeout expires.
-	WaitForAck(commandID string, timeout time.Duration) (bool, error)
+	// identifier or until the timeout expires. It returns the
+	// acknowledgment the vehicle sent, whose status tells whether the
+	// command was accepted, rejected or only partly applied.
+	WaitForAck(commandID string, timeout time.Duration) (Ack, error)
+}
+
+// ExpiringClient is implemented by clients whose orders carry a validity
+// window and that can send explicit release commands. A vehicle that does not
+// receive a new order before the window closes resumes its default behaviour.
+type ExpiringClient interface {
+	Client
+
+	// SendOrderUntil sends a command that the vehicle must drop at
+	// validUntil and returns the command identifier.
+	SendOrderUntil(vehicleID string, powerKW float64, validUntil time.Time) (commandID string, err error)
+
+	// SendRelease asks the vehicle to drop its current setpoint and resume
+	// its default behaviour.
+	SendRelease(vehicleID string) (commandID string, err error)
+}
+
+// DroopClient is implemented by clients able to configure vehicles to follow
+// the grid frequency locally.
+type DroopClient interface {
+	// SendDroop pushes the droop parameters to the vehicle. They apply until
+	// validUntil or until the vehicle receives a release command.
+	SendDroop(vehicleID string, params model.DroopParams, validUntil time.Time) (commandID string, err error)
+}
+
+// QueueingClient is implemented by clients that queue the commands they could
+// not publish, failing with ErrOrderQueued, and deliver them later.
+type QueueingClient interface {
+	// DropQueued drops the commands still queued for the vehicle, so that
+	// they are never delivered.
+	DropQueued(vehicleID string) error
+}
+
+// MetadataClient is implemented by clients able to attach metadata about the
+// originating signal to the orders they send, such as MQTT v5 user
+// properties.
+type MetadataClient interface {
+	// SendOrderWithMetadata sends a command carrying metadata that the
+	// vehicle must drop at validUntil. A zero validUntil leaves the
+	// validity to the client.
+	SendOrderWithMetadata(vehicleID string, powerKW float64, validUntil time.Time, metadata map[string]string) (commandID string, err error)
 }
@@ -4,3 +4,11 @@ import "errors"
 
 // ErrAckTimeout is returned when no acknowledgment is received before the timeout.
 var ErrAckTimeout = errors.New("timeout waiting for ack")
+
+// ErrOrderRejected is reported when a vehicle acknowledges a command with the
+// rejected status.
+var ErrOrderRejected = errors.New("order rejected")
+
+// ErrOrderQueued is returned for a command that could not be published and
+// was queued to be delivered once the broker is reachable.
+var ErrOrderQueued = errors.New("order queued in outbox")
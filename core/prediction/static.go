@@ -0,0 +1,49 @@
+package prediction
+
+import (
+	"fmt"
+	"time"
+)
+
+// StaticPredictionEngine predicts a fixed availability probability per
+// vehicle, for instance from configuration. It does not forecast SoC.
+type StaticPredictionEngine struct {
+	availability map[string]float64
+}
+
+// NewStaticPredictionEngine returns an engine predicting the given
+// probabilities. Vehicles without one are predicted available. It returns an
+// error when a probability is outside [0,1].
+func NewStaticPredictionEngine(availability map[string]float64) (*StaticPredictionEngine, error) {
+	if err := ValidateAvailability(availability); err != nil {
+		return nil, err
+	}
+	cp := make(map[string]float64, len(availability))
+	for id, p := range availability {
+		cp[id] = p
+	}
+	return &StaticPredictionEngine{availability: cp}, nil
+}
+
+// ValidateAvailability checks that every probability is within [0,1].
+func ValidateAvailability(availability map[string]float64) error {
+	for id, p := range availability {
+		if p < 0 || p > 1 {
+			return fmt.Errorf("availability of %s must be between 0 and 1", id)
+		}
+	}
+	return nil
+}
+
+// PredictAvailability returns the configured probability for the vehicle or 1.
+func (e *StaticPredictionEngine) PredictAvailability(id string, _ time.Time) float64 {
+	if p, ok := e.availability[id]; ok {
+		return p
+	}
+	return 1
+}
+
+// ForecastSoC returns nil since the engine has no SoC model.
+func (e *StaticPredictionEngine) ForecastSoC(string, time.Duration) []float64 {
+	return nil
+}
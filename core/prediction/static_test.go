@@ -0,0 +1,27 @@
+package prediction
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStaticPredictionEngine(t *testing.T) {
+	avail := map[string]float64{"v1": 0.4}
+	eng, err := NewStaticPredictionEngine(avail)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	avail["v1"] = 0.9
+	if p := eng.PredictAvailability("v1", time.Now()); p != 0.4 {
+		t.Fatalf("expected configured value, got %v", p)
+	}
+	if p := eng.PredictAvailability("v2", time.Now()); p != 1 {
+		t.Fatalf("expected default value 1, got %v", p)
+	}
+	if eng.ForecastSoC("v1", time.Hour) != nil {
+		t.Fatalf("expected no SoC forecast")
+	}
+	if _, err := NewStaticPredictionEngine(map[string]float64{"v1": -0.1}); err == nil {
+		t.Fatalf("expected invalid probability to be rejected")
+	}
+}
@@ -0,0 +1,108 @@
+package settlement
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Report views exported by WriteCSV.
+const (
+	ViewSignals  = "signals"
+	ViewVehicles = "vehicles"
+	ViewMonths   = "months"
+)
+
+var amountHeader = []string{"energy_kwh", "capacity_eur", "energy_eur", "penalty_eur", "driver_eur", "net_eur"}
+
+// WriteCSV writes one view of the report: a row per signal and vehicle, per
+// vehicle, or per month with a row per vehicle of the month after its total.
+func WriteCSV(w io.Writer, rep Report, view string) error {
+	cw := csv.NewWriter(w)
+	var err error
+	switch view {
+	case ViewSignals:
+		err = writeSignals(cw, rep)
+	case ViewVehicles:
+		err = writeVehicles(cw, rep)
+	case ViewMonths:
+		err = writeMonths(cw, rep)
+	default:
+		return fmt.Errorf("unknown settlement view %q", view)
+	}
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeSignals(cw *csv.Writer, rep Report) error {
+	header := append([]string{"timestamp", "signal_type", "duration_seconds", "target_kw", "delivered_kw", "energy_price", "vehicle_id"}, amountHeader...)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, s := range rep.Signals {
+		prefix := []string{s.Timestamp.UTC().Format(time.RFC3339), s.SignalType, num(s.DurationSeconds), num(s.TargetKW), num(s.DeliveredKW), num(s.EnergyPrice)}
+		if err := cw.Write(append(append(prefix, ""), amounts(s.Amounts)...)); err != nil {
+			return err
+		}
+		for _, id := range sortedKeys(s.Vehicles) {
+			if err := cw.Write(append(append(prefix, id), amounts(s.Vehicles[id])...)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeVehicles(cw *csv.Writer, rep Report) error {
+	if err := cw.Write(append([]string{"vehicle_id", "signals"}, amountHeader...)); err != nil {
+		return err
+	}
+	for _, v := range rep.Vehicles {
+		if err := cw.Write(append([]string{v.VehicleID, strconv.Itoa(v.Signals)}, amounts(v.Amounts)...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeMonths(cw *csv.Writer, rep Report) error {
+	if err := cw.Write(append([]string{"month", "vehicle_id", "signals"}, amountHeader...)); err != nil {
+		return err
+	}
+	for _, m := range rep.Months {
+		if err := cw.Write(append([]string{m.Month, "", strconv.Itoa(m.Signals)}, amounts(m.Amounts)...)); err != nil {
+			return err
+		}
+		for _, v := range m.Vehicles {
+			if err := cw.Write(append([]string{m.Month, v.VehicleID, strconv.Itoa(v.Signals)}, amounts(v.Amounts)...)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func amounts(a Amounts) []string {
+	return []string{num(a.EnergyKWh), num(a.CapacityEUR), num(a.EnergyEUR), num(a.PenaltyEUR), num(a.DriverEUR), num(a.NetEUR)}
+}
+
+// num formats amounts to a hundredth of a cent.
+func num(f float64) string {
+	return strconv.FormatFloat(math.Round(f*1e4)/1e4, 'f', -1, 64)
+}
+
+func sortedKeys(m map[string]Amounts) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,5 @@
+// Package settlement computes the revenue of dispatched flexibility from the
+// dispatch logs: capacity remuneration per product, energy value, penalties
+// for non-delivery and the share paid to drivers, per signal, per vehicle and
+// per month.
+package settlement
@@ -0,0 +1,364 @@
+package settlement
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/kilianp07/v2g/core/dispatch/logging"
+	"github.com/kilianp07/v2g/core/model"
+)
+
+// Amounts are the revenue components of a statement in €.
+type Amounts struct {
+	EnergyKWh   float64 `json:"energy_kwh"`
+	CapacityEUR float64 `json:"capacity_eur"`
+	EnergyEUR   float64 `json:"energy_eur"`
+	PenaltyEUR  float64 `json:"penalty_eur"`
+	// DriverEUR is paid to the drivers out of the revenue.
+	DriverEUR float64 `json:"driver_eur"`
+	// NetEUR is the revenue kept after penalties and the driver share.
+	NetEUR float64 `json:"net_eur"`
+}
+
+func (a *Amounts) add(b Amounts) {
+	a.EnergyKWh += b.EnergyKWh
+	a.CapacityEUR += b.CapacityEUR
+	a.EnergyEUR += b.EnergyEUR
+	a.PenaltyEUR += b.PenaltyEUR
+	a.DriverEUR += b.DriverEUR
+	a.NetEUR += b.NetEUR
+}
+
+// SignalStatement settles one dispatched signal.
+type SignalStatement struct {
+	Timestamp       time.Time `json:"timestamp"`
+	SignalType      string    `json:"signal_type"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	TargetKW        float64   `json:"target_kw"`
+	// DeliveredKW is the power held by the vehicles that acknowledged.
+	DeliveredKW float64 `json:"delivered_kw"`
+	// EnergyPrice is the €/kWh the delivered energy was valued at.
+	EnergyPrice float64 `json:"energy_price"`
+	Amounts
+	Vehicles map[string]Amounts `json:"vehicles"`
+}
+
+// VehicleStatement sums the revenue of a vehicle over several signals.
+type VehicleStatement struct {
+	VehicleID string `json:"vehicle_id"`
+	Signals   int    `json:"signals"`
+	Amounts
+}
+
+// MonthStatement rolls up the signals dispatched in a calendar month (UTC).
+type MonthStatement struct {
+	Month   string `json:"month"`
+	Signals int    `json:"signals"`
+	Amounts
+	Vehicles []VehicleStatement `json:"vehicles"`
+}
+
+// Report holds the statements of a period.
+type Report struct {
+	Signals  []SignalStatement  `json:"signals"`
+	Vehicles []VehicleStatement `json:"vehicles"`
+	Months   []MonthStatement   `json:"months"`
+	Total    Amounts            `json:"total"`
+}
+
+// Settler settles the records of a dispatch log store.
+type Settler struct {
+	store  logging.LogStore
+	tariff Tariff
+}
+
+// NewSettler returns a settler pricing the records of store with tariff.
+func NewSettler(store logging.LogStore, tariff Tariff) *Settler {
+	return &Settler{store: store, tariff: tariff}
+}
+
+// Report settles the records matching q.
+func (s *Settler) Report(ctx context.Context, q logging.LogQuery) (Report, error) {
+	records, err := s.store.Query(ctx, q)
+	if err != nil {
+		return Report{}, err
+	}
+	return Settle(records, s.tariff), nil
+}
+
+// Settle prices the records with the tariff. The rounds of a session or droop
+// signal are settled with the dispatch they follow as one signal. Each vehicle
+// is credited with the capacity and energy it delivered and charged with the
+// penalty for the power it was assigned but did not deliver. Drivers receive
+// DriverShare of their vehicle's revenue net of penalties, never less than
+// zero.
+func Settle(records []logging.LogRecord, t Tariff) Report {
+	sorted := append([]logging.LogRecord(nil), records...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ti, tj := recordTime(sorted[i]), recordTime(sorted[j])
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+	signals := groupSignals(sorted)
+	rep := Report{Signals: make([]SignalStatement, 0, len(signals))}
+
+	vehicles := map[string]*VehicleStatement{}
+	months := map[string]*MonthStatement{}
+	monthVehicles := map[string]map[string]*VehicleStatement{}
+	var order []string
+	for _, group := range signals {
+		st := settleSignal(group, t)
+		rep.Signals = append(rep.Signals, st)
+		rep.Total.add(st.Amounts)
+
+		month := st.Timestamp.UTC().Format("2006-01")
+		ms, ok := months[month]
+		if !ok {
+			ms = &MonthStatement{Month: month}
+			months[month] = ms
+			monthVehicles[month] = map[string]*VehicleStatement{}
+			order = append(order, month)
+		}
+		ms.Signals++
+		ms.add(st.Amounts)
+		for id, a := range st.Vehicles {
+			addVehicle(vehicles, id, a)
+			addVehicle(monthVehicles[month], id, a)
+		}
+	}
+	rep.Vehicles = sortedVehicles(vehicles)
+	for _, m := range order {
+		ms := months[m]
+		ms.Vehicles = sortedVehicles(monthVehicles[m])
+		rep.Months = append(rep.Months, *ms)
+	}
+	return rep
+}
+
+func addVehicle(m map[string]*VehicleStatement, id string, a Amounts) {
+	vs, ok := m[id]
+	if !ok {
+		vs = &VehicleStatement{VehicleID: id}
+		m[id] = vs
+	}
+	vs.Signals++
+	vs.add(a)
+}
+
+func sortedVehicles(m map[string]*VehicleStatement) []VehicleStatement {
+	res := make([]VehicleStatement, 0, len(m))
+	for _, vs := range m {
+		res = append(res, *vs)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].VehicleID < res[j].VehicleID })
+	return res
+}
+
+// recordTime returns the time the signal started, or the record time when the
+// signal has none.
+func recordTime(r logging.LogRecord) time.Time {
+	if !r.Signal.Timestamp.IsZero() {
+		return r.Signal.Timestamp
+	}
+	return r.Timestamp
+}
+
+// signalKey identifies the records of one signal.
+type signalKey struct {
+	signal   model.SignalType
+	start    int64
+	duration time.Duration
+	power    float64
+}
+
+func keyOf(s model.FlexibilitySignal) signalKey {
+	return signalKey{signal: s.Type, start: s.Timestamp.UnixNano(), duration: s.Duration, power: s.PowerKW}
+}
+
+// groupSignals groups the sorted records per signal: each dispatch with the
+// session rounds following it, and the rounds of a droop signal, which has no
+// dispatch record.
+func groupSignals(sorted []logging.LogRecord) [][]logging.LogRecord {
+	var groups [][]logging.LogRecord
+	open := map[signalKey]int{}
+	for _, rec := range sorted {
+		k := keyOf(rec.Signal)
+		if i, ok := open[k]; ok && rec.Round > 0 {
+			groups[i] = append(groups[i], rec)
+			continue
+		}
+		open[k] = len(groups)
+		groups = append(groups, []logging.LogRecord{rec})
+	}
+	return groups
+}
+
+// signalPower returns the power each vehicle was assigned and held over the
+// signal. A dispatch holds its setpoints for the whole signal. The later
+// rounds replace the setpoints of the vehicles they moved from the time they
+// were logged, so the powers are averaged over the signal duration.
+func signalPower(group []logging.LogRecord) (map[string]float64, map[string]float64) {
+	first := group[0]
+	if len(group) == 1 {
+		return first.Response.Assignments, delivered(first.Response)
+	}
+	start := recordTime(first)
+	total := first.Signal.Duration
+	assigned, held := map[string]float64{}, map[string]float64{}
+	avgAssigned, avgHeld := map[string]float64{}, map[string]float64{}
+	for i, rec := range group {
+		for id, kw := range rec.Response.Assignments {
+			assigned[id] = kw
+		}
+		for id, kw := range acknowledged(rec.Response) {
+			held[id] = kw
+		}
+		if total <= 0 {
+			continue
+		}
+		from, to := start, start.Add(total)
+		if i > 0 {
+			from = clampTime(rec.Timestamp, start, to)
+		}
+		if i+1 < len(group) {
+			to = clampTime(group[i+1].Timestamp, start, to)
+		}
+		w := float64(to.Sub(from)) / float64(total)
+		for id, kw := range assigned {
+			avgAssigned[id] += w * kw
+		}
+		for id, kw := range held {
+			avgHeld[id] += w * kw
+		}
+	}
+	if total <= 0 {
+		avgAssigned, avgHeld = assigned, held
+	}
+	for id, kw := range avgHeld {
+		if math.Abs(kw) < 1e-9 {
+			delete(avgHeld, id)
+		}
+	}
+	return avgAssigned, avgHeld
+}
+
+func clampTime(t, lo, hi time.Time) time.Time {
+	if t.Before(lo) {
+		return lo
+	}
+	if t.After(hi) {
+		return hi
+	}
+	return t
+}
+
+// settleSignal prices one signal from its dispatch and rounds.
+//
+//gocyclo:ignore
+func settleSignal(group []logging.LogRecord, t Tariff) SignalStatement {
+	rec := group[0]
+	p := t.product(rec.Signal.Type)
+	hours := rec.Signal.Duration.Hours()
+	st := SignalStatement{
+		Timestamp:       recordTime(rec),
+		SignalType:      rec.Signal.Type.String(),
+		DurationSeconds: rec.Signal.Duration.Seconds(),
+		TargetKW:        math.Abs(rec.TargetPower),
+		EnergyPrice:     p.Energy,
+		Vehicles:        map[string]Amounts{},
+	}
+	if st.EnergyPrice == 0 {
+		st.EnergyPrice = rec.Response.MarketPrice
+	}
+
+	assigned, held := signalPower(group)
+	missing := map[string]float64{}
+	var totalMissing float64
+	for id, kw := range assigned {
+		if m := math.Abs(kw) - math.Abs(held[id]); m > 0 {
+			missing[id] = m
+			totalMissing += m
+		}
+	}
+	for _, kw := range held {
+		st.DeliveredKW += math.Abs(kw)
+	}
+	shortfall := math.Max(0, st.TargetKW-st.DeliveredKW)
+	st.PenaltyEUR = p.Penalty * shortfall * hours
+	capacityKW := math.Min(st.DeliveredKW, st.TargetKW)
+
+	ids := make(map[string]struct{}, len(held)+len(missing))
+	for id := range held {
+		ids[id] = struct{}{}
+	}
+	for id := range missing {
+		ids[id] = struct{}{}
+	}
+	for id := range ids {
+		kw := math.Abs(held[id])
+		var a Amounts
+		a.EnergyKWh = kw * hours
+		a.EnergyEUR = st.EnergyPrice * a.EnergyKWh
+		if st.DeliveredKW > 0 {
+			a.CapacityEUR = p.Capacity * capacityKW * hours * kw / st.DeliveredKW
+		}
+		if totalMissing > 0 {
+			a.PenaltyEUR = st.PenaltyEUR * missing[id] / totalMissing
+		}
+		gross := a.CapacityEUR + a.EnergyEUR - a.PenaltyEUR
+		a.DriverEUR = t.DriverShare * math.Max(0, gross)
+		a.NetEUR = gross - a.DriverEUR
+		st.Vehicles[id] = a
+
+		st.EnergyKWh += a.EnergyKWh
+		st.CapacityEUR += a.CapacityEUR
+		st.EnergyEUR += a.EnergyEUR
+		st.DriverEUR += a.DriverEUR
+	}
+	st.NetEUR = st.CapacityEUR + st.EnergyEUR - st.PenaltyEUR - st.DriverEUR
+	return st
+}
+
+// delivered returns the non-zero entries of acknowledged.
+func delivered(res logging.Result) map[string]float64 {
+	held := acknowledged(res)
+	for id, kw := range held {
+		if kw == 0 {
+			delete(held, id)
+		}
+	}
+	return held
+}
+
+// acknowledged returns the power each vehicle acknowledged applying last: for
+// its assignment, replaced by the fallback rounds it acknowledged. Vehicles
+// without a logged applied power are taken at their setpoint.
+func acknowledged(res logging.Result) map[string]float64 {
+	held := make(map[string]float64)
+	for id, kw := range res.Assignments {
+		if res.Acknowledged[id] {
+			held[id] = appliedPower(res.Applied, id, kw)
+		}
+	}
+	for _, r := range res.FallbackRounds {
+		for id, kw := range r.Assignments {
+			if r.Acknowledged[id] {
+				held[id] = appliedPower(r.Applied, id, kw)
+			}
+		}
+	}
+	return held
+}
+
+// appliedPower returns the applied power logged for the vehicle, or its
+// setpoint kw when none was.
+func appliedPower(applied map[string]float64, id string, kw float64) float64 {
+	if p, ok := applied[id]; ok {
+		return p
+	}
+	return kw
+}
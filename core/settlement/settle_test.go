@@ -0,0 +1,195 @@
+package settlement
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/core/dispatch/logging"
+	"github.com/kilianp07/v2g/core/model"
+)
+
+func approx(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func settlementRecords() []logging.LogRecord {
+	jan := time.Date(2024, 1, 10, 8, 0, 0, 0, time.UTC)
+	feb := time.Date(2024, 2, 3, 18, 0, 0, 0, time.UTC)
+	return []logging.LogRecord{
+		{
+			Timestamp:   feb,
+			Signal:      model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 20, Duration: 30 * time.Minute, Timestamp: feb},
+			TargetPower: 20,
+			Response: logging.Result{
+				Assignments:  map[string]float64{"v1": 10, "v2": 10},
+				Acknowledged: map[string]bool{"v1": true, "v2": false},
+				FallbackRounds: []logging.FallbackRound{{
+					Round:        1,
+					Assignments:  map[string]float64{"v1": 15},
+					Acknowledged: map[string]bool{"v1": true},
+				}},
+				MarketPrice: 0.2,
+			},
+		},
+		{
+			Timestamp:   jan,
+			Signal:      model.FlexibilitySignal{Type: model.SignalFCR, PowerKW: 10, Duration: time.Hour, Timestamp: jan},
+			TargetPower: 10,
+			Response: logging.Result{
+				Assignments:  map[string]float64{"v1": 5, "v2": 5},
+				Acknowledged: map[string]bool{"v1": true, "v2": true},
+				MarketPrice:  0.1,
+			},
+		},
+	}
+}
+
+func settlementTariff() Tariff {
+	return Tariff{
+		Products: map[string]ProductTariff{
+			"FCR": {Capacity: 0.02},
+			"MA":  {Capacity: 0.01, Penalty: 1},
+		},
+		DriverShare: 0.5,
+	}
+}
+
+func TestSettle_CapacityEnergyPenaltyAndShare(t *testing.T) {
+	rep := Settle(settlementRecords(), settlementTariff())
+	if len(rep.Signals) != 2 || rep.Signals[0].SignalType != "FCR" {
+		t.Fatalf("expected signals sorted by time: %+v", rep.Signals)
+	}
+	fcr := rep.Signals[0]
+	// 10 kW for 1 h: 0.2 € capacity and 10 kWh at 0.1 €/kWh.
+	if !approx(fcr.CapacityEUR, 0.2) || !approx(fcr.EnergyEUR, 1) || fcr.PenaltyEUR != 0 || !approx(fcr.DriverEUR, 0.6) {
+		t.Fatalf("unexpected FCR statement: %+v", fcr.Amounts)
+	}
+
+	ma := rep.Signals[1]
+	// v1 holds 15 kW after the fallback round, v2 failed: 5 kW short for 0.5 h.
+	if ma.DeliveredKW != 15 || !approx(ma.PenaltyEUR, 2.5) {
+		t.Fatalf("unexpected delivery: %+v", ma)
+	}
+	v1, v2 := ma.Vehicles["v1"], ma.Vehicles["v2"]
+	if !approx(v1.EnergyKWh, 7.5) || !approx(v1.EnergyEUR, 1.5) || !approx(v1.CapacityEUR, 0.075) || v1.PenaltyEUR != 0 {
+		t.Fatalf("unexpected v1 amounts: %+v", v1)
+	}
+	if v2.EnergyKWh != 0 || !approx(v2.PenaltyEUR, 2.5) || v2.DriverEUR != 0 || !approx(v2.NetEUR, -2.5) {
+		t.Fatalf("unexpected v2 amounts: %+v", v2)
+	}
+	if !approx(ma.NetEUR, 0.075+1.5-2.5-v1.DriverEUR) {
+		t.Fatalf("unexpected MA net: %+v", ma.Amounts)
+	}
+
+	if len(rep.Months) != 2 || rep.Months[0].Month != "2024-01" || rep.Months[1].Month != "2024-02" {
+		t.Fatalf("unexpected months: %+v", rep.Months)
+	}
+	if len(rep.Vehicles) != 2 || rep.Vehicles[0].VehicleID != "v1" || rep.Vehicles[0].Signals != 2 {
+		t.Fatalf("unexpected vehicles: %+v", rep.Vehicles)
+	}
+	if !approx(rep.Total.NetEUR, fcr.NetEUR+ma.NetEUR) {
+		t.Fatalf("total %v does not match the signals", rep.Total.NetEUR)
+	}
+}
+
+func TestSettle_SessionRoundsSettledOnce(t *testing.T) {
+	t0 := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	sig := model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 20, Duration: time.Hour, Timestamp: t0}
+	records := []logging.LogRecord{
+		{
+			Timestamp: t0.Add(45 * time.Minute), Signal: sig, TargetPower: 20, Round: 2,
+			Response: logging.Result{Assignments: map[string]float64{"v3": 5}, Acknowledged: map[string]bool{"v3": true}, MarketPrice: 0.2},
+		},
+		{
+			Timestamp: t0, Signal: sig, TargetPower: 20,
+			Response: logging.Result{
+				Assignments:  map[string]float64{"v1": 10, "v2": 10},
+				Acknowledged: map[string]bool{"v1": true, "v2": true},
+				MarketPrice:  0.2,
+			},
+		},
+		{
+			Timestamp: t0.Add(30 * time.Minute), Signal: sig, TargetPower: 20, Round: 1,
+			Response: logging.Result{
+				Assignments:  map[string]float64{"v2": 0, "v3": 10},
+				Acknowledged: map[string]bool{"v2": true, "v3": true},
+				MarketPrice:  0.2,
+			},
+		},
+	}
+	rep := Settle(records, settlementTariff())
+	if len(rep.Signals) != 1 {
+		t.Fatalf("expected the rounds settled with their dispatch, got %d signals", len(rep.Signals))
+	}
+	st := rep.Signals[0]
+	// v2 holds 10 kW for 30 min, v3 10 kW for 15 min then 5 kW for 15 min.
+	if !approx(st.DeliveredKW, 18.75) || !approx(st.EnergyKWh, 18.75) || !approx(st.PenaltyEUR, 1.25) {
+		t.Fatalf("unexpected statement: %+v", st)
+	}
+	if v2, v3 := st.Vehicles["v2"], st.Vehicles["v3"]; !approx(v2.EnergyKWh, 5) || !approx(v3.EnergyKWh, 3.75) {
+		t.Fatalf("unexpected vehicle energy: v2 %+v v3 %+v", v2, v3)
+	}
+	if len(rep.Vehicles) != 3 || rep.Vehicles[2].Signals != 1 {
+		t.Fatalf("expected one signal per vehicle: %+v", rep.Vehicles)
+	}
+}
+
+func TestSettle_PartialAcksPaidAtAppliedPower(t *testing.T) {
+	t0 := time.Date(2024, 4, 2, 9, 0, 0, 0, time.UTC)
+	records := []logging.LogRecord{{
+		Timestamp:   t0,
+		Signal:      model.FlexibilitySignal{Type: model.SignalMA, PowerKW: 20, Duration: time.Hour, Timestamp: t0},
+		TargetPower: 20,
+		Response: logging.Result{
+			Assignments:  map[string]float64{"v1": 10, "v2": 10},
+			Acknowledged: map[string]bool{"v1": true, "v2": true},
+			Applied:      map[string]float64{"v1": 4},
+			FallbackRounds: []logging.FallbackRound{{
+				Round:        1,
+				Assignments:  map[string]float64{"v2": 16},
+				Acknowledged: map[string]bool{"v2": true},
+				Applied:      map[string]float64{"v2": 12},
+			}},
+			MarketPrice: 0.1,
+		},
+	}}
+	st := Settle(records, settlementTariff()).Signals[0]
+	// v1 applied 4 of its 10 kW, v2 12 of the 16 kW of the fallback round.
+	if !approx(st.DeliveredKW, 16) || !approx(st.PenaltyEUR, 4) {
+		t.Fatalf("unexpected statement: %+v", st)
+	}
+	if v1, v2 := st.Vehicles["v1"], st.Vehicles["v2"]; !approx(v1.EnergyKWh, 4) || !approx(v2.EnergyKWh, 12) {
+		t.Fatalf("unexpected vehicle energy: v1 %+v v2 %+v", v1, v2)
+	}
+}
+
+func TestSettler_ReportAndCSV(t *testing.T) {
+	store, err := logging.NewJSONLStore(filepath.Join(t.TempDir(), "dispatch.log"))
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	for _, r := range settlementRecords() {
+		if err := store.Append(context.Background(), r); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	rep, err := NewSettler(store, settlementTariff()).Report(context.Background(), logging.LogQuery{End: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)})
+	if err != nil || len(rep.Signals) != 1 {
+		t.Fatalf("expected the January signal only: %+v %v", rep.Signals, err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, rep, ViewMonths); err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || lines[1] != "2024-01,,1,10,0.2,1,0,0.6,0.6" {
+		t.Fatalf("unexpected months csv:\n%s", buf.String())
+	}
+	if err := WriteCSV(&buf, rep, "weekly"); err == nil {
+		t.Fatalf("expected error for unknown view")
+	}
+}
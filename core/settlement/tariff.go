@@ -0,0 +1,54 @@
+package settlement
+
+import (
+	"fmt"
+
+	"github.com/kilianp07/v2g/core/model"
+)
+
+// Tariff prices the flexibility delivered for each product.
+type Tariff struct {
+	// Products maps signal type names (FCR, aFRR, MA, NEBEF, EcoWatt) to
+	// their prices. Signals of other types only earn the energy value.
+	Products map[string]ProductTariff `json:"products"`
+	// DriverShare is the share of each vehicle's net revenue paid to its
+	// driver, between 0 and 1.
+	DriverShare float64 `json:"driver_share"`
+}
+
+// ProductTariff holds the prices of one product.
+type ProductTariff struct {
+	// Capacity remunerates each kW delivered, up to the signal power, per
+	// hour in €.
+	Capacity float64 `json:"capacity_eur_per_kw_h"`
+	// Energy values each kWh delivered in €. Zero uses the market price
+	// recorded with the dispatch.
+	Energy float64 `json:"energy_eur_per_kwh"`
+	// Penalty charges each kWh of the signal left undelivered in €.
+	Penalty float64 `json:"penalty_eur_per_kwh"`
+}
+
+// product returns the prices of signal type st.
+func (t Tariff) product(st model.SignalType) ProductTariff {
+	return t.Products[st.String()]
+}
+
+// Validate checks the product names and that prices are not negative.
+func (t Tariff) Validate() error {
+	if t.DriverShare < 0 || t.DriverShare > 1 {
+		return fmt.Errorf("settlement.driver_share must be between 0 and 1")
+	}
+	known := map[string]bool{}
+	for st := model.SignalFCR; st <= model.SignalEcoWatt; st++ {
+		known[st.String()] = true
+	}
+	for name, p := range t.Products {
+		if !known[name] {
+			return fmt.Errorf("settlement.products: unknown product %q", name)
+		}
+		if p.Capacity < 0 || p.Energy < 0 || p.Penalty < 0 {
+			return fmt.Errorf("settlement.products.%s: prices must not be negative", name)
+		}
+	}
+	return nil
+}
@@ -19,6 +19,16 @@ type LastDispatch struct {
 	Timestamp        time.Time `json:"timestamp"`
 }
 
+// Health reports the circuit breaker state of a vehicle: closed while it
+// acknowledges orders, open while it is quarantined until OpenUntil and
+// half_open while it is probed with small orders.
+type Health struct {
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	OpenUntil           time.Time `json:"open_until,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+}
+
 // Status captures the current known state of a vehicle.
 type Status struct {
 	VehicleID              string             `json:"vehicle_id"`
@@ -30,6 +40,7 @@ type Status struct {
 	ForecastedSoC          map[string]float64 `json:"forecasted_soc,omitempty"`
 	NextDispatchWindow     TimeWindow         `json:"next_dispatch_window,omitempty"`
 	LastDispatchDecision   LastDispatch       `json:"last_dispatch_decision"`
+	Health                 *Health            `json:"health,omitempty"`
 }
 
 type Filter struct {
@@ -42,6 +53,7 @@ type Store interface {
 	Set(Status)
 	List(Filter) []Status
 	RecordDispatch(id string, dec LastDispatch)
+	SetHealth(id string, h Health)
 }
 
 type MemoryStore struct {
@@ -71,6 +83,17 @@ func (s *MemoryStore) RecordDispatch(id string, dec LastDispatch) {
 	s.mu.Unlock()
 }
 
+func (s *MemoryStore) SetHealth(id string, h Health) {
+	s.mu.Lock()
+	st := s.data[id]
+	if st.VehicleID == "" {
+		st.VehicleID = id
+	}
+	st.Health = &h
+	s.data[id] = st
+	s.mu.Unlock()
+}
+
 func (s *MemoryStore) List(f Filter) []Status {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -42,3 +42,12 @@ func TestMemoryStore_RecordDispatchNew(t *testing.T) {
 		t.Fatalf("auto create failed %#v", out)
 	}
 }
+
+func TestMemoryStore_SetHealth(t *testing.T) {
+	s := NewMemoryStore()
+	s.SetHealth("v1", Health{State: "open", ConsecutiveFailures: 3})
+	out := s.List(Filter{})
+	if len(out) != 1 || out[0].Health == nil || out[0].Health.State != "open" {
+		t.Fatalf("health not recorded: %#v", out)
+	}
+}
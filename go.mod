@@ -5,6 +5,7 @@ go 1.23.2
 require github.com/eclipse/paho.mqtt.golang v1.5.0
 
 require (
+	github.com/eclipse/paho.golang v0.22.0
 	github.com/getsentry/sentry-go v0.34.1
 	github.com/google/uuid v1.6.0
 	github.com/influxdata/influxdb-client-go/v2 v2.14.0
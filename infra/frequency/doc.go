@@ -0,0 +1,3 @@
+// Package frequency provides grid frequency sources for the droop controller:
+// a file rewritten by a local meter, an MQTT topic and a stand-in generator.
+package frequency
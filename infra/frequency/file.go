@@ -0,0 +1,32 @@
+package frequency
+
+import (
+	"context"
+	"os"
+
+	"github.com/kilianp07/v2g/core/dispatch"
+)
+
+// FileSource reads the frequency from a file rewritten by a local meter.
+// Plain numbers are dated with the file modification time.
+type FileSource struct {
+	path string
+}
+
+// NewFileSource returns a source reading path on every call.
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+// Latest implements dispatch.FrequencySource.
+func (f *FileSource) Latest(_ context.Context) (dispatch.FrequencySample, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return dispatch.FrequencySample{}, err
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return dispatch.FrequencySample{}, err
+	}
+	return parseSample(data, info.ModTime())
+}
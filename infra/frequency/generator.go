@@ -0,0 +1,59 @@
+package frequency
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/kilianp07/v2g/core/dispatch"
+)
+
+// Generator is a stand-in frequency source producing a sine wave around the
+// nominal frequency with optional noise.
+type Generator struct {
+	nominal   float64
+	amplitude float64
+	period    time.Duration
+	noise     float64
+	start     time.Time
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewGenerator returns a generator oscillating amplitudeMHz around nominalHz
+// (50 Hz when zero) over period (five minutes when zero).
+func NewGenerator(nominalHz, amplitudeMHz float64, period time.Duration, noiseMHz float64, seed int64) *Generator {
+	if nominalHz <= 0 {
+		nominalHz = 50
+	}
+	if period <= 0 {
+		period = 5 * time.Minute
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Generator{
+		nominal:   nominalHz,
+		amplitude: amplitudeMHz / 1000,
+		period:    period,
+		noise:     noiseMHz / 1000,
+		start:     time.Now(),
+		rng:       rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Latest implements dispatch.FrequencySource.
+func (g *Generator) Latest(_ context.Context) (dispatch.FrequencySample, error) {
+	now := time.Now()
+	phase := 2 * math.Pi * now.Sub(g.start).Seconds() / g.period.Seconds()
+	hz := g.nominal + g.amplitude*math.Sin(phase)
+	if g.noise > 0 {
+		g.mu.Lock()
+		hz += g.noise * g.rng.NormFloat64()
+		g.mu.Unlock()
+	}
+	return dispatch.FrequencySample{Hz: hz, Time: now}, nil
+}
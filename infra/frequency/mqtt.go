@@ -0,0 +1,90 @@
+package frequency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+
+	"github.com/kilianp07/v2g/core/dispatch"
+	"github.com/kilianp07/v2g/infra/logger"
+	infmqtt "github.com/kilianp07/v2g/infra/mqtt"
+)
+
+// ErrNoSample is returned before the first measurement is received.
+var ErrNoSample = errors.New("no frequency sample received")
+
+// MQTTSource keeps the last frequency published on an MQTT topic.
+type MQTTSource struct {
+	cli  paho.Client
+	log  logger.Logger
+	mu   sync.RWMutex
+	last dispatch.FrequencySample
+	ok   bool
+}
+
+// NewMQTTSource connects to the broker and subscribes to topic.
+func NewMQTTSource(mqttCfg infmqtt.Config, topic string) (*MQTTSource, error) {
+	opts, err := infmqtt.NewClientOptions(mqttCfg)
+	if err != nil {
+		return nil, err
+	}
+	id := mqttCfg.ClientID
+	if id != "" {
+		id += "-frequency"
+	} else {
+		id = "frequency-" + uuid.NewString()
+	}
+	opts.SetClientID(id)
+	s := &MQTTSource{log: logger.New("frequency")}
+	opts.OnConnect = func(c paho.Client) {
+		if token := c.Subscribe(topic, 0, s.onMessage); token.Wait() && token.Error() != nil {
+			s.log.Errorf("subscribe %s: %v", topic, token.Error())
+		}
+	}
+	s.cli = paho.NewClient(opts)
+	if token := s.cli.Connect(); token.Wait() && token.Error() != nil {
+		return nil, token.Error()
+	}
+	return s, nil
+}
+
+func (s *MQTTSource) onMessage(_ paho.Client, msg paho.Message) {
+	sample, err := parseSample(msg.Payload(), time.Now())
+	if err != nil {
+		s.log.Errorf("%v", err)
+		return
+	}
+	s.update(sample)
+}
+
+func (s *MQTTSource) update(sample dispatch.FrequencySample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ok && sample.Time.Before(s.last.Time) {
+		return
+	}
+	s.last = sample
+	s.ok = true
+}
+
+// Latest implements dispatch.FrequencySource.
+func (s *MQTTSource) Latest(_ context.Context) (dispatch.FrequencySample, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.ok {
+		return dispatch.FrequencySample{}, ErrNoSample
+	}
+	return s.last, nil
+}
+
+// Close disconnects from the broker.
+func (s *MQTTSource) Close() error {
+	if s.cli != nil && s.cli.IsConnected() {
+		s.cli.Disconnect(250)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package frequency
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kilianp07/v2g/config"
+	"github.com/kilianp07/v2g/core/dispatch"
+	infmqtt "github.com/kilianp07/v2g/infra/mqtt"
+)
+
+// New creates the frequency source selected by cfg.
+func New(cfg config.FrequencyConfig, mqttCfg infmqtt.Config) (dispatch.FrequencySource, error) {
+	switch cfg.Source {
+	case "file":
+		return NewFileSource(cfg.Path), nil
+	case "mqtt":
+		return NewMQTTSource(mqttCfg, cfg.Topic)
+	case "generator":
+		return NewGenerator(cfg.NominalHz, cfg.AmplitudeMHz, time.Duration(cfg.PeriodSeconds)*time.Second, cfg.NoiseMHz, cfg.Seed), nil
+	default:
+		return nil, fmt.Errorf("unknown frequency source %q", cfg.Source)
+	}
+}
+
+// parseSample decodes a measurement that is either a plain number in Hz or a
+// JSON object {"hz": 49.98, "timestamp": <unix ms>}. Samples without a
+// timestamp are dated at.
+func parseSample(data []byte, at time.Time) (dispatch.FrequencySample, error) {
+	text := strings.TrimSpace(string(data))
+	if hz, err := strconv.ParseFloat(text, 64); err == nil {
+		return dispatch.FrequencySample{Hz: hz, Time: at}, nil
+	}
+	var m struct {
+		Hz        *float64 `json:"hz"`
+		Timestamp int64    `json:"timestamp"`
+	}
+	if err := json.Unmarshal([]byte(text), &m); err != nil {
+		return dispatch.FrequencySample{}, fmt.Errorf("decode frequency: %w", err)
+	}
+	if m.Hz == nil {
+		return dispatch.FrequencySample{}, fmt.Errorf("decode frequency: missing hz")
+	}
+	if m.Timestamp > 0 {
+		at = time.UnixMilli(m.Timestamp)
+	}
+	return dispatch.FrequencySample{Hz: *m.Hz, Time: at}, nil
+}
@@ -0,0 +1,50 @@
+package frequency
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseSample(t *testing.T) {
+	at := time.Unix(100, 0)
+	s, err := parseSample([]byte(" 49.98\n"), at)
+	if err != nil || s.Hz != 49.98 || !s.Time.Equal(at) {
+		t.Fatalf("plain sample: %+v %v", s, err)
+	}
+	s, err = parseSample([]byte(`{"hz":50.02,"timestamp":1700000000000}`), at)
+	if err != nil || s.Hz != 50.02 || !s.Time.Equal(time.UnixMilli(1700000000000)) {
+		t.Fatalf("json sample: %+v %v", s, err)
+	}
+	if _, err := parseSample([]byte(`{"timestamp":1}`), at); err == nil {
+		t.Fatalf("expected error for missing hz")
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "freq")
+	if err := os.WriteFile(path, []byte("49.95"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	s, err := NewFileSource(path).Latest(context.Background())
+	if err != nil || s.Hz != 49.95 {
+		t.Fatalf("file sample: %+v %v", s, err)
+	}
+	if _, err := NewFileSource(filepath.Join(t.TempDir(), "missing")).Latest(context.Background()); err == nil {
+		t.Fatalf("expected error for missing file")
+	}
+}
+
+func TestGenerator_StaysWithinAmplitude(t *testing.T) {
+	g := NewGenerator(50, 100, time.Second, 0, 1)
+	s, err := g.Latest(context.Background())
+	if err != nil {
+		t.Fatalf("latest: %v", err)
+	}
+	if math.Abs(s.Hz-50) > 0.1+1e-9 {
+		t.Fatalf("frequency %v outside amplitude", s.Hz)
+	}
+}
@@ -0,0 +1,3 @@
+// Package market imports day-ahead and imbalance price series from CSV or JSON
+// files and HTTP endpoints into a market.Book.
+package market
@@ -0,0 +1,129 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kilianp07/v2g/config"
+	coremarket "github.com/kilianp07/v2g/core/market"
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+)
+
+// Loader keeps a Book filled with the configured price series.
+type Loader struct {
+	cfg    config.MarketConfig
+	book   *coremarket.Book
+	client *http.Client
+	log    logger.Logger
+}
+
+// NewLoader returns a loader filling a new book routed as cfg.Signals
+// requires.
+func NewLoader(cfg config.MarketConfig, log logger.Logger) *Loader {
+	book := coremarket.NewBook()
+	for st, k := range cfg.Signals {
+		book.Route(st, coremarket.Kind(k))
+	}
+	return &Loader{cfg: cfg, book: book, client: &http.Client{Timeout: 10 * time.Second}, log: log}
+}
+
+// Book returns the book the loader fills.
+func (l *Loader) Book() *coremarket.Book {
+	return l.book
+}
+
+// Refresh loads every configured series. A series failing to load keeps its
+// previous values and the first error is returned.
+func (l *Loader) Refresh(ctx context.Context) error {
+	var first error
+	for k, src := range map[coremarket.Kind]config.PriceSourceConfig{
+		coremarket.DayAhead:  l.cfg.DayAhead,
+		coremarket.Imbalance: l.cfg.Imbalance,
+	} {
+		if !src.Configured() {
+			continue
+		}
+		s, err := l.load(ctx, src)
+		if err != nil {
+			err = fmt.Errorf("%s prices: %w", k, err)
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		l.book.Set(k, s)
+	}
+	return first
+}
+
+// Run refreshes the series every RefreshMinutes until ctx is cancelled.
+func (l *Loader) Run(ctx context.Context) {
+	if l.cfg.RefreshMinutes <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(l.cfg.RefreshMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Refresh(ctx); err != nil {
+				l.log.Errorf("market price refresh: %v", err)
+			}
+		}
+	}
+}
+
+// PriceAt implements dispatch.PriceProvider.
+func (l *Loader) PriceAt(t time.Time, st model.SignalType) (float64, bool) {
+	return l.book.PriceAt(t, st)
+}
+
+func (l *Loader) load(ctx context.Context, src config.PriceSourceConfig) (coremarket.Series, error) {
+	var (
+		data        []byte
+		contentType string
+		err         error
+	)
+	if src.File != "" {
+		data, err = os.ReadFile(src.File)
+	} else {
+		data, contentType, err = l.fetch(ctx, src.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	points, err := parse(data, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if src.Scale != 0 {
+		for i := range points {
+			points[i].Price *= src.Scale
+		}
+	}
+	return coremarket.NewSeries(points)
+}
+
+func (l *Loader) fetch(ctx context.Context, url string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	return data, resp.Header.Get("Content-Type"), err
+}
@@ -0,0 +1,69 @@
+package market
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kilianp07/v2g/config"
+	"github.com/kilianp07/v2g/core/model"
+	"github.com/kilianp07/v2g/infra/logger"
+)
+
+func TestParseCSVAndJSON(t *testing.T) {
+	pts, err := ParseCSV(strings.NewReader("timestamp,price\n2024-01-01T00:00:00Z,50.5\n1704070800,60\n"))
+	if err != nil || len(pts) != 2 || pts[0].Price != 50.5 || pts[1].Start.Unix() != 1704070800 {
+		t.Fatalf("csv: %+v %v", pts, err)
+	}
+	if _, err := ParseCSV(strings.NewReader("time,value\n")); err == nil {
+		t.Fatalf("expected error for missing columns")
+	}
+	pts, err = ParseJSON([]byte(`[{"start":"2024-01-01T00:00:00Z","end":"2024-01-01T00:15:00Z","price":-5}]`))
+	if err != nil || len(pts) != 1 || pts[0].Price != -5 || pts[0].End.Sub(pts[0].Start) != 15*time.Minute {
+		t.Fatalf("json: %+v %v", pts, err)
+	}
+	if _, err := ParseJSON([]byte(`[{"start":"2024-01-01T00:00:00Z"}]`)); err == nil {
+		t.Fatalf("expected error for missing price")
+	}
+}
+
+func TestLoader_FileAndHTTP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "day_ahead.csv")
+	if err := os.WriteFile(path, []byte("start,end,price\n2024-01-01T00:00:00Z,2024-01-01T01:00:00Z,80\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"start":"2024-01-01T00:00:00Z","price":200}]`))
+	}))
+	defer srv.Close()
+
+	l := NewLoader(config.MarketConfig{
+		DayAhead:  config.PriceSourceConfig{File: path, Scale: 0.001},
+		Imbalance: config.PriceSourceConfig{URL: srv.URL},
+		Signals:   map[model.SignalType]string{model.SignalFCR: "day_ahead"},
+	}, logger.NopLogger{})
+	if err := l.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	at := time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC)
+	if p, ok := l.PriceAt(at, model.SignalFCR); !ok || p != 0.08 {
+		t.Fatalf("expected scaled day-ahead price for rerouted FCR, got %v %v", p, ok)
+	}
+	if p, ok := l.PriceAt(at, model.SignalAFRR); !ok || p != 200 {
+		t.Fatalf("expected imbalance price from HTTP, got %v %v", p, ok)
+	}
+
+	srv.Close()
+	if err := l.Refresh(context.Background()); err == nil {
+		t.Fatalf("expected refresh error once the endpoint is down")
+	}
+	if p, _ := l.PriceAt(at, model.SignalAFRR); p != 200 {
+		t.Fatalf("expected previous prices to be kept, got %v", p)
+	}
+}
@@ -0,0 +1,127 @@
+package market
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	coremarket "github.com/kilianp07/v2g/core/market"
+)
+
+// ParseCSV decodes a price series with a header row naming the columns start
+// (or timestamp), an optional end and price. Times are RFC 3339 or Unix
+// seconds.
+func ParseCSV(r io.Reader) ([]coremarket.Point, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+	cols := map[string]int{}
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	start, ok := cols["start"]
+	if !ok {
+		start, ok = cols["timestamp"]
+	}
+	price, hasPrice := cols["price"]
+	if !ok || !hasPrice {
+		return nil, fmt.Errorf("csv header must name start and price columns")
+	}
+	end, hasEnd := cols["end"]
+
+	var points []coremarket.Point
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return points, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read csv line %d: %w", line, err)
+		}
+		var p coremarket.Point
+		if p.Start, err = parseTime(rec[start]); err != nil {
+			return nil, fmt.Errorf("csv line %d: %w", line, err)
+		}
+		if hasEnd && rec[end] != "" {
+			if p.End, err = parseTime(rec[end]); err != nil {
+				return nil, fmt.Errorf("csv line %d: %w", line, err)
+			}
+		}
+		if p.Price, err = strconv.ParseFloat(strings.TrimSpace(rec[price]), 64); err != nil {
+			return nil, fmt.Errorf("csv line %d: invalid price %q", line, rec[price])
+		}
+		points = append(points, p)
+	}
+}
+
+// ParseJSON decodes a price series from an array of objects with start (or
+// timestamp), an optional end and price. Times are RFC 3339 or Unix seconds.
+func ParseJSON(data []byte) ([]coremarket.Point, error) {
+	var raw []struct {
+		Start     json.RawMessage `json:"start"`
+		Timestamp json.RawMessage `json:"timestamp"`
+		End       json.RawMessage `json:"end"`
+		Price     *float64        `json:"price"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("decode prices: %w", err)
+	}
+	points := make([]coremarket.Point, 0, len(raw))
+	for i, r := range raw {
+		start := r.Start
+		if len(start) == 0 {
+			start = r.Timestamp
+		}
+		if len(start) == 0 || r.Price == nil {
+			return nil, fmt.Errorf("price %d: start and price are required", i)
+		}
+		var (
+			p   = coremarket.Point{Price: *r.Price}
+			err error
+		)
+		if p.Start, err = parseTime(unquote(start)); err != nil {
+			return nil, fmt.Errorf("price %d: %w", i, err)
+		}
+		if len(r.End) > 0 && string(r.End) != "null" {
+			if p.End, err = parseTime(unquote(r.End)); err != nil {
+				return nil, fmt.Errorf("price %d: %w", i, err)
+			}
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// parse decodes CSV when contentType or the data look like CSV and JSON
+// otherwise.
+func parse(data []byte, contentType string) ([]coremarket.Point, error) {
+	trimmed := bytes.TrimSpace(data)
+	if strings.Contains(contentType, "csv") || (len(trimmed) > 0 && trimmed[0] != '[') {
+		return ParseCSV(bytes.NewReader(data))
+	}
+	return ParseJSON(data)
+}
+
+func unquote(raw json.RawMessage) string {
+	return strings.Trim(string(raw), `"`)
+}
+
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	return t, nil
+}
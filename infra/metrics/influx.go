@@ -67,6 +67,7 @@ func (s *InfluxSink) RecordDispatchResult(res []coremetrics.DispatchResult) erro
 			AddTag("dispatch_id", strconv.FormatInt(r.Signal.Timestamp.UnixNano(), 10)).
 			AddTag("component", "dispatch_manager").
 			AddField("power_kw", round3(r.PowerKW)).
+			AddField("applied_kw", round3(r.AppliedKW)).
 			AddField("score", round3(r.Score)).
 			AddField("market_price", round3(r.MarketPrice)).
 			SetTime(r.Signal.Timestamp)
@@ -168,6 +169,7 @@ func (s *InfluxSink) RecordFallback(ev coremetrics.FallbackEvent) error {
 	}
 	p = p.AddField("power_kw", round3(ev.ResidualPower)).
 		AddField("fallback_reason", ev.Reason).
+		AddField("round", ev.Round).
 		SetTime(ev.Time)
 	return s.writeAPI.WritePoint(ctx, p)
 }
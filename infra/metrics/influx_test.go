@@ -32,6 +32,7 @@ func TestInfluxSink_RecordDispatchResult(t *testing.T) {
 		EndTime:      now.Add(time.Hour),
 		VehicleID:    "veh1",
 		PowerKW:      5,
+		AppliedKW:    4,
 		Score:        1.2,
 		MarketPrice:  50,
 		Acknowledged: true,
@@ -48,6 +49,7 @@ func TestInfluxSink_RecordDispatchResult(t *testing.T) {
 		AddTag("dispatch_id", strconv.FormatInt(now.UnixNano(), 10)).
 		AddTag("component", "dispatch_manager").
 		AddField("power_kw", 5.0).
+		AddField("applied_kw", 4.0).
 		AddField("score", 1.2).
 		AddField("market_price", 50.0).
 		SetTime(now)
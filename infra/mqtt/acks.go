@@ -0,0 +1,151 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	coremon "github.com/kilianp07/v2g/core/monitoring"
+	coremqtt "github.com/kilianp07/v2g/core/mqtt"
+)
+
+// ErrAckVehicleMismatch is returned for an acknowledgment coming from another
+// vehicle than the one the command was sent to.
+var ErrAckVehicleMismatch = errors.New("ack from unexpected vehicle")
+
+// pendingAck is a command awaiting its acknowledgment.
+type pendingAck struct {
+	vehicleID string
+	ch        chan coremqtt.Ack
+}
+
+// ackWaiter tracks the commands awaiting an acknowledgment.
+type ackWaiter struct {
+	mu      sync.Mutex
+	pending map[string]pendingAck
+}
+
+func newAckWaiter() *ackWaiter {
+	return &ackWaiter{pending: make(map[string]pendingAck)}
+}
+
+// expect registers a command sent to the vehicle so that its acknowledgment
+// can be awaited.
+func (a *ackWaiter) expect(commandID, vehicleID string) {
+	a.mu.Lock()
+	a.pending[commandID] = pendingAck{vehicleID: vehicleID, ch: make(chan coremqtt.Ack, 1)}
+	a.mu.Unlock()
+}
+
+// forget drops a command whose acknowledgment is no longer awaited.
+func (a *ackWaiter) forget(commandID string) {
+	a.mu.Lock()
+	delete(a.pending, commandID)
+	a.mu.Unlock()
+}
+
+// vehicle returns the vehicle an awaited command was sent to.
+func (a *ackWaiter) vehicle(commandID string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	p, ok := a.pending[commandID]
+	return p.vehicleID, ok
+}
+
+// deliver hands the acknowledgment to the waiter of its command and reports
+// whether the command was awaited.
+func (a *ackWaiter) deliver(ack coremqtt.Ack) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	p, ok := a.pending[ack.CommandID]
+	if ok {
+		select {
+		case p.ch <- ack:
+		default:
+		}
+	}
+	return ok
+}
+
+// wait blocks until the command is acknowledged or timeout.
+func (a *ackWaiter) wait(commandID string, timeout time.Duration) (coremqtt.Ack, error) {
+	a.mu.Lock()
+	p, ok := a.pending[commandID]
+	a.mu.Unlock()
+	if !ok {
+		err := fmt.Errorf("unknown command")
+		coremon.CaptureException(err, map[string]string{"module": "mqtt"})
+		return coremqtt.Ack{CommandID: commandID}, err
+	}
+	defer a.forget(commandID)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case ack := <-p.ch:
+		return ack, nil
+	case <-timer.C:
+		return coremqtt.Ack{CommandID: commandID}, fmt.Errorf("%w", coremqtt.ErrAckTimeout)
+	}
+}
+
+// receive authenticates an acknowledgment and hands it to its waiter. from is
+// the vehicle named by the topic the acknowledgment arrived on and
+// correlation the MQTT v5 correlation data, both empty when unknown. With an
+// authenticator, acknowledgments must be signed by a key of the vehicle the
+// command was sent to and name that vehicle. It reports whether the
+// acknowledgment was awaited.
+func (a *ackWaiter) receive(auth *Authenticator, payload []byte, from, correlation string) (coremqtt.Ack, bool, error) {
+	keyID := ""
+	if auth != nil {
+		var err error
+		if payload, keyID, err = auth.Open(payload); err != nil {
+			return coremqtt.Ack{}, false, err
+		}
+	}
+	ack := coremqtt.Ack{Status: coremqtt.AckAccepted}
+	if len(payload) > 0 || correlation == "" || auth != nil {
+		var err error
+		if ack, err = decodeAck(payload); err != nil {
+			return coremqtt.Ack{}, false, err
+		}
+	}
+	if correlation != "" {
+		if ack.CommandID != "" && ack.CommandID != correlation {
+			return ack, false, fmt.Errorf("ack for %s carries correlation data of %s", ack.CommandID, correlation)
+		}
+		ack.CommandID = correlation
+	}
+	vehicleID, ok := a.vehicle(ack.CommandID)
+	if !ok {
+		return ack, false, nil
+	}
+	for _, claimed := range []string{from, ack.VehicleID} {
+		if claimed != "" && claimed != vehicleID {
+			return ack, false, fmt.Errorf("%w: %s answered for %s", ErrAckVehicleMismatch, claimed, vehicleID)
+		}
+	}
+	if auth != nil && (ack.VehicleID != vehicleID || !auth.Authorized(keyID, vehicleID)) {
+		return ack, false, fmt.Errorf("%w: ack for %s signed with key %q", ErrAckVehicleMismatch, vehicleID, keyID)
+	}
+	return ack, a.deliver(ack), nil
+}
+
+// decodeAck parses an acknowledgment payload. Payloads without a status, sent
+// by vehicles reporting only the command ID, are accepted acknowledgments.
+func decodeAck(payload []byte) (coremqtt.Ack, error) {
+	var ack coremqtt.Ack
+	if err := json.Unmarshal(payload, &ack); err != nil {
+		return coremqtt.Ack{}, err
+	}
+	switch ack.Status {
+	case "":
+		ack.Status = coremqtt.AckAccepted
+	case coremqtt.AckAccepted, coremqtt.AckRejected, coremqtt.AckPartial:
+	default:
+		return coremqtt.Ack{}, fmt.Errorf("unknown ack status %q", ack.Status)
+	}
+	return ack, nil
+}
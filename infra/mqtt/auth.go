@@ -0,0 +1,250 @@
+package mqtt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Signature algorithms accepted in keystore entries.
+const (
+	AlgHMACSHA256 = "hmac-sha256"
+	AlgEd25519    = "ed25519"
+)
+
+// FleetKeyID identifies the fleet key of a keystore in signed messages.
+const FleetKeyID = "fleet"
+
+// DefaultSignatureTTL is how long a signed message is accepted after it was
+// signed.
+const DefaultSignatureTTL = time.Minute
+
+// Errors returned when a signed message cannot be authenticated.
+var (
+	ErrUnsigned         = errors.New("message is not signed")
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrSignatureExpired = errors.New("signature expired")
+	ErrReplay           = errors.New("replayed message")
+)
+
+// Key is a keystore entry. HMAC keys share Secret between the dispatcher and
+// the vehicle. Ed25519 keys hold the PrivateKey the owner of the keystore
+// signs with and the PublicKey of the peer whose messages it verifies: the
+// dispatcher keeps its own private key and the vehicle public key, the vehicle
+// its own private key and the dispatcher public key. Binary values are base64
+// encoded in the keystore file.
+type Key struct {
+	Algorithm  string `json:"algorithm"`
+	Secret     []byte `json:"secret,omitempty"`
+	PrivateKey []byte `json:"private_key,omitempty"`
+	PublicKey  []byte `json:"public_key,omitempty"`
+}
+
+// Keystore holds the signing keys of the fleet. A vehicle entry takes
+// precedence over the fleet key.
+type Keystore struct {
+	Fleet    *Key           `json:"fleet,omitempty"`
+	Vehicles map[string]Key `json:"vehicles,omitempty"`
+}
+
+// LoadKeystore reads a JSON keystore file and validates its keys.
+func LoadKeystore(path string) (*Keystore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read keystore: %w", err)
+	}
+	var ks Keystore
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, fmt.Errorf("decode keystore: %w", err)
+	}
+	if ks.Fleet != nil {
+		if err := ks.Fleet.validate(); err != nil {
+			return nil, fmt.Errorf("fleet key: %w", err)
+		}
+	}
+	for id, k := range ks.Vehicles {
+		if id == FleetKeyID {
+			return nil, fmt.Errorf("vehicle key id %q is reserved", id)
+		}
+		if err := k.validate(); err != nil {
+			return nil, fmt.Errorf("key of %s: %w", id, err)
+		}
+	}
+	return &ks, nil
+}
+
+func (k Key) validate() error {
+	switch k.Algorithm {
+	case AlgHMACSHA256:
+		if len(k.Secret) == 0 {
+			return fmt.Errorf("hmac key requires a secret")
+		}
+	case AlgEd25519:
+		if len(k.PrivateKey) != ed25519.SeedSize && len(k.PrivateKey) != ed25519.PrivateKeySize {
+			return fmt.Errorf("invalid ed25519 private key")
+		}
+		if len(k.PublicKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("invalid ed25519 public key")
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q", k.Algorithm)
+	}
+	return nil
+}
+
+func (k Key) sign(msg []byte) []byte {
+	if k.Algorithm == AlgEd25519 {
+		priv := ed25519.PrivateKey(k.PrivateKey)
+		if len(k.PrivateKey) == ed25519.SeedSize {
+			priv = ed25519.NewKeyFromSeed(k.PrivateKey)
+		}
+		return ed25519.Sign(priv, msg)
+	}
+	mac := hmac.New(sha256.New, k.Secret)
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+func (k Key) verify(msg, sig []byte) bool {
+	if k.Algorithm == AlgEd25519 {
+		return ed25519.Verify(ed25519.PublicKey(k.PublicKey), msg, sig)
+	}
+	return hmac.Equal(k.sign(msg), sig)
+}
+
+// key returns the key signing the messages of the vehicle and its ID.
+func (ks *Keystore) key(vehicleID string) (string, Key, bool) {
+	if k, ok := ks.Vehicles[vehicleID]; ok {
+		return vehicleID, k, true
+	}
+	if ks.Fleet != nil {
+		return FleetKeyID, *ks.Fleet, true
+	}
+	return "", Key{}, false
+}
+
+// byID returns the key with the given ID.
+func (ks *Keystore) byID(keyID string) (Key, bool) {
+	if keyID == FleetKeyID {
+		if ks.Fleet == nil {
+			return Key{}, false
+		}
+		return *ks.Fleet, true
+	}
+	k, ok := ks.Vehicles[keyID]
+	return k, ok
+}
+
+// envelope is a signed message. The signature covers the payload, the key
+// ID, the nonce and the expiry.
+type envelope struct {
+	Payload   json.RawMessage `json:"payload"`
+	KeyID     string          `json:"key_id"`
+	Nonce     string          `json:"nonce"`
+	ExpiresAt int64           `json:"expires_at"`
+	Signature []byte          `json:"signature"`
+}
+
+func (e envelope) signed() []byte {
+	b := make([]byte, 0, len(e.Payload)+len(e.KeyID)+len(e.Nonce)+24)
+	b = append(b, e.Payload...)
+	b = append(b, 0)
+	b = append(b, e.KeyID...)
+	b = append(b, 0)
+	b = append(b, e.Nonce...)
+	b = append(b, 0)
+	return strconv.AppendInt(b, e.ExpiresAt, 10)
+}
+
+// Authenticator signs outgoing messages and authenticates incoming ones with
+// the keys of a keystore. Each nonce is accepted once until its message
+// expires so that captured messages cannot be replayed.
+type Authenticator struct {
+	keys *Keystore
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewAuthenticator returns an Authenticator signing messages valid for ttl,
+// DefaultSignatureTTL when zero.
+func NewAuthenticator(keys *Keystore, ttl time.Duration) *Authenticator {
+	if ttl <= 0 {
+		ttl = DefaultSignatureTTL
+	}
+	return &Authenticator{keys: keys, ttl: ttl, now: time.Now, seen: make(map[string]time.Time)}
+}
+
+// Seal signs the JSON payload with the key of the vehicle and returns the
+// signed message.
+func (a *Authenticator) Seal(vehicleID string, payload []byte) ([]byte, error) {
+	keyID, key, ok := a.keys.key(vehicleID)
+	if !ok {
+		return nil, fmt.Errorf("%w for %s", ErrUnknownKey, vehicleID)
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	env := envelope{
+		Payload:   payload,
+		KeyID:     keyID,
+		Nonce:     hex.EncodeToString(nonce),
+		ExpiresAt: a.now().Add(a.ttl).UnixMilli(),
+	}
+	env.Signature = key.sign(env.signed())
+	return json.Marshal(env)
+}
+
+// Open authenticates a signed message and returns its payload along with the
+// ID of the key that signed it. Callers check that the key may speak for the
+// vehicle concerned with Authorized.
+func (a *Authenticator) Open(msg []byte) ([]byte, string, error) {
+	var env envelope
+	if err := json.Unmarshal(msg, &env); err != nil || len(env.Payload) == 0 || len(env.Signature) == 0 {
+		return nil, "", ErrUnsigned
+	}
+	key, ok := a.keys.byID(env.KeyID)
+	if !ok {
+		return nil, "", fmt.Errorf("%w %q", ErrUnknownKey, env.KeyID)
+	}
+	if !key.verify(env.signed(), env.Signature) {
+		return nil, "", ErrInvalidSignature
+	}
+	now := a.now()
+	expires := time.UnixMilli(env.ExpiresAt)
+	if !now.Before(expires) {
+		return nil, "", ErrSignatureExpired
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for n, exp := range a.seen {
+		if !now.Before(exp) {
+			delete(a.seen, n)
+		}
+	}
+	if _, dup := a.seen[env.Nonce]; dup {
+		return nil, "", ErrReplay
+	}
+	a.seen[env.Nonce] = expires
+	return env.Payload, env.KeyID, nil
+}
+
+// Authorized reports whether messages signed with keyID may speak for the
+// vehicle: its own key, or the fleet key when it has none.
+func (a *Authenticator) Authorized(keyID, vehicleID string) bool {
+	id, _, ok := a.keys.key(vehicleID)
+	return ok && id == keyID
+}
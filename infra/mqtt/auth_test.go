@@ -0,0 +1,147 @@
+package mqtt
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	coremqtt "github.com/kilianp07/v2g/core/mqtt"
+)
+
+func TestAuthenticatorHMAC(t *testing.T) {
+	ks := &Keystore{Fleet: &Key{Algorithm: AlgHMACSHA256, Secret: []byte("fleet-secret")}}
+	signer := NewAuthenticator(ks, time.Minute)
+	verifier := NewAuthenticator(ks, time.Minute)
+
+	msg, err := signer.Seal("veh1", []byte(`{"command_id":"c1"}`))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	payload, keyID, err := verifier.Open(msg)
+	if err != nil || string(payload) != `{"command_id":"c1"}` || keyID != FleetKeyID {
+		t.Fatalf("open: %s %s %v", payload, keyID, err)
+	}
+	if !verifier.Authorized(keyID, "veh1") {
+		t.Fatalf("expected fleet key to speak for veh1")
+	}
+	if _, _, err := verifier.Open(msg); !errors.Is(err, ErrReplay) {
+		t.Fatalf("expected replay to be rejected, got %v", err)
+	}
+
+	var env envelope
+	_ = json.Unmarshal(msg, &env)
+	env.Payload = json.RawMessage(`{"command_id":"c2"}`)
+	tampered, _ := json.Marshal(env)
+	if _, _, err := verifier.Open(tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected tampered message to be rejected, got %v", err)
+	}
+	if _, _, err := verifier.Open([]byte(`{"command_id":"c1"}`)); !errors.Is(err, ErrUnsigned) {
+		t.Fatalf("expected unsigned message to be rejected, got %v", err)
+	}
+
+	signer.now = func() time.Time { return time.Now().Add(-2 * time.Minute) }
+	old, _ := signer.Seal("veh1", []byte(`{}`))
+	if _, _, err := verifier.Open(old); !errors.Is(err, ErrSignatureExpired) {
+		t.Fatalf("expected expired message to be rejected, got %v", err)
+	}
+}
+
+func TestAuthenticatorEd25519(t *testing.T) {
+	dispPub, dispPriv, _ := ed25519.GenerateKey(nil)
+	vehPub, vehPriv, _ := ed25519.GenerateKey(nil)
+	dispatcher := NewAuthenticator(&Keystore{Vehicles: map[string]Key{
+		"veh1": {Algorithm: AlgEd25519, PrivateKey: dispPriv, PublicKey: vehPub},
+	}}, 0)
+	vehicle := NewAuthenticator(&Keystore{Vehicles: map[string]Key{
+		"veh1": {Algorithm: AlgEd25519, PrivateKey: vehPriv.Seed(), PublicKey: dispPub},
+	}}, 0)
+
+	order, err := dispatcher.Seal("veh1", []byte(`{"type":"setpoint"}`))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if _, keyID, err := vehicle.Open(order); err != nil || !vehicle.Authorized(keyID, "veh1") || vehicle.Authorized(keyID, "veh2") {
+		t.Fatalf("vehicle open: %s %v", keyID, err)
+	}
+	ack, _ := vehicle.Seal("veh1", []byte(`{"command_id":"c1"}`))
+	if _, _, err := dispatcher.Open(ack); err != nil {
+		t.Fatalf("dispatcher open: %v", err)
+	}
+	if _, _, err := dispatcher.Open(order); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected the dispatcher's own order to fail verification, got %v", err)
+	}
+	if _, err := dispatcher.Seal("veh2", []byte(`{}`)); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected unknown key, got %v", err)
+	}
+}
+
+func TestLoadKeystore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	data := `{"fleet":{"algorithm":"hmac-sha256","secret":"c2VjcmV0"},"vehicles":{"veh1":{"algorithm":"ed25519"}}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := LoadKeystore(path); err == nil {
+		t.Fatalf("expected error for ed25519 key without keys")
+	}
+	data = `{"fleet":{"algorithm":"hmac-sha256","secret":"c2VjcmV0"}}`
+	_ = os.WriteFile(path, []byte(data), 0o600)
+	ks, err := LoadKeystore(path)
+	if err != nil || string(ks.Fleet.Secret) != "secret" {
+		t.Fatalf("load: %+v %v", ks, err)
+	}
+}
+
+type topicMessage struct {
+	mockMessage
+	topic string
+}
+
+func (m topicMessage) Topic() string { return m.topic }
+
+func TestSignedAckMustComeFromOrderVehicle(t *testing.T) {
+	mc := &mockClient{}
+	newMQTTClient = func(o *paho.ClientOptions) pahoClient { mc.opts = o; return mc }
+	defer func() { newMQTTClient = func(opts *paho.ClientOptions) pahoClient { return paho.NewClient(opts) } }()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	_ = os.WriteFile(path, []byte(`{"vehicles":{"veh1":{"algorithm":"hmac-sha256","secret":"djE="},"veh2":{"algorithm":"hmac-sha256","secret":"djI="}}}`), 0o600)
+	cli, err := NewPahoClient(Config{Broker: "tcp://localhost:1883", ClientID: "id", AckTopic: "vehicle/+/ack", Keystore: path})
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	cmdID, err := cli.SendOrder("veh1", 5)
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if _, _, err := cli.auth.Open(mc.published[0].payload); err != nil {
+		t.Fatalf("expected signed order: %v", err)
+	}
+
+	vehicles := NewAuthenticator(cli.auth.keys, 0)
+	seal := func(vehicleID string, ack coremqtt.Ack) []byte {
+		b, _ := json.Marshal(ack)
+		msg, _ := vehicles.Seal(vehicleID, b)
+		return msg
+	}
+	ack := coremqtt.Ack{CommandID: cmdID, VehicleID: "veh1", Status: coremqtt.AckAccepted}
+	unsigned, _ := json.Marshal(ack)
+	cli.onAck(nil, topicMessage{mockMessage{unsigned}, "vehicle/veh1/ack"})
+	cli.onAck(nil, topicMessage{mockMessage{seal("veh1", ack)}, "vehicle/veh2/ack"})
+	cli.onAck(nil, topicMessage{mockMessage{seal("veh2", ack)}, "vehicle/veh1/ack"})
+	if _, err := cli.WaitForAck(cmdID, time.Millisecond); !errors.Is(err, coremqtt.ErrAckTimeout) {
+		t.Fatalf("expected forged acks to be ignored, got %v", err)
+	}
+
+	cmdID, _ = cli.SendOrder("veh1", 5)
+	ack.CommandID = cmdID
+	cli.onAck(nil, topicMessage{mockMessage{seal("veh1", ack)}, "vehicle/veh1/ack"})
+	if got, err := cli.WaitForAck(cmdID, time.Millisecond); err != nil || !got.Accepted() {
+		t.Fatalf("expected signed ack, got %+v %v", got, err)
+	}
+}
@@ -1,42 +1,121 @@
 package mqtt
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"os"
-	"sync"
+	"strings"
 	"time"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/google/uuid"
 
+	"github.com/kilianp07/v2g/core/model"
 	coremon "github.com/kilianp07/v2g/core/monitoring"
 	coremqtt "github.com/kilianp07/v2g/core/mqtt"
 	"github.com/kilianp07/v2g/infra/logger"
 )
 
 // Config defines the connection parameters for the Paho MQTT client.
+// Protocol selects the MQTT version of the order client, "3.1.1" by default
+// or "5". ResponseTopic is the topic MQTT v5 orders ask vehicles to answer
+// on; it defaults to the response template of Topics. AckTopic and
+// ResponseTopic are absolute and take precedence over the topic templates,
+// which name all the other topics. Keystore is the path of
+// the keystore signing orders and authenticating acknowledgments; orders are
+// sent unsigned when empty. Outbox is the path of the SQLite database keeping
+// the commands that could not be published until the broker is reachable;
+// they are dropped when empty.
 type Config struct {
-	Broker     string          `json:"broker"`
-	ClientID   string          `json:"client_id"`
-	Username   string          `json:"username"`
-	Password   string          `json:"password"`
-	AckTopic   string          `json:"ack_topic"`
-	UseTLS     bool            `json:"use_tls"`
-	ClientCert string          `json:"client_cert"`
-	ClientKey  string          `json:"client_key"`
-	CABundle   string          `json:"ca_bundle"`
-	AuthMethod string          `json:"auth_method"`
-	QoS        map[string]byte `json:"qos"`
-	LWTTopic   string          `json:"lwt_topic"`
-	LWTPayload string          `json:"lwt_payload"`
-	LWTQoS     byte            `json:"lwt_qos"`
-	LWTRetain  bool            `json:"lwt_retain"`
-	MaxRetries int             `json:"max_retries"`
-	BackoffMS  int             `json:"backoff_ms"`
-	TLSConfig  *tls.Config     `json:"-"`
+	Protocol      string          `json:"protocol"`
+	Topics        Topics          `json:"topics"`
+	Broker        string          `json:"broker"`
+	ClientID      string          `json:"client_id"`
+	Username      string          `json:"username"`
+	Password      string          `json:"password"`
+	AckTopic      string          `json:"ack_topic"`
+	ResponseTopic string          `json:"response_topic"`
+	UseTLS        bool            `json:"use_tls"`
+	ClientCert    string          `json:"client_cert"`
+	ClientKey     string          `json:"client_key"`
+	CABundle      string          `json:"ca_bundle"`
+	AuthMethod    string          `json:"auth_method"`
+	QoS           map[string]byte `json:"qos"`
+	LWTTopic      string          `json:"lwt_topic"`
+	LWTPayload    string          `json:"lwt_payload"`
+	LWTQoS        byte            `json:"lwt_qos"`
+	LWTRetain     bool            `json:"lwt_retain"`
+	MaxRetries    int             `json:"max_retries"`
+	BackoffMS     int             `json:"backoff_ms"`
+	// OrderTTLSeconds bounds the validity of orders sent without an explicit
+	// deadline. Zero uses DefaultOrderTTL.
+	OrderTTLSeconds int    `json:"order_ttl_seconds"`
+	Keystore        string `json:"keystore"`
+	// SignatureTTLSeconds bounds how long signed messages are accepted. Zero
+	// uses DefaultSignatureTTL.
+	SignatureTTLSeconds int         `json:"signature_ttl_seconds"`
+	Outbox              string      `json:"outbox"`
+	TLSConfig           *tls.Config `json:"-"`
+}
+
+// DefaultOrderTTL is the validity of orders sent without an explicit deadline.
+const DefaultOrderTTL = 15 * time.Minute
+
+// Command types carried in the "type" field of command payloads.
+const (
+	CommandSetpoint = "setpoint"
+	CommandRelease  = "release"
+	CommandDroop    = "droop"
+)
+
+// orderTTL returns the configured order validity.
+func (c Config) orderTTL() time.Duration {
+	if c.OrderTTLSeconds <= 0 {
+		return DefaultOrderTTL
+	}
+	return time.Duration(c.OrderTTLSeconds) * time.Second
+}
+
+// ackTopic returns the template of the ACK topics. AckTopic is a
+// subscription filter whose first single-level wildcard is the vehicle.
+func (c Config) ackTopic() Template {
+	if c.AckTopic != "" {
+		return Template(strings.Replace(c.AckTopic, "+", VehiclePlaceholder, 1))
+	}
+	return c.Topics.AckTopic()
+}
+
+// responseTopic returns the topic MQTT v5 orders ask vehicles to answer on.
+func (c Config) responseTopic() string {
+	if c.ResponseTopic != "" {
+		return c.ResponseTopic
+	}
+	return string(c.Topics.ResponseTopic(c.ClientID))
+}
+
+// authenticator loads the configured keystore, or returns nil when orders are
+// not signed.
+func (c Config) authenticator() (*Authenticator, error) {
+	if c.Keystore == "" {
+		return nil, nil
+	}
+	ks, err := LoadKeystore(c.Keystore)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuthenticator(ks, time.Duration(c.SignatureTTLSeconds)*time.Second), nil
+}
+
+// outbox opens the configured outbox, or returns nil when commands that could
+// not be published are dropped.
+func (c Config) outbox() (*Outbox, error) {
+	if c.Outbox == "" {
+		return nil, nil
+	}
+	return NewOutbox(c.Outbox)
 }
 
 // PahoClient implements the Publisher interface using Eclipse Paho.
@@ -49,12 +128,16 @@ type pahoClient interface {
 }
 
 type PahoClient struct {
-	cli      pahoClient
-	ackTopic string
-	qos      map[string]byte
+	cli          pahoClient
+	ackTopic     Template
+	commandTopic Template
+	qos          map[string]byte
 
-	mu         sync.Mutex
-	ackChans   map[string]chan struct{}
+	acks       *ackWaiter
+	auth       *Authenticator
+	outbox     *Outbox
+	flush      chan struct{}
+	cancel     context.CancelFunc
 	logger     logger.Logger
 	lwtTopic   string
 	lwtPayload string
@@ -62,6 +145,7 @@ type PahoClient struct {
 	lwtRetain  bool
 	maxRetries int
 	backoff    time.Duration
+	orderTTL   time.Duration
 }
 
 var newMQTTClient = func(opts *paho.ClientOptions) pahoClient {
@@ -74,18 +158,31 @@ func NewPahoClient(cfg Config) (*PahoClient, error) {
 	if err != nil {
 		return nil, err
 	}
+	auth, err := cfg.authenticator()
+	if err != nil {
+		return nil, err
+	}
+	outbox, err := cfg.outbox()
+	if err != nil {
+		return nil, err
+	}
 
 	logger := logger.New("mqtt_client")
-	pc := &PahoClient{ackTopic: cfg.AckTopic,
-		ackChans:   make(map[string]chan struct{}),
-		logger:     logger,
-		qos:        cfg.QoS,
-		lwtTopic:   cfg.LWTTopic,
-		lwtPayload: cfg.LWTPayload,
-		lwtQoS:     cfg.LWTQoS,
-		lwtRetain:  cfg.LWTRetain,
-		maxRetries: cfg.MaxRetries,
-		backoff:    time.Duration(cfg.BackoffMS) * time.Millisecond,
+	pc := &PahoClient{ackTopic: cfg.ackTopic(),
+		commandTopic: cfg.Topics.CommandTopic(),
+		acks:         newAckWaiter(),
+		auth:         auth,
+		outbox:       outbox,
+		flush:        make(chan struct{}, 1),
+		logger:       logger,
+		qos:          cfg.QoS,
+		lwtTopic:     cfg.LWTTopic,
+		lwtPayload:   cfg.LWTPayload,
+		lwtQoS:       cfg.LWTQoS,
+		lwtRetain:    cfg.LWTRetain,
+		maxRetries:   cfg.MaxRetries,
+		backoff:      time.Duration(cfg.BackoffMS) * time.Millisecond,
+		orderTTL:     cfg.orderTTL(),
 	}
 
 	opts.OnConnect = func(c paho.Client) {
@@ -94,9 +191,10 @@ func NewPahoClient(cfg Config) (*PahoClient, error) {
 		if q, ok := pc.qos["ack"]; ok {
 			qos = q
 		}
-		if token := c.Subscribe(pc.ackTopic, qos, pc.onAck); token.Wait() && token.Error() != nil {
+		if token := c.Subscribe(pc.ackTopic.Filter(), qos, pc.onAck); token.Wait() && token.Error() != nil {
 			logger.Errorf("subscribe error: %v", token.Error())
 		}
+		requestFlush(pc.flush)
 	}
 	opts.OnConnectionLost = func(_ paho.Client, err error) {
 		logger.Errorf("connection lost: %v", err)
@@ -105,10 +203,18 @@ func NewPahoClient(cfg Config) (*PahoClient, error) {
 		logger.Warnf("reconnecting to MQTT broker")
 	}
 	c := newMQTTClient(opts)
+	pc.cli = c
 	if token := c.Connect(); token.Wait() && token.Error() != nil {
+		if outbox != nil {
+			_ = outbox.Close()
+		}
 		return nil, token.Error()
 	}
-	pc.cli = c
+	if outbox != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		pc.cancel = cancel
+		go runOutbox(ctx, pc.flush, pc.flushOutbox)
+	}
 	return pc, nil
 }
 
@@ -160,62 +266,103 @@ func (c Config) LoadTLSConfig() (*tls.Config, error) {
 }
 
 func (p *PahoClient) onAck(_ paho.Client, msg paho.Message) {
-	var m struct {
-		CommandID string `json:"command_id"`
-	}
-	if err := json.Unmarshal(msg.Payload(), &m); err != nil {
-		p.logger.Errorf("failed to decode ack: %v", err)
+	ack, delivered, err := p.acks.receive(p.auth, msg.Payload(), p.ackTopic.Vehicle(msg.Topic()), "")
+	if err != nil {
+		p.logger.Errorf("rejected ack on %s: %v", msg.Topic(), err)
 		coremon.CaptureException(err, map[string]string{"module": "mqtt"})
 		return
 	}
-	p.mu.Lock()
-	ch, ok := p.ackChans[m.CommandID]
-	if ok {
-		select {
-		case ch <- struct{}{}:
-		default:
-		}
-		p.logger.Infof("received ack %s", m.CommandID)
+	if delivered {
+		p.logger.Infof("received %s ack %s", ack.Status, ack.CommandID)
 	}
-	p.mu.Unlock()
+}
+
+// command is the payload published on the vehicle command topic.
+type command struct {
+	CommandID  string  `json:"command_id"`
+	VehicleID  string  `json:"vehicle_id"`
+	Type       string  `json:"type"`
+	PowerKW    float64 `json:"power_kw"`
+	Timestamp  int64   `json:"timestamp"`
+	ValidUntil int64   `json:"valid_until,omitempty"`
+
+	Droop *model.DroopParams `json:"droop,omitempty"`
 }
 
 // SendOrder sends a dispatch order to the vehicle specific topic and returns
-// the command identifier used for acknowledgment tracking.
+// the command identifier used for acknowledgment tracking. The order expires
+// after the configured order TTL.
 func (p *PahoClient) SendOrder(vehicleID string, powerKW float64) (string, error) {
+	ttl := p.orderTTL
+	if ttl <= 0 {
+		ttl = DefaultOrderTTL
+	}
+	return p.SendOrderUntil(vehicleID, powerKW, time.Now().Add(ttl))
+}
+
+// SendOrderUntil sends a dispatch order that the vehicle must drop at
+// validUntil.
+func (p *PahoClient) SendOrderUntil(vehicleID string, powerKW float64, validUntil time.Time) (string, error) {
+	return p.sendCommand(command{
+		VehicleID:  vehicleID,
+		Type:       CommandSetpoint,
+		PowerKW:    powerKW,
+		ValidUntil: validUntil.UnixMilli(),
+	})
+}
+
+// SendRelease sends a release command asking the vehicle to drop its setpoint
+// and resume its default behaviour.
+func (p *PahoClient) SendRelease(vehicleID string) (string, error) {
+	return p.sendCommand(command{VehicleID: vehicleID, Type: CommandRelease})
+}
+
+// DropQueued implements mqtt.QueueingClient.
+func (p *PahoClient) DropQueued(vehicleID string) error {
+	return dropQueued(p.outbox, vehicleID)
+}
+
+// SendDroop pushes droop parameters so that the vehicle follows the grid
+// frequency locally until validUntil.
+func (p *PahoClient) SendDroop(vehicleID string, params model.DroopParams, validUntil time.Time) (string, error) {
+	return p.sendCommand(command{
+		VehicleID:  vehicleID,
+		Type:       CommandDroop,
+		ValidUntil: validUntil.UnixMilli(),
+		Droop:      &params,
+	})
+}
+
+func (p *PahoClient) sendCommand(cmd command) (string, error) {
 	cmdID := uuid.NewString()
-	order := struct {
-		CommandID string  `json:"command_id"`
-		VehicleID string  `json:"vehicle_id"`
-		PowerKW   float64 `json:"power_kw"`
-		Timestamp int64   `json:"timestamp"`
-	}{
-		CommandID: cmdID,
-		VehicleID: vehicleID,
-		PowerKW:   powerKW,
-		Timestamp: time.Now().UnixMilli(),
-	}
-	payload, err := json.Marshal(order)
+	cmd.CommandID = cmdID
+	cmd.Timestamp = time.Now().UnixMilli()
+	payload, err := json.Marshal(cmd)
 	if err != nil {
 		return "", err
 	}
-
-	topic := fmt.Sprintf("vehicle/%s/command", vehicleID)
-	qos := byte(0)
-	if q, ok := p.qos["command"]; ok {
-		qos = q
+	vehicleID := cmd.VehicleID
+	signed, err := p.seal(vehicleID, payload)
+	if err != nil {
+		return "", err
 	}
+	if p.outbox != nil {
+		// A queued command must not be delivered after this one.
+		if err := p.outbox.Supersede(context.Background(), vehicleID); err != nil {
+			p.logger.Errorf("outbox: %v", err)
+		}
+	}
+
 	if p.maxRetries <= 0 {
 		p.maxRetries = 3
 	}
 	if p.backoff <= 0 {
 		p.backoff = 100 * time.Millisecond
 	}
+	topic := p.commandTopic.Topic(vehicleID)
 	var publishErr error
 	for attempt := 0; attempt <= p.maxRetries; attempt++ {
-		token := p.cli.Publish(topic, qos, false, payload)
-		token.Wait()
-		publishErr = token.Error()
+		publishErr = p.publish(topic, signed)
 		if publishErr == nil {
 			p.logger.Infof("sent order %s to %s", cmdID, topic)
 			break
@@ -225,46 +372,62 @@ func (p *PahoClient) SendOrder(vehicleID string, powerKW float64) (string, error
 	}
 	if publishErr != nil {
 		coremon.CaptureException(publishErr, map[string]string{"vehicle_id": vehicleID, "module": "mqtt"})
-		return "", publishErr
+		return "", queueCommand(p.outbox, cmd, payload, nil, publishErr)
 	}
 
-	p.mu.Lock()
-	p.ackChans[cmdID] = make(chan struct{}, 1)
-	p.mu.Unlock()
-
+	p.acks.expect(cmdID, vehicleID)
 	return cmdID, nil
 }
 
-// WaitForAck blocks until an ACK for the given command ID is received or timeout.
-func (p *PahoClient) WaitForAck(commandID string, timeout time.Duration) (bool, error) {
-	p.mu.Lock()
-	ch := p.ackChans[commandID]
-	p.mu.Unlock()
-	if ch == nil {
-		err := fmt.Errorf("unknown command")
-		coremon.CaptureException(err, map[string]string{"module": "mqtt"})
-		return false, err
-	}
-
-	timer := time.NewTimer(timeout)
-	defer timer.Stop()
-	select {
-	case <-ch:
-		p.mu.Lock()
-		delete(p.ackChans, commandID)
-		p.mu.Unlock()
-		return true, nil
-	case <-timer.C:
-		p.mu.Lock()
-		delete(p.ackChans, commandID)
-		p.mu.Unlock()
-		return false, fmt.Errorf("%w", coremqtt.ErrAckTimeout)
+// seal signs the payload for the vehicle when orders are signed.
+func (p *PahoClient) seal(vehicleID string, payload []byte) ([]byte, error) {
+	if p.auth == nil {
+		return payload, nil
+	}
+	return p.auth.Seal(vehicleID, payload)
+}
+
+// publish sends a command payload on topic.
+func (p *PahoClient) publish(topic string, payload []byte) error {
+	qos := byte(0)
+	if q, ok := p.qos["command"]; ok {
+		qos = q
 	}
+	token := p.cli.Publish(topic, qos, false, payload)
+	token.Wait()
+	return token.Error()
 }
 
-// Disconnect gracefully closes the MQTT connection.
+// flushOutbox delivers the commands of the outbox, signing them again since
+// their signature may have expired while they waited.
+func (p *PahoClient) flushOutbox() {
+	sent, err := p.outbox.Flush(context.Background(), func(e OutboxEntry) error {
+		payload, err := p.seal(e.VehicleID, e.Command)
+		if err != nil {
+			return err
+		}
+		return p.publish(p.commandTopic.Topic(e.VehicleID), payload)
+	})
+	if sent > 0 {
+		p.logger.Infof("delivered %d queued orders", sent)
+	}
+	if err != nil {
+		p.logger.Warnf("outbox flush: %v", err)
+	}
+}
+
+// WaitForAck blocks until an ACK for the given command ID is received or timeout.
+func (p *PahoClient) WaitForAck(commandID string, timeout time.Duration) (coremqtt.Ack, error) {
+	return p.acks.wait(commandID, timeout)
+}
+
+// Disconnect gracefully closes the MQTT connection and the outbox.
 func (p *PahoClient) Disconnect() {
 	if p.cli != nil && p.cli.IsConnected() {
 		p.cli.Disconnect(250)
 	}
+	if p.cancel != nil {
+		p.cancel()
+		_ = p.outbox.Close()
+	}
 }
@@ -0,0 +1,49 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestSendOrderCarriesValidity(t *testing.T) {
+	mc := &mockClient{}
+	newMQTTClient = func(o *paho.ClientOptions) pahoClient { mc.opts = o; return mc }
+	defer func() { newMQTTClient = func(opts *paho.ClientOptions) pahoClient { return paho.NewClient(opts) } }()
+	cli, err := NewPahoClient(Config{Broker: "tcp://localhost:1883", ClientID: "id", OrderTTLSeconds: 60})
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	before := time.Now()
+	if _, err := cli.SendOrder("veh1", 10); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	until := before.Add(time.Hour)
+	if _, err := cli.SendOrderUntil("veh1", 5, until); err != nil {
+		t.Fatalf("send until: %v", err)
+	}
+	if _, err := cli.SendRelease("veh1"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if len(mc.published) != 3 {
+		t.Fatalf("expected 3 publishes, got %d", len(mc.published))
+	}
+	var cmds [3]command
+	for i := range cmds {
+		if err := json.Unmarshal(mc.published[i].payload, &cmds[i]); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	ttl := time.UnixMilli(cmds[0].ValidUntil).Sub(before)
+	if cmds[0].Type != CommandSetpoint || ttl < 59*time.Second || ttl > 61*time.Second {
+		t.Fatalf("unexpected default validity: %+v", cmds[0])
+	}
+	if cmds[1].ValidUntil != until.UnixMilli() {
+		t.Fatalf("expected explicit validity, got %d", cmds[1].ValidUntil)
+	}
+	if cmds[2].Type != CommandRelease || cmds[2].PowerKW != 0 || cmds[2].ValidUntil != 0 {
+		t.Fatalf("unexpected release payload: %+v", cmds[2])
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"fmt"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
+	coremqtt "github.com/kilianp07/v2g/core/mqtt"
 )
 
 // helper to generate self-signed cert
@@ -94,8 +95,8 @@ func TestQoSSettings(t *testing.T) {
 	// trigger ack
 	payload := fmt.Sprintf(`{"command_id":"%s"}`, cmdID)
 	cli.onAck(nil, mockMessage{[]byte(payload)})
-	ok, err := cli.WaitForAck(cmdID, time.Millisecond)
-	if err != nil || !ok {
+	ack, err := cli.WaitForAck(cmdID, time.Millisecond)
+	if err != nil || !ack.Accepted() {
 		t.Fatalf("ack wait failed: %v", err)
 	}
 }
@@ -149,12 +150,30 @@ func TestWaitForAckTimeout(t *testing.T) {
 		t.Fatalf("client: %v", err)
 	}
 	cmdID, _ := cli.SendOrder("veh1", 1)
-	ok, err := cli.WaitForAck(cmdID, time.Millisecond)
-	if err == nil || ok {
+	ack, err := cli.WaitForAck(cmdID, time.Millisecond)
+	if err == nil || ack.Accepted() {
 		t.Fatalf("expected timeout")
 	}
 }
 
+func TestDecodeAck(t *testing.T) {
+	ack, err := decodeAck([]byte(`{"command_id":"c1"}`))
+	if err != nil || ack.Status != coremqtt.AckAccepted || ack.Applied(5) != 5 {
+		t.Fatalf("legacy ack: %+v %v", ack, err)
+	}
+	ack, err = decodeAck([]byte(`{"command_id":"c1","status":"partial","applied_kw":3,"reason":"max_power","soc":0.4}`))
+	if err != nil || ack.Status != coremqtt.AckPartial || ack.Applied(5) != 3 || ack.Reason != coremqtt.AckReasonMaxPower || ack.SoC == nil {
+		t.Fatalf("partial ack: %+v %v", ack, err)
+	}
+	ack, err = decodeAck([]byte(`{"command_id":"c1","status":"rejected","reason":"battery_empty"}`))
+	if err != nil || ack.Accepted() || ack.Applied(5) != 0 {
+		t.Fatalf("rejected ack: %+v %v", ack, err)
+	}
+	if _, err := decodeAck([]byte(`{"command_id":"c1","status":"maybe"}`)); err == nil {
+		t.Fatalf("expected error for unknown status")
+	}
+}
+
 // mockClient implements pahoClient for tests
 type mockClient struct {
 	opts       *paho.ClientOptions
@@ -163,8 +182,9 @@ type mockClient struct {
 		qos   byte
 	}
 	published []struct {
-		topic string
-		qos   byte
+		topic   string
+		qos     byte
+		payload []byte
 	}
 	publishErrs []error
 }
@@ -177,11 +197,13 @@ func (m *mockClient) Connect() paho.Token {
 	return &dummyToken{}
 }
 func (m *mockClient) Disconnect(uint) {}
-func (m *mockClient) Publish(topic string, qos byte, _ bool, _ interface{}) paho.Token {
+func (m *mockClient) Publish(topic string, qos byte, _ bool, payload interface{}) paho.Token {
+	b, _ := payload.([]byte)
 	m.published = append(m.published, struct {
-		topic string
-		qos   byte
-	}{topic, qos})
+		topic   string
+		qos     byte
+		payload []byte
+	}{topic, qos, b})
 	if len(m.publishErrs) > 0 {
 		err := m.publishErrs[0]
 		m.publishErrs = m.publishErrs[1:]
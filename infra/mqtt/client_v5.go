@@ -0,0 +1,446 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	paho5 "github.com/eclipse/paho.golang/paho"
+	"github.com/google/uuid"
+
+	"github.com/kilianp07/v2g/core/model"
+	coremon "github.com/kilianp07/v2g/core/monitoring"
+	coremqtt "github.com/kilianp07/v2g/core/mqtt"
+	"github.com/kilianp07/v2g/infra/logger"
+)
+
+// Protocol versions accepted in Config.Protocol.
+const (
+	ProtocolV311 = "3.1.1"
+	ProtocolV5   = "5"
+)
+
+// OrderClient is the order client returned by NewClient.
+type OrderClient interface {
+	coremqtt.ExpiringClient
+	coremqtt.DroopClient
+	Disconnect()
+}
+
+// NewClient connects the order client speaking the MQTT version selected by
+// cfg.Protocol.
+func NewClient(cfg Config) (OrderClient, error) {
+	switch cfg.Protocol {
+	case "", ProtocolV311:
+		c, err := NewPahoClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	case ProtocolV5:
+		c, err := NewPahoV5Client(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	default:
+		return nil, fmt.Errorf("unsupported mqtt protocol %q", cfg.Protocol)
+	}
+}
+
+// ReasonCodeError reports a command the broker refused with an MQTT v5
+// reason code.
+type ReasonCodeError struct {
+	Code   byte
+	Reason string
+}
+
+func (e *ReasonCodeError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("publish refused with reason code 0x%02x", e.Code)
+	}
+	return fmt.Sprintf("publish refused with reason code 0x%02x: %s", e.Code, e.Reason)
+}
+
+// v5Connection is the part of the autopaho connection manager used by the
+// MQTT v5 client.
+type v5Connection interface {
+	AwaitConnection(ctx context.Context) error
+	Publish(ctx context.Context, p *paho5.Publish) (*paho5.PublishResponse, error)
+	Disconnect(ctx context.Context) error
+}
+
+var newV5Connection = func(ctx context.Context, cfg autopaho.ClientConfig) (v5Connection, error) {
+	return autopaho.NewConnection(ctx, cfg)
+}
+
+// v5ConnectTimeout bounds the initial connection to the broker.
+const v5ConnectTimeout = 10 * time.Second
+
+// PahoV5Client sends orders over MQTT v5 using the Eclipse Paho v5 library.
+// Commands carry the response topic vehicles must acknowledge on and their
+// command ID as correlation data, expire at the broker once their validity
+// ends so that vehicles reconnecting later never apply stale orders, and
+// describe the command and its signal in user properties.
+type PahoV5Client struct {
+	conn          v5Connection
+	cancel        context.CancelFunc
+	ackTopic      Template
+	commandTopic  Template
+	responseTopic string
+	qos           map[string]byte
+	acks          *ackWaiter
+	auth          *Authenticator
+	outbox        *Outbox
+	flush         chan struct{}
+	logger        logger.Logger
+	maxRetries    int
+	backoff       time.Duration
+	orderTTL      time.Duration
+}
+
+// NewPahoV5Client connects to the MQTT v5 broker and subscribes to the
+// response topic and the ACK topic.
+func NewPahoV5Client(cfg Config) (*PahoV5Client, error) {
+	broker, err := url.Parse(cfg.Broker)
+	if err != nil {
+		return nil, fmt.Errorf("parse broker url: %w", err)
+	}
+	auth, err := cfg.authenticator()
+	if err != nil {
+		return nil, err
+	}
+	outbox, err := cfg.outbox()
+	if err != nil {
+		return nil, err
+	}
+	pc := &PahoV5Client{
+		ackTopic:      cfg.ackTopic(),
+		commandTopic:  cfg.Topics.CommandTopic(),
+		responseTopic: cfg.responseTopic(),
+		qos:           cfg.QoS,
+		acks:          newAckWaiter(),
+		auth:          auth,
+		outbox:        outbox,
+		flush:         make(chan struct{}, 1),
+		logger:        logger.New("mqtt_v5_client"),
+		maxRetries:    cfg.MaxRetries,
+		backoff:       time.Duration(cfg.BackoffMS) * time.Millisecond,
+		orderTTL:      cfg.orderTTL(),
+	}
+	if pc.maxRetries <= 0 {
+		pc.maxRetries = 3
+	}
+	if pc.backoff <= 0 {
+		pc.backoff = 100 * time.Millisecond
+	}
+
+	ackQoS := cfg.QoS["ack"]
+	subs := []paho5.SubscribeOptions{{Topic: pc.responseTopic, QoS: ackQoS}}
+	if filter := pc.ackTopic.Filter(); filter != pc.responseTopic {
+		subs = append(subs, paho5.SubscribeOptions{Topic: filter, QoS: ackQoS})
+	}
+	cc := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{broker},
+		KeepAlive:                     30,
+		CleanStartOnInitialConnection: true,
+		ConnectTimeout:                v5ConnectTimeout,
+		OnConnectionUp: func(cm *autopaho.ConnectionManager, _ *paho5.Connack) {
+			pc.logger.Infof("MQTT v5 connected")
+			ctx, cancel := context.WithTimeout(context.Background(), v5ConnectTimeout)
+			defer cancel()
+			if _, err := cm.Subscribe(ctx, &paho5.Subscribe{Subscriptions: subs}); err != nil {
+				pc.logger.Errorf("subscribe error: %v", err)
+			}
+			requestFlush(pc.flush)
+		},
+		OnConnectError: func(err error) {
+			pc.logger.Errorf("connection error: %v", err)
+		},
+		ClientConfig: paho5.ClientConfig{
+			ClientID:          cfg.ClientID,
+			OnPublishReceived: []func(paho5.PublishReceived) (bool, error){pc.onPublish},
+			OnClientError: func(err error) {
+				pc.logger.Errorf("connection lost: %v", err)
+			},
+		},
+	}
+	if cfg.AuthMethod == "username_password" || cfg.AuthMethod == "both" || cfg.AuthMethod == "" {
+		cc.ConnectUsername = cfg.Username
+		if cfg.Password != "" {
+			cc.ConnectPassword = []byte(cfg.Password)
+		}
+	}
+	if cfg.UseTLS {
+		tlsCfg, err := cfg.LoadTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		cc.TlsCfg = tlsCfg
+	}
+	if cfg.LWTTopic != "" {
+		cc.WillMessage = &paho5.WillMessage{
+			Topic:   cfg.LWTTopic,
+			Payload: []byte(cfg.LWTPayload),
+			QoS:     cfg.LWTQoS,
+			Retain:  cfg.LWTRetain,
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err := newV5Connection(ctx, cc)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	waitCtx, waitCancel := context.WithTimeout(ctx, v5ConnectTimeout)
+	defer waitCancel()
+	if err := conn.AwaitConnection(waitCtx); err != nil {
+		cancel()
+		if outbox != nil {
+			_ = outbox.Close()
+		}
+		return nil, fmt.Errorf("mqtt v5 connect: %w", err)
+	}
+	pc.conn = conn
+	pc.cancel = cancel
+	if outbox != nil {
+		go runOutbox(ctx, pc.flush, pc.flushOutbox)
+	}
+	return pc, nil
+}
+
+// onPublish matches acknowledgments to the awaited commands by their
+// correlation data, or by the command_id of the payload for vehicles that
+// answer on the shared ACK topic without it.
+func (p *PahoV5Client) onPublish(pr paho5.PublishReceived) (bool, error) {
+	msg := pr.Packet
+	var correlation string
+	if msg.Properties != nil {
+		correlation = string(msg.Properties.CorrelationData)
+	}
+	from := ""
+	if msg.Topic != p.responseTopic {
+		from = p.ackTopic.Vehicle(msg.Topic)
+	}
+	ack, delivered, err := p.acks.receive(p.auth, msg.Payload, from, correlation)
+	if err != nil {
+		p.logger.Errorf("rejected ack on %s: %v", msg.Topic, err)
+		coremon.CaptureException(err, map[string]string{"module": "mqtt"})
+		return false, nil
+	}
+	if delivered {
+		p.logger.Infof("received %s ack %s", ack.Status, ack.CommandID)
+	}
+	return true, nil
+}
+
+// SendOrder sends a dispatch order that expires after the configured order
+// TTL.
+func (p *PahoV5Client) SendOrder(vehicleID string, powerKW float64) (string, error) {
+	return p.SendOrderWithMetadata(vehicleID, powerKW, time.Time{}, nil)
+}
+
+// SendOrderUntil sends a dispatch order that the vehicle must drop at
+// validUntil and that the broker discards if it cannot deliver it by then.
+func (p *PahoV5Client) SendOrderUntil(vehicleID string, powerKW float64, validUntil time.Time) (string, error) {
+	return p.SendOrderWithMetadata(vehicleID, powerKW, validUntil, nil)
+}
+
+// SendOrderWithMetadata implements coremqtt.MetadataClient. The metadata is
+// published as user properties.
+func (p *PahoV5Client) SendOrderWithMetadata(vehicleID string, powerKW float64, validUntil time.Time, metadata map[string]string) (string, error) {
+	if validUntil.IsZero() {
+		validUntil = time.Now().Add(p.orderTTL)
+	}
+	return p.sendCommand(command{
+		VehicleID:  vehicleID,
+		Type:       CommandSetpoint,
+		PowerKW:    powerKW,
+		ValidUntil: validUntil.UnixMilli(),
+	}, validUntil, metadata)
+}
+
+// SendRelease sends a release command. It expires after the order TTL since
+// the orders it releases have expired by then.
+func (p *PahoV5Client) SendRelease(vehicleID string) (string, error) {
+	return p.sendCommand(command{VehicleID: vehicleID, Type: CommandRelease}, time.Now().Add(p.orderTTL), nil)
+}
+
+// DropQueued implements mqtt.QueueingClient.
+func (p *PahoV5Client) DropQueued(vehicleID string) error {
+	return dropQueued(p.outbox, vehicleID)
+}
+
+// SendDroop pushes droop parameters so that the vehicle follows the grid
+// frequency locally until validUntil.
+func (p *PahoV5Client) SendDroop(vehicleID string, params model.DroopParams, validUntil time.Time) (string, error) {
+	return p.sendCommand(command{
+		VehicleID:  vehicleID,
+		Type:       CommandDroop,
+		ValidUntil: validUntil.UnixMilli(),
+		Droop:      &params,
+	}, validUntil, nil)
+}
+
+func (p *PahoV5Client) sendCommand(cmd command, expiresAt time.Time, metadata map[string]string) (string, error) {
+	cmd.CommandID = uuid.NewString()
+	cmd.Timestamp = time.Now().UnixMilli()
+	raw, err := json.Marshal(cmd)
+	if err != nil {
+		return "", err
+	}
+	payload, err := p.seal(cmd.VehicleID, raw)
+	if err != nil {
+		return "", err
+	}
+	if p.outbox != nil {
+		// A queued command must not be delivered after this one.
+		if err := p.outbox.Supersede(context.Background(), cmd.VehicleID); err != nil {
+			p.logger.Errorf("outbox: %v", err)
+		}
+	}
+	pub := p.publishPacket(cmd, payload, expiresAt, metadata)
+
+	// The ack may arrive before Publish returns.
+	p.acks.expect(cmd.CommandID, cmd.VehicleID)
+	var publishErr error
+	for attempt := 0; attempt <= p.maxRetries; attempt++ {
+		publishErr = p.publish(pub)
+		var rc *ReasonCodeError
+		if publishErr == nil || errors.As(publishErr, &rc) {
+			break
+		}
+		p.logger.Errorf("publish attempt %d failed: %v", attempt+1, publishErr)
+		time.Sleep(p.backoff * time.Duration(1<<attempt))
+	}
+	if publishErr != nil {
+		p.acks.forget(cmd.CommandID)
+		p.logger.Errorf("order %s to %s failed: %v", cmd.CommandID, pub.Topic, publishErr)
+		coremon.CaptureException(publishErr, map[string]string{"vehicle_id": cmd.VehicleID, "module": "mqtt"})
+		// Orders refused by the broker would be refused again.
+		var rc *ReasonCodeError
+		if errors.As(publishErr, &rc) {
+			return "", publishErr
+		}
+		return "", queueCommand(p.outbox, cmd, raw, metadata, publishErr)
+	}
+	p.logger.Infof("sent order %s to %s", cmd.CommandID, pub.Topic)
+	return cmd.CommandID, nil
+}
+
+// seal signs the payload for the vehicle when orders are signed.
+func (p *PahoV5Client) seal(vehicleID string, payload []byte) ([]byte, error) {
+	if p.auth == nil {
+		return payload, nil
+	}
+	return p.auth.Seal(vehicleID, payload)
+}
+
+// flushOutbox delivers the commands of the outbox. They are signed again and
+// releases, kept until delivered, expire at the broker after the order TTL.
+func (p *PahoV5Client) flushOutbox() {
+	sent, err := p.outbox.Flush(context.Background(), func(e OutboxEntry) error {
+		var cmd command
+		if err := json.Unmarshal(e.Command, &cmd); err != nil {
+			return err
+		}
+		payload, err := p.seal(e.VehicleID, e.Command)
+		if err != nil {
+			return err
+		}
+		expiresAt := e.ExpiresAt
+		if expiresAt.IsZero() {
+			expiresAt = time.Now().Add(p.orderTTL)
+		}
+		return p.publish(p.publishPacket(cmd, payload, expiresAt, e.Metadata))
+	})
+	if sent > 0 {
+		p.logger.Infof("delivered %d queued orders", sent)
+	}
+	if err != nil {
+		p.logger.Warnf("outbox flush: %v", err)
+	}
+}
+
+// publish sends the packet and converts a refusal reason code into a
+// ReasonCodeError.
+func (p *PahoV5Client) publish(pub *paho5.Publish) error {
+	ctx, cancel := context.WithTimeout(context.Background(), v5ConnectTimeout)
+	defer cancel()
+	resp, err := p.conn.Publish(ctx, pub)
+	if resp != nil && resp.ReasonCode >= 0x80 {
+		rc := &ReasonCodeError{Code: resp.ReasonCode}
+		if resp.Properties != nil {
+			rc.Reason = resp.Properties.ReasonString
+		}
+		return rc
+	}
+	return err
+}
+
+// publishPacket builds the MQTT v5 publish of a command.
+func (p *PahoV5Client) publishPacket(cmd command, payload []byte, expiresAt time.Time, metadata map[string]string) *paho5.Publish {
+	qos := byte(0)
+	if q, ok := p.qos["command"]; ok {
+		qos = q
+	}
+	props := &paho5.PublishProperties{
+		ContentType:     "application/json",
+		ResponseTopic:   p.responseTopic,
+		CorrelationData: []byte(cmd.CommandID),
+		MessageExpiry:   messageExpiry(expiresAt, time.Now()),
+	}
+	props.User.Add("type", cmd.Type).Add("vehicle_id", cmd.VehicleID)
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		props.User.Add(k, metadata[k])
+	}
+	return &paho5.Publish{
+		Topic:      p.commandTopic.Topic(cmd.VehicleID),
+		QoS:        qos,
+		Payload:    payload,
+		Properties: props,
+	}
+}
+
+// messageExpiry returns the message expiry interval in seconds until
+// expiresAt, at least one second, or nil when expiresAt is zero.
+func messageExpiry(expiresAt, now time.Time) *uint32 {
+	if expiresAt.IsZero() {
+		return nil
+	}
+	secs := math.Ceil(expiresAt.Sub(now).Seconds())
+	secs = math.Max(1, math.Min(secs, math.MaxUint32))
+	v := uint32(secs)
+	return &v
+}
+
+// WaitForAck blocks until an ACK for the given command ID is received or timeout.
+func (p *PahoV5Client) WaitForAck(commandID string, timeout time.Duration) (coremqtt.Ack, error) {
+	return p.acks.wait(commandID, timeout)
+}
+
+// Disconnect gracefully closes the MQTT connection and the outbox.
+func (p *PahoV5Client) Disconnect() {
+	if p.conn == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	_ = p.conn.Disconnect(ctx)
+	p.cancel()
+	if p.outbox != nil {
+		_ = p.outbox.Close()
+	}
+}
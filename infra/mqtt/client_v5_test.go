@@ -0,0 +1,124 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	paho5 "github.com/eclipse/paho.golang/paho"
+)
+
+type fakeV5Conn struct {
+	published []*paho5.Publish
+	responses []*paho5.PublishResponse
+}
+
+func (f *fakeV5Conn) AwaitConnection(context.Context) error { return nil }
+func (f *fakeV5Conn) Disconnect(context.Context) error      { return nil }
+func (f *fakeV5Conn) Publish(_ context.Context, p *paho5.Publish) (*paho5.PublishResponse, error) {
+	f.published = append(f.published, p)
+	if len(f.responses) > 0 {
+		resp := f.responses[0]
+		f.responses = f.responses[1:]
+		return resp, errors.New("error publishing")
+	}
+	return nil, nil
+}
+
+func newTestV5Client(t *testing.T, cfg Config) (*PahoV5Client, *fakeV5Conn, autopaho.ClientConfig) {
+	t.Helper()
+	conn := &fakeV5Conn{}
+	var captured autopaho.ClientConfig
+	newV5Connection = func(_ context.Context, cc autopaho.ClientConfig) (v5Connection, error) {
+		captured = cc
+		return conn, nil
+	}
+	t.Cleanup(func() {
+		newV5Connection = func(ctx context.Context, cc autopaho.ClientConfig) (v5Connection, error) {
+			return autopaho.NewConnection(ctx, cc)
+		}
+	})
+	cli, err := NewPahoV5Client(cfg)
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	return cli, conn, captured
+}
+
+func TestV5OrderProperties(t *testing.T) {
+	cli, conn, _ := newTestV5Client(t, Config{Broker: "tcp://localhost:1883", ClientID: "disp", QoS: map[string]byte{"command": 1}})
+	until := time.Now().Add(90 * time.Second)
+	id, err := cli.SendOrderWithMetadata("veh1", 7, until, map[string]string{"signal_type": "FCR"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if len(conn.published) != 1 {
+		t.Fatalf("expected 1 publish, got %d", len(conn.published))
+	}
+	pub := conn.published[0]
+	if pub.Topic != "vehicle/veh1/command" || pub.QoS != 1 {
+		t.Fatalf("unexpected publish: %s qos %d", pub.Topic, pub.QoS)
+	}
+	props := pub.Properties
+	if props.ResponseTopic != "v2g/dispatch/disp/ack" || string(props.CorrelationData) != id {
+		t.Fatalf("unexpected response properties: %+v", props)
+	}
+	if props.MessageExpiry == nil || *props.MessageExpiry < 89 || *props.MessageExpiry > 90 {
+		t.Fatalf("unexpected message expiry: %v", props.MessageExpiry)
+	}
+	if props.User.Get("type") != CommandSetpoint || props.User.Get("vehicle_id") != "veh1" || props.User.Get("signal_type") != "FCR" {
+		t.Fatalf("unexpected user properties: %v", props.User)
+	}
+	var cmd command
+	if err := json.Unmarshal(pub.Payload, &cmd); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if cmd.CommandID != id || cmd.PowerKW != 7 || cmd.ValidUntil != until.UnixMilli() {
+		t.Fatalf("unexpected payload: %+v", cmd)
+	}
+}
+
+func TestV5AckByCorrelationData(t *testing.T) {
+	cli, _, cc := newTestV5Client(t, Config{Broker: "tcp://localhost:1883", ClientID: "disp", AckTopic: "vehicle/+/ack"})
+	first, _ := cli.SendOrder("veh1", 5)
+	second, _ := cli.SendOrder("veh2", 5)
+
+	recv := cc.OnPublishReceived[0]
+	_, _ = recv(paho5.PublishReceived{Packet: &paho5.Publish{
+		Topic:      "v2g/dispatch/disp/ack",
+		Properties: &paho5.PublishProperties{CorrelationData: []byte(first)},
+	}})
+	payload, _ := json.Marshal(map[string]string{"command_id": second})
+	_, _ = recv(paho5.PublishReceived{Packet: &paho5.Publish{Topic: "vehicle/veh2/ack", Payload: payload}})
+
+	for _, id := range []string{first, second} {
+		if ack, err := cli.WaitForAck(id, 100*time.Millisecond); !ack.Accepted() || err != nil {
+			t.Fatalf("expected ack for %s, got %+v %v", id, ack, err)
+		}
+	}
+}
+
+func TestV5ReasonCodeIsNotRetried(t *testing.T) {
+	cli, conn, _ := newTestV5Client(t, Config{Broker: "tcp://localhost:1883", ClientID: "disp"})
+	conn.responses = []*paho5.PublishResponse{{
+		ReasonCode: 0x87,
+		Properties: &paho5.PublishResponseProperties{ReasonString: "not authorized"},
+	}}
+	_, err := cli.SendOrder("veh1", 5)
+	var rc *ReasonCodeError
+	if !errors.As(err, &rc) || rc.Code != 0x87 || rc.Reason != "not authorized" {
+		t.Fatalf("expected reason code error, got %v", err)
+	}
+	if len(conn.published) != 1 {
+		t.Fatalf("expected no retry, got %d publishes", len(conn.published))
+	}
+}
+
+func TestNewClientRejectsUnknownProtocol(t *testing.T) {
+	if _, err := NewClient(Config{Protocol: "4"}); err == nil {
+		t.Fatalf("expected error for unknown protocol")
+	}
+}
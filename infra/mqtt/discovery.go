@@ -35,6 +35,13 @@ func (d *PahoFleetDiscovery) Close() error {
 	return nil
 }
 
+// NewFleetDiscovery connects to the broker and returns a discovery instance
+// using the discovery topics and payload of cfg.Topics.
+func NewFleetDiscovery(cfg Config) (*PahoFleetDiscovery, error) {
+	t := cfg.Topics
+	return NewPahoFleetDiscovery(cfg, t.DiscoveryRequestTopic().Topic(""), t.DiscoveryResponseTopic().Filter(), t.DiscoveryPing())
+}
+
 // NewPahoFleetDiscovery connects to the broker and returns a discovery instance.
 func NewPahoFleetDiscovery(cfg Config, broadcastTopic, responseTopic, magicWord string) (*PahoFleetDiscovery, error) {
 	id := cfg.ClientID
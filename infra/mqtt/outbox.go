@@ -0,0 +1,322 @@
+package mqtt
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	_ "modernc.org/sqlite"
+
+	coremqtt "github.com/kilianp07/v2g/core/mqtt"
+)
+
+// ErrOrderQueued is returned for a command that could not be published and
+// was stored in the outbox to be delivered once the broker is reachable.
+var ErrOrderQueued = coremqtt.ErrOrderQueued
+
+// outboxFlushInterval is how often the clients retry delivering the commands
+// of the outbox and drop the expired ones.
+const outboxFlushInterval = 5 * time.Second
+
+var (
+	outboxDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mqtt_outbox_depth",
+		Help: "Commands waiting in the outbox",
+	})
+	outboxAge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mqtt_outbox_oldest_age_seconds",
+		Help: "Age of the oldest command waiting in the outbox",
+	})
+	outboxQueued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_outbox_queued_total",
+		Help: "Commands stored in the outbox",
+	}, []string{"type"})
+	outboxFlushed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_outbox_flushed_total",
+		Help: "Commands delivered from the outbox",
+	}, []string{"type"})
+	outboxExpired = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_outbox_expired_total",
+		Help: "Commands dropped from the outbox once expired",
+	}, []string{"type"})
+)
+
+func init() {
+	prometheus.MustRegister(outboxDepth, outboxAge, outboxQueued, outboxFlushed, outboxExpired)
+}
+
+// OutboxEntry is a command waiting in the outbox. Command is the unsigned
+// JSON command, signed again when it is delivered. Commands without an
+// ExpiresAt, such as releases, are kept until delivered.
+type OutboxEntry struct {
+	CommandID  string
+	VehicleID  string
+	Type       string
+	Command    []byte
+	Metadata   map[string]string
+	EnqueuedAt time.Time
+	ExpiresAt  time.Time
+}
+
+func (e OutboxEntry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// Outbox persists the commands that could not be published to a SQLite
+// database so that they survive a restart and are delivered once the broker
+// is reachable again. Only the latest command of a vehicle is kept, since it
+// replaces the previous ones on the vehicle.
+type Outbox struct {
+	db  *sql.DB
+	now func() time.Time
+
+	// mu serializes deliveries with the commands superseding them.
+	mu sync.Mutex
+}
+
+// NewOutbox opens or creates the outbox database at path.
+func NewOutbox(path string) (*Outbox, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	schema := `CREATE TABLE IF NOT EXISTS mqtt_outbox (
+        command_id TEXT PRIMARY KEY,
+        vehicle_id TEXT,
+        type TEXT,
+        command BLOB,
+        metadata TEXT,
+        enqueued_at INTEGER,
+        expires_at INTEGER
+    );`
+	if _, err := db.Exec(schema); err != nil {
+		if cerr := db.Close(); cerr != nil {
+			return nil, fmt.Errorf("close db: %v (schema err: %w)", cerr, err)
+		}
+		return nil, err
+	}
+	o := &Outbox{db: db, now: time.Now}
+	o.refresh(context.Background())
+	return o, nil
+}
+
+// Enqueue stores the command, replacing the commands still waiting for its
+// vehicle.
+func (o *Outbox) Enqueue(ctx context.Context, e OutboxEntry) error {
+	meta, err := json.Marshal(e.Metadata)
+	if err != nil {
+		return err
+	}
+	var expires int64
+	if !e.ExpiresAt.IsZero() {
+		expires = e.ExpiresAt.UnixMilli()
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mqtt_outbox WHERE vehicle_id = ?`, e.VehicleID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO mqtt_outbox (command_id, vehicle_id, type, command, metadata, enqueued_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		e.CommandID, e.VehicleID, e.Type, e.Command, string(meta), e.EnqueuedAt.UnixMilli(), expires); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	outboxQueued.WithLabelValues(e.Type).Inc()
+	o.refresh(ctx)
+	return nil
+}
+
+// Supersede drops the commands waiting for the vehicle. The clients call it
+// before sending a newer command to the vehicle so that a flush never delivers
+// the older one after it.
+func (o *Outbox) Supersede(ctx context.Context, vehicleID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	res, err := o.db.ExecContext(ctx, `DELETE FROM mqtt_outbox WHERE vehicle_id = ?`, vehicleID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		o.refresh(ctx)
+	}
+	return nil
+}
+
+// Pending returns the waiting commands, oldest first.
+func (o *Outbox) Pending(ctx context.Context) ([]OutboxEntry, error) {
+	rows, err := o.db.QueryContext(ctx,
+		`SELECT command_id, vehicle_id, type, command, metadata, enqueued_at, expires_at FROM mqtt_outbox ORDER BY enqueued_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var res []OutboxEntry
+	for rows.Next() {
+		var (
+			e                 OutboxEntry
+			meta              string
+			enqueued, expires int64
+		)
+		if err := rows.Scan(&e.CommandID, &e.VehicleID, &e.Type, &e.Command, &meta, &enqueued, &expires); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(meta), &e.Metadata); err != nil {
+			return nil, fmt.Errorf("unmarshal metadata: %w", err)
+		}
+		e.EnqueuedAt = time.UnixMilli(enqueued)
+		if expires > 0 {
+			e.ExpiresAt = time.UnixMilli(expires)
+		}
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
+
+// Flush drops the expired commands and hands the others to send, oldest
+// first, removing each once sent. After a send error the remaining commands
+// are kept for a later flush. It returns the number of commands delivered
+// and the first error. A command is removed after it was sent, so a crash in
+// between delivers it twice rather than losing it.
+func (o *Outbox) Flush(ctx context.Context, send func(OutboxEntry) error) (int, error) {
+	entries, err := o.Pending(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer o.refresh(ctx)
+	var (
+		sent   int
+		failed error
+	)
+	for _, e := range entries {
+		if failed != nil && !e.expired(o.now()) {
+			continue
+		}
+		ok, err := o.flushEntry(ctx, e, send)
+		if err != nil {
+			failed = err
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, failed
+}
+
+// flushEntry delivers a command unless it expired or was superseded in the
+// meantime.
+func (o *Outbox) flushEntry(ctx context.Context, e OutboxEntry, send func(OutboxEntry) error) (bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var n int
+	if err := o.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM mqtt_outbox WHERE command_id = ?`, e.CommandID).Scan(&n); err != nil || n == 0 {
+		return false, err
+	}
+	delivered := !e.expired(o.now())
+	if delivered {
+		if err := send(e); err != nil {
+			return false, err
+		}
+		outboxFlushed.WithLabelValues(e.Type).Inc()
+	} else {
+		outboxExpired.WithLabelValues(e.Type).Inc()
+	}
+	_, err := o.db.ExecContext(ctx, `DELETE FROM mqtt_outbox WHERE command_id = ?`, e.CommandID)
+	return delivered, err
+}
+
+// Stats returns the number of waiting commands and the age of the oldest.
+func (o *Outbox) Stats(ctx context.Context) (int, time.Duration, error) {
+	var (
+		depth  int
+		oldest sql.NullInt64
+	)
+	err := o.db.QueryRowContext(ctx, `SELECT COUNT(*), MIN(enqueued_at) FROM mqtt_outbox`).Scan(&depth, &oldest)
+	if err != nil || !oldest.Valid {
+		return depth, 0, err
+	}
+	return depth, o.now().Sub(time.UnixMilli(oldest.Int64)), nil
+}
+
+// refresh updates the depth and age gauges.
+func (o *Outbox) refresh(ctx context.Context) {
+	depth, age, err := o.Stats(ctx)
+	if err != nil {
+		return
+	}
+	outboxDepth.Set(float64(depth))
+	outboxAge.Set(age.Seconds())
+}
+
+// Close closes the underlying database.
+func (o *Outbox) Close() error { return o.db.Close() }
+
+// queueCommand stores a command that could not be published in the outbox,
+// when one is configured, and returns the error reported to the caller.
+// Setpoints and droop commands expire at their validity deadline.
+func queueCommand(o *Outbox, cmd command, payload []byte, metadata map[string]string, cause error) error {
+	if o == nil {
+		return cause
+	}
+	e := OutboxEntry{
+		CommandID:  cmd.CommandID,
+		VehicleID:  cmd.VehicleID,
+		Type:       cmd.Type,
+		Command:    payload,
+		Metadata:   metadata,
+		EnqueuedAt: o.now(),
+	}
+	if cmd.ValidUntil > 0 {
+		e.ExpiresAt = time.UnixMilli(cmd.ValidUntil)
+	}
+	if err := o.Enqueue(context.Background(), e); err != nil {
+		return fmt.Errorf("%w (outbox: %v)", cause, err)
+	}
+	return fmt.Errorf("%w: %v", ErrOrderQueued, cause)
+}
+
+// dropQueued drops the commands queued for the vehicle in the outbox, when
+// one is configured.
+func dropQueued(o *Outbox, vehicleID string) error {
+	if o == nil {
+		return nil
+	}
+	return o.Supersede(context.Background(), vehicleID)
+}
+
+// runOutbox flushes the outbox periodically and whenever trigger fires, such
+// as on reconnection, until ctx is done.
+func runOutbox(ctx context.Context, trigger <-chan struct{}, flush func()) {
+	ticker := time.NewTicker(outboxFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			flush()
+		case <-trigger:
+			flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// requestFlush asks runOutbox to flush without waiting for the next tick.
+func requestFlush(trigger chan struct{}) {
+	select {
+	case trigger <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,126 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestOutboxFlush(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "outbox.db")
+	o, err := NewOutbox(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	now := time.UnixMilli(time.Now().UnixMilli())
+	o.now = func() time.Time { return now }
+	entries := []OutboxEntry{
+		{CommandID: "c1", VehicleID: "veh1", Type: CommandSetpoint, Command: []byte(`{}`), EnqueuedAt: now.Add(-3 * time.Minute)},
+		{CommandID: "c2", VehicleID: "veh2", Type: CommandRelease, Command: []byte(`{}`), EnqueuedAt: now.Add(-2 * time.Minute)},
+		{CommandID: "c3", VehicleID: "veh1", Type: CommandSetpoint, Command: []byte(`{}`), EnqueuedAt: now.Add(-time.Minute), ExpiresAt: now.Add(time.Minute)},
+		{CommandID: "c4", VehicleID: "veh3", Type: CommandSetpoint, Command: []byte(`{}`), EnqueuedAt: now, ExpiresAt: now.Add(time.Second)},
+	}
+	for _, e := range entries {
+		if err := o.Enqueue(ctx, e); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	if depth, age, _ := o.Stats(ctx); depth != 3 || age != 2*time.Minute {
+		t.Fatalf("expected c1 to be superseded, got depth %d age %v", depth, age)
+	}
+
+	now = now.Add(time.Second)
+	_, err = o.Flush(ctx, func(OutboxEntry) error { return fmt.Errorf("broker down") })
+	if err == nil {
+		t.Fatalf("expected send error")
+	}
+	if depth, _, _ := o.Stats(ctx); depth != 2 {
+		t.Fatalf("expected the expired order to be dropped, got depth %d", depth)
+	}
+	_ = o.Close()
+
+	o, err = NewOutbox(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer func() { _ = o.Close() }()
+	var sent []string
+	n, err := o.Flush(ctx, func(e OutboxEntry) error { sent = append(sent, e.CommandID); return nil })
+	if err != nil || n != 2 || len(sent) != 2 || sent[0] != "c2" || sent[1] != "c3" {
+		t.Fatalf("flush: %d %v %v", n, sent, err)
+	}
+	if depth, _, _ := o.Stats(ctx); depth != 0 {
+		t.Fatalf("expected empty outbox, got %d", depth)
+	}
+}
+
+func TestReleaseQueuedWhileBrokerUnreachable(t *testing.T) {
+	mc := &mockClient{}
+	newMQTTClient = func(o *paho.ClientOptions) pahoClient { mc.opts = o; return mc }
+	defer func() { newMQTTClient = func(opts *paho.ClientOptions) pahoClient { return paho.NewClient(opts) } }()
+	cli, err := NewPahoClient(Config{Broker: "tcp://localhost:1883", ClientID: "id", MaxRetries: 1, BackoffMS: 1})
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	if cli.outbox, err = NewOutbox(filepath.Join(t.TempDir(), "outbox.db")); err != nil {
+		t.Fatalf("outbox: %v", err)
+	}
+	defer func() { _ = cli.outbox.Close() }()
+
+	mc.publishErrs = []error{errors.New("net fail"), errors.New("net fail")}
+	if _, err := cli.SendRelease("veh1"); !errors.Is(err, ErrOrderQueued) {
+		t.Fatalf("expected queued release, got %v", err)
+	}
+	<-cli.flush
+	mc.opts.OnConnect(mc)
+	if len(cli.flush) != 1 {
+		t.Fatalf("expected reconnection to request a flush")
+	}
+	cli.flushOutbox()
+	last := mc.published[len(mc.published)-1]
+	var cmd command
+	if err := json.Unmarshal(last.payload, &cmd); err != nil || cmd.Type != CommandRelease || last.topic != "vehicle/veh1/command" {
+		t.Fatalf("expected queued release to be delivered, got %s on %s", last.payload, last.topic)
+	}
+	if depth, _, _ := cli.outbox.Stats(context.Background()); depth != 0 {
+		t.Fatalf("expected empty outbox, got %d", depth)
+	}
+}
+
+func TestSetpointQueuedUntilDeadline(t *testing.T) {
+	mc := &mockClient{}
+	newMQTTClient = func(o *paho.ClientOptions) pahoClient { mc.opts = o; return mc }
+	defer func() { newMQTTClient = func(opts *paho.ClientOptions) pahoClient { return paho.NewClient(opts) } }()
+	cli, err := NewPahoClient(Config{Broker: "tcp://localhost:1883", ClientID: "id", MaxRetries: 1, BackoffMS: 1})
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	if cli.outbox, err = NewOutbox(filepath.Join(t.TempDir(), "outbox.db")); err != nil {
+		t.Fatalf("outbox: %v", err)
+	}
+	defer func() { _ = cli.outbox.Close() }()
+	ctx := context.Background()
+
+	until := time.UnixMilli(time.Now().Add(time.Minute).UnixMilli())
+	mc.publishErrs = []error{errors.New("net fail"), errors.New("net fail")}
+	if _, err := cli.SendOrderUntil("veh1", 7, until); !errors.Is(err, ErrOrderQueued) {
+		t.Fatalf("expected queued setpoint, got %v", err)
+	}
+	pending, err := cli.outbox.Pending(ctx)
+	if err != nil || len(pending) != 1 || pending[0].Type != CommandSetpoint || !pending[0].ExpiresAt.Equal(until) {
+		t.Fatalf("expected the setpoint queued until its deadline, got %+v %v", pending, err)
+	}
+	if err := cli.DropQueued("veh1"); err != nil {
+		t.Fatalf("drop: %v", err)
+	}
+	if depth, _, _ := cli.outbox.Stats(ctx); depth != 0 {
+		t.Fatalf("expected the dropped setpoint removed, got depth %d", depth)
+	}
+}
@@ -2,21 +2,42 @@ package mqtt
 
 import (
 	"fmt"
+	"math"
 	"sync"
 	"time"
 
+	"github.com/kilianp07/v2g/core/model"
 	coremqtt "github.com/kilianp07/v2g/core/mqtt"
 )
 
 // Client mirrors the core mqtt.Client interface.
 type Client = coremqtt.Client
 
+// Ack mirrors the core mqtt.Ack type.
+type Ack = coremqtt.Ack
+
 // MockPublisher is a simple publisher used in tests.
 type MockPublisher struct {
 	Messages   map[string]float64
 	FailIDs    map[string]bool
 	AckResults map[string]bool
-	mu         sync.Mutex
+	// ValidUntil records the deadline of the last order sent to each vehicle.
+	ValidUntil map[string]time.Time
+	// Released records the vehicles that received a release command.
+	Released map[string]bool
+	// Droop records the droop parameters pushed to each vehicle.
+	Droop map[string]model.DroopParams
+	// Metadata records the metadata of the last order sent to each vehicle.
+	Metadata map[string]map[string]string
+	// AppliedKW caps the power the listed vehicles apply. Orders beyond the
+	// cap are acknowledged as partially applied.
+	AppliedKW map[string]float64
+	// QueueIDs lists the vehicles whose orders fail with ErrOrderQueued.
+	// Queued holds their setpoints until DropQueued.
+	QueueIDs map[string]bool
+	Queued   map[string]float64
+	applied  map[string]float64
+	mu       sync.Mutex
 }
 
 // NewMockPublisher creates a new MockPublisher.
@@ -25,29 +46,120 @@ func NewMockPublisher() *MockPublisher {
 		Messages:   make(map[string]float64),
 		FailIDs:    make(map[string]bool),
 		AckResults: make(map[string]bool),
+		ValidUntil: make(map[string]time.Time),
+		Released:   make(map[string]bool),
+		Droop:      make(map[string]model.DroopParams),
+		Metadata:   make(map[string]map[string]string),
+		AppliedKW:  make(map[string]float64),
+		QueueIDs:   make(map[string]bool),
+		Queued:     make(map[string]float64),
+		applied:    make(map[string]float64),
 	}
 }
 
 // SendOrder records the message or returns an error if configured to fail.
 func (m *MockPublisher) SendOrder(vehicleID string, powerKW float64) (string, error) {
+	return m.SendOrderUntil(vehicleID, powerKW, time.Time{})
+}
+
+// SendOrderUntil records the message along with its deadline.
+func (m *MockPublisher) SendOrderUntil(vehicleID string, powerKW float64, validUntil time.Time) (string, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if m.FailIDs[vehicleID] {
 		return "", fmt.Errorf("publish failed")
 	}
+	if m.QueueIDs[vehicleID] {
+		m.Queued[vehicleID] = powerKW
+		return "", fmt.Errorf("%w: publish failed", coremqtt.ErrOrderQueued)
+	}
 	m.Messages[vehicleID] = powerKW
+	m.ValidUntil[vehicleID] = validUntil
+	delete(m.Released, vehicleID)
 	commandID := fmt.Sprintf("cmd-%s", vehicleID)
 	m.AckResults[commandID] = !m.FailIDs[vehicleID]
+	if limit, ok := m.AppliedKW[vehicleID]; ok && math.Abs(powerKW) > limit {
+		m.applied[commandID] = math.Copysign(limit, powerKW)
+	} else {
+		delete(m.applied, commandID)
+	}
+	return commandID, nil
+}
+
+// SendOrderWithMetadata records the order along with its metadata.
+func (m *MockPublisher) SendOrderWithMetadata(vehicleID string, powerKW float64, validUntil time.Time, metadata map[string]string) (string, error) {
+	commandID, err := m.SendOrderUntil(vehicleID, powerKW, validUntil)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	m.Metadata[vehicleID] = metadata
+	m.mu.Unlock()
+	return commandID, nil
+}
+
+// DropQueued forgets the setpoint queued for the vehicle.
+func (m *MockPublisher) DropQueued(vehicleID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.Queued, vehicleID)
+	return nil
+}
+
+// SendRelease records a release as a zero setpoint.
+func (m *MockPublisher) SendRelease(vehicleID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.FailIDs[vehicleID] {
+		return "", fmt.Errorf("publish failed")
+	}
+	m.Messages[vehicleID] = 0
+	m.Released[vehicleID] = true
+	delete(m.ValidUntil, vehicleID)
+	commandID := fmt.Sprintf("release-%s", vehicleID)
+	m.AckResults[commandID] = true
 	return commandID, nil
 }
 
 // WaitForAck simulates an immediate acknowledgment based on the stored result.
-func (m *MockPublisher) WaitForAck(commandID string, timeout time.Duration) (bool, error) {
+// Commands whose result is false are rejected.
+func (m *MockPublisher) WaitForAck(commandID string, timeout time.Duration) (coremqtt.Ack, error) {
 	m.mu.Lock()
 	ok, exists := m.AckResults[commandID]
+	applied, partial := m.applied[commandID]
 	m.mu.Unlock()
-	if !exists {
-		return false, fmt.Errorf("unknown command")
+	ack := coremqtt.Ack{CommandID: commandID, Status: coremqtt.AckAccepted}
+	switch {
+	case !exists:
+		return coremqtt.Ack{CommandID: commandID}, fmt.Errorf("unknown command")
+	case !ok:
+		ack.Status = coremqtt.AckRejected
+	case partial:
+		ack.Status = coremqtt.AckPartial
+		ack.AppliedKW = &applied
 	}
-	return ok, nil
+	return ack, nil
+}
+
+// SendDroop records the droop parameters pushed to the vehicle.
+func (m *MockPublisher) SendDroop(vehicleID string, params model.DroopParams, validUntil time.Time) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.FailIDs[vehicleID] {
+		return "", fmt.Errorf("publish failed")
+	}
+	m.Droop[vehicleID] = params
+	m.ValidUntil[vehicleID] = validUntil
+	delete(m.Released, vehicleID)
+	commandID := fmt.Sprintf("droop-%s", vehicleID)
+	m.AckResults[commandID] = true
+	return commandID, nil
+}
+
+// Setpoint returns the last power sent to the vehicle and whether it was
+// released since. It is safe to call while orders are being sent.
+func (m *MockPublisher) Setpoint(vehicleID string) (float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Messages[vehicleID], m.Released[vehicleID]
 }
@@ -0,0 +1,154 @@
+package mqtt
+
+import (
+	"path"
+	"strings"
+)
+
+// Placeholders substituted in topic templates.
+const (
+	TenantPlaceholder  = "{tenant}"
+	SitePlaceholder    = "{site}"
+	VehiclePlaceholder = "{vehicle}"
+)
+
+// Default topic templates, relative to the namespace.
+const (
+	DefaultCommandTopic           = "vehicle/{vehicle}/command"
+	DefaultAckTopic               = "vehicle/{vehicle}/ack"
+	DefaultDiscoveryRequestTopic  = "v2g/fleet/discovery"
+	DefaultDiscoveryResponseTopic = "v2g/fleet/response/{vehicle}"
+	DefaultTelemetryRequestTopic  = "v2g/telemetry/request"
+	DefaultTelemetryResponseTopic = "v2g/telemetry/response/{vehicle}"
+	DefaultStateTopic             = "v2g/vehicle/state/{vehicle}"
+	DefaultDiscoveryPayload       = "hello"
+)
+
+// Topics configures the MQTT topic namespace shared by the dispatcher, the
+// fleet discovery, the telemetry manager and the simulator. Templates may use
+// the {tenant}, {site} and {vehicle} placeholders and default to the
+// historical topics. Namespace, typically "{tenant}/{site}", is prepended to
+// every template so that several aggregator tenants can share one broker.
+// DiscoveryPayload is the word broadcast to discover vehicles.
+type Topics struct {
+	Tenant            string `json:"tenant"`
+	Site              string `json:"site"`
+	Namespace         string `json:"namespace"`
+	Command           string `json:"command"`
+	Ack               string `json:"ack"`
+	Response          string `json:"response"`
+	DiscoveryRequest  string `json:"discovery_request"`
+	DiscoveryResponse string `json:"discovery_response"`
+	DiscoveryPayload  string `json:"discovery_payload"`
+	TelemetryRequest  string `json:"telemetry_request"`
+	TelemetryResponse string `json:"telemetry_response"`
+	State             string `json:"state"`
+}
+
+// Template is a topic template whose tenant and site are resolved. It yields
+// the topic of a vehicle, the filter matching all vehicles and the vehicle of
+// a received topic.
+type Template string
+
+// resolve prepends the namespace to the template, or to def when empty, and
+// substitutes the tenant and site.
+func (t Topics) resolve(tmpl, def string) Template {
+	if tmpl == "" {
+		tmpl = def
+	}
+	if t.Namespace != "" {
+		tmpl = path.Join(t.Namespace, tmpl)
+	}
+	r := strings.NewReplacer(TenantPlaceholder, t.Tenant, SitePlaceholder, t.Site)
+	return Template(r.Replace(tmpl))
+}
+
+// CommandTopic returns the template of the topics vehicles receive commands on.
+func (t Topics) CommandTopic() Template { return t.resolve(t.Command, DefaultCommandTopic) }
+
+// AckTopic returns the template of the topics vehicles acknowledge on.
+func (t Topics) AckTopic() Template { return t.resolve(t.Ack, DefaultAckTopic) }
+
+// ResponseTopic returns the template of the topic MQTT v5 orders ask vehicles
+// to answer on, "v2g/dispatch/{client_id}/ack" by default.
+func (t Topics) ResponseTopic(clientID string) Template {
+	return t.resolve(t.Response, "v2g/dispatch/"+clientID+"/ack")
+}
+
+// DiscoveryRequestTopic returns the template of the discovery broadcast topic.
+func (t Topics) DiscoveryRequestTopic() Template {
+	return t.resolve(t.DiscoveryRequest, DefaultDiscoveryRequestTopic)
+}
+
+// DiscoveryResponseTopic returns the template of the topics vehicles answer
+// discovery on.
+func (t Topics) DiscoveryResponseTopic() Template {
+	return t.resolve(t.DiscoveryResponse, DefaultDiscoveryResponseTopic)
+}
+
+// DiscoveryPing returns the payload of the discovery broadcast.
+func (t Topics) DiscoveryPing() string {
+	if t.DiscoveryPayload == "" {
+		return DefaultDiscoveryPayload
+	}
+	return t.DiscoveryPayload
+}
+
+// TelemetryRequestTopic returns the template of the telemetry poll topic.
+// Vehicles also listen on its subtopic named after them.
+func (t Topics) TelemetryRequestTopic() Template {
+	return t.resolve(t.TelemetryRequest, DefaultTelemetryRequestTopic)
+}
+
+// TelemetryResponseTopic returns the template of the topics vehicles answer
+// telemetry polls on.
+func (t Topics) TelemetryResponseTopic() Template {
+	return t.resolve(t.TelemetryResponse, DefaultTelemetryResponseTopic)
+}
+
+// StateTopic returns the template of the topics vehicles push their state on.
+func (t Topics) StateTopic() Template { return t.resolve(t.State, DefaultStateTopic) }
+
+// Topic returns the topic of the vehicle.
+func (t Template) Topic(vehicleID string) string {
+	return strings.ReplaceAll(string(t), VehiclePlaceholder, vehicleID)
+}
+
+// Filter returns the subscription filter matching the topics of all vehicles.
+func (t Template) Filter() string {
+	levels := strings.Split(string(t), "/")
+	for i, l := range levels {
+		if strings.Contains(l, VehiclePlaceholder) {
+			levels[i] = "+"
+		}
+	}
+	return strings.Join(levels, "/")
+}
+
+// Vehicle returns the vehicle named by a topic of the template, or "" when
+// the template names no vehicle or the topic does not match it.
+func (t Template) Vehicle(topic string) string {
+	levels := strings.Split(string(t), "/")
+	parts := strings.Split(topic, "/")
+	if len(levels) != len(parts) {
+		return ""
+	}
+	vehicle := ""
+	for i, l := range levels {
+		before, after, ok := strings.Cut(l, VehiclePlaceholder)
+		if !ok {
+			if l != parts[i] {
+				return ""
+			}
+			continue
+		}
+		p := parts[i]
+		if len(p) <= len(before)+len(after) || !strings.HasPrefix(p, before) || !strings.HasSuffix(p, after) {
+			return ""
+		}
+		if vehicle == "" {
+			vehicle = p[len(before) : len(p)-len(after)]
+		}
+	}
+	return vehicle
+}
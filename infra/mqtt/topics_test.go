@@ -0,0 +1,57 @@
+package mqtt
+
+import "testing"
+
+func TestTopicsDefaults(t *testing.T) {
+	var topics Topics
+	if got := topics.CommandTopic().Topic("veh1"); got != "vehicle/veh1/command" {
+		t.Fatalf("command topic %q", got)
+	}
+	if got := topics.DiscoveryResponseTopic().Filter(); got != "v2g/fleet/response/+" {
+		t.Fatalf("discovery filter %q", got)
+	}
+	if got := topics.ResponseTopic("disp").Topic(""); got != "v2g/dispatch/disp/ack" {
+		t.Fatalf("response topic %q", got)
+	}
+	if topics.DiscoveryPing() != DefaultDiscoveryPayload {
+		t.Fatalf("unexpected discovery payload %q", topics.DiscoveryPing())
+	}
+}
+
+func TestTopicsNamespace(t *testing.T) {
+	topics := Topics{Tenant: "acme", Site: "lyon", Namespace: "{tenant}/{site}", State: "state/ev-{vehicle}"}
+	ack := topics.AckTopic()
+	if got := ack.Topic("veh1"); got != "acme/lyon/vehicle/veh1/ack" {
+		t.Fatalf("ack topic %q", got)
+	}
+	if got := ack.Filter(); got != "acme/lyon/vehicle/+/ack" {
+		t.Fatalf("ack filter %q", got)
+	}
+	if v := ack.Vehicle("acme/lyon/vehicle/veh1/ack"); v != "veh1" {
+		t.Fatalf("got %q", v)
+	}
+	if v := ack.Vehicle("other/lyon/vehicle/veh1/ack"); v != "" {
+		t.Fatalf("expected another tenant's topic not to match, got %q", v)
+	}
+	state := topics.StateTopic()
+	if got := state.Filter(); got != "acme/lyon/state/+" {
+		t.Fatalf("state filter %q", got)
+	}
+	if v := state.Vehicle("acme/lyon/state/ev-veh2"); v != "veh2" {
+		t.Fatalf("got %q", v)
+	}
+	if v := Template("acks").Vehicle("acks"); v != "" {
+		t.Fatalf("got %q", v)
+	}
+}
+
+func TestLegacyAckTopic(t *testing.T) {
+	cfg := Config{AckTopic: "fleet/+/ack", Topics: Topics{Namespace: "acme"}}
+	if got := cfg.ackTopic(); got != "fleet/{vehicle}/ack" {
+		t.Fatalf("expected ack_topic to override the templates, got %q", got)
+	}
+	cfg.AckTopic = ""
+	if got := cfg.ackTopic().Filter(); got != "acme/vehicle/+/ack" {
+		t.Fatalf("ack filter %q", got)
+	}
+}
@@ -20,11 +20,14 @@ import (
 
 // Manager collects telemetry from vehicles either via push or polling.
 type Manager struct {
-	cfg  config.TelemetryConfig
-	cli  paho.Client
-	sink coremetrics.VehicleStateRecorder
-	log  logger.Logger
-	disc dispatch.FleetDiscovery
+	cfg    config.TelemetryConfig
+	topics infmqtt.Topics
+	cli    paho.Client
+	sink   coremetrics.VehicleStateRecorder
+	log    logger.Logger
+	disc   dispatch.FleetDiscovery
+
+	cache *dispatch.TelemetryCache
 
 	respCh chan telemetryMessage
 
@@ -60,6 +63,7 @@ func NewManager(mqttCfg infmqtt.Config, cfg config.TelemetryConfig, sink coremet
 	}
 	m := &Manager{
 		cfg:         cfg,
+		topics:      mqttCfg.Topics,
 		cli:         cli,
 		sink:        sink,
 		log:         logger.New("telemetry"),
@@ -76,6 +80,12 @@ func NewManager(mqttCfg infmqtt.Config, cfg config.TelemetryConfig, sink coremet
 	return m, nil
 }
 
+// SetTelemetryCache configures a cache updated with every processed message.
+// It must be called before Start.
+func (m *Manager) SetTelemetryCache(c *dispatch.TelemetryCache) {
+	m.cache = c
+}
+
 // Start runs telemetry collection until context is done.
 func (m *Manager) Start(ctx context.Context) {
 	mode := strings.ToLower(m.cfg.Mode)
@@ -83,14 +93,12 @@ func (m *Manager) Start(ctx context.Context) {
 		mode = "push"
 	}
 	if mode == "push" || mode == "hybrid" {
-		topic := strings.TrimSuffix(m.cfg.StatePrefix, "/") + "/+"
-		if token := m.cli.Subscribe(topic, 0, m.onPush); token.Wait() && token.Error() != nil {
+		if token := m.cli.Subscribe(m.stateTopic().Filter(), 0, m.onPush); token.Wait() && token.Error() != nil {
 			m.log.Errorf("subscribe state: %v", token.Error())
 		}
 	}
 	if mode == "pull" || mode == "hybrid" {
-		topic := strings.TrimSuffix(m.cfg.ResponsePrefix, "/") + "/+"
-		if token := m.cli.Subscribe(topic, 0, m.onResponse); token.Wait() && token.Error() != nil {
+		if token := m.cli.Subscribe(m.responseTopic().Filter(), 0, m.onResponse); token.Wait() && token.Error() != nil {
 			m.log.Errorf("subscribe response: %v", token.Error())
 		}
 		go m.pollLoop(ctx)
@@ -108,7 +116,44 @@ func (m *Manager) onPush(_ paho.Client, msg paho.Message) {
 }
 
 func (m *Manager) onResponse(_ paho.Client, msg paho.Message) {
-	m.respCh <- telemetryMessage{VehicleID: extractID(msg.Topic()), Payload: msg.Payload(), Arrived: time.Now()}
+	m.respCh <- telemetryMessage{VehicleID: vehicleID(m.responseTopic(), msg.Topic()), Payload: msg.Payload(), Arrived: time.Now()}
+}
+
+// requestTopic returns the poll topic. The legacy request_topic setting takes
+// precedence over the topic templates.
+func (m *Manager) requestTopic() string {
+	if m.cfg.RequestTopic != "" {
+		return m.cfg.RequestTopic
+	}
+	return m.topics.TelemetryRequestTopic().Topic("")
+}
+
+// stateTopic returns the template of the state topics. The legacy
+// state_topic_prefix setting takes precedence over the topic templates.
+func (m *Manager) stateTopic() infmqtt.Template {
+	return prefixTemplate(m.cfg.StatePrefix, m.topics.StateTopic())
+}
+
+// responseTopic returns the template of the poll response topics. The legacy
+// response_topic_prefix setting takes precedence over the topic templates.
+func (m *Manager) responseTopic() infmqtt.Template {
+	return prefixTemplate(m.cfg.ResponsePrefix, m.topics.TelemetryResponseTopic())
+}
+
+func prefixTemplate(prefix string, def infmqtt.Template) infmqtt.Template {
+	if prefix == "" {
+		return def
+	}
+	return infmqtt.Template(strings.TrimSuffix(prefix, "/") + "/" + infmqtt.VehiclePlaceholder)
+}
+
+// vehicleID returns the vehicle named by a topic of the template, falling back
+// to the last topic level.
+func vehicleID(tmpl infmqtt.Template, topic string) string {
+	if id := tmpl.Vehicle(topic); id != "" {
+		return id
+	}
+	return extractID(topic)
 }
 
 func extractID(topic string) string {
@@ -148,7 +193,7 @@ func (m *Manager) doPoll(ctx context.Context) {
 		expected = map[string]struct{}{}
 	}
 	m.pollReq.Inc()
-	token := m.cli.Publish(m.cfg.RequestTopic, 0, false, []byte("poll"))
+	token := m.cli.Publish(m.requestTopic(), 0, false, []byte("poll"))
 	token.Wait()
 	timeout := time.NewTimer(time.Duration(m.cfg.Timeout()) * time.Second)
 	for {
@@ -186,7 +231,7 @@ func (m *Manager) process(payload []byte, topic, context string) error {
 		return err
 	}
 	if msg.VehicleID == "" {
-		msg.VehicleID = extractID(topic)
+		msg.VehicleID = vehicleID(m.stateTopic(), topic)
 	}
 	ts := time.Now()
 	if msg.TS != nil {
@@ -204,6 +249,15 @@ func (m *Manager) process(payload []byte, topic, context string) error {
 	if msg.Charging != nil {
 		v.Charging = *msg.Charging
 	}
+	if m.cache != nil {
+		m.cache.Update(dispatch.TelemetrySample{
+			VehicleID: v.ID,
+			PowerKW:   msg.PowerKW,
+			SoC:       v.SoC,
+			Available: msg.Available == nil || *msg.Available,
+			Time:      ts,
+		})
+	}
 	if m.sink != nil {
 		_ = m.sink.RecordVehicleState(coremetrics.VehicleStateEvent{Vehicle: v, Context: context, Component: "telemetry", Time: ts})
 	}
@@ -10,6 +10,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	"github.com/kilianp07/v2g/config"
+	"github.com/kilianp07/v2g/core/dispatch"
 	coremetrics "github.com/kilianp07/v2g/core/metrics"
 	"github.com/kilianp07/v2g/core/model"
 )
@@ -56,6 +57,22 @@ func TestProcessFromTopic(t *testing.T) {
 	}
 }
 
+func TestProcessUpdatesCache(t *testing.T) {
+	cache := dispatch.NewTelemetryCache()
+	mgr := &Manager{cache: cache}
+	payload := []byte(`{"vehicle_id":"veh1","soc":0.4,"available":false,"power_kw":2.5,"ts":1700000000}`)
+	if err := mgr.process(payload, "", "push"); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	s, ok := cache.Latest("veh1")
+	if !ok {
+		t.Fatalf("sample not cached")
+	}
+	if s.PowerKW != 2.5 || s.SoC != 0.4 || s.Available || s.Time.Unix() != 1700000000 {
+		t.Fatalf("unexpected sample: %+v", s)
+	}
+}
+
 func TestExtractID(t *testing.T) {
 	id := extractID("v2g/telemetry/response/veh42")
 	if id != "veh42" {
@@ -2,8 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"log"
 	"math/rand"
 	"time"
@@ -15,8 +13,9 @@ var rng = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 // AckStrategy defines how a vehicle acknowledges commands.
 type AckStrategy interface {
-	// Ack publishes an acknowledgment. It returns true if the ACK was sent.
-	Ack(ctx context.Context, cli paho.Client, vehicleID, commandID string) bool
+	// Ack publishes the acknowledgment payload of a command on topic. It
+	// returns true if the ACK was sent.
+	Ack(ctx context.Context, cli paho.Client, topic, vehicleID, commandID string, payload []byte) bool
 }
 
 // AutoAck sends an ACK after an optional fixed delay.
@@ -25,7 +24,7 @@ type AutoAck struct {
 }
 
 // Ack implements AckStrategy.
-func (a AutoAck) Ack(ctx context.Context, cli paho.Client, vehicleID, commandID string) bool {
+func (a AutoAck) Ack(ctx context.Context, cli paho.Client, topic, vehicleID, commandID string, payload []byte) bool {
 	if a.Delay > 0 {
 		select {
 		case <-time.After(a.Delay):
@@ -33,7 +32,7 @@ func (a AutoAck) Ack(ctx context.Context, cli paho.Client, vehicleID, commandID
 			return false
 		}
 	}
-	return publishAck(cli, vehicleID, commandID)
+	return publishAck(cli, topic, vehicleID, commandID, payload)
 }
 
 // RandomAck drops acknowledgments with the configured probability and
@@ -44,7 +43,7 @@ type RandomAck struct {
 }
 
 // Ack implements AckStrategy.
-func (r RandomAck) Ack(ctx context.Context, cli paho.Client, vehicleID, commandID string) bool {
+func (r RandomAck) Ack(ctx context.Context, cli paho.Client, topic, vehicleID, commandID string, payload []byte) bool {
 	if r.DropRate > 0 && rng.Float64() < r.DropRate {
 		return false
 	}
@@ -55,18 +54,28 @@ func (r RandomAck) Ack(ctx context.Context, cli paho.Client, vehicleID, commandI
 			return false
 		}
 	}
-	return publishAck(cli, vehicleID, commandID)
+	return publishAck(cli, topic, vehicleID, commandID, payload)
 }
 
-func publishAck(cli paho.Client, vehicleID, commandID string) bool {
-	payload, err := json.Marshal(struct {
-		CommandID string `json:"command_id"`
-	}{CommandID: commandID})
-	if err != nil {
-		log.Printf("marshal ack: %v", err)
-		return false
+// responder is implemented by clients able to answer a command on the
+// response topic it carried, such as MQTT v5 clients.
+type responder interface {
+	respond(commandID string, payload []byte) (bool, error)
+}
+
+func publishAck(cli paho.Client, topic, vehicleID, commandID string, payload []byte) bool {
+	if r, ok := cli.(responder); ok {
+		sent, err := r.respond(commandID, payload)
+		if err != nil {
+			log.Printf("publish ack error for %s: %v", vehicleID, err)
+			return false
+		}
+		if sent {
+			log.Printf("%s: published ack %s on response topic", vehicleID, commandID)
+			return true
+		}
 	}
-	token := cli.Publish(fmt.Sprintf("vehicle/%s/ack", vehicleID), 0, false, payload)
+	token := cli.Publish(topic, 0, false, payload)
 	if !token.WaitTimeout(5 * time.Second) {
 		log.Printf("ack publish timeout for %s", vehicleID)
 		return false
@@ -8,6 +8,7 @@ import (
 // Config holds parameters for the simulator.
 type Config struct {
 	Broker          string
+	MQTTVersion     string
 	Count           int
 	FleetSize       int
 	AckLatency      time.Duration
@@ -24,6 +25,8 @@ type Config struct {
 	TelemetryRequestTopic   string
 	TelemetryResponsePrefix string
 	StateTopicPrefix        string
+	FrequencyTopic          string
+	Keystore                string
 
 	CommuterPct      float64
 	AvailabilityFile string
@@ -33,7 +36,10 @@ type Config struct {
 	BatteryProfile string
 	Verbose        bool
 
-	TopicPrefix string
+	TopicPrefix    string
+	Tenant         string
+	Site           string
+	TopicNamespace string
 
 	InfluxURL    string
 	InfluxToken  string
@@ -46,6 +52,12 @@ func (c *Config) Validate() error {
 	if c.Broker == "" {
 		return fmt.Errorf("broker is required")
 	}
+	if c.MQTTVersion == "" {
+		c.MQTTVersion = "3.1.1"
+	}
+	if c.MQTTVersion != "3.1.1" && c.MQTTVersion != "5" {
+		return fmt.Errorf("mqtt-version must be 3.1.1 or 5")
+	}
 	if c.FleetSize == 0 {
 		c.FleetSize = c.Count
 	}
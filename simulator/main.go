@@ -15,6 +15,7 @@ import (
 
 	coremetrics "github.com/kilianp07/v2g/core/metrics"
 	"github.com/kilianp07/v2g/infra/metrics"
+	"github.com/kilianp07/v2g/infra/mqtt"
 )
 
 func main() {
@@ -28,6 +29,9 @@ func main() {
 	}
 
 	applyBatteryProfile(&cfg)
+	if cfg.MQTTVersion == "5" {
+		mqttClientFactory = realMQTTv5Client
+	}
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
@@ -78,13 +82,22 @@ func main() {
 		Availability:   prof,
 		Schedule:       schedule,
 	}
+	var auth *mqtt.Authenticator
+	if cfg.Keystore != "" {
+		ks, err := mqtt.LoadKeystore(cfg.Keystore)
+		if err != nil {
+			log.Fatalf("keystore: %v", err)
+		}
+		auth = mqtt.NewAuthenticator(ks, 0)
+	}
 	vehicles := GenerateFleet(fleetCfg, tmpl)
-	runVehicles(ctx, vehicles, cfg, strat, sink)
+	runVehicles(ctx, vehicles, cfg, strat, sink, auth)
 }
 
 func parseFlags() Config {
 	var cfg Config
 	flag.StringVar(&cfg.Broker, "broker", "tcp://localhost:1883", "MQTT broker URL")
+	flag.StringVar(&cfg.MQTTVersion, "mqtt-version", "3.1.1", "MQTT protocol version (3.1.1 or 5)")
 	flag.IntVar(&cfg.Count, "count", 1, "number of vehicles")
 	flag.IntVar(&cfg.FleetSize, "fleet-size", 0, "auto generated fleet size")
 	flag.DurationVar(&cfg.AckLatency, "ack-latency", 0, "ack latency")
@@ -101,12 +114,17 @@ func parseFlags() Config {
 	flag.StringVar(&cfg.TemplateFile, "template-file", "", "vehicle template overrides")
 	flag.StringVar(&cfg.BatteryProfile, "battery-profile", "", "predefined battery profile (small,medium,large)")
 	flag.BoolVar(&cfg.Verbose, "verbose", false, "enable verbose logging")
-	flag.StringVar(&cfg.TopicPrefix, "topic-prefix", "v2g", "MQTT topic prefix")
+	flag.StringVar(&cfg.TopicPrefix, "topic-prefix", "", "discovery topic prefix overriding the topic templates")
+	flag.StringVar(&cfg.Tenant, "tenant", "", "tenant substituted in topic templates")
+	flag.StringVar(&cfg.Site, "site", "", "site substituted in topic templates")
+	flag.StringVar(&cfg.TopicNamespace, "topic-namespace", "", "namespace prepended to every topic, e.g. {tenant}/{site}")
 	flag.BoolVar(&cfg.TelemetryPush, "telemetry-push", false, "enable telemetry push")
 	flag.DurationVar(&cfg.TelemetryInterval, "telemetry-interval", 10*time.Second, "telemetry interval")
-	flag.StringVar(&cfg.TelemetryRequestTopic, "telemetry-request-topic", "v2g/telemetry/request", "telemetry request topic")
-	flag.StringVar(&cfg.TelemetryResponsePrefix, "telemetry-response-prefix", "v2g/telemetry/response/", "telemetry response topic prefix")
-	flag.StringVar(&cfg.StateTopicPrefix, "state-topic-prefix", "v2g/vehicle/state/", "telemetry state topic prefix")
+	flag.StringVar(&cfg.TelemetryRequestTopic, "telemetry-request-topic", "", "telemetry request topic overriding the topic templates")
+	flag.StringVar(&cfg.TelemetryResponsePrefix, "telemetry-response-prefix", "", "telemetry response topic prefix")
+	flag.StringVar(&cfg.StateTopicPrefix, "state-topic-prefix", "", "telemetry state topic prefix overriding the topic templates")
+	flag.StringVar(&cfg.FrequencyTopic, "frequency-topic", "", "grid frequency topic followed in droop mode")
+	flag.StringVar(&cfg.Keystore, "keystore", "", "keystore verifying orders and signing acks")
 	flag.StringVar(&cfg.InfluxURL, "influx-url", "", "InfluxDB URL")
 	flag.StringVar(&cfg.InfluxToken, "influx-token", "", "InfluxDB token")
 	flag.StringVar(&cfg.InfluxOrg, "influx-org", "", "InfluxDB organization")
@@ -176,7 +194,7 @@ func applyBatteryProfile(cfg *Config) {
 	}
 }
 
-func runVehicles(ctx context.Context, vehicles []SimulatedVehicle, cfg Config, strat AckStrategy, sink coremetrics.MetricsSink) {
+func runVehicles(ctx context.Context, vehicles []SimulatedVehicle, cfg Config, strat AckStrategy, sink coremetrics.MetricsSink, auth *mqtt.Authenticator) {
 	var wg sync.WaitGroup
 	for i := range vehicles {
 		b := &Battery{
@@ -188,6 +206,7 @@ func runVehicles(ctx context.Context, vehicles []SimulatedVehicle, cfg Config, s
 		v := &vehicles[i]
 		v.Broker = cfg.Broker
 		v.TopicPrefix = cfg.TopicPrefix
+		v.Topics = mqtt.Topics{Tenant: cfg.Tenant, Site: cfg.Site, Namespace: cfg.TopicNamespace}
 		v.Strategy = strat
 		v.Interval = cfg.TelemetryInterval
 		v.MaxPower = cfg.MaxPower
@@ -197,6 +216,8 @@ func runVehicles(ctx context.Context, vehicles []SimulatedVehicle, cfg Config, s
 		v.TelemetryRequestTopic = cfg.TelemetryRequestTopic
 		v.TelemetryResponsePrefix = cfg.TelemetryResponsePrefix
 		v.StateTopicPrefix = cfg.StateTopicPrefix
+		v.FrequencyTopic = cfg.FrequencyTopic
+		v.Auth = auth
 		wg.Add(1)
 		go func(v *SimulatedVehicle) {
 			defer wg.Done()
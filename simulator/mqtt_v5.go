@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	paho5 "github.com/eclipse/paho.golang/paho"
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// realMQTTv5Client connects with MQTT v5 and adapts the connection to the
+// paho.Client interface used by the vehicles.
+func realMQTTv5Client(broker, clientID string) (paho.Client, error) {
+	if broker == "" || clientID == "" {
+		return nil, fmt.Errorf("broker and clientID must be provided")
+	}
+	u, err := url.Parse(broker)
+	if err != nil {
+		return nil, err
+	}
+	c := &v5Client{
+		subs:      make(map[string]v5Subscription),
+		responses: make(map[string]v5Response),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cm, err := autopaho.NewConnection(ctx, autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{u},
+		KeepAlive:                     30,
+		CleanStartOnInitialConnection: true,
+		ConnectTimeout:                10 * time.Second,
+		OnConnectionUp:                func(cm *autopaho.ConnectionManager, _ *paho5.Connack) { c.resubscribe(cm) },
+		ClientConfig: paho5.ClientConfig{
+			ClientID:          clientID,
+			OnPublishReceived: []func(paho5.PublishReceived) (bool, error){c.onPublish},
+		},
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	waitCtx, waitCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer waitCancel()
+	if err := cm.AwaitConnection(waitCtx); err != nil {
+		cancel()
+		return nil, err
+	}
+	c.cm, c.cancel = cm, cancel
+	return c, nil
+}
+
+type v5Subscription struct {
+	qos     byte
+	handler paho.MessageHandler
+}
+
+// v5Response is where the dispatcher asked a command to be acknowledged.
+type v5Response struct {
+	topic       string
+	correlation []byte
+}
+
+// v5Client implements paho.Client on top of an MQTT v5 connection. It
+// remembers the response topic and correlation data of each command so that
+// acknowledgments reach the dispatcher the way it asked for them.
+type v5Client struct {
+	cm     *autopaho.ConnectionManager
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	subs      map[string]v5Subscription
+	responses map[string]v5Response
+}
+
+func (c *v5Client) onPublish(pr paho5.PublishReceived) (bool, error) {
+	p := pr.Packet
+	if p.Properties != nil && p.Properties.ResponseTopic != "" {
+		// Signed commands carry the command in their payload field.
+		var m struct {
+			CommandID string `json:"command_id"`
+			Payload   struct {
+				CommandID string `json:"command_id"`
+			} `json:"payload"`
+		}
+		if json.Unmarshal(p.Payload, &m) == nil {
+			id := m.CommandID
+			if id == "" {
+				id = m.Payload.CommandID
+			}
+			if id != "" {
+				c.mu.Lock()
+				c.responses[id] = v5Response{topic: p.Properties.ResponseTopic, correlation: p.Properties.CorrelationData}
+				c.mu.Unlock()
+			}
+		}
+	}
+	c.mu.Lock()
+	var handlers []paho.MessageHandler
+	for filter, s := range c.subs {
+		if topicMatches(filter, p.Topic) {
+			handlers = append(handlers, s.handler)
+		}
+	}
+	c.mu.Unlock()
+	msg := &v5Message{p: p}
+	for _, h := range handlers {
+		h(c, msg)
+	}
+	return len(handlers) > 0, nil
+}
+
+// respond publishes the acknowledgment of a command on the response topic of
+// the command. It reports false when the command did not ask for one.
+func (c *v5Client) respond(commandID string, payload []byte) (bool, error) {
+	c.mu.Lock()
+	r, ok := c.responses[commandID]
+	delete(c.responses, commandID)
+	c.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.cm.Publish(ctx, &paho5.Publish{
+		Topic:      r.topic,
+		Payload:    payload,
+		Properties: &paho5.PublishProperties{CorrelationData: r.correlation},
+	})
+	return true, err
+}
+
+func (c *v5Client) resubscribe(cm *autopaho.ConnectionManager) {
+	c.mu.Lock()
+	var opts []paho5.SubscribeOptions
+	for filter, s := range c.subs {
+		opts = append(opts, paho5.SubscribeOptions{Topic: filter, QoS: s.qos})
+	}
+	c.mu.Unlock()
+	if len(opts) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, _ = cm.Subscribe(ctx, &paho5.Subscribe{Subscriptions: opts})
+}
+
+func (c *v5Client) IsConnected() bool      { return c.cm != nil }
+func (c *v5Client) IsConnectionOpen() bool { return c.cm != nil }
+func (c *v5Client) Connect() paho.Token    { return doneToken(nil) }
+
+func (c *v5Client) Disconnect(quiesce uint) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(quiesce)*time.Millisecond)
+	defer cancel()
+	_ = c.cm.Disconnect(ctx)
+	c.cancel()
+}
+
+func (c *v5Client) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	var b []byte
+	switch p := payload.(type) {
+	case []byte:
+		b = p
+	case string:
+		b = []byte(p)
+	default:
+		return doneToken(fmt.Errorf("unsupported payload type %T", payload))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := c.cm.Publish(ctx, &paho5.Publish{Topic: topic, QoS: qos, Retain: retained, Payload: b})
+	return doneToken(err)
+}
+
+func (c *v5Client) Subscribe(topic string, qos byte, callback paho.MessageHandler) paho.Token {
+	return c.SubscribeMultiple(map[string]byte{topic: qos}, callback)
+}
+
+func (c *v5Client) SubscribeMultiple(filters map[string]byte, callback paho.MessageHandler) paho.Token {
+	var opts []paho5.SubscribeOptions
+	c.mu.Lock()
+	for filter, qos := range filters {
+		c.subs[filter] = v5Subscription{qos: qos, handler: callback}
+		opts = append(opts, paho5.SubscribeOptions{Topic: filter, QoS: qos})
+	}
+	c.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := c.cm.Subscribe(ctx, &paho5.Subscribe{Subscriptions: opts})
+	return doneToken(err)
+}
+
+func (c *v5Client) Unsubscribe(topics ...string) paho.Token {
+	c.mu.Lock()
+	for _, t := range topics {
+		delete(c.subs, t)
+	}
+	c.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := c.cm.Unsubscribe(ctx, &paho5.Unsubscribe{Topics: topics})
+	return doneToken(err)
+}
+
+func (c *v5Client) AddRoute(topic string, callback paho.MessageHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.subs[topic]
+	s.handler = callback
+	c.subs[topic] = s
+}
+
+func (c *v5Client) OptionsReader() paho.ClientOptionsReader { return paho.ClientOptionsReader{} }
+
+// topicMatches reports whether topic matches the MQTT topic filter.
+func topicMatches(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, part := range f {
+		if part == "#" {
+			return true
+		}
+		if i >= len(t) || (part != "+" && part != t[i]) {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
+
+// v5Message adapts a v5 publish to paho.Message.
+type v5Message struct {
+	p *paho5.Publish
+}
+
+func (m *v5Message) Duplicate() bool   { return false }
+func (m *v5Message) Qos() byte         { return m.p.QoS }
+func (m *v5Message) Retained() bool    { return m.p.Retain }
+func (m *v5Message) Topic() string     { return m.p.Topic }
+func (m *v5Message) MessageID() uint16 { return m.p.PacketID }
+func (m *v5Message) Payload() []byte   { return m.p.Payload }
+func (m *v5Message) Ack()              {}
+
+// completedToken is a paho.Token for an operation that already completed.
+type completedToken struct {
+	err  error
+	done chan struct{}
+}
+
+func doneToken(err error) paho.Token {
+	t := &completedToken{err: err, done: make(chan struct{})}
+	close(t.done)
+	return t
+}
+
+func (t *completedToken) Wait() bool                     { return true }
+func (t *completedToken) WaitTimeout(time.Duration) bool { return true }
+func (t *completedToken) Done() <-chan struct{}          { return t.done }
+func (t *completedToken) Error() error                   { return t.err }
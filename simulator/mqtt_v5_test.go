@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestTopicMatches(t *testing.T) {
+	cases := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"vehicle/v1/command", "vehicle/v1/command", true},
+		{"vehicle/+/command", "vehicle/v2/command", true},
+		{"vehicle/#", "vehicle/v2/command", true},
+		{"vehicle/+", "vehicle/v2/command", false},
+		{"vehicle/v1/command", "vehicle/v2/command", false},
+	}
+	for _, c := range cases {
+		if got := topicMatches(c.filter, c.topic); got != c.want {
+			t.Fatalf("topicMatches(%q, %q) = %v", c.filter, c.topic, got)
+		}
+	}
+}
+
+type respondingClient struct {
+	stubClient
+	responded []string
+}
+
+func (c *respondingClient) respond(commandID string, _ []byte) (bool, error) {
+	c.responded = append(c.responded, commandID)
+	return commandID == "cmd1", nil
+}
+
+func TestPublishAckUsesResponseTopic(t *testing.T) {
+	cli := &respondingClient{}
+	if !publishAck(cli, "vehicle/v1/ack", "v1", "cmd1", []byte(`{"command_id":"cmd1"}`)) {
+		t.Fatalf("expected ack to be sent")
+	}
+	if len(cli.pubs) != 0 {
+		t.Fatalf("expected no publish on the shared ack topic, got %v", cli.pubs)
+	}
+	if !publishAck(cli, "vehicle/v1/ack", "v1", "cmd2", []byte(`{"command_id":"cmd2"}`)) || len(cli.pubs) != 1 || cli.pubs[0] != "vehicle/v1/ack" {
+		t.Fatalf("expected fallback to the shared ack topic, got %v", cli.pubs)
+	}
+}
@@ -13,13 +13,23 @@ import (
 
 	"github.com/kilianp07/v2g/core/metrics"
 	"github.com/kilianp07/v2g/core/model"
+	coremqtt "github.com/kilianp07/v2g/core/mqtt"
+	"github.com/kilianp07/v2g/infra/mqtt"
 )
 
 // command represents a dispatch instruction awaiting acknowledgment.
 type command struct {
-	id       string
-	power    float64
-	received time.Time
+	ack       coremqtt.Ack
+	requested float64
+	applied   float64
+	received  time.Time
+}
+
+// orderOutcome is how a vehicle handled a power order.
+type orderOutcome struct {
+	status  coremqtt.AckStatus
+	applied float64
+	reason  string
 }
 
 // SimulatedVehicle connects to MQTT and acknowledges commands.
@@ -34,10 +44,21 @@ type SimulatedVehicle struct {
 	Interval    time.Duration
 	Metrics     metrics.MetricsSink
 
+	// Topics configures the topic templates shared with the dispatcher.
+	// TopicPrefix, TelemetryRequestTopic and StateTopicPrefix, when set,
+	// override the discovery, telemetry request and state templates.
+	Topics mqtt.Topics
+
 	TelemetryPush           bool
 	TelemetryRequestTopic   string
 	TelemetryResponsePrefix string
 	StateTopicPrefix        string
+	// FrequencyTopic carries grid frequency measurements followed by
+	// vehicles configured in droop mode.
+	FrequencyTopic string
+	// Auth, when set, makes the vehicle drop commands not signed for it and
+	// sign its acknowledgments.
+	Auth *mqtt.Authenticator
 
 	// Segment defines the behavioural cluster for this vehicle.
 	Segment string
@@ -50,6 +71,12 @@ type SimulatedVehicle struct {
 
 	mu           sync.Mutex
 	currentPower float64
+	// validUntil is the expiry of the current setpoint. The vehicle goes
+	// back to idle once it has passed.
+	validUntil time.Time
+	// droop, when set, makes the vehicle follow gridHz locally.
+	droop  *model.DroopParams
+	gridHz float64
 
 	client paho.Client
 	ackCh  chan command
@@ -96,28 +123,32 @@ func (v *SimulatedVehicle) Run(ctx context.Context) error {
 		defer wg.Done()
 		v.availabilityLoop(ctx)
 	}()
-	broadcast := strings.TrimSuffix(v.TopicPrefix, "/") + "/fleet/discovery"
-	if token := cli.Subscribe(broadcast, 0, v.onDiscovery()); token.Wait() && token.Error() != nil {
+	if token := cli.Subscribe(v.discoveryTopic(), 0, v.onDiscovery()); token.Wait() && token.Error() != nil {
 		cli.Disconnect(250)
 		return token.Error()
 	}
 
-	topic := fmt.Sprintf("vehicle/%s/command", v.ID)
-	if token := cli.Subscribe(topic, 0, v.onCommand(ctx)); token.Wait() && token.Error() != nil {
+	if token := cli.Subscribe(v.Topics.CommandTopic().Topic(v.ID), 0, v.onCommand(ctx)); token.Wait() && token.Error() != nil {
 		cli.Disconnect(250)
 		return token.Error()
 	}
 
-	if v.TelemetryRequestTopic != "" {
-		if t := cli.Subscribe(v.TelemetryRequestTopic, 0, v.onTelemetryRequest()); t.Wait() && t.Error() != nil {
-			cli.Disconnect(250)
-			return t.Error()
-		}
-		if t := cli.Subscribe(strings.TrimSuffix(v.TelemetryRequestTopic, "/")+"/"+v.ID, 0, v.onTelemetryRequest()); t.Wait() && t.Error() != nil {
+	if v.FrequencyTopic != "" {
+		if t := cli.Subscribe(v.FrequencyTopic, 0, v.onFrequency()); t.Wait() && t.Error() != nil {
 			cli.Disconnect(250)
 			return t.Error()
 		}
 	}
+
+	request := v.telemetryRequestTopic()
+	if t := cli.Subscribe(request, 0, v.onTelemetryRequest()); t.Wait() && t.Error() != nil {
+		cli.Disconnect(250)
+		return t.Error()
+	}
+	if t := cli.Subscribe(strings.TrimSuffix(request, "/")+"/"+v.ID, 0, v.onTelemetryRequest()); t.Wait() && t.Error() != nil {
+		cli.Disconnect(250)
+		return t.Error()
+	}
 	<-ctx.Done()
 	close(v.ackCh)
 	wg.Wait()
@@ -127,27 +158,71 @@ func (v *SimulatedVehicle) Run(ctx context.Context) error {
 
 func (v *SimulatedVehicle) onCommand(ctx context.Context) func(paho.Client, paho.Message) {
 	return func(_ paho.Client, msg paho.Message) {
+		payload, err := v.openCommand(msg.Payload())
+		if err != nil {
+			log.Printf("%s: dropping command: %v", v.ID, err)
+			return
+		}
 		var m struct {
-			CommandID string  `json:"command_id"`
-			PowerKW   float64 `json:"power_kw"`
+			CommandID  string             `json:"command_id"`
+			VehicleID  string             `json:"vehicle_id"`
+			Type       string             `json:"type"`
+			PowerKW    float64            `json:"power_kw"`
+			ValidUntil int64              `json:"valid_until"`
+			Droop      *model.DroopParams `json:"droop"`
 		}
-		if err := json.Unmarshal(msg.Payload(), &m); err != nil {
+		if err := json.Unmarshal(payload, &m); err != nil {
 			log.Printf("%s: decode command: %v", v.ID, err)
 			return
 		}
+		if v.Auth != nil && m.VehicleID != v.ID {
+			log.Printf("%s: dropping command %s signed for %s", v.ID, m.CommandID, m.VehicleID)
+			return
+		}
 		now := time.Now()
-		allowed := v.applyPowerOrder(m.PowerKW)
+		var until time.Time
+		if m.ValidUntil > 0 {
+			until = time.UnixMilli(m.ValidUntil)
+		}
+		ack := coremqtt.Ack{CommandID: m.CommandID, VehicleID: v.ID, Status: coremqtt.AckAccepted}
+		var applied float64
+		switch m.Type {
+		case "release":
+			v.release()
+			log.Printf("%s: released by %s", v.ID, m.CommandID)
+		case "droop":
+			if m.Droop == nil {
+				log.Printf("%s: droop command %s without parameters", v.ID, m.CommandID)
+				return
+			}
+			v.setDroop(*m.Droop, until)
+			log.Printf("%s: following frequency with %.1f kW capacity", v.ID, m.Droop.CapacityKW)
+		default:
+			out := v.applyOrder(m.PowerKW, until)
+			applied = out.applied
+			ack.Status, ack.Reason = out.status, out.reason
+			if out.status != coremqtt.AckRejected {
+				ack.AppliedKW = &applied
+			}
+			if out.status != coremqtt.AckAccepted {
+				log.Printf("%s: order %s %s (%s), applying %.1f of %.1f kW", v.ID, m.CommandID, out.status, out.reason, applied, m.PowerKW)
+			}
+		}
+		v.mu.Lock()
+		soc := v.Battery.Soc
+		v.mu.Unlock()
+		ack.SoC = &soc
 		if rec, ok := v.Metrics.(metrics.DispatchOrderRecorder); ok {
 			_ = rec.RecordDispatchOrder(metrics.DispatchOrderEvent{
 				OrderID:   m.CommandID,
 				VehicleID: v.ID,
 				Signal:    model.SignalFCR,
-				PowerKW:   allowed,
-				Accepted:  true,
+				PowerKW:   applied,
+				Accepted:  ack.Accepted(),
 				Time:      now,
 			})
 		}
-		cmd := command{id: m.CommandID, power: allowed, received: now}
+		cmd := command{ack: ack, requested: m.PowerKW, applied: applied, received: now}
 		select {
 		case v.ackCh <- cmd:
 		default:
@@ -156,9 +231,33 @@ func (v *SimulatedVehicle) onCommand(ctx context.Context) func(paho.Client, paho
 	}
 }
 
+// openCommand authenticates a command payload when the vehicle has keys.
+func (v *SimulatedVehicle) openCommand(payload []byte) ([]byte, error) {
+	if v.Auth == nil {
+		return payload, nil
+	}
+	payload, keyID, err := v.Auth.Open(payload)
+	if err != nil {
+		return nil, err
+	}
+	if !v.Auth.Authorized(keyID, v.ID) {
+		return nil, fmt.Errorf("command signed with key %q", keyID)
+	}
+	return payload, nil
+}
+
+// ackPayload encodes the acknowledgment, signed when the vehicle has keys.
+func (v *SimulatedVehicle) ackPayload(ack coremqtt.Ack) ([]byte, error) {
+	payload, err := json.Marshal(ack)
+	if err != nil || v.Auth == nil {
+		return payload, err
+	}
+	return v.Auth.Seal(v.ID, payload)
+}
+
 func (v *SimulatedVehicle) onDiscovery() func(paho.Client, paho.Message) {
 	return func(_ paho.Client, msg paho.Message) {
-		if string(msg.Payload()) != "hello" {
+		if string(msg.Payload()) != v.Topics.DiscoveryPing() {
 			return
 		}
 		payload, err := json.Marshal(model.Vehicle{
@@ -173,8 +272,7 @@ func (v *SimulatedVehicle) onDiscovery() func(paho.Client, paho.Message) {
 			log.Printf("%s: marshal discovery: %v", v.ID, err)
 			return
 		}
-		resp := strings.TrimSuffix(v.TopicPrefix, "/") + "/fleet/response/" + v.ID
-		token := v.client.Publish(resp, 0, false, payload)
+		token := v.client.Publish(v.discoveryResponseTopic(), 0, false, payload)
 		if !token.WaitTimeout(5 * time.Second) {
 			log.Printf("%s: discovery publish timeout", v.ID)
 			return
@@ -200,10 +298,15 @@ func (v *SimulatedVehicle) worker(ctx context.Context) {
 			if !ok {
 				return
 			}
-			sent := v.Strategy.Ack(ctx, v.client, v.ID, cmd.id)
+			payload, err := v.ackPayload(cmd.ack)
+			if err != nil {
+				log.Printf("%s: encode ack: %v", v.ID, err)
+				continue
+			}
+			sent := v.Strategy.Ack(ctx, v.client, v.Topics.AckTopic().Topic(v.ID), v.ID, cmd.ack.CommandID, payload)
 			if rec, ok := v.Metrics.(metrics.DispatchAckRecorder); ok {
 				_ = rec.RecordDispatchAck(metrics.DispatchAckEvent{
-					OrderID:      cmd.id,
+					OrderID:      cmd.ack.CommandID,
 					VehicleID:    v.ID,
 					Signal:       model.SignalFCR,
 					Acknowledged: sent,
@@ -214,13 +317,14 @@ func (v *SimulatedVehicle) worker(ctx context.Context) {
 			_ = v.Metrics.RecordDispatchResult([]metrics.DispatchResult{{
 				Signal: model.FlexibilitySignal{
 					Type:      model.SignalFCR,
-					PowerKW:   cmd.power,
+					PowerKW:   cmd.requested,
 					Timestamp: cmd.received,
 				},
 				StartTime:    cmd.received,
 				EndTime:      cmd.received.Add(time.Hour),
 				VehicleID:    v.ID,
-				PowerKW:      cmd.power,
+				PowerKW:      cmd.requested,
+				AppliedKW:    cmd.applied,
 				Acknowledged: sent,
 				DispatchTime: time.Now(),
 			}})
@@ -230,39 +334,118 @@ func (v *SimulatedVehicle) worker(ctx context.Context) {
 	}
 }
 
-func (v *SimulatedVehicle) applyPowerOrder(p float64) float64 {
+// applyOrder applies the setpoint and records its expiry. Orders that are
+// already expired are rejected.
+func (v *SimulatedVehicle) applyOrder(p float64, until time.Time) orderOutcome {
+	if !until.IsZero() && !time.Now().Before(until) {
+		log.Printf("%s: rejecting expired order", v.ID)
+		return orderOutcome{status: coremqtt.AckRejected, reason: coremqtt.AckReasonExpired}
+	}
+	out := v.applyPowerOrder(p)
+	if out.status != coremqtt.AckRejected {
+		v.mu.Lock()
+		v.validUntil = until
+		v.mu.Unlock()
+	}
+	return out
+}
+
+// release drops the current setpoint and returns the vehicle to idle.
+func (v *SimulatedVehicle) release() {
 	v.mu.Lock()
-	defer v.mu.Unlock()
-	if p > 0 {
-		if p > v.MaxPower {
-			log.Printf("%s: requested power %.1f exceeds max %.1f", v.ID, p, v.MaxPower)
-			return v.currentPower
-		}
-		if p > v.Battery.DischargeRateKW {
-			log.Printf("%s: discharge rate %.1f exceeds limit %.1f", v.ID, p, v.Battery.DischargeRateKW)
-			return v.currentPower
+	v.currentPower = 0
+	v.validUntil = time.Time{}
+	v.droop = nil
+	v.mu.Unlock()
+}
+
+// setDroop makes the vehicle follow the grid frequency until the deadline.
+func (v *SimulatedVehicle) setDroop(p model.DroopParams, until time.Time) {
+	v.mu.Lock()
+	v.droop = &p
+	v.validUntil = until
+	v.mu.Unlock()
+}
+
+func (v *SimulatedVehicle) onFrequency() func(paho.Client, paho.Message) {
+	return func(_ paho.Client, msg paho.Message) {
+		text := strings.TrimSpace(string(msg.Payload()))
+		var hz float64
+		if _, err := fmt.Sscanf(text, "%g", &hz); err != nil {
+			var m struct {
+				Hz float64 `json:"hz"`
+			}
+			if err := json.Unmarshal(msg.Payload(), &m); err != nil {
+				log.Printf("%s: decode frequency: %v", v.ID, err)
+				return
+			}
+			hz = m.Hz
 		}
+		v.mu.Lock()
+		v.gridHz = hz
+		v.mu.Unlock()
+	}
+}
+
+// followDroop applies the droop response to the last received frequency.
+func (v *SimulatedVehicle) followDroop() {
+	v.mu.Lock()
+	droop, hz := v.droop, v.gridHz
+	v.mu.Unlock()
+	if droop == nil || hz == 0 {
+		return
+	}
+	v.applyPowerOrder(droop.SetpointKW(hz))
+}
+
+// expireOrder drops the setpoint once its validity window has passed.
+func (v *SimulatedVehicle) expireOrder(now time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.validUntil.IsZero() || now.Before(v.validUntil) {
+		return
+	}
+	if v.currentPower != 0 {
+		log.Printf("%s: setpoint %.1f kW expired, returning to idle", v.ID, v.currentPower)
+	}
+	v.currentPower = 0
+	v.validUntil = time.Time{}
+	v.droop = nil
+}
+
+// applyPowerOrder applies the setpoint within the power limits of the
+// vehicle. A setpoint beyond a limit is clamped to it and partially accepted;
+// a setpoint the battery cannot follow at all is rejected and leaves the
+// current one in place.
+func (v *SimulatedVehicle) applyPowerOrder(p float64) orderOutcome {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	out := orderOutcome{status: coremqtt.AckAccepted, applied: p}
+	limit, reason := v.MaxPower, coremqtt.AckReasonMaxPower
+	switch {
+	case p > 0:
 		if v.Battery.Soc <= 0 {
-			log.Printf("%s: battery empty, cannot discharge", v.ID)
-			return v.currentPower
+			return orderOutcome{status: coremqtt.AckRejected, reason: coremqtt.AckReasonBatteryEmpty}
 		}
-	} else if p < 0 {
-		ap := -p
-		if ap > v.MaxPower {
-			log.Printf("%s: requested power %.1f exceeds max %.1f", v.ID, ap, v.MaxPower)
-			return v.currentPower
+		if v.Battery.DischargeRateKW < limit {
+			limit, reason = v.Battery.DischargeRateKW, coremqtt.AckReasonDischargeRate
 		}
-		if ap > v.Battery.ChargeRateKW {
-			log.Printf("%s: charge rate %.1f exceeds limit %.1f", v.ID, ap, v.Battery.ChargeRateKW)
-			return v.currentPower
+		if p > limit {
+			out = orderOutcome{status: coremqtt.AckPartial, applied: limit, reason: reason}
 		}
+	case p < 0:
 		if v.Battery.Soc >= 1 {
-			log.Printf("%s: battery full, cannot charge", v.ID)
-			return v.currentPower
+			return orderOutcome{status: coremqtt.AckRejected, reason: coremqtt.AckReasonBatteryFull}
+		}
+		if v.Battery.ChargeRateKW < limit {
+			limit, reason = v.Battery.ChargeRateKW, coremqtt.AckReasonChargeRate
+		}
+		if -p > limit {
+			out = orderOutcome{status: coremqtt.AckPartial, applied: -limit, reason: reason}
 		}
 	}
-	v.currentPower = p
-	return p
+	v.currentPower = out.applied
+	return out
 }
 
 func (v *SimulatedVehicle) batteryLoop(ctx context.Context) {
@@ -275,6 +458,8 @@ func (v *SimulatedVehicle) batteryLoop(ctx context.Context) {
 			now := time.Now()
 			dt := now.Sub(last)
 			last = now
+			v.expireOrder(now)
+			v.followDroop()
 			v.mu.Lock()
 			applied := v.Battery.ApplyPower(v.currentPower, dt)
 			v.currentPower = applied
@@ -361,16 +546,20 @@ func (v *SimulatedVehicle) handleAvailabilityTick(ctx context.Context) {
 	if err != nil {
 		return
 	}
-	broadcast := strings.TrimSuffix(v.TopicPrefix, "/") + "/fleet/discovery"
-	if t := newCli.Subscribe(broadcast, 0, v.onDiscovery()); t.Wait() && t.Error() != nil {
+	if t := newCli.Subscribe(v.discoveryTopic(), 0, v.onDiscovery()); t.Wait() && t.Error() != nil {
 		newCli.Disconnect(250)
 		return
 	}
-	cmdTopic := fmt.Sprintf("vehicle/%s/command", v.ID)
-	if t := newCli.Subscribe(cmdTopic, 0, v.onCommand(ctx)); t.Wait() && t.Error() != nil {
+	if t := newCli.Subscribe(v.Topics.CommandTopic().Topic(v.ID), 0, v.onCommand(ctx)); t.Wait() && t.Error() != nil {
 		newCli.Disconnect(250)
 		return
 	}
+	if v.FrequencyTopic != "" {
+		if t := newCli.Subscribe(v.FrequencyTopic, 0, v.onFrequency()); t.Wait() && t.Error() != nil {
+			newCli.Disconnect(250)
+			return
+		}
+	}
 	v.mu.Lock()
 	if v.client != nil {
 		v.client.Disconnect(250)
@@ -400,8 +589,7 @@ func (v *SimulatedVehicle) publishAvailability(avail bool) {
 		PowerKW   float64 `json:"power_kw"`
 		TS        int64   `json:"ts"`
 	}{v.ID, soc, avail, power > 0, power, now.Unix()})
-	topic := strings.TrimSuffix(v.StateTopicPrefix, "/") + "/" + v.ID
-	t := v.client.Publish(topic, 0, false, payload)
+	t := v.client.Publish(v.stateTopic(), 0, false, payload)
 	t.WaitTimeout(2 * time.Second)
 }
 
@@ -421,7 +609,38 @@ func (v *SimulatedVehicle) publishTelemetry(now time.Time) {
 		PowerKW   float64 `json:"power_kw"`
 		TS        int64   `json:"ts"`
 	}{v.ID, soc, true, power > 0, power, now.Unix()})
-	topic := strings.TrimSuffix(v.StateTopicPrefix, "/") + "/" + v.ID
-	t := v.client.Publish(topic, 0, false, payload)
+	t := v.client.Publish(v.stateTopic(), 0, false, payload)
 	t.WaitTimeout(5 * time.Second)
 }
+
+// discoveryTopic returns the topic discovery requests are broadcast on.
+func (v *SimulatedVehicle) discoveryTopic() string {
+	if v.TopicPrefix != "" {
+		return strings.TrimSuffix(v.TopicPrefix, "/") + "/fleet/discovery"
+	}
+	return v.Topics.DiscoveryRequestTopic().Topic(v.ID)
+}
+
+// discoveryResponseTopic returns the topic the vehicle answers discovery on.
+func (v *SimulatedVehicle) discoveryResponseTopic() string {
+	if v.TopicPrefix != "" {
+		return strings.TrimSuffix(v.TopicPrefix, "/") + "/fleet/response/" + v.ID
+	}
+	return v.Topics.DiscoveryResponseTopic().Topic(v.ID)
+}
+
+// telemetryRequestTopic returns the topic telemetry polls are broadcast on.
+func (v *SimulatedVehicle) telemetryRequestTopic() string {
+	if v.TelemetryRequestTopic != "" {
+		return v.TelemetryRequestTopic
+	}
+	return v.Topics.TelemetryRequestTopic().Topic(v.ID)
+}
+
+// stateTopic returns the topic the vehicle publishes its state on.
+func (v *SimulatedVehicle) stateTopic() string {
+	if v.StateTopicPrefix != "" {
+		return strings.TrimSuffix(v.StateTopicPrefix, "/") + "/" + v.ID
+	}
+	return v.Topics.StateTopic().Topic(v.ID)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	paho5 "github.com/eclipse/paho.golang/paho"
+
+	coremetrics "github.com/kilianp07/v2g/core/metrics"
+	coremqtt "github.com/kilianp07/v2g/core/mqtt"
+	"github.com/kilianp07/v2g/infra/mqtt"
+)
+
+func TestApplyOrderOutcomes(t *testing.T) {
+	bat := &Battery{CapacityKWh: 50, Soc: 0.5, ChargeRateKW: 7, DischargeRateKW: 11}
+	v := NewSimulatedVehicle("v1", "", "", AutoAck{}, bat, time.Second, 10, nil)
+	until := time.Now().Add(time.Minute)
+
+	cases := []struct {
+		power   float64
+		soc     float64
+		status  coremqtt.AckStatus
+		applied float64
+		reason  string
+	}{
+		{5, 0.5, coremqtt.AckAccepted, 5, ""},
+		{15, 0.5, coremqtt.AckPartial, 10, coremqtt.AckReasonMaxPower},
+		{-9, 0.5, coremqtt.AckPartial, -7, coremqtt.AckReasonChargeRate},
+		{5, 0, coremqtt.AckRejected, 0, coremqtt.AckReasonBatteryEmpty},
+		{-5, 1, coremqtt.AckRejected, 0, coremqtt.AckReasonBatteryFull},
+	}
+	for _, c := range cases {
+		bat.Soc = c.soc
+		out := v.applyOrder(c.power, until)
+		if out.status != c.status || out.applied != c.applied || out.reason != c.reason {
+			t.Fatalf("order %.1f kW at soc %.1f: got %+v", c.power, c.soc, out)
+		}
+	}
+	if v.currentPower != -7 {
+		t.Fatalf("rejected orders should keep the setpoint, got %.1f", v.currentPower)
+	}
+
+	out := v.applyOrder(5, time.Now().Add(-time.Second))
+	if out.status != coremqtt.AckRejected || out.reason != coremqtt.AckReasonExpired {
+		t.Fatalf("expected expired order to be rejected, got %+v", out)
+	}
+}
+
+func TestSignedCommandsAndAcks(t *testing.T) {
+	keys := &mqtt.Keystore{Vehicles: map[string]mqtt.Key{
+		"v1": {Algorithm: mqtt.AlgHMACSHA256, Secret: []byte("v1-secret")},
+		"v2": {Algorithm: mqtt.AlgHMACSHA256, Secret: []byte("v2-secret")},
+	}}
+	dispatcher := mqtt.NewAuthenticator(keys, 0)
+	bat := &Battery{CapacityKWh: 50, Soc: 0.5, ChargeRateKW: 7, DischargeRateKW: 11}
+	v := NewSimulatedVehicle("v1", "", "", AutoAck{}, bat, time.Second, 10, nil)
+	v.Metrics = coremetrics.NopSink{}
+	v.Auth = mqtt.NewAuthenticator(keys, 0)
+	onCommand := v.onCommand(context.Background())
+	send := func(signedFor, target, id string, signed bool) {
+		payload, _ := json.Marshal(map[string]any{"command_id": id, "vehicle_id": target, "type": "setpoint", "power_kw": 5})
+		if signed {
+			payload, _ = dispatcher.Seal(signedFor, payload)
+		}
+		onCommand(nil, &v5Message{p: &paho5.Publish{Payload: payload}})
+	}
+
+	send("", "v1", "unsigned", false)
+	send("v2", "v1", "other-key", true)
+	send("v2", "v2", "other-vehicle", true)
+	send("v1", "v1", "cmd1", true)
+	if len(v.ackCh) != 1 {
+		t.Fatalf("expected only the signed command to be applied, got %d", len(v.ackCh))
+	}
+	cmd := <-v.ackCh
+	payload, err := v.ackPayload(cmd.ack)
+	if err != nil {
+		t.Fatalf("ack payload: %v", err)
+	}
+	body, keyID, err := dispatcher.Open(payload)
+	if err != nil || keyID != "v1" {
+		t.Fatalf("expected ack signed by v1, got %q %v", keyID, err)
+	}
+	var ack coremqtt.Ack
+	if err := json.Unmarshal(body, &ack); err != nil || ack.CommandID != "cmd1" || ack.VehicleID != "v1" {
+		t.Fatalf("unexpected ack: %+v %v", ack, err)
+	}
+}
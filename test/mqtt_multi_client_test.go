@@ -52,7 +52,7 @@ func TestMultipleMQTTClients(t *testing.T) {
 		t.Fatalf("send order: %v", err)
 	}
 	ack, err := pub.WaitForAck(cmdID, time.Second)
-	if err != nil || !ack {
+	if err != nil || !ack.Accepted() {
 		t.Fatalf("ack failed: %v", err)
 	}
 }
@@ -98,7 +98,7 @@ func newPublisher(t *testing.T, broker string) *mqtt.PahoClient {
 func newDiscovery(t *testing.T, broker string) *mqtt.PahoFleetDiscovery {
 	t.Helper()
 	discCfg := mqtt.Config{Broker: broker, ClientID: "dispatcher"}
-	disc, err := mqtt.NewPahoFleetDiscovery(discCfg, "v2g/fleet/discovery", "v2g/fleet/response/+", "hello")
+	disc, err := mqtt.NewFleetDiscovery(discCfg)
 	if err != nil {
 		t.Fatalf("discovery: %v", err)
 	}
@@ -148,7 +148,7 @@ func cleanupSimulator(cancelSim context.CancelFunc, cmd *exec.Cmd, simOut *syncB
 
 func waitForSimulatorReady(ctx context.Context, broker string) error {
 	discCfg := mqtt.Config{Broker: broker, ClientID: "ready-check"}
-	disc, err := mqtt.NewPahoFleetDiscovery(discCfg, "v2g/fleet/discovery", "v2g/fleet/response/+", "hello")
+	disc, err := mqtt.NewFleetDiscovery(discCfg)
 	if err != nil {
 		return err
 	}
@@ -175,7 +175,7 @@ func waitForSimulatorReady(ctx context.Context, broker string) error {
 
 func discoverVehicles(ctx context.Context, broker string, t *testing.T) []model.Vehicle {
 	discCfg := mqtt.Config{Broker: broker, ClientID: "tester"}
-	disc, err := mqtt.NewPahoFleetDiscovery(discCfg, "v2g/fleet/discovery", "v2g/fleet/response/+", "hello")
+	disc, err := mqtt.NewFleetDiscovery(discCfg)
 	if err != nil {
 		t.Fatalf("discovery init: %v", err)
 	}